@@ -1,6 +1,8 @@
 package config
 
 import (
+	"flag"
+	"os"
 	"seekourney/utils"
 	"seekourney/utils/normalize"
 )
@@ -25,15 +27,50 @@ type Config struct {
 
 	// Normalizer is a function that normalizes words
 	Normalizer normalize.Normalizer
+
+	// SearchCacheSize is the number of searches whose results are cached,
+	// zero or less disables the cache.
+	SearchCacheSize int
+
+	// IndexerStartupSeconds is how long an indexer may take to get ready
+	// after it is started, see indexAPI.IndexHandler. Zero or less uses
+	// indexAPI.DEFAULTSTARTUPTIMEOUT.
+	IndexerStartupSeconds int
+
+	// IndexerCheckSeconds is how often running indexers are pinged, and
+	// crashed ones restarted, see indexAPI.IndexHandler.Supervise.
+	// Zero or less disables supervision.
+	IndexerCheckSeconds int
+
+	// IndexerLogDir is the directory where what indexers write to stdout and
+	// stderr is appended to files named after their ID, rotated at 1 MiB.
+	// If empty, only the last lines are kept in memory.
+	IndexerLogDir string
+
+	// Storage is the storage backend, "postgres" or "embedded".
+	Storage string
+
+	// StoragePath is the directory the embedded backend stores data in.
+	StoragePath string
+
+	// Database is used by the postgres backend, can be overridden by
+	// environment variables and flags, see ApplyEnv and ApplyFlags.
+	Database Database
 }
 
 // New creates a new config
 func New() *Config {
 
 	return &Config{
-		ParrallelIndexing:  true,
-		ParrallelSearching: true,
-		Normalizer:         normalize.STEMMING,
+		ParrallelIndexing:     true,
+		ParrallelSearching:    true,
+		Normalizer:            normalize.STEMMING,
+		SearchCacheSize:       256,
+		IndexerStartupSeconds: 30,
+		IndexerCheckSeconds:   10,
+		Storage:               "postgres",
+		StoragePath:           "../embedded-data",
+		Database:              DefaultDatabase(),
 	}
 }
 
@@ -46,12 +83,41 @@ func (c Config) ConfigName() string {
 	return "Global config"
 }
 
-// Load loads the config from a file, or creates a new one if it doesn't exist
+// Load loads the config from a file, or creates a new one if it doesn't exist.
+// Settings missing from the file keep their default values.
 func Load() *Config {
 
 	return utils.LoadOrElse(path, func() *Config {
 		return New()
 	}, func() *Config {
-		return &Config{}
+		return New()
 	})
 }
+
+// LoadWithOverrides loads the config, then applies the environment variables
+// and the flags in args, which take precedence over the file.
+// Args are parsed with flags, which may define flags of its own,
+// see ApplyFlagSet. Returns the arguments after the flags.
+func LoadWithOverrides(
+	flags *flag.FlagSet,
+	args []string,
+) (*Config, []string, error) {
+	conf := Load()
+
+	err := conf.ApplyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rest, err := conf.ApplyFlagSet(flags, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conf, rest, nil
+}
+
+// Save writes the config to the config file, overwriting the old one.
+func Save(conf *Config) error {
+	return utils.Save(conf, path)
+}
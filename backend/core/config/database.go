@@ -0,0 +1,201 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"seekourney/utils"
+	"strconv"
+	"strings"
+)
+
+// _MAXPORT_ is the highest valid TCP port.
+const _MAXPORT_ utils.Port = 65535
+
+// Environment variables overriding the database settings in the config file.
+const (
+	ENVDBEXTERNAL  string = "SEEKOURNEY_DB_EXTERNAL"
+	ENVDBHOST      string = "SEEKOURNEY_DB_HOST"
+	ENVDBPORT      string = "SEEKOURNEY_DB_PORT"
+	ENVDBUSER      string = "SEEKOURNEY_DB_USER"
+	ENVDBPASSWORD  string = "SEEKOURNEY_DB_PASSWORD"
+	ENVDBNAME      string = "SEEKOURNEY_DB_NAME"
+	ENVDBSSLMODE   string = "SEEKOURNEY_DB_SSLMODE"
+	ENVDBCONTAINER string = "SEEKOURNEY_DB_CONTAINER"
+)
+
+// Database holds the settings for connecting to the postgres database.
+type Database struct {
+	// External connects to an already running database, instead of starting
+	// one in a docker container and stopping it on exit.
+	External bool
+
+	Host     string
+	Port     utils.Port
+	User     string
+	Password string
+	Name     string
+
+	// SSLMode is passed to the driver as is, see the lib/pq documentation.
+	SSLMode string
+
+	// Container is the name of the docker container the database runs in,
+	// when it is not external.
+	Container string
+}
+
+// DefaultDatabase returns the settings for the database container started
+// by docker-start.
+func DefaultDatabase() Database {
+	return Database{
+		External:  false,
+		Host:      "localhost",
+		Port:      5433,
+		User:      "go-postgres",
+		Password:  "go-postgres",
+		Name:      "go-postgres",
+		SSLMode:   "disable",
+		Container: "go-postgres",
+	}
+}
+
+// ConnectionString returns the settings in the key=value format
+// used by the postgres driver.
+func (db Database) ConnectionString() string {
+	pairs := []string{
+		"host=" + quoteConnectionValue(db.Host),
+		"port=" + db.Port.String(),
+		"user=" + quoteConnectionValue(db.User),
+		"password=" + quoteConnectionValue(db.Password),
+		"dbname=" + quoteConnectionValue(db.Name),
+		"sslmode=" + quoteConnectionValue(db.SSLMode),
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+// String describes where the database is, without the password.
+func (db Database) String() string {
+	mode := "container " + db.Container
+	if db.External {
+		mode = "external"
+	}
+
+	return fmt.Sprintf(
+		"%s@%s:%d/%s (%s)",
+		db.User,
+		db.Host,
+		db.Port,
+		db.Name,
+		mode,
+	)
+}
+
+// Validate checks the settings that can be invalid once parsed,
+// such as a port out of range.
+func (db Database) Validate() error {
+	if db.Port == 0 || db.Port > _MAXPORT_ {
+		return fmt.Errorf("invalid database port %d", db.Port)
+	}
+
+	return nil
+}
+
+// quoteConnectionValue quotes value if needed, so it can contain spaces
+// and quotes in a connection string.
+func quoteConnectionValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " '\\") {
+		return value
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + escaped + "'"
+}
+
+// ApplyEnv overrides the database settings with the environment variables
+// that are set, see ENVDBHOST and the others, and validates the result.
+// lookup is usually os.LookupEnv.
+func (conf *Config) ApplyEnv(lookup func(key string) (string, bool)) error {
+	db := &conf.Database
+
+	fields := map[string]*string{
+		ENVDBHOST:      &db.Host,
+		ENVDBUSER:      &db.User,
+		ENVDBPASSWORD:  &db.Password,
+		ENVDBNAME:      &db.Name,
+		ENVDBSSLMODE:   &db.SSLMode,
+		ENVDBCONTAINER: &db.Container,
+	}
+	for key, field := range fields {
+		if value, ok := lookup(key); ok {
+			*field = value
+		}
+	}
+
+	if value, ok := lookup(ENVDBPORT); ok {
+		port, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", ENVDBPORT, value)
+		}
+		db.Port = utils.Port(port)
+	}
+
+	if value, ok := lookup(ENVDBEXTERNAL); ok {
+		external, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", ENVDBEXTERNAL, value)
+		}
+		db.External = external
+	}
+
+	return db.Validate()
+}
+
+// ApplyFlags overrides the database settings with the flags given in args,
+// such as -db-host, validates the result, and returns the arguments after
+// the flags. Usage and errors are written to output.
+func (conf *Config) ApplyFlags(
+	name string,
+	args []string,
+	output io.Writer,
+) ([]string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(output)
+
+	return conf.ApplyFlagSet(flags, args)
+}
+
+// ApplyFlagSet is like ApplyFlags, with the database flags added to flags,
+// which may define flags of its own.
+func (conf *Config) ApplyFlagSet(
+	flags *flag.FlagSet,
+	args []string,
+) ([]string, error) {
+	db := &conf.Database
+
+	// The current settings are the defaults,
+	// so only flags that are given override them.
+	flags.BoolVar(&db.External, "db-external", db.External,
+		"connect to a running database instead of starting a container")
+	flags.StringVar(&db.Host, "db-host", db.Host, "database host")
+	flags.UintVar((*uint)(&db.Port), "db-port", uint(db.Port), "database port")
+	flags.StringVar(&db.User, "db-user", db.User, "database user")
+	flags.StringVar(&db.Password, "db-password", db.Password,
+		"database password, prefer "+ENVDBPASSWORD)
+	flags.StringVar(&db.Name, "db-name", db.Name, "database name")
+	flags.StringVar(&db.SSLMode, "db-sslmode", db.SSLMode, "database sslmode")
+	flags.StringVar(&db.Container, "db-container", db.Container,
+		"name of the database container")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return flags.Args(), nil
+}
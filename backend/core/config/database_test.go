@@ -0,0 +1,132 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// env returns a lookup function for the given environment.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func TestConnectionString(t *testing.T) {
+	db := DefaultDatabase()
+	assert.Equal(t,
+		"host=localhost port=5433 user=go-postgres password=go-postgres "+
+			"dbname=go-postgres sslmode=disable",
+		db.ConnectionString(),
+	)
+
+	db.Password = `it's a \secret`
+	db.User = ""
+	assert.Contains(t, db.ConnectionString(), `password='it\'s a \\secret'`)
+	assert.Contains(t, db.ConnectionString(), `user='' `)
+}
+
+func TestStringHidesPassword(t *testing.T) {
+	db := DefaultDatabase()
+	db.Password = "hunter2"
+	assert.NotContains(t, db.String(), db.Password)
+	assert.Contains(t, db.String(), "container go-postgres")
+
+	db.External = true
+	assert.Contains(t, db.String(), "external")
+}
+
+func TestApplyEnv(t *testing.T) {
+	conf := New()
+	err := conf.ApplyEnv(env(map[string]string{
+		ENVDBHOST:     "db.example.com",
+		ENVDBPORT:     "6543",
+		ENVDBEXTERNAL: "true",
+		ENVDBPASSWORD: "",
+	}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "db.example.com", conf.Database.Host)
+	assert.Equal(t, 6543, int(conf.Database.Port))
+	assert.True(t, conf.Database.External)
+	assert.Equal(t, "", conf.Database.Password)
+	// Unset variables keep the current value.
+	assert.Equal(t, "go-postgres", conf.Database.User)
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	invalid := []map[string]string{
+		{ENVDBPORT: "port"},
+		{ENVDBPORT: "0"},
+		{ENVDBPORT: "70000"},
+		{ENVDBEXTERNAL: "maybe"},
+	}
+
+	for _, vars := range invalid {
+		conf := New()
+		assert.Error(t, conf.ApplyEnv(env(vars)), vars)
+	}
+}
+
+func TestApplyFlags(t *testing.T) {
+	conf := New()
+	conf.Database.Host = "from-file"
+	conf.Database.User = "from-file"
+
+	err := conf.ApplyEnv(env(map[string]string{
+		ENVDBHOST: "from-env",
+		ENVDBUSER: "from-env",
+	}))
+	assert.NoError(t, err)
+
+	rest, err := conf.ApplyFlags(
+		"test",
+		[]string{"-db-host", "from-flag", "-db-external", "up"},
+		io.Discard,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"up"}, rest)
+
+	// Flags take precedence over the environment, which takes precedence
+	// over the file.
+	assert.Equal(t, "from-flag", conf.Database.Host)
+	assert.Equal(t, "from-env", conf.Database.User)
+	assert.Equal(t, "go-postgres", conf.Database.Name)
+	assert.True(t, conf.Database.External)
+}
+
+func TestApplyFlagsInvalid(t *testing.T) {
+	invalid := [][]string{
+		{"-db-port", "70000"},
+		{"-db-port", "0"},
+		{"-db-port", "port"},
+		{"-unknown"},
+	}
+
+	for _, args := range invalid {
+		conf := New()
+		_, err := conf.ApplyFlags("test", args, io.Discard)
+		assert.Error(t, err, args)
+	}
+}
+
+func TestApplyFlagSet(t *testing.T) {
+	conf := New()
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	recursive := flags.Bool("recursive", false, "command flag")
+
+	rest, err := conf.ApplyFlagSet(
+		flags,
+		[]string{"-recursive", "-db-name", "from-flag", "/path"},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/path"}, rest)
+	assert.True(t, *recursive)
+	assert.Equal(t, "from-flag", conf.Database.Name)
+}
@@ -0,0 +1,106 @@
+/*
+Package dbtest runs tests against a throwaway postgres database in a docker
+container. Every package testing against postgres uses its own container
+name and port, since go test runs packages in parallel:
+
+	func TestStore(t *testing.T) {
+		settings := dbtest.Start(t, "go-postgres-test-store", 5434)
+		db := dbtest.Connect(t, settings)
+		...
+	}
+
+Tests are skipped if docker is not installed, or when run with -short.
+*/
+package dbtest
+
+import (
+	"database/sql"
+	"os/exec"
+	"seekourney/core/config"
+	"seekourney/utils"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq" // PostgreSQL driver
+)
+
+const (
+	// _READYTIMEOUT_ is how long to wait for a container to accept
+	// connections, pulling the image may take a while.
+	_READYTIMEOUT_ time.Duration = 2 * time.Minute
+	_RETRYDELAY_   time.Duration = 500 * time.Millisecond
+)
+
+// Start starts an empty database in a container called name, listening on
+// port, and returns its settings. It is stopped when the test ends.
+func Start(t *testing.T, name string, port utils.Port) config.Database {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not installed")
+	}
+
+	settings := config.DefaultDatabase()
+	settings.Port = port
+	settings.Container = name
+
+	// A container left by an interrupted run holds the name and port.
+	_ = exec.Command("docker", "rm", "--force", name).Run()
+
+	output, err := exec.Command(
+		"docker", "run", "--rm", "--detach",
+		"--name", name,
+		"-e", "POSTGRES_USER="+settings.User,
+		"-e", "POSTGRES_PASSWORD="+settings.Password,
+		"-e", "POSTGRES_DB="+settings.Name,
+		"-p", port.String()+":5432",
+		"postgres",
+	).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Error starting container %s: %s\n%s", name, err, output)
+	}
+
+	t.Cleanup(func() {
+		err := exec.Command("docker", "stop", name).Run()
+		if err != nil {
+			t.Errorf("Error stopping container %s: %s", name, err)
+		}
+	})
+
+	return settings
+}
+
+// Connect opens a connection to the database with settings, waiting until
+// it accepts connections. It is closed when the test ends, unless it is
+// closed before.
+func Connect(t *testing.T, settings config.Database) *sql.DB {
+	db, err := sql.Open("postgres", settings.ConnectionString())
+	if err != nil {
+		t.Fatalf("Error opening database connection: %s", err)
+	}
+	t.Cleanup(func() {
+		// Returns an error if already closed, which is fine.
+		_ = db.Close()
+	})
+
+	deadline := time.Now().Add(_READYTIMEOUT_)
+	for {
+		err = db.Ping()
+		if err == nil {
+			return db
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Database %s is not ready: %s", settings, err)
+		}
+		time.Sleep(_RETRYDELAY_)
+	}
+}
+
+// Reset removes every table and type from db, leaving an empty schema.
+func Reset(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`)
+	if err != nil {
+		t.Fatalf("Error resetting database: %s", err)
+	}
+}
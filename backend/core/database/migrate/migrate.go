@@ -0,0 +1,302 @@
+/*
+Package migrate keeps the database schema up to date.
+
+The schema is defined by numbered SQL files in the migrations directory,
+which are embedded in the binary. The version of the latest applied
+migration is recorded in the schema_migrations table, and pending
+migrations are applied in order, each in its own transaction.
+
+Migrations are never edited once released, a change to the schema is
+always a new file named <version>_<name>.sql, with the next version.
+*/
+package migrate
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"seekourney/core/database"
+	"sort"
+	"strconv"
+)
+
+const (
+	// _TABLE_ records the applied migrations.
+	_TABLE_ string = "schema_migrations"
+
+	// _BASELINEVERSION_ is the schema created by the old initdb.sql,
+	// which databases created before migrations existed already have.
+	_BASELINEVERSION_ int = 1
+)
+
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+// latestVersion selects the version of the latest applied migration.
+var latestVersion = database.Select("COALESCE(MAX(version), 0)").
+	From(_TABLE_).
+	Build()
+
+// fileName matches migration files, like 0002_word_count.sql.
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// Migration is a single change to the schema.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Status is the state of the schema of a database.
+type Status struct {
+	// Current is the version of the latest applied migration,
+	// 0 for an empty database.
+	Current int
+
+	// Latest is the version of the newest known migration.
+	Latest int
+
+	// Pending are the migrations not yet applied, in order.
+	Pending []Migration
+}
+
+// Migrations returns every known migration, in order.
+func Migrations() ([]Migration, error) {
+	return parseMigrations(embedded, "migrations")
+}
+
+// parseMigrations reads the migrations in dir, and checks that their
+// versions count up from 1 without gaps.
+func parseMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, errors.New("invalid migration name " + entry.Name())
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    match[2],
+			SQL:     string(content),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf(
+				"migration %d_%s should have version %d",
+				migration.Version,
+				migration.Name,
+				i+1,
+			)
+		}
+	}
+
+	return migrations, nil
+}
+
+// GetStatus returns the current version of the database,
+// and the migrations that Up would apply.
+func GetStatus(db *sql.DB) (Status, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return Status{}, err
+	}
+
+	err = ensureTable(db)
+	if err != nil {
+		return Status{}, err
+	}
+
+	current, err := currentVersion(db)
+	if err != nil {
+		return Status{}, err
+	}
+
+	return status(migrations, current)
+}
+
+// status compares the known migrations with the current version.
+func status(migrations []Migration, current int) (Status, error) {
+	if current > len(migrations) {
+		return Status{}, fmt.Errorf(
+			"database has version %d, newer than this server (%d)",
+			current,
+			len(migrations),
+		)
+	}
+
+	return Status{
+		Current: current,
+		Latest:  len(migrations),
+		Pending: migrations[current:],
+	}, nil
+}
+
+// Up applies all pending migrations, and returns the applied ones.
+// If a migration fails it is rolled back, and the earlier ones are kept.
+func Up(db *sql.DB) ([]Migration, error) {
+	current, err := GetStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]Migration, 0, len(current.Pending))
+	for _, migration := range current.Pending {
+		done, err := apply(db, migration)
+		if err != nil {
+			return applied, fmt.Errorf(
+				"migration %d_%s failed: %w",
+				migration.Version,
+				migration.Name,
+				err,
+			)
+		}
+		if done {
+			log.Printf(
+				"Applied migration %d_%s\n",
+				migration.Version,
+				migration.Name,
+			)
+			applied = append(applied, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+// apply runs a migration and records it in a single transaction.
+// Returns false if another server applied it first.
+func apply(db *sql.DB, migration Migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		// Does nothing if the transaction was committed.
+		_ = tx.Rollback()
+	}()
+
+	// Blocks servers starting at the same time until this one is done.
+	_, err = tx.Exec("LOCK TABLE " + _TABLE_ + " IN EXCLUSIVE MODE")
+	if err != nil {
+		return false, err
+	}
+
+	var current int
+	err = latestVersion.Row(tx).Scan(&current)
+	if err != nil {
+		return false, err
+	}
+	if current >= migration.Version {
+		return false, nil
+	}
+
+	_, err = tx.Exec(migration.SQL)
+	if err != nil {
+		return false, err
+	}
+
+	err = record(tx, migration.Version, migration.Name)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// currentVersion returns the version of the latest applied migration.
+func currentVersion(db *sql.DB) (int, error) {
+	var version int
+
+	err := latestVersion.Row(db).Scan(&version)
+
+	return version, err
+}
+
+// record marks a migration as applied.
+func record(tx *sql.Tx, version int, name string) error {
+	_, err := database.Insert(_TABLE_, "version", "name").
+		Values(version, name).
+		Build().
+		Exec(tx)
+
+	return err
+}
+
+// ensureTable creates the schema_migrations table if it does not exist.
+//
+// Databases created before migrations existed already have the schema of
+// the old initdb.sql, but no record of it. These are recorded as being at
+// the baseline version, so that the initial migration is not run again.
+func ensureTable(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Does nothing if the transaction was committed.
+		_ = tx.Rollback()
+	}()
+
+	var exists bool
+	err = tx.QueryRow("SELECT to_regclass($1) IS NOT NULL", _TABLE_).
+		Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS ` + _TABLE_ + ` (
+  version int PRIMARY KEY,
+  name text NOT NULL,
+  applied_at timestamptz DEFAULT now() NOT NULL
+)`)
+	if err != nil {
+		return err
+	}
+
+	var existingSchema bool
+	err = tx.QueryRow("SELECT to_regclass('document') IS NOT NULL").
+		Scan(&existingSchema)
+	if err != nil {
+		return err
+	}
+
+	if existingSchema {
+		log.Println("Found schema created by initdb.sql, recording baseline")
+		err = record(tx, _BASELINEVERSION_, "initial")
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,262 @@
+package migrate
+
+import (
+	"database/sql"
+	"seekourney/core/database/dbtest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+
+	assert.GreaterOrEqual(t, len(migrations), 2)
+	assert.Equal(t, "initial", migrations[0].Name)
+	assert.Contains(t, migrations[0].SQL, "CREATE TABLE document")
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version)
+		assert.NotEmpty(t, migration.SQL)
+	}
+}
+
+func TestParseMigrationsOrder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.sql": {Data: []byte("SELECT 2")},
+		"m/0001_first.sql":  {Data: []byte("SELECT 1")},
+		"m/0003_third.sql":  {Data: []byte("SELECT 3")},
+	}
+
+	migrations, err := parseMigrations(fsys, "m")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(migrations))
+	assert.Equal(t, "first", migrations[0].Name)
+	assert.Equal(t, "SELECT 1", migrations[0].SQL)
+	assert.Equal(t, "third", migrations[2].Name)
+}
+
+func TestParseMigrationsInvalid(t *testing.T) {
+	gap := fstest.MapFS{
+		"m/0001_first.sql": {Data: []byte("SELECT 1")},
+		"m/0003_third.sql": {Data: []byte("SELECT 3")},
+	}
+	_, err := parseMigrations(gap, "m")
+	assert.Error(t, err)
+
+	duplicate := fstest.MapFS{
+		"m/0001_first.sql": {Data: []byte("SELECT 1")},
+		"m/0001_again.sql": {Data: []byte("SELECT 1")},
+	}
+	_, err = parseMigrations(duplicate, "m")
+	assert.Error(t, err)
+
+	badName := fstest.MapFS{
+		"m/first.sql": {Data: []byte("SELECT 1")},
+	}
+	_, err = parseMigrations(badName, "m")
+	assert.Error(t, err)
+}
+
+func TestStatus(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+
+	current, err := status(migrations, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, current.Current)
+	assert.Equal(t, 3, current.Latest)
+	assert.Equal(t, migrations[1:], current.Pending)
+
+	current, err = status(migrations, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, current.Pending)
+
+	_, err = status(migrations, 4)
+	assert.Error(t, err)
+}
+
+// TestPostgres applies the migrations to a database in a container,
+// emptied before every test, see dbtest.
+func TestPostgres(t *testing.T) {
+	settings := dbtest.Start(t, "go-postgres-test-migrate", 5435)
+	db := dbtest.Connect(t, settings)
+
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		test func(*testing.T, *sql.DB, []Migration)
+	}{
+		{"UpEmpty", testUpEmpty},
+		{"UpBaseline", testUpBaseline},
+		{"UpBaselineWordCount", testUpBaselineWordCount},
+		{"ApplyRollback", testApplyRollback},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dbtest.Reset(t, db)
+			test.test(t, db, migrations)
+		})
+	}
+}
+
+// versions returns the versions of migrations.
+func versions(migrations []Migration) []int {
+	result := make([]int, len(migrations))
+	for i, migration := range migrations {
+		result[i] = migration.Version
+	}
+	return result
+}
+
+// exists returns true if db has the table.
+func exists(t *testing.T, db *sql.DB, table string) bool {
+	var found bool
+	err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL", table).
+		Scan(&found)
+	assert.NoError(t, err)
+	return found
+}
+
+func testUpEmpty(t *testing.T, db *sql.DB, migrations []Migration) {
+	current, err := GetStatus(db)
+	assert.NoError(t, err)
+	assert.Zero(t, current.Current)
+	assert.Equal(t, versions(migrations), versions(current.Pending))
+
+	applied, err := Up(db)
+	assert.NoError(t, err)
+	assert.Equal(t, versions(migrations), versions(applied))
+	assert.True(t, exists(t, db, "document_revision"))
+
+	current, err = GetStatus(db)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), current.Current)
+	assert.Empty(t, current.Pending)
+
+	var recorded int
+	err = db.QueryRow("SELECT COUNT(*) FROM " + _TABLE_).Scan(&recorded)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), recorded)
+
+	// Running again applies nothing.
+	applied, err = Up(db)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+}
+
+// createBaseline creates the schema of the old initdb.sql, which the initial
+// migration is, with a document, and runs extra.
+func createBaseline(
+	t *testing.T,
+	db *sql.DB,
+	migrations []Migration,
+	extra string,
+) {
+	_, err := db.Exec(migrations[0].SQL)
+	assert.NoError(t, err)
+
+	// last_indexed was stored JSON encoded.
+	_, err = db.Exec(`
+		INSERT INTO indexer (id, name, exec, port)
+			VALUES ('i1', 'files', '/bin/files', 39000);
+		INSERT INTO collection (id, path, indexer_id, recursive,
+			source_type, respect_last_modified, normalizer)
+			VALUES ('c1', '/docs', 'i1', true, 'dir', false, 0);
+		INSERT INTO document (path, type, words, last_indexed,
+			collection_id, raw_text)
+			VALUES ('/docs/pie.txt', 'file', '{"apple": 2, "pie": 1}',
+				'"2025-03-01T12:00:00+01:00"', 'c1', 'apple apple pie')`)
+	assert.NoError(t, err)
+
+	if extra != "" {
+		_, err = db.Exec(extra)
+		assert.NoError(t, err)
+	}
+}
+
+// assertMigratedBaseline checks that Up migrates the baseline database
+// created by createBaseline, keeping its document.
+func assertMigratedBaseline(
+	t *testing.T,
+	db *sql.DB,
+	migrations []Migration,
+) {
+	applied, err := Up(db)
+	assert.NoError(t, err)
+	assert.Equal(t, versions(migrations[1:]), versions(applied))
+
+	var name string
+	err = db.QueryRow(
+		"SELECT name FROM "+_TABLE_+" WHERE version = $1",
+		_BASELINEVERSION_,
+	).Scan(&name)
+	assert.NoError(t, err)
+	assert.Equal(t, "initial", name)
+
+	var wordCount int
+	var lastIndexed time.Time
+	var text string
+	err = db.QueryRow(`
+		SELECT word_count, last_indexed, convert_from(content, 'UTF8')
+		FROM document JOIN document_text USING (path)
+		WHERE path = '/docs/pie.txt'`,
+	).Scan(&wordCount, &lastIndexed, &text)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, wordCount)
+	assert.True(t, lastIndexed.Equal(
+		time.Date(2025, time.March, 1, 11, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "apple apple pie", text)
+
+	applied, err = Up(db)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+}
+
+func testUpBaseline(t *testing.T, db *sql.DB, migrations []Migration) {
+	createBaseline(t, db, migrations, "")
+	assertMigratedBaseline(t, db, migrations)
+}
+
+// Servers before migrations existed added word_count at startup.
+func testUpBaselineWordCount(
+	t *testing.T,
+	db *sql.DB,
+	migrations []Migration,
+) {
+	createBaseline(t, db, migrations, `
+		ALTER TABLE document
+			ADD COLUMN word_count int DEFAULT 0 NOT NULL;
+		UPDATE document SET word_count = 3`)
+	assertMigratedBaseline(t, db, migrations)
+}
+
+func testApplyRollback(t *testing.T, db *sql.DB, migrations []Migration) {
+	_, err := Up(db)
+	assert.NoError(t, err)
+
+	broken := Migration{
+		Version: len(migrations) + 1,
+		Name:    "broken",
+		SQL:     "CREATE TABLE broken (id int); SELECT * FROM missing",
+	}
+	done, err := apply(db, broken)
+	assert.Error(t, err)
+	assert.False(t, done)
+
+	// Nothing of the failed migration is kept.
+	assert.False(t, exists(t, db, "broken"))
+	current, err := currentVersion(db)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), current)
+
+	// Already applied migrations are skipped.
+	done, err = apply(db, migrations[len(migrations)-1])
+	assert.NoError(t, err)
+	assert.False(t, done)
+}
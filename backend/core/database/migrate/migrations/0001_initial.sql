@@ -1,7 +1,6 @@
 CREATE TYPE path_type AS ENUM ('web', 'file');
 CREATE TYPE SOURCE_TYPE AS ENUM ('file', 'dir', 'url');
 
-
 CREATE TABLE indexer (
   id text PRIMARY KEY,
   name text NOT NULL,
@@ -0,0 +1,11 @@
+-- Stores the number of words of every document, used to normalize
+-- term frequencies while scoring in the database.
+-- Databases created from the old initdb.sql may have the column already.
+ALTER TABLE document
+  ADD COLUMN IF NOT EXISTS word_count int DEFAULT 0 NOT NULL;
+
+UPDATE document
+SET word_count = (
+  SELECT COALESCE(SUM(value::int), 0) FROM jsonb_each_text(words)
+)
+WHERE word_count = 0;
@@ -0,0 +1,11 @@
+-- Deleting a collection deletes its documents, and deleting an indexer
+-- deletes its collections, so no row refers to a deleted one.
+ALTER TABLE document
+  DROP CONSTRAINT IF EXISTS document_collection_id_fkey,
+  ADD CONSTRAINT document_collection_id_fkey
+    FOREIGN KEY (collection_id) REFERENCES collection(id) ON DELETE CASCADE;
+
+ALTER TABLE collection
+  DROP CONSTRAINT IF EXISTS collection_indexer_id_fkey,
+  ADD CONSTRAINT collection_indexer_id_fkey
+    FOREIGN KEY (indexer_id) REFERENCES indexer(id) ON DELETE CASCADE;
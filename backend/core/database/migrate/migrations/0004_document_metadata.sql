@@ -0,0 +1,14 @@
+-- Describes documents besides their content, see utils.Metadata.
+-- modified is NULL when the indexer does not know it.
+ALTER TABLE document
+  ADD COLUMN title text DEFAULT '' NOT NULL,
+  ADD COLUMN size bigint DEFAULT 0 NOT NULL,
+  ADD COLUMN modified timestamptz,
+  ADD COLUMN mime_type text DEFAULT '' NOT NULL,
+  ADD COLUMN language text DEFAULT '' NOT NULL;
+
+-- last_indexed was stored as a JSON encoded time, such as
+-- "2025-03-01T12:00:00+01:00" including the quotes.
+ALTER TABLE document
+  ALTER COLUMN last_indexed TYPE timestamptz
+    USING trim(both '"' from last_indexed)::timestamptz;
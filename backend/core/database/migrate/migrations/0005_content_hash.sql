@@ -0,0 +1,5 @@
+-- Hash of the content a document was normalized from, see
+-- document.ContentHash. Pushing a document with the same hash again does
+-- not rewrite it. Empty for documents stored before, they are rewritten.
+ALTER TABLE document
+  ADD COLUMN content_hash text DEFAULT '' NOT NULL;
@@ -0,0 +1,7 @@
+-- When an indexer last sent each document, even if it was unchanged.
+-- Documents not seen by a complete reindex of their collection are removed.
+ALTER TABLE document
+  ADD COLUMN last_seen timestamptz DEFAULT now() NOT NULL;
+
+CREATE INDEX document_collection_last_seen
+  ON document (collection_id, last_seen);
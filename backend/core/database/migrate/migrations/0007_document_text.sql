@@ -0,0 +1,13 @@
+-- The raw text of documents is kept apart from their rows, so scoring
+-- does not read it. It is only loaded for previews and phrase filters.
+-- Core stores it gzip compressed, the text moved here is left as it was,
+-- see postgres.decodeText.
+CREATE TABLE document_text (
+  path text PRIMARY KEY REFERENCES document(path) ON DELETE CASCADE,
+  content bytea NOT NULL
+);
+
+INSERT INTO document_text (path, content)
+  SELECT path, convert_to(raw_text, 'UTF8') FROM document;
+
+ALTER TABLE document DROP COLUMN raw_text;
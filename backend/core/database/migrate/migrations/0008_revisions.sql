@@ -0,0 +1,19 @@
+-- Previous versions of documents, see the revision package.
+-- A collection keeps the last revisions versions of each of its documents.
+-- content is stored like in document_text.
+ALTER TABLE collection
+  ADD COLUMN revisions int DEFAULT 0 NOT NULL;
+
+CREATE TABLE document_revision (
+  path text NOT NULL REFERENCES document(path) ON DELETE CASCADE,
+  number int NOT NULL,
+  words jsonb NOT NULL,
+  word_count int NOT NULL,
+  content bytea NOT NULL,
+  content_hash text NOT NULL,
+  last_indexed timestamptz NOT NULL,
+  PRIMARY KEY (path, number)
+);
+
+CREATE INDEX document_revision_last_indexed
+  ON document_revision (path, last_indexed);
@@ -0,0 +1,8 @@
+-- Revisions keep the metadata of their version, like document.
+-- Revisions kept before have no metadata.
+ALTER TABLE document_revision
+  ADD COLUMN title text DEFAULT '' NOT NULL,
+  ADD COLUMN size bigint DEFAULT 0 NOT NULL,
+  ADD COLUMN modified timestamptz,
+  ADD COLUMN mime_type text DEFAULT '' NOT NULL,
+  ADD COLUMN language text DEFAULT '' NOT NULL;
@@ -0,0 +1,17 @@
+-- Revisions outlive their document, so searches as of a past time find the
+-- documents deleted since. They are deleted with their collection instead,
+-- and keep the type of their document. deleted is when the document was
+-- deleted, set on the revision it was kept as.
+ALTER TABLE document_revision
+  ADD COLUMN collection_id text REFERENCES collection(id) ON DELETE CASCADE,
+  ADD COLUMN type path_type,
+  ADD COLUMN deleted timestamptz;
+
+UPDATE document_revision
+  SET collection_id = document.collection_id, type = document.type
+  FROM document
+  WHERE document.path = document_revision.path;
+
+ALTER TABLE document_revision
+  ALTER COLUMN type SET NOT NULL,
+  DROP CONSTRAINT document_revision_path_fkey;
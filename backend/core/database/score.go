@@ -0,0 +1,269 @@
+package database
+
+import (
+	"database/sql"
+	"seekourney/utils"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Filter contains the search filters a document must satisfy to match.
+// PlusWords must all be in the document, MinusWords must all be absent.
+// If Paths is not nil, only the documents with these paths match.
+// Quotes are verified in Go, since the raw text is not in the document
+// row, and only the paths of the documents containing them are given.
+// If AsOf is not zero, the versions at that time are matched instead,
+// see VersionsAsOf.
+type Filter struct {
+	PlusWords  []string
+	MinusWords []string
+	Paths      []utils.Path
+	AsOf       time.Time
+}
+
+// _VERSIONS_ names the versions of documents in a statement,
+// see VersionsAsOf.
+const _VERSIONS_ string = "versions"
+
+// metadataColumns are the columns of utils.Metadata, which documents and
+// their revisions both have.
+var metadataColumns = []string{
+	"title",
+	"size",
+	"modified",
+	"mime_type",
+	"language",
+}
+
+/*
+VersionsAsOf selects the version of every document that was indexed last at
+asOf, either from current, which has the stored documents, or from their
+revisions. Documents without such a version are left out, and so are
+documents deleted at asOf, whose newest revision has the time they were
+deleted. Both must have the given columns, besides path and last_indexed.
+*/
+func VersionsAsOf(current string, asOf time.Time, columns ...string) Query {
+	selected := strings.Join(
+		append([]string{"path", "last_indexed"}, columns...), ", ")
+
+	latest := Select(
+		append([]string{"DISTINCT ON (path) path", "deleted"}, columns...)...,
+	).
+		From("(SELECT "+selected+", NULL::timestamptz AS deleted FROM "+
+			current+" WHERE last_indexed <= $1 UNION ALL SELECT "+selected+
+			", deleted FROM "+utils.TABLEDOCUMENTREVISION+
+			" WHERE last_indexed <= $1) AS version", asOf).
+		OrderBy("path", "last_indexed DESC").
+		Build()
+
+	return Select(append([]string{"path"}, columns...)...).
+		With("latest", latest).
+		From("latest").
+		Where("deleted IS NULL OR deleted > $1", asOf).
+		Build()
+}
+
+// scoredTable returns the table the documents matching filter are read
+// from, adding the versions at filter.AsOf to statement if needed.
+func scoredTable(statement *SelectStatement, filter Filter) string {
+	if filter.AsOf.IsZero() {
+		return utils.TABLEDOCUMENT
+	}
+
+	statement.With(_VERSIONS_, VersionsAsOf(
+		utils.TABLEDOCUMENT,
+		filter.AsOf,
+		append([]string{"type", "words", "word_count"}, metadataColumns...)...,
+	))
+	return _VERSIONS_
+}
+
+// scoreColumns returns the columns of a ScoreRow. The source and metadata
+// are those of the versions scored as of a past time, see scoredTable.
+func scoreColumns(filter Filter) []string {
+	table := utils.TABLEDOCUMENT
+	if !filter.AsOf.IsZero() {
+		table = _VERSIONS_
+	}
+
+	columns := []string{"path", "score", table + ".type"}
+	for _, column := range metadataColumns {
+		columns = append(columns, table+"."+column)
+	}
+
+	return columns
+}
+
+// ScoreRow is a scored document returned by ScoreQuery.
+type ScoreRow struct {
+	Path     utils.Path
+	Score    utils.Score
+	Source   utils.Source
+	Metadata utils.Metadata
+}
+
+// SQLScan scans a SQL row into a ScoreRow object.
+func (row ScoreRow) SQLScan(rows *sql.Rows) (ScoreRow, error) {
+	var sourceName string
+	var modified sql.NullTime
+
+	err := rows.Scan(
+		&row.Path,
+		&row.Score,
+		&sourceName,
+		&row.Metadata.Title,
+		&row.Metadata.Size,
+		&modified,
+		&row.Metadata.MIMEType,
+		&row.Metadata.Language,
+	)
+	if err != nil {
+		return ScoreRow{}, err
+	}
+
+	row.Source, err = utils.ParseSource(sourceName)
+	if err != nil {
+		return ScoreRow{}, err
+	}
+
+	if modified.Valid {
+		row.Metadata.Modified = modified.Time
+	}
+
+	return row, nil
+}
+
+// filterMatches only selects the documents that satisfy filter.
+func filterMatches(statement *SelectStatement, filter Filter) {
+	if len(filter.PlusWords) > 0 {
+		statement.Where("words ?& $1", pq.StringArray(filter.PlusWords))
+	}
+
+	if len(filter.MinusWords) > 0 {
+		statement.Where("NOT words ?| $1", pq.StringArray(filter.MinusWords))
+	}
+
+	if filter.Paths != nil {
+		paths := make([]string, len(filter.Paths))
+		for i, path := range filter.Paths {
+			paths[i] = string(path)
+		}
+		statement.Where("path = ANY($1)", pq.StringArray(paths))
+	}
+}
+
+// termStrings converts terms to strings, for a text array parameter.
+func termStrings(terms []utils.Word) []string {
+	words := make([]string, len(terms))
+	for i, term := range terms {
+		words[i] = string(term)
+	}
+
+	return words
+}
+
+// MatchingPaths returns the paths of the documents matching filter,
+// and containing at least one of terms, ordered.
+// These are the documents ScoreQuery may return.
+func MatchingPaths(
+	conn Conn,
+	terms []utils.Word,
+	filter Filter,
+) ([]utils.Path, error) {
+	statement := Select("path")
+	statement.
+		From(scoredTable(statement, filter)).
+		Where("words ?| $1", pq.StringArray(termStrings(terms)))
+	filterMatches(statement, filter)
+
+	rows, err := statement.OrderBy("path").Build().Rows(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make([]utils.Path, 0)
+	for rows.Next() {
+		var path utils.Path
+		err = rows.Scan(&path)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+/*
+ScoreQuery scores every document matching filter against the given terms,
+and returns the limit best ones, best first.
+
+All of the tf-idf calculation happens in a single statement:
+term frequency is read from the words of each document and divided by
+its stored word count, and the idf of each term is computed from the
+number of matching documents containing it. A term given twice counts
+twice. Only the final rows are sent back from the database,
+with the source and metadata of their documents. Searches as of a past time
+score the versions at that time, count them for the idf, and return their
+source and metadata, so documents deleted since are found.
+See: https://en.wikipedia.org/wiki/Tf%E2%80%93idf
+*/
+func ScoreQuery(
+	conn Conn,
+	terms []utils.Word,
+	filter Filter,
+	limit int,
+) ([]ScoreRow, error) {
+	weights := Select("word", "COUNT(*) AS weight").
+		From("unnest($1::text[]) AS word", pq.StringArray(termStrings(terms))).
+		GroupBy("word")
+
+	statement := Select(scoreColumns(filter)...).
+		With("terms", weights.Build())
+	table := scoredTable(statement, filter)
+
+	matches := Select(
+		"path",
+		"word",
+		"weight",
+		"(words ->> word)::float8 / GREATEST(word_count, 1) AS tf",
+	).
+		From(table).
+		Join("terms", "words ? word")
+	filterMatches(matches, filter)
+
+	idf := Select(
+		"word",
+		"LN((SELECT COUNT(*) FROM "+table+")::float8 / (COUNT(*) + 1)) / "+
+			"LN(2) AS idf",
+	).
+		From("matches").
+		GroupBy("word")
+
+	scored := Select("path", "SUM(weight * tf * idf) AS score").
+		From("matches").
+		JoinUsing("idf", "word").
+		GroupBy("path").
+		OrderBy("score DESC", "path").
+		Limit(limit)
+
+	statement.
+		With("matches", matches.Build()).
+		With("idf", idf.Build()).
+		With("scored", scored.Build()).
+		From("scored").
+		JoinUsing(table, "path")
+	query := statement.OrderBy("score DESC", "path").Build()
+
+	insert := func(res *[]ScoreRow, row ScoreRow) {
+		*res = append(*res, row)
+	}
+
+	result := make([]ScoreRow, 0, limit)
+	err := ExecScan(conn, query, &result, insert)
+
+	return result, err
+}
@@ -3,8 +3,8 @@ package database
 import (
 	"database/sql"
 	"iter"
-	"log"
 	"math/rand"
+	"regexp"
 	"seekourney/utils"
 	"strconv"
 	"strings"
@@ -17,11 +17,27 @@ const (
 	_VALUES_     = "VALUES"
 	_SELECT_     = "SELECT"
 	_UPDATE_     = "UPDATE"
+	_DELETE_     = "DELETE"
 	_FROM_       = "FROM"
 	_WHERE_      = "WHERE"
+	_AND_        = "AND"
 	_AS_         = "AS"
 	_SET_        = "SET"
+	_WITH_       = "WITH"
+	_JOIN_       = "JOIN"
+	_LEFTJOIN_   = "LEFT JOIN"
+	_ON_         = "ON"
+	_USING_      = "USING"
+	_GROUPBY_    = "GROUP BY"
+	_ORDERBY_    = "ORDER BY"
+	_LIMIT_      = "LIMIT"
+	_FORUPDATE_  = "FOR UPDATE"
+	_RETURNING_  = "RETURNING"
 	_JSON_VALUE_ = "JSON_VALUE"
+	_ONCONFLICT_ = "ON CONFLICT"
+	_DOUPDATE_   = "DO UPDATE"
+	_DONOTHING_  = "DO NOTHING"
+	_EXCLUDED_   = "EXCLUDED."
 )
 
 type ObjectId = utils.ObjectId
@@ -72,7 +88,71 @@ func ScanRowsIter[T SQLScan[T]](Rows *sql.Rows) iter.Seq[utils.Result[T]] {
 	}
 }
 
-// / Write
+// ExecScan runs query and scans every row into obj.
+// The insert function is used to insert each row into obj.
+func ExecScan[T SQLScan[T], U any](
+	conn Conn,
+	query Query,
+	obj *U,
+	insert func(*U, T),
+) (resErr error) {
+
+	rows, err := query.Rows(conn)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if resErr == nil {
+			resErr = err
+		}
+	}()
+
+	for row := range ScanRowsIter[T](rows) {
+		if row.Err != nil {
+			return row.Err
+		}
+
+		insert(obj, row.Value)
+	}
+
+	return rows.Err()
+}
+
+// sqlInt is used to scan an int from a SQL row
+// we use this new type to bypass the local type restriction for methods
+// int is non local
+type sqlInt int
+
+func (n sqlInt) SQLScan(rows *sql.Rows) (sqlInt, error) {
+	var i int
+	err := rows.Scan(&i)
+	if err != nil {
+		return 0, err
+	}
+	return sqlInt(i), nil
+}
+
+// RowAmount gets number of entries in a given row.
+func RowAmount(db *sql.DB, table string) (int, error) {
+	query := Select("COUNT(*)").From(table).Build()
+	var count sqlInt
+
+	insert := func(res *sqlInt, sqlRes sqlInt) {
+		*res = sqlRes
+	}
+
+	err := ExecScan(db, query, &count, insert)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+/// Write
 
 // SQLValue represents a value fetched from SQL database.
 type SQLValue = any
@@ -92,85 +172,320 @@ type SQLWrite interface {
 	SQLGetValues() []SQLValue
 }
 
-// objectTemplate is a type that represents a SQL Object row thing.
-// TODO: Improve this
-type objectTemplate string
+// InsertInto executes an INSERT statement into the database.
+func InsertInto(conn Conn, object SQLWrite) (sql.Result, error) {
+	return InsertObjects(object).Build().Exec(conn)
+}
 
-// valueSubstitution is a type that represents a SQL value substitution.
-type valueSubstitution string
+// InsertObjects inserts objects, which must all be rows of the same table.
+func InsertObjects[T SQLWrite](objects ...T) *InsertStatement {
+	template := objects[0]
+	statement := Insert(template.SQLGetName(), template.SQLGetFields()...)
+	for _, object := range objects {
+		statement.Values(object.SQLGetValues()...)
+	}
 
-// Statment is a type that represents a SQL statement.
-type Statment string
+	return statement
+}
 
-/// Insert
+// UpsertObjects inserts objects like InsertObjects, but updates every other
+// field of an existing row with the same primary key instead of failing.
+// Objects must have different primary keys.
+func UpsertObjects[T SQLWrite](objects ...T) *InsertStatement {
+	return onConflictUpdate(InsertObjects(objects...), objects[0])
+}
 
-// InsertInto executes an INSERT statement into the database.
-func InsertInto(db *sql.DB, object SQLWrite) (sql.Result, error) {
-	stmt := InsertIntoStatment(object)
-	return db.Exec(string(stmt), object.SQLGetValues()...)
+// UpsertFrom upserts every row of the table source, which must have the
+// fields of template, like UpsertObjects.
+func UpsertFrom(template SQLWrite, source string) *InsertStatement {
+	fields := template.SQLGetFields()
+	statement := Insert(template.SQLGetName(), fields...).
+		Select(Select(fields...).From(source).Build())
+
+	return onConflictUpdate(statement, template)
 }
 
-// InsertIntoStatment creates an INSERT statement from a SQLWrite object.
-func InsertIntoStatment(template SQLWrite) Statment {
-	return insertIntoStatment(
-		sqlTemplate(template),
-		sqlValueSubstition(template),
+// onConflictUpdate makes statement update every field of template except
+// the primary key, when a row with the same primary key exists.
+func onConflictUpdate(
+	statement *InsertStatement,
+	template SQLWrite,
+) *InsertStatement {
+	fields := template.SQLGetFields()
+	return statement.OnConflict(fields[0]).DoUpdate(fields[1:]...)
+}
+
+/// Queries
+
+/*
+Query is a complete SQL statement with its arguments, built by one of the
+statement builders, such as Select. Its placeholders are numbered $1, $2, ...
+in the order of Args.
+
+A Query can be used as a subquery by passing its SQL and Args to a clause:
+
+	matching := Select("id").From("collection").Where("indexer_id = $1", id)
+	Delete("document").Where(
+		"collection_id IN ("+matching.Build().SQL+")",
+		matching.Build().Args...,
 	)
+*/
+type Query struct {
+	SQL  string
+	Args []any
+}
+
+// Conn runs queries, it is implemented by *sql.DB and *sql.Tx.
+type Conn interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// String returns the SQL of query.
+func (query Query) String() string {
+	return query.SQL
+}
+
+// Exec executes query without returning any rows.
+func (query Query) Exec(conn Conn) (sql.Result, error) {
+	return conn.Exec(query.SQL, query.Args...)
+}
+
+// Rows executes query and returns its rows.
+func (query Query) Rows(conn Conn) (*sql.Rows, error) {
+	return conn.Query(query.SQL, query.Args...)
+}
+
+// Row executes query, which returns at most one row.
+func (query Query) Row(conn Conn) *sql.Row {
+	return conn.QueryRow(query.SQL, query.Args...)
 }
 
-// insertIntoStatment creates an INSERT statement from a template
-// and a value substitution.
-func insertIntoStatment(
-	template objectTemplate,
-	sub valueSubstitution,
-) Statment {
-	list := []string{
-		_INSERT_,
-		_INTO_,
-		string(template),
-		string(sub),
+// placeholder matches the $n placeholders of a clause.
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// clause is a part of a statement with its own arguments.
+// Its placeholders are numbered from $1, and may repeat.
+type clause struct {
+	sql  string
+	args []any
+}
+
+// builder assembles a statement from words and clauses,
+// numbering the placeholders of every clause after those before it.
+type builder struct {
+	words []string
+	args  []any
+}
+
+// write adds words to the statement.
+func (b *builder) write(words ...string) {
+	b.words = append(b.words, words...)
+}
+
+// add adds the SQL of c to the statement, with its placeholders renumbered.
+// Panics if c has a placeholder without an argument,
+// which is a mistake in the code building the statement.
+func (b *builder) add(c clause) {
+	offset := len(b.args)
+
+	sql := placeholder.ReplaceAllStringFunc(c.sql, func(match string) string {
+		number, err := strconv.Atoi(match[1:])
+		if err != nil || number < 1 || number > len(c.args) {
+			panic("SQL clause " + c.sql + " has no argument for " + match)
+		}
+		return "$" + strconv.Itoa(offset+number)
+	})
+
+	b.words = append(b.words, sql)
+	b.args = append(b.args, c.args...)
+}
+
+// join adds clauses to the statement, separated by sep,
+// which is empty for a space, or ends a clause like a comma.
+func (b *builder) join(clauses []clause, sep string) {
+	for i, c := range clauses {
+		switch {
+		case i == 0 || sep == "":
+		case sep == ",":
+			b.words[len(b.words)-1] += sep
+		default:
+			b.write(sep)
+		}
+		b.add(c)
+	}
+}
+
+// where adds a WHERE clause with every condition, if there are any.
+// Several conditions are put in parentheses,
+// so joining them with AND does not change their meaning.
+func (b *builder) where(conditions []clause) {
+	if len(conditions) == 0 {
+		return
 	}
-	return Statment(strings.Join(list, " "))
 
+	if len(conditions) > 1 {
+		wrapped := make([]clause, len(conditions))
+		for i, condition := range conditions {
+			wrapped[i] = clause{
+				sql:  "(" + condition.sql + ")",
+				args: condition.args,
+			}
+		}
+		conditions = wrapped
+	}
+
+	b.write(_WHERE_)
+	b.join(conditions, _AND_)
 }
 
-// sqlTemplate creates a SQL template from a Go struct/object.
-func sqlTemplate(template SQLWrite) objectTemplate {
-	name := template.SQLGetName()
-	fields := template.SQLGetFields()
+// returning adds a RETURNING clause, if there are columns.
+func (b *builder) returning(columns []string) {
+	if len(columns) == 0 {
+		return
+	}
 
-	return objectTemplate(name + " (" + strings.Join(fields, ",") + ")")
+	b.write(_RETURNING_, strings.Join(columns, ", "))
 }
 
-// sqlValueSubstition creates a SQL value substitution from a Go struct/object.
-func sqlValueSubstition(template SQLWrite) valueSubstitution {
-	values := template.SQLGetValues()
+// build returns the assembled statement.
+func (b *builder) build() Query {
+	return Query{SQL: strings.Join(b.words, " "), Args: b.args}
+}
+
+/// Insert
+
+// InsertStatement builds an INSERT statement, see Insert.
+type InsertStatement struct {
+	table     string
+	columns   []string
+	rows      []clause
+	source    *clause
+	conflict  []string
+	updates   []string
+	doNothing bool
+	where     []clause
+	returning []string
+}
+
+// Insert starts an INSERT into the given columns of table.
+// Rows are added with Values, or selected with Select.
+func Insert(table string, columns ...string) *InsertStatement {
+	return &InsertStatement{table: table, columns: columns}
+}
 
-	str := _VALUES_ + " ("
+// Values adds a row, with one value for every column.
+func (s *InsertStatement) Values(values ...any) *InsertStatement {
+	if len(values) != len(s.columns) {
+		panic("INSERT into " + s.table + " needs " +
+			strconv.Itoa(len(s.columns)) + " values, got " +
+			strconv.Itoa(len(values)))
+	}
+
+	params := make([]string, len(values))
 	for i := range values {
-		str += "$" + strconv.Itoa(i+1)
-		if i != len(values)-1 {
-			str += ", "
-		}
+		params[i] = "$" + strconv.Itoa(i+1)
 	}
-	str += ")"
 
-	return valueSubstitution(str)
+	s.rows = append(s.rows, clause{
+		sql:  "(" + strings.Join(params, ", ") + ")",
+		args: values,
+	})
+	return s
 }
 
-/// Select
+// Select inserts the rows returned by query, instead of Values.
+func (s *InsertStatement) Select(query Query) *InsertStatement {
+	s.source = &clause{sql: query.SQL, args: query.Args}
+	return s
+}
+
+// OnConflict names the unique columns of a conflicting row,
+// what happens to it is set with DoUpdate or DoNothing.
+func (s *InsertStatement) OnConflict(columns ...string) *InsertStatement {
+	s.conflict = columns
+	return s
+}
+
+// DoUpdate sets the given columns of a conflicting row to the values
+// that were to be inserted.
+func (s *InsertStatement) DoUpdate(columns ...string) *InsertStatement {
+	s.updates = columns
+	return s
+}
+
+// DoNothing skips conflicting rows.
+func (s *InsertStatement) DoNothing() *InsertStatement {
+	s.doNothing = true
+	return s
+}
+
+// Where only updates the conflicting rows matching condition, see DoUpdate.
+// The stored row is named by its table, and the new one EXCLUDED.
+func (s *InsertStatement) Where(
+	condition string,
+	args ...any,
+) *InsertStatement {
+	s.where = append(s.where, clause{sql: condition, args: args})
+	return s
+}
+
+// Returning returns the given columns of every inserted or updated row.
+func (s *InsertStatement) Returning(columns ...string) *InsertStatement {
+	s.returning = columns
+	return s
+}
+
+// Build returns the statement.
+func (s *InsertStatement) Build() Query {
+	b := builder{}
+	b.write(_INSERT_, _INTO_,
+		s.table+" ("+strings.Join(s.columns, ", ")+")")
+
+	if s.source != nil {
+		b.add(*s.source)
+	} else {
+		b.write(_VALUES_)
+		b.join(s.rows, ",")
+	}
+
+	if len(s.conflict) > 0 || s.doNothing {
+		b.write(_ONCONFLICT_)
+		if len(s.conflict) > 0 {
+			b.write("(" + strings.Join(s.conflict, ", ") + ")")
+		}
 
-// SelectStatment is a type that represents a SQL SELECT keyword.
-type SelectStatment string
+		if s.doNothing || len(s.updates) == 0 {
+			b.write(_DONOTHING_)
+		} else {
+			updates := make([]string, len(s.updates))
+			for i, column := range s.updates {
+				updates[i] = column + " = " + _EXCLUDED_ + column
+			}
+			b.write(_DOUPDATE_, _SET_, strings.Join(updates, ", "))
+			b.where(s.where)
+		}
+	}
 
-// SelectQuery is a type that represents a SQL SELECT with a query.
-type SelectQuery string
+	b.returning(s.returning)
+	return b.build()
+}
 
-// SelectFrom is a type that represents a SQL SELECT with a FROM clause.
-type SelectFrom string
+/// Select
 
-// SelectWhere is a type that represents a SQL SELECT with a WHERE clause.
-type SelectWhere string
+// SelectStatement builds a SELECT statement, see Select.
+type SelectStatement struct {
+	with    []clause
+	columns []string
+	from    *clause
+	joins   []clause
+	where   []clause
+	groupBy []string
+	orderBy []string
+	limit   *clause
+	locked  bool
+}
 
 // JsonValue creates a JSON_VALUE SELECT statement
 // of the form JSON_VALUE(sqlField, '$.jsonField') AS name.
@@ -189,122 +504,239 @@ func JsonValue(sqlField string, jsonField string, name string) string {
 	return strings.Join(s, " ")
 }
 
-// Select returns SELECT as a SelectStatement.
-func Select() SelectStatment {
-	return SelectStatment(_SELECT_)
+// Select starts a SELECT of the given columns or expressions,
+// or of every column if none are given.
+func Select(columns ...string) *SelectStatement {
+	if len(columns) == 0 {
+		columns = []string{"*"}
+	}
+
+	return &SelectStatement{columns: columns}
 }
 
-// Queries adds a list of queries to the SQL statement.
-func (s SelectStatment) Queries(query ...string) SelectQuery {
-	return SelectQuery(string(s) + " " + strings.Join(query, ", "))
+// With adds a common table expression named name, which the statement
+// can select from.
+func (s *SelectStatement) With(name string, query Query) *SelectStatement {
+	s.with = append(s.with, clause{
+		sql:  name + " " + _AS_ + " (" + query.SQL + ")",
+		args: query.Args,
+	})
+	return s
 }
 
-// QueryAll adds a wildcard (*) to the SQL statement.
-func (s SelectStatment) QueryAll() SelectQuery {
-	return s.Queries("*")
+// From selects from table, which may be any FROM item with its arguments,
+// such as a function call or several comma separated tables.
+func (s *SelectStatement) From(table string, args ...any) *SelectStatement {
+	s.from = &clause{sql: table, args: args}
+	return s
 }
 
-// From adds a FROM clause to the SQL statement.
-func (s SelectQuery) From(table string) SelectFrom {
-	return SelectFrom(string(s) + " " + _FROM_ + " " + table)
+// Join joins table on the rows where condition holds.
+func (s *SelectStatement) Join(
+	table string,
+	condition string,
+	args ...any,
+) *SelectStatement {
+	s.joins = append(s.joins, clause{
+		sql:  _JOIN_ + " " + table + " " + _ON_ + " " + condition,
+		args: args,
+	})
+	return s
 }
 
-// Where adds a WHERE clause to the SQL statement.
-func (s SelectFrom) Where(condition string) SelectWhere {
-	return SelectWhere(string(s) + " " + _WHERE_ + " " + condition)
+// LeftJoin joins table like Join, but keeps the rows that match no row of
+// table, with NULL for its columns.
+func (s *SelectStatement) LeftJoin(
+	table string,
+	condition string,
+	args ...any,
+) *SelectStatement {
+	s.joins = append(s.joins, clause{
+		sql:  _LEFTJOIN_ + " " + table + " " + _ON_ + " " + condition,
+		args: args,
+	})
+	return s
 }
 
-// ExecExec executes a SQL statement and returns the result into obj.
-// The insert function is used to insert the result into obj.
-func ExecScan[T SQLScan[T], U any](
-	db *sql.DB,
-	query string,
-	obj *U,
-	insert func(*U, T),
-	args ...any) (resErr error) {
+// JoinUsing joins table on the rows with equal values in columns,
+// which both tables have.
+func (s *SelectStatement) JoinUsing(
+	table string,
+	columns ...string,
+) *SelectStatement {
+	s.joins = append(s.joins, clause{
+		sql: _JOIN_ + " " + table + " " + _USING_ +
+			" (" + strings.Join(columns, ", ") + ")",
+	})
+	return s
+}
 
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		return err
-	}
+// Where only selects the rows where condition holds.
+// Every condition given must hold.
+func (s *SelectStatement) Where(
+	condition string,
+	args ...any,
+) *SelectStatement {
+	s.where = append(s.where, clause{sql: condition, args: args})
+	return s
+}
 
-	defer func() {
+// GroupBy groups the rows by the given columns or expressions.
+func (s *SelectStatement) GroupBy(columns ...string) *SelectStatement {
+	s.groupBy = append(s.groupBy, columns...)
+	return s
+}
 
-		log.Println("awa closing rows:", err)
-		err = rows.Close()
-		if resErr != nil {
-			log.Println("Error closing rows:", err)
-			resErr = err
-		}
-	}()
+// OrderBy orders the rows by the given columns or expressions,
+// which may be followed by DESC.
+func (s *SelectStatement) OrderBy(columns ...string) *SelectStatement {
+	s.orderBy = append(s.orderBy, columns...)
+	return s
+}
 
-	for row := range ScanRowsIter[T](rows) {
-		if row.Err != nil {
-			return row.Err
-		}
+// Limit selects at most limit rows.
+func (s *SelectStatement) Limit(limit int) *SelectStatement {
+	s.limit = &clause{sql: _LIMIT_ + " $1", args: []any{limit}}
+	return s
+}
 
-		insert(obj, row.Value)
+// ForUpdate locks the selected rows until the end of the transaction,
+// so other transactions cannot change or delete them meanwhile.
+func (s *SelectStatement) ForUpdate() *SelectStatement {
+	s.locked = true
+	return s
+}
+
+// Build returns the statement.
+func (s *SelectStatement) Build() Query {
+	b := builder{}
+
+	if len(s.with) > 0 {
+		b.write(_WITH_)
+		b.join(s.with, ",")
 	}
 
-	return nil
+	b.write(_SELECT_, strings.Join(s.columns, ", "))
+	if s.from != nil {
+		b.write(_FROM_)
+		b.add(*s.from)
+	}
+	b.join(s.joins, "")
+	b.where(s.where)
+
+	if len(s.groupBy) > 0 {
+		b.write(_GROUPBY_, strings.Join(s.groupBy, ", "))
+	}
+	if len(s.orderBy) > 0 {
+		b.write(_ORDERBY_, strings.Join(s.orderBy, ", "))
+	}
+	if s.limit != nil {
+		b.add(*s.limit)
+	}
+	if s.locked {
+		b.write(_FORUPDATE_)
+	}
+
+	return b.build()
 }
 
-// sqlInt is used to scan an int from a SQL row
-// we use this new type to bypass the local type restriction for methods
-// int is non local
-type sqlInt int
+/// Update
 
-func (n sqlInt) SQLScan(rows *sql.Rows) (sqlInt, error) {
-	var i int
-	err := rows.Scan(&i)
-	if err != nil {
-		return 0, err
-	}
-	return sqlInt(i), nil
+// UpdateStatement builds an UPDATE statement, see Update.
+type UpdateStatement struct {
+	table     string
+	set       []clause
+	where     []clause
+	returning []string
 }
 
-// RowAmount gets number of entries in a given row.
-func RowAmount(db *sql.DB, table string) (int, error) {
-	query := Select().Queries("COUNT(*)").From(table)
-	var count sqlInt
+// Update starts an UPDATE of the rows of table.
+func Update(table string) *UpdateStatement {
+	return &UpdateStatement{table: table}
+}
 
-	insert := func(res *sqlInt, sqlRes sqlInt) {
-		*res = sqlRes
-	}
+// Set sets column to value.
+func (s *UpdateStatement) Set(column string, value any) *UpdateStatement {
+	return s.SetExpr(column+" = $1", value)
+}
 
-	err := ExecScan(db, string(query), &count, insert)
+// SetExpr adds an assignment such as "count = count + $1".
+func (s *UpdateStatement) SetExpr(
+	assignment string,
+	args ...any,
+) *UpdateStatement {
+	s.set = append(s.set, clause{sql: assignment, args: args})
+	return s
+}
 
-	if err != nil {
-		return 0, err
-	}
+// Where only updates the rows where condition holds.
+// Every condition given must hold.
+func (s *UpdateStatement) Where(
+	condition string,
+	args ...any,
+) *UpdateStatement {
+	s.where = append(s.where, clause{sql: condition, args: args})
+	return s
+}
 
-	return int(count), nil
+// Returning returns the given columns of every updated row.
+func (s *UpdateStatement) Returning(columns ...string) *UpdateStatement {
+	s.returning = columns
+	return s
 }
 
-/// Update
+// Build returns the statement.
+// Panics if nothing is set, which is a mistake in the calling code.
+func (s *UpdateStatement) Build() Query {
+	if len(s.set) == 0 {
+		panic("UPDATE of " + s.table + " sets nothing")
+	}
+
+	b := builder{}
+	b.write(_UPDATE_, s.table, _SET_)
+	b.join(s.set, ",")
+	b.where(s.where)
+	b.returning(s.returning)
 
-// UpdateStatment is a type that represents a SQL UPDATE statement.
-type UpdateStatment string
+	return b.build()
+}
 
-// UpdateSet is a type that represents a SQL UPDATE with a SET clause.
-type UpdateSet string
+/// Delete
 
-// UpdateWhere is a type that represents a SQL UPDATE with a WHERE clause.
-type UpdateWhere string
+// DeleteStatement builds a DELETE statement, see Delete.
+type DeleteStatement struct {
+	table     string
+	where     []clause
+	returning []string
+}
 
-// Select returns SELECT as a SelectStatement.
-func Update(table string) UpdateStatment {
-	return UpdateStatment(_UPDATE_ + " " + table)
+// Delete starts a DELETE of the rows of table.
+func Delete(table string) *DeleteStatement {
+	return &DeleteStatement{table: table}
 }
 
-// Queries adds a list of queries to the SQL statement.
-func (s UpdateStatment) Set(KeyValue ...string) UpdateSet {
-	return UpdateSet(
-		string(s) + " " + _SET_ + " " + strings.Join(KeyValue, ", "),
-	)
+// Where only deletes the rows where condition holds.
+// Every condition given must hold.
+func (s *DeleteStatement) Where(
+	condition string,
+	args ...any,
+) *DeleteStatement {
+	s.where = append(s.where, clause{sql: condition, args: args})
+	return s
 }
 
-// Where adds a WHERE clause to the SQL statement.
-func (s UpdateSet) Where(condition string) UpdateWhere {
-	return UpdateWhere(string(s) + " " + _WHERE_ + " " + condition)
+// Returning returns the given columns of every deleted row.
+func (s *DeleteStatement) Returning(columns ...string) *DeleteStatement {
+	s.returning = columns
+	return s
+}
+
+// Build returns the statement.
+func (s *DeleteStatement) Build() Query {
+	b := builder{}
+	b.write(_DELETE_, _FROM_, s.table)
+	b.where(s.where)
+	b.returning(s.returning)
+
+	return b.build()
 }
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// row is a SQLWrite for tests.
+type row struct {
+	id   string
+	name string
+}
+
+func (r row) SQLGetName() string {
+	return "item"
+}
+
+func (r row) SQLGetFields() []string {
+	return []string{"id", "name"}
+}
+
+func (r row) SQLGetValues() []SQLValue {
+	return []SQLValue{r.id, r.name}
+}
+
+func TestSelect(t *testing.T) {
+	query := Select("path", "COUNT(*)").
+		From("document").
+		Join("collection", "collection.id = collection_id").
+		Where("($1 = '' OR collection_id = $1)", "c1").
+		Where("path > $1", "/a").
+		GroupBy("path").
+		OrderBy("path", "name DESC").
+		Limit(10).
+		Build()
+
+	assert.Equal(t, "SELECT path, COUNT(*) FROM document "+
+		"JOIN collection ON collection.id = collection_id "+
+		"WHERE (($1 = '' OR collection_id = $1)) AND (path > $2) "+
+		"GROUP BY path ORDER BY path, name DESC LIMIT $3", query.SQL)
+	assert.Equal(t, []any{"c1", "/a", 10}, query.Args)
+
+	query = Select().From("indexer").Where("id = $1", "i1").Build()
+	assert.Equal(t, "SELECT * FROM indexer WHERE id = $1", query.SQL)
+	assert.Equal(t, []any{"i1"}, query.Args)
+
+	query = Select("path").From("document").OrderBy("path").ForUpdate().
+		Build()
+	assert.Equal(t, "SELECT path FROM document ORDER BY path FOR UPDATE",
+		query.SQL)
+}
+
+func TestSelectWith(t *testing.T) {
+	terms := Select("word").From("unnest($1::text[]) AS word", "words")
+	matches := Select("path").
+		From("document").
+		JoinUsing("terms", "word").
+		Where("raw_text LIKE $1", "%a%")
+
+	query := Select("path").
+		With("terms", terms.Build()).
+		With("matches", matches.Build()).
+		From("matches").
+		LeftJoin("document", "document.path = matches.path").
+		Limit(5).
+		Build()
+
+	assert.Equal(t, "WITH terms AS "+
+		"(SELECT word FROM unnest($1::text[]) AS word), "+
+		"matches AS (SELECT path FROM document JOIN terms USING (word) "+
+		"WHERE raw_text LIKE $2) "+
+		"SELECT path FROM matches "+
+		"LEFT JOIN document ON document.path = matches.path LIMIT $3",
+		query.SQL)
+	assert.Equal(t, []any{"words", "%a%", 5}, query.Args)
+}
+
+func TestSubquery(t *testing.T) {
+	matching := Select("id").
+		From("collection").
+		Where("indexer_id = $1", "i1").
+		Build()
+
+	query := Delete("document").
+		Where("path <> $1", "/a").
+		Where("collection_id IN ("+matching.SQL+")", matching.Args...).
+		Returning("path").
+		Build()
+
+	assert.Equal(t, "DELETE FROM document WHERE (path <> $1) AND "+
+		"(collection_id IN (SELECT id FROM collection WHERE indexer_id = $2)) "+
+		"RETURNING path", query.SQL)
+	assert.Equal(t, []any{"/a", "i1"}, query.Args)
+}
+
+func TestUpdate(t *testing.T) {
+	query := Update("document").
+		Set("words", "{}").
+		SetExpr("word_count = word_count + $1", 2).
+		Where("path = $1", "/a").
+		Returning("path").
+		Build()
+
+	assert.Equal(t, "UPDATE document SET words = $1, "+
+		"word_count = word_count + $2 WHERE path = $3 RETURNING path",
+		query.SQL)
+	assert.Equal(t, []any{"{}", 2, "/a"}, query.Args)
+
+	assert.Panics(t, func() {
+		Update("document").Where("path = $1", "/a").Build()
+	})
+}
+
+func TestInsert(t *testing.T) {
+	query := Insert("item", "id", "name").
+		Values("1", "one").
+		Values("2", "two").
+		OnConflict("id").
+		DoNothing().
+		Build()
+
+	assert.Equal(t, "INSERT INTO item (id, name) VALUES ($1, $2), ($3, $4) "+
+		"ON CONFLICT (id) DO NOTHING", query.SQL)
+	assert.Equal(t, []any{"1", "one", "2", "two"}, query.Args)
+
+	assert.Panics(t, func() {
+		Insert("item", "id", "name").Values("1")
+	})
+}
+
+func TestUpsertObjects(t *testing.T) {
+	query := UpsertObjects(row{"1", "one"}, row{"2", "two"}).
+		Where("EXCLUDED.name <> item.name").
+		Returning("id", "(xmax = 0)").
+		Build()
+
+	assert.Equal(t, "INSERT INTO item (id, name) VALUES ($1, $2), ($3, $4) "+
+		"ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name "+
+		"WHERE EXCLUDED.name <> item.name RETURNING id, (xmax = 0)",
+		query.SQL)
+	assert.Equal(t, []any{"1", "one", "2", "two"}, query.Args)
+
+	query = UpsertFrom(row{}, "import").Build()
+	assert.Equal(t, "INSERT INTO item (id, name) SELECT id, name FROM import "+
+		"ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name", query.SQL)
+	assert.Empty(t, query.Args)
+}
+
+func TestMissingArgument(t *testing.T) {
+	assert.Panics(t, func() {
+		Select().From("document").Where("path = $2", "/a").Build()
+	})
+}
+
+func TestVersionsAsOf(t *testing.T) {
+	asOf := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	query := VersionsAsOf("document", asOf, "words")
+
+	assert.Equal(t, "WITH latest AS ("+
+		"SELECT DISTINCT ON (path) path, deleted, words FROM "+
+		"(SELECT path, last_indexed, words, NULL::timestamptz AS deleted "+
+		"FROM document WHERE last_indexed <= $1 UNION ALL "+
+		"SELECT path, last_indexed, words, deleted FROM document_revision "+
+		"WHERE last_indexed <= $1) AS version "+
+		"ORDER BY path, last_indexed DESC) "+
+		"SELECT path, words FROM latest "+
+		"WHERE deleted IS NULL OR deleted > $2", query.SQL)
+	assert.Equal(t, []any{asOf, asOf}, query.Args)
+}
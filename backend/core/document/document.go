@@ -1,7 +1,9 @@
 package document
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"seekourney/core/database"
@@ -20,6 +22,15 @@ type udoc = indexing.UnnormalizedDocument
 type Document struct {
 	udoc
 	LastIndexed time.Time
+
+	// LastSeen is when an indexer last sent the document, even if it was
+	// unchanged and not written. Documents not seen by a complete reindex
+	// of their collection are removed, see storage.Store.SweepCollection.
+	LastSeen time.Time
+
+	// Hash identifies the content the document was normalized from,
+	// see ContentHash. Empty if it is not known.
+	Hash string
 }
 
 // NewDocument creates a new docuemnt from the given values.
@@ -39,6 +50,7 @@ func NewDocument(
 			RawText:    text,
 		},
 		LastIndexed: lastIndexed,
+		LastSeen:    lastIndexed,
 	}
 }
 
@@ -55,6 +67,7 @@ func Normalize(
 		freqMap[k] += v
 	}
 
+	now := time.Now()
 	return Document{
 		udoc: udoc{
 			Path:       doc.Path,
@@ -62,11 +75,46 @@ func Normalize(
 			Words:      freqMap,
 			Collection: doc.Collection,
 			RawText:    doc.RawText,
+			Metadata:   doc.Metadata,
 		},
-		LastIndexed: time.Now(),
+		LastIndexed: now,
+		LastSeen:    now,
+		Hash:        ContentHash(doc),
 	}
 }
 
+// ContentHash returns a hash of everything an indexer sent for doc:
+// its text, words, collection, source and metadata.
+// Documents with the same hash are stored the same, unless the normalizer
+// was changed in between.
+func ContentHash(doc indexing.UnnormalizedDocument) string {
+	// Maps are encoded with sorted keys, so equal documents encode the same.
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		log.Printf("Error hashing document %s: %s", doc.Path, err)
+		return ""
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// Renormalize rebuilds the words of a stored document from its raw text,
+// using the provided normalizer. The raw text is tokenized the same way
+// indexers do it, so the result matches a fresh index of the same content.
+func Renormalize(doc Document, normalizer normalize.Normalizer) Document {
+	raw := doc.udoc
+	raw.Words = indexing.IndexString(doc.RawText)
+
+	renormalized := Normalize(raw, normalizer)
+	renormalized.LastIndexed = doc.LastIndexed
+	renormalized.LastSeen = doc.LastSeen
+	// The words are rebuilt from the text, not sent by an indexer.
+	renormalized.Hash = doc.Hash
+
+	return renormalized
+}
+
 // Misc
 
 // DebugPrint prints information about the document
@@ -118,7 +166,8 @@ func (doc Document) SQLGetName() string {
 	return "document"
 }
 
-// SQLGetFields returns the fields to be inserted into the database
+// SQLGetFields returns the fields to be inserted into the database.
+// The raw text is stored in its own table, it is not one of them.
 func (doc Document) SQLGetFields() []string {
 	return []string{
 		"path",
@@ -126,46 +175,92 @@ func (doc Document) SQLGetFields() []string {
 		"words",
 		"last_indexed",
 		"collection_id",
-		"raw_text",
+		"word_count",
+		"title",
+		"size",
+		"modified",
+		"mime_type",
+		"language",
+		"content_hash",
+		"last_seen",
 	}
 }
 
+// WordsJSON returns the words of the document encoded as JSON,
+// the format they are stored in in the database.
+func (doc Document) WordsJSON() ([]byte, error) {
+	return json.Marshal(doc.Words)
+}
+
 // SQLGetValues returns the values to be inserted into the database
 func (doc Document) SQLGetValues() []any {
 
-	bytes, err := json.Marshal(doc.Words)
+	bytes, err := doc.WordsJSON()
 
 	if err != nil {
 		log.Printf("Error marshalling dict: %s", err)
-		return []database.SQLValue{doc.Path, "file", nil}
+		return []database.SQLValue{doc.Path, doc.Source.String(), nil}
 	}
 
-	timeBytes, err := doc.LastIndexed.Local().MarshalJSON()
-	if err != nil {
-		log.Printf("Error marshalling time: %s", err)
-		return []database.SQLValue{doc.Path, "file", nil}
+	// An unknown modification time is stored as NULL.
+	modified := sql.NullTime{
+		Time:  doc.Modified,
+		Valid: !doc.Modified.IsZero(),
 	}
 
 	return []database.SQLValue{
 		doc.Path,
-		"file",
+		doc.Source.String(),
 		bytes,
-		timeBytes,
+		doc.LastIndexed,
 		doc.Collection,
-		doc.RawText,
+		doc.GetWordCount(),
+		doc.Title,
+		doc.Size,
+		modified,
+		doc.MIMEType,
+		doc.Language,
+		doc.Hash,
+		doc.LastSeen,
 	}
 }
 
-// SQLScan scans a row from the database into a Document
+// SQLScan scans a row from the database into a Document.
+// The raw text is stored apart from the row, it is left empty.
 func (doc Document) SQLScan(rows *sql.Rows) (Document, error) {
 	var path utils.Path
-	var source string
+	var sourceName string
 	var words []byte
-	var timeBytes []byte
+	var lastIndexed time.Time
 	var collectionID indexing.CollectionID
-	var text string
+	// Stored so the database can score documents,
+	// in Go it is calculated from the words, see GetWordCount.
+	var wordCount int
+	var metadata utils.Metadata
+	var modified sql.NullTime
+	var hash string
+	var lastSeen time.Time
+
+	err := rows.Scan(
+		&path,
+		&sourceName,
+		&words,
+		&lastIndexed,
+		&collectionID,
+		&wordCount,
+		&metadata.Title,
+		&metadata.Size,
+		&modified,
+		&metadata.MIMEType,
+		&metadata.Language,
+		&hash,
+		&lastSeen,
+	)
+	if err != nil {
+		return Document{}, err
+	}
 
-	err := rows.Scan(&path, &source, &words, &timeBytes, &collectionID, &text)
+	source, err := utils.ParseSource(sourceName)
 	if err != nil {
 		return Document{}, err
 	}
@@ -178,22 +273,21 @@ func (doc Document) SQLScan(rows *sql.Rows) (Document, error) {
 		return Document{}, err
 	}
 
-	var lastIndexed time.Time
-	err = lastIndexed.UnmarshalJSON(timeBytes)
-	if err != nil {
-		log.Printf("Error unmarshalling time: %s", err)
-		return Document{}, err
+	if modified.Valid {
+		metadata.Modified = modified.Time
 	}
 
 	return Document{
 		udoc: udoc{
 			Path:       path,
-			Source:     utils.SOURCE_LOCAL,
+			Source:     source,
 			Words:      freqMap,
 			Collection: collectionID,
-			RawText:    text,
+			Metadata:   metadata,
 		},
 		LastIndexed: lastIndexed,
+		LastSeen:    lastSeen,
+		Hash:        hash,
 	}, nil
 }
 
@@ -214,68 +308,3 @@ func (doc *Document) CalculateTf(word utils.Word) float64 {
 	return float64(freq) / float64(doc.GetWordCount())
 
 }
-
-// UpdateDB updates the document in the database
-func (doc *Document) UpdateDB(db *sql.DB) error {
-
-	pairs := []string{}
-	// Skip the first one, it's the path/primary key
-	q1 := database.Update("document").Set(pairs[1:]...)
-	query := q1.Where("path=$1")
-
-	log.Printf("Update query: %s", string(query))
-
-	_, err := db.Exec(
-		string(query),
-		doc.Path,
-	)
-
-	return err
-}
-
-// DocumentFromDB retrieves a document from the database
-func DocumentFromDB(db *sql.DB, path utils.Path) (Document, error) {
-
-	var doc Document
-
-	q1 := database.Select().Queries(doc.SQLGetFields()...)
-	query := q1.From("document").Where("path = $1")
-
-	insert := func(res *Document, doc Document) {
-		*res = doc
-	}
-
-	err := database.ExecScan(
-		db,
-		string(query),
-		&doc,
-		insert,
-		path,
-	)
-
-	return doc, err
-
-}
-
-// DocumentExsitsDB checks if a document exists in the database
-func DocumentExsitsDB(db *sql.DB, path utils.Path) (bool, error) {
-
-	// TODO: A better way to do this
-
-	doc, err := DocumentFromDB(db, path)
-	if err != nil {
-		return false, err
-	}
-
-	if doc.Path == "" {
-		return false, nil
-	}
-
-	if doc.Path != path {
-		// This should never happen
-		log.Panicf("Document path mismatch: %s != %s", doc.Path, path)
-	}
-
-	return true, nil
-
-}
@@ -0,0 +1,66 @@
+package document
+
+import (
+	"seekourney/indexing"
+	"seekourney/utils"
+	"seekourney/utils/normalize"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenormalize(t *testing.T) {
+	lastIndexed := time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC)
+	doc := NewDocument(
+		"/some/path",
+		utils.SOURCE_LOCAL,
+		utils.FrequencyMap{"Running": 1, "Runs": 1},
+		"1",
+		"Running runs",
+		lastIndexed,
+	)
+	doc.Title = "Running"
+	doc.Language = "en"
+
+	stemmed := Renormalize(doc, normalize.STEMMING)
+	assert.Equal(t, utils.FrequencyMap{"run": 2}, stemmed.Words)
+	assert.Equal(t, doc.RawText, stemmed.RawText)
+	assert.Equal(t, lastIndexed, stemmed.LastIndexed)
+	assert.Equal(t, doc.Metadata, stemmed.Metadata)
+	assert.Equal(t, doc.Hash, stemmed.Hash)
+
+	lowered := Renormalize(stemmed, normalize.TO_LOWER)
+	assert.Equal(
+		t,
+		utils.FrequencyMap{"running": 1, "runs": 1},
+		lowered.Words,
+	)
+}
+
+func TestContentHash(t *testing.T) {
+	raw := indexing.DocFromText("/a", utils.SOURCE_LOCAL, "1", "Some text")
+	hash := ContentHash(raw)
+	assert.Len(t, hash, 64)
+
+	// Maps are hashed the same whatever order they were filled in.
+	again := indexing.DocFromText("/a", utils.SOURCE_LOCAL, "1", "Some text")
+	assert.Equal(t, hash, ContentHash(again))
+	assert.Equal(t, hash, Normalize(raw, normalize.TO_LOWER).Hash)
+
+	changes := []func(doc *indexing.UnnormalizedDocument){
+		func(doc *indexing.UnnormalizedDocument) { doc.RawText = "Other" },
+		func(doc *indexing.UnnormalizedDocument) { doc.Words["new"] = 1 },
+		func(doc *indexing.UnnormalizedDocument) { doc.Collection = "2" },
+		func(doc *indexing.UnnormalizedDocument) { doc.Title = "Title" },
+		func(doc *indexing.UnnormalizedDocument) {
+			doc.Modified = time.Now()
+		},
+	}
+	for i, change := range changes {
+		changed := indexing.DocFromText(
+			"/a", utils.SOURCE_LOCAL, "1", "Some text")
+		change(&changed)
+		assert.NotEqual(t, hash, ContentHash(changed), i)
+	}
+}
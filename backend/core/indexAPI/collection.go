@@ -30,6 +30,9 @@ type UnregisteredCollection struct {
 
 	// What function to normalize all documents with
 	Normalfunc normalize.Normalizer
+
+	// Number of previous versions kept of every document, see revision
+	Revisions int
 }
 
 // Collection is a struct that represents a collection of documents.
@@ -56,6 +59,7 @@ func (col Collection) SQLGetFields() []string {
 		"source_type",
 		"respect_last_modified",
 		"normalizer",
+		"revisions",
 	}
 }
 
@@ -70,6 +74,7 @@ func (col Collection) SQLGetValues() []any {
 		indexing.SourceTypeToStr(col.SourceType),
 		col.RespectLastModified,
 		col.Normalfunc,
+		col.Revisions,
 	}
 }
 
@@ -82,6 +87,7 @@ func (col Collection) SQLScan(rows *sql.Rows) (Collection, error) {
 	var sourceType string
 	var respectLastModified bool
 	var normalizer normalize.Normalizer
+	var revisions int
 
 	err := rows.Scan(
 		&id,
@@ -91,6 +97,7 @@ func (col Collection) SQLScan(rows *sql.Rows) (Collection, error) {
 		&sourceType,
 		&respectLastModified,
 		&normalizer,
+		&revisions,
 	)
 	if err != nil {
 		return Collection{}, err
@@ -110,43 +117,65 @@ func (col Collection) SQLScan(rows *sql.Rows) (Collection, error) {
 			Recursive:           recursive,
 			RespectLastModified: respectLastModified,
 			Normalfunc:          normalizer,
+			Revisions:           revisions,
 		},
 		id,
 	}, nil
 
 }
 
-// CollectionFromDB returns a Collection from the database, with the given ID.
-func CollectionFromDB(
-	db *sql.DB,
-	id indexing.CollectionID,
-) (Collection, error) {
-	var colloction Collection
+// CollectionStore stores registered collections, see storage.Store.
+type CollectionStore interface {
+	// Collection returns the collection with the given ID,
+	// or an error if there is none.
+	Collection(id indexing.CollectionID) (Collection, error)
 
-	q1 := database.Select().QueryAll()
-	query := q1.From(colloction.SQLGetName()).Where("id = $1")
+	// InsertCollection stores a new collection, its ID must be unused,
+	// and its indexer must be stored.
+	InsertCollection(collection Collection) error
 
-	insert := func(res *Collection, col Collection) {
-		*res = col
-	}
+	// UpdateCollection replaces the stored collection with the same ID,
+	// its indexer must be stored.
+	UpdateCollection(collection Collection) error
+}
 
-	err := database.ExecScan(
-		db,
-		string(query),
-		&colloction,
-		insert,
-		id,
-	)
+// UpdatePlan is the work needed to make the stored documents of a collection
+// match its new settings, see PlanUpdate.
+type UpdatePlan struct {
+	// Reindex is true if the collection must be indexed again.
+	Reindex bool
+
+	// RemoveUnseen is true if stored documents may no longer belong to the
+	// collection. They are kept until it is indexed again, which removes
+	// those it does not find, see sweep.
+	RemoveUnseen bool
+}
+
+// PlanUpdate decides what work is needed when old is replaced by updated.
+// Changing where or how documents are found needs a reindex.
+// RespectLastModified only affects later reindexing, and Revisions later
+// changes. The normalizer is the same for every collection, see
+// renormalize.
+func PlanUpdate(old Collection, updated Collection) UpdatePlan {
+	var plan UpdatePlan
+
+	// Documents outside the new path, from another indexer or source,
+	// or in subdirectories no longer indexed would be left behind.
+	plan.RemoveUnseen = old.Path != updated.Path ||
+		old.IndexerID != updated.IndexerID ||
+		old.SourceType != updated.SourceType ||
+		(old.Recursive && !updated.Recursive)
 
-	return colloction, err
+	plan.Reindex = plan.RemoveUnseen || old.Recursive != updated.Recursive
 
+	return plan
 }
 
 // TODO move to better place
 // RegisterCollection creates a Collection from an UnregisteredCollection
 // and adds it to the database, making it available to index.
 func RegisterCollection(
-	db *sql.DB,
+	store CollectionStore,
 	ureqCol UnregisteredCollection,
 ) (Collection, error) {
 	id := database.GenerateId()
@@ -155,7 +184,7 @@ func RegisterCollection(
 		ID:                     indexing.CollectionID(id),
 	}
 
-	_, err := database.InsertInto(db, collection)
+	err := store.InsertCollection(collection)
 	if err != nil {
 		log.Printf("Error inserting collection: %s", err)
 		return Collection{}, err
@@ -0,0 +1,76 @@
+package indexAPI
+
+import (
+	"seekourney/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(collection *Collection)
+		plan   UpdatePlan
+	}{
+		{
+			"Nothing",
+			func(collection *Collection) {},
+			UpdatePlan{},
+		},
+		{
+			"RespectLastModified",
+			func(collection *Collection) {
+				collection.RespectLastModified = true
+			},
+			UpdatePlan{},
+		},
+		{
+			"Path",
+			func(collection *Collection) {
+				collection.Path = "/other/path"
+			},
+			UpdatePlan{Reindex: true, RemoveUnseen: true},
+		},
+		{
+			"Indexer",
+			func(collection *Collection) {
+				collection.IndexerID = "other"
+			},
+			UpdatePlan{Reindex: true, RemoveUnseen: true},
+		},
+		{
+			"SourceType",
+			func(collection *Collection) {
+				collection.SourceType = utils.DIR_SOURCE
+			},
+			UpdatePlan{Reindex: true, RemoveUnseen: true},
+		},
+		{
+			"Recursive",
+			func(collection *Collection) {
+				collection.Recursive = true
+			},
+			UpdatePlan{Reindex: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated := makeTestCollection()
+			test.change(&updated)
+
+			plan := PlanUpdate(makeTestCollection(), updated)
+			assert.Equal(t, test.plan, plan)
+		})
+	}
+
+	// Fewer subdirectories leave documents behind.
+	old := makeTestCollection()
+	old.Recursive = true
+	assert.Equal(
+		t,
+		UpdatePlan{Reindex: true, RemoveUnseen: true},
+		PlanUpdate(old, makeTestCollection()),
+	)
+}
@@ -1,12 +1,11 @@
 package indexAPI
 
 import (
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"log"
+	"net/url"
 	"os/exec"
-	"seekourney/core/database"
 	"seekourney/indexing"
 	"seekourney/utils"
 	"sync"
@@ -19,6 +18,7 @@ const (
 	_PING_          string        = "ping"
 	_SHUTDOWN_      string        = "shutdown"
 	_INDEX_         string        = "index"
+	_CANCEL_        string        = "cancel"
 	_SHORTTIMEOUT_  time.Duration = 2 * time.Second
 	_MEDIUMTIMEOUT_ time.Duration = 5 * time.Second
 )
@@ -38,10 +38,18 @@ type DispatchErrors struct {
 }
 
 // RunningIndexer is a struct that represents an indexer running on the system.
+// Create it with newRunningIndexer.
 type RunningIndexer struct {
 	ID   IndexerID
 	Exec *exec.Cmd
 	Port utils.Port
+
+	// stderr holds the end of what the indexer wrote to stderr, if captured.
+	stderr *stderrTail
+
+	// exited is closed when the process has exited, with exitErr.
+	exited  chan struct{}
+	exitErr error
 }
 
 // GetRequestJSON sends a GET request to the indexer and returns the response
@@ -83,10 +91,11 @@ func PostRequest(
 	return utils.PostRequest(body, _ENDPOINTPREFIX_, indexer.Port, urlPath...)
 }
 
-// Wait waits for the indexer to finish executing.
+// Wait waits for the indexer to finish executing, and returns its exit error.
 // It also synchronizes stdout and stderr output
 func (indexer *RunningIndexer) Wait() error {
-	return indexer.Exec.Wait()
+	<-indexer.exited
+	return indexer.exitErr
 }
 
 // IndexHandler keeps track of all indexers running on the system and
@@ -96,14 +105,35 @@ type IndexHandler struct {
 	Mutex    sync.Mutex
 	Indexers map[IndexerID]*RunningIndexer
 
+	// StartupTimeout is how long an indexer may take to answer pings once
+	// started, see DEFAULTSTARTUPTIMEOUT.
+	StartupTimeout time.Duration
+
+	// LogDir is the directory where the output of every indexer is
+	// appended to a file named after its ID, see OutputLog.
+	// If empty, output is only kept in memory.
+	LogDir string
+
+	// OnDown is called when an indexer started by the handler is marked
+	// crashed or stopped, with the reason, since it no longer works on the
+	// jobs dispatched to it. It is called in its own goroutine, if set.
+	OnDown func(id IndexerID, reason error)
+
+	// supervised holds the health of the indexers started by the handler,
+	// it has its own mutex so it can be read while indexers start.
+	healthMutex sync.Mutex
+	supervised  map[IndexerID]*supervisedIndexer
+
 	// TODO: Keep track of re indexing timers
 }
 
 // NewIndexHandler creates a new empty Indexhandler.
 func NewIndexHandler() IndexHandler {
 	return IndexHandler{
-		Mutex:    sync.Mutex{},
-		Indexers: map[IndexerID]*RunningIndexer{},
+		Mutex:          sync.Mutex{},
+		Indexers:       map[IndexerID]*RunningIndexer{},
+		StartupTimeout: DEFAULTSTARTUPTIMEOUT,
+		supervised:     map[IndexerID]*supervisedIndexer{},
 	}
 }
 
@@ -120,7 +150,7 @@ func newDispatchErrors() DispatchErrors {
 /*
 // DispatchReindex requests reindexing of a document
 func (handler *IndexHandler) DispatchReindex(
-	db *sql.DB,
+	store IndexerStore,
 	path utils.Path,
 ) error {
 	// get doc, get collection from db
@@ -131,10 +161,13 @@ func (handler *IndexHandler) DispatchReindex(
 */
 
 // Dispatch requests indexing of a collection from the assigned
-// indexer of the collection.
+// indexer of the collection, which reports its progress against job.
+// An indexer that does not answer is started, or waited for if it is
+// starting already, see StartIndexer. The mutex must not be held.
 func (handler *IndexHandler) Dispatch(
 	indexer IndexerData,
 	collection Collection,
+	job indexing.JobID,
 ) DispatchErrors {
 	errs := newDispatchErrors()
 
@@ -147,6 +180,7 @@ func (handler *IndexHandler) Dispatch(
 		CollectionID: collection.ID,
 		Recursive:    collection.Recursive,
 		Parrallel:    false,
+		JobID:        job,
 	}
 
 	test, err := json.MarshalIndent(settings, "", "  ")
@@ -165,7 +199,11 @@ func (handler *IndexHandler) Dispatch(
 	if err != nil {
 		// Indexer wasn't running, start it.
 		errs.IndexerWasRunning = false
-		running, err := indexer.start()
+		handler.Mutex.Lock()
+		handler.reap()
+		handler.Mutex.Unlock()
+
+		err = handler.ensureStarted(indexer)
 		if err != nil {
 			errs.StartupAttempt = err
 			errs.DispatchAttempt = errors.New(
@@ -173,8 +211,6 @@ func (handler *IndexHandler) Dispatch(
 			return errs
 		}
 
-		handler.Indexers[indexer.ID] = running
-
 		secondBody := utils.JsonBody(settings)
 		// Try indexing request again.
 		resp, err = utils.PostRequestJSON[IndexerResponse](
@@ -183,8 +219,10 @@ func (handler *IndexHandler) Dispatch(
 			indexer.Port,
 			_INDEX_,
 		)
-		// Should never fail since startup successful.
-		utils.PanicOnError(err)
+		if err != nil {
+			errs.DispatchAttempt = err
+			return errs
+		}
 	}
 
 	if resp.Status != indexing.STATUSSUCCESSFUL {
@@ -199,80 +237,49 @@ func (handler *IndexHandler) Dispatch(
 
 // DispatchFromCollection is a wrapper for Dispatch and fetches the
 // indexer assigned to collection from database before requesting indexing.
+// The mutex must not be held.
 func (handler *IndexHandler) DispatchFromCollection(
-	db *sql.DB,
+	store IndexerStore,
 	collection Collection,
+	job indexing.JobID,
 ) DispatchErrors {
-
-	insert := func(res *IndexerData, indexer IndexerData) {
-		*res = indexer
+	indexer, err := store.Indexer(collection.IndexerID)
+	if err != nil {
+		errs := newDispatchErrors()
+		errs.DispatchAttempt = err
+		return errs
 	}
 
-	indexerID := collection.IndexerID
-
-	q := database.Select().QueryAll().From("indexer").Where("id = $1")
-	var indexer IndexerData
-	err := database.ExecScan(db, string(q), &indexer, insert, indexerID)
-	utils.PanicOnError(err)
-
-	return handler.Dispatch(indexer, collection)
+	return handler.Dispatch(indexer, collection, job)
 }
 
 // DispatchFromID is a wrapper for DispatchFromCollection and fetches the
 // collection from the associated ID from database before requesting indexing.
 func (handler *IndexHandler) DispatchFromID(
-	db *sql.DB,
+	store IndexerStore,
 	id indexing.CollectionID,
+	job indexing.JobID,
 ) DispatchErrors {
 	// TODO get collection from database
 	collection := Collection{}
 
-	return handler.DispatchFromCollection(db, collection)
+	return handler.DispatchFromCollection(store, collection, job)
 }
 
-// ForceShutdownAll tries to kill all running indexers
-func (handler *IndexHandler) ForceShutdownAll() {
-	handler.Mutex.Lock()
-	for _, indexer := range handler.Indexers {
-		err := indexer.Exec.Process.Kill()
-		if err != nil {
-			log.Println(err)
-		} else {
-			log.Printf("Killed indexer %s", indexer.ID)
-		}
-	}
-	handler.Mutex.Unlock()
-}
-
-/* TODO: Reimplement old functions
-
-// shutdownIndexerGraceful requests shutdown of the process
-// associated with the indexer info, through the indexing API.
-// If graceful shutdown fails, the original (single) indexer
-// process will be killed, and non-nil error returned.
-func shutdownIndexerGraceful(info IndexerInfo) error {
-	client := http.Client{
-		Timeout: _SHORTTIMEOUT_,
-	}
-	resp, err := client.Get(string(info.endpoint) + _SHUTDOWN_)
-	if err != nil {
-		return err
-	}
-	defer closeResponse(resp)
-
-	parsedResp, err := parseResponse(resp)
+// CancelJob asks indexer to stop sending documents of job,
+// see indexing.Context.Cancelled.
+func CancelJob(indexer IndexerData, job indexing.JobID) error {
+	resp, err := utils.GetRequestJSON[IndexerResponse](
+		_ENDPOINTPREFIX_,
+		indexer.Port,
+		_CANCEL_+"?job="+url.QueryEscape(string(job)),
+	)
 	if err != nil {
 		return err
 	}
-	if parsedResp.Status != indexing.STATUSSUCCESSFUL ||
-		parsedResp.Data.Message != indexing.MESSAGEEXITING {
-		defer carelessShutdown(info)
-		return errors.New("JSON response to indexer shutdown request failed" +
-			" to match expected format")
+	if resp.Status != indexing.STATUSSUCCESSFUL {
+		return errors.New("indexer failed to cancel job: " + resp.Data.Message)
 	}
 
-	info.cmd.WaitDelay = _MEDIUMTIMEOUT_
-	// Kills process if wait timed out and returns error.
-	return info.cmd.Wait()
+	return nil
 }
-*/
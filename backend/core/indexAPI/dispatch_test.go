@@ -1,6 +1,8 @@
 package indexAPI
 
 import (
+	"errors"
+	"os/exec"
 	"seekourney/indexing"
 	"seekourney/utils"
 	"seekourney/utils/normalize"
@@ -171,7 +173,7 @@ func TestDispatchSuccessIsRunning(t *testing.T) {
 		JSON(indexing.ResponseSuccess(""))
 
 	handler := NewIndexHandler()
-	errs := handler.Dispatch(makeTestIndexerData(), makeTestCollection())
+	errs := handler.Dispatch(makeTestIndexerData(), makeTestCollection(), "")
 	assert.True(t, gock.IsDone())
 
 	assert.True(t, errs.IndexerWasRunning)
@@ -197,7 +199,7 @@ func TestDispatchSuccessNotRunning(t *testing.T) {
 		JSON(indexing.ResponseSuccess(""))
 
 	handler := NewIndexHandler()
-	errs := handler.Dispatch(makeTestIndexerData(), makeTestCollection())
+	errs := handler.Dispatch(makeTestIndexerData(), makeTestCollection(), "")
 	assert.True(t, gock.IsDone())
 
 	assert.False(t, errs.IndexerWasRunning)
@@ -219,7 +221,7 @@ func TestDispatchStartupFail(t *testing.T) {
 		JSON(indexing.ResponseFail("failed to startup indexer"))
 
 	handler := NewIndexHandler()
-	errs := handler.Dispatch(makeTestIndexerData(), makeTestCollection())
+	errs := handler.Dispatch(makeTestIndexerData(), makeTestCollection(), "")
 	assert.True(t, gock.IsDone())
 
 	assert.False(t, errs.IndexerWasRunning)
@@ -237,7 +239,7 @@ func TestDispatchIndexFail(t *testing.T) {
 		JSON(indexing.ResponseFail("unable to fulfill indexing request"))
 
 	handler := NewIndexHandler()
-	errs := handler.Dispatch(makeTestIndexerData(), makeTestCollection())
+	errs := handler.Dispatch(makeTestIndexerData(), makeTestCollection(), "")
 	assert.True(t, gock.IsDone())
 
 	assert.True(t, errs.IndexerWasRunning)
@@ -246,3 +248,128 @@ func TestDispatchIndexFail(t *testing.T) {
 	// Indexer was not added to running indexers map.
 	assert.Equal(t, len(handler.Indexers), 0)
 }
+
+func TestDispatchWaitsForStart(t *testing.T) {
+	defer gock.Off()
+	gock.New(string(_TESTURI_)).
+		Post(_SLASHINDEX_).
+		Reply(500).
+		JSON("")
+	gock.New(string(_TESTURI_)).
+		Post(_SLASHINDEX_).
+		Reply(200).
+		JSON(indexing.ResponseSuccess(""))
+
+	// Being restarted by the supervisor.
+	handler := NewIndexHandler()
+	started := make(chan struct{})
+	handler.supervised[_TESTINDEXERID_] = &supervisedIndexer{
+		data:    makeTestIndexerData(),
+		health:  IndexerHealth{State: STATESTARTING, Healthy: true},
+		output:  newOutputLog(_LOGLINES_, ""),
+		started: started,
+	}
+
+	dispatched := make(chan DispatchErrors)
+	go func() {
+		dispatched <- handler.Dispatch(
+			makeTestIndexerData(),
+			makeTestCollection(),
+			"",
+		)
+	}()
+
+	handler.healthMutex.Lock()
+	handler.supervised[_TESTINDEXERID_].health.State = STATERUNNING
+	handler.healthMutex.Unlock()
+	close(started)
+
+	errs := <-dispatched
+	assert.True(t, gock.IsDone())
+	assert.False(t, errs.IndexerWasRunning)
+	assert.NoError(t, errs.StartupAttempt)
+	assert.NoError(t, errs.DispatchAttempt)
+}
+
+func TestDispatchSecondRequestFail(t *testing.T) {
+	defer gock.Off()
+	gock.New(string(_TESTURI_)).
+		Post(_SLASHINDEX_).
+		Times(2).
+		Reply(500).
+		JSON("")
+	gock.New(string(_TESTURI_)).
+		Get(_PING_).
+		Reply(200).
+		JSON(indexing.ResponsePing())
+
+	handler := NewIndexHandler()
+	errs := handler.Dispatch(makeTestIndexerData(), makeTestCollection(), "")
+	assert.True(t, gock.IsDone())
+
+	assert.False(t, errs.IndexerWasRunning)
+	assert.NoError(t, errs.StartupAttempt)
+	assert.Error(t, errs.DispatchAttempt)
+}
+
+func TestDispatchFromCollectionMissing(t *testing.T) {
+	handler := NewIndexHandler()
+	errs := handler.DispatchFromCollection(
+		missingIndexerStore{},
+		makeTestCollection(),
+		"",
+	)
+
+	assert.NoError(t, errs.StartupAttempt)
+	assert.Error(t, errs.DispatchAttempt)
+}
+
+// missingIndexerStore is an IndexerStore without any indexer.
+type missingIndexerStore struct {
+	IndexerStore
+}
+
+func (missingIndexerStore) Indexer(id IndexerID) (IndexerData, error) {
+	return IndexerData{}, errors.New("indexer " + string(id) + " not found")
+}
+
+func TestStopIndexerNotRunning(t *testing.T) {
+	handler := NewIndexHandler()
+	assert.NoError(t, handler.StopIndexer(_TESTINDEXERID_))
+}
+
+func TestStopIndexerKill(t *testing.T) {
+	// Nothing answers on the port, so the process is killed.
+	cmd := exec.Command("sleep", "60")
+	assert.NoError(t, cmd.Start())
+
+	handler := NewIndexHandler()
+	handler.Indexers[_TESTINDEXERID_] = newRunningIndexer(
+		_TESTINDEXERID_,
+		cmd,
+		_TESTPORT_,
+		nil,
+	)
+
+	assert.NoError(t, handler.StopIndexer(_TESTINDEXERID_))
+	assert.NotNil(t, cmd.ProcessState)
+	assert.Empty(t, handler.Indexers)
+}
+
+func TestCancelJob(t *testing.T) {
+	defer gock.Off()
+	gock.New(string(_TESTURI_)).
+		Get("/"+_CANCEL_).
+		MatchParam("job", "j1").
+		Reply(200).
+		JSON(indexing.ResponseSuccess(""))
+	gock.New(string(_TESTURI_)).
+		Get("/"+_CANCEL_).
+		MatchParam("job", "j2").
+		Reply(200).
+		JSON(indexing.ResponseFail("unknown job"))
+
+	assert.NoError(t, CancelJob(makeTestIndexerData(), "j1"))
+	assert.Error(t, CancelJob(makeTestIndexerData(), "j2"))
+	assert.True(t, gock.IsDone())
+}
@@ -0,0 +1,174 @@
+package indexAPI
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"seekourney/indexing"
+	"slices"
+	"sync"
+	"time"
+)
+
+// StartIndexer starts indexer if it is not running, and waits until it is
+// ready, see IndexerData.start. An indexer started outside of the handler
+// that answers pings is left as it is, and one being started already, such
+// as by the supervisor, is waited for. The mutex is not held while waiting.
+func (handler *IndexHandler) StartIndexer(indexer IndexerData) error {
+	handler.Mutex.Lock()
+	handler.reap()
+	_, ok := handler.Indexers[indexer.ID]
+	handler.Mutex.Unlock()
+	if ok {
+		return nil
+	}
+
+	resp, err := ping(indexer.Port)
+	if err == nil && resp.Status == indexing.STATUSSUCCESSFUL &&
+		resp.Data.Message == indexing.MESSAGEPONG {
+		log.Printf("Indexer %s is already running outside of Core", indexer.ID)
+		return nil
+	}
+
+	return handler.ensureStarted(indexer)
+}
+
+// ensureStarted starts indexer, or waits until it has started if it is
+// being started already, see waitStarted. The mutex must not be held.
+func (handler *IndexHandler) ensureStarted(indexer IndexerData) error {
+	running, err := handler.startSupervised(indexer)
+	if errors.Is(err, errAlreadyStarted) {
+		return handler.waitStarted(indexer.ID)
+	}
+	if err != nil {
+		return err
+	}
+	handler.install(running)
+
+	return nil
+}
+
+// install adds running to the indexers started by the handler,
+// once it has started without the mutex held.
+func (handler *IndexHandler) install(running *RunningIndexer) {
+	handler.Mutex.Lock()
+	defer handler.Mutex.Unlock()
+
+	handler.Indexers[running.ID] = running
+}
+
+// StopIndexer shuts down an indexer started by the handler, by asking it to
+// exit through the indexing API, and killing it if it does not exit within
+// _MEDIUMTIMEOUT_. Does nothing if the indexer is not running.
+func (handler *IndexHandler) StopIndexer(id IndexerID) error {
+	handler.Mutex.Lock()
+	running, ok := handler.Indexers[id]
+	delete(handler.Indexers, id)
+	handler.stopped(id)
+	handler.Mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return running.stop()
+}
+
+// ShutdownAll stops every indexer started by the handler at once,
+// see StopIndexer, and returns when all have exited and their log files
+// are closed.
+func (handler *IndexHandler) ShutdownAll() {
+	handler.Mutex.Lock()
+	indexers := handler.Indexers
+	handler.Indexers = map[IndexerID]*RunningIndexer{}
+	handler.healthMutex.Lock()
+	for id, supervised := range handler.supervised {
+		handler.markStopped(id, supervised)
+	}
+	handler.healthMutex.Unlock()
+	handler.Mutex.Unlock()
+
+	var group sync.WaitGroup
+	for _, running := range indexers {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+
+			err := running.stop()
+			if err != nil {
+				log.Printf("Error stopping indexer %s: %s", running.ID, err)
+			}
+		}()
+	}
+	group.Wait()
+
+	handler.healthMutex.Lock()
+	defer handler.healthMutex.Unlock()
+	for id, supervised := range handler.supervised {
+		err := supervised.output.Close()
+		if err != nil {
+			log.Printf("Error closing log of indexer %s: %s", id, err)
+		}
+	}
+}
+
+// Running returns the IDs of the indexers started by the handler
+// that have not exited, ordered.
+func (handler *IndexHandler) Running() []IndexerID {
+	handler.Mutex.Lock()
+	defer handler.Mutex.Unlock()
+
+	handler.reap()
+
+	ids := make([]IndexerID, 0, len(handler.Indexers))
+	for id := range handler.Indexers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return ids
+}
+
+// reap forgets the indexers whose process has exited on its own,
+// and marks them as crashed, see Supervise. The mutex must be held.
+func (handler *IndexHandler) reap() {
+	for id, running := range handler.Indexers {
+		if running.hasExited() {
+			log.Printf("Indexer %s exited: %v", id, running.exitErr)
+			delete(handler.Indexers, id)
+			handler.crashed(
+				id,
+				fmt.Errorf("indexer exited: %v", running.exitErr),
+			)
+		}
+	}
+}
+
+// hasExited returns true if the process of the indexer has exited.
+func (indexer *RunningIndexer) hasExited() bool {
+	select {
+	case <-indexer.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop asks the indexer to exit through the indexing API, and kills it if
+// it does not answer that it is exiting, or does not exit within
+// _MEDIUMTIMEOUT_.
+func (indexer *RunningIndexer) stop() error {
+	resp, err := GetRequestJSON[IndexerResponse](indexer, _SHUTDOWN_)
+	if err == nil && resp.Status == indexing.STATUSSUCCESSFUL &&
+		resp.Data.Message == indexing.MESSAGEEXITING {
+		select {
+		case <-indexer.exited:
+			log.Printf("Stopped indexer %s", indexer.ID)
+			return nil
+		case <-time.After(_MEDIUMTIMEOUT_):
+		}
+	}
+
+	log.Printf("Indexer %s did not shut down, killing it", indexer.ID)
+	return indexer.kill()
+}
@@ -0,0 +1,156 @@
+package indexAPI
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startProcess starts command with sh as an indexer on port.
+func startProcess(
+	t *testing.T,
+	command string,
+	port utils.Port,
+) *RunningIndexer {
+	cmd := exec.Command("sh", "-c", command)
+	assert.NoError(t, cmd.Start())
+	return newRunningIndexer(_TESTINDEXERID_, cmd, port, nil)
+}
+
+// serveIndexer answers indexer requests on port with handler,
+// until the test ends.
+func serveIndexer(t *testing.T, port utils.Port, handler http.HandlerFunc) {
+	server := &http.Server{
+		Addr:    fmt.Sprintf("localhost:%d", port),
+		Handler: handler,
+	}
+	go func() {
+		err := server.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			assert.NoError(t, err)
+		}
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, server.Close())
+	})
+
+	// Wait until the server listens.
+	for range 100 {
+		_, err := ping(port)
+		if err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStopIndexerGraceful(t *testing.T) {
+	port := freePort(t)
+	running := startProcess(t, "exec sleep 60", port)
+
+	serveIndexer(t, port,
+		func(writer http.ResponseWriter, request *http.Request) {
+			if request.URL.Path != "/"+_SHUTDOWN_ {
+				_, err := writer.Write(indexing.ResponsePing())
+				assert.NoError(t, err)
+				return
+			}
+			_, err := writer.Write(indexing.ResponseExiting())
+			assert.NoError(t, err)
+			// The indexer exits on its own after answering.
+			assert.NoError(t, running.Exec.Process.Kill())
+		},
+	)
+
+	handler := NewIndexHandler()
+	handler.Indexers[_TESTINDEXERID_] = running
+
+	started := time.Now()
+	assert.NoError(t, handler.StopIndexer(_TESTINDEXERID_))
+	assert.Less(t, time.Since(started), _MEDIUMTIMEOUT_)
+	assert.True(t, running.hasExited())
+	assert.Empty(t, handler.Indexers)
+}
+
+func TestStopIndexerRefused(t *testing.T) {
+	port := freePort(t)
+	running := startProcess(t, "exec sleep 60", port)
+
+	serveIndexer(t, port,
+		func(writer http.ResponseWriter, request *http.Request) {
+			_, err := writer.Write(indexing.ResponseFail("busy"))
+			assert.NoError(t, err)
+		},
+	)
+
+	handler := NewIndexHandler()
+	handler.Indexers[_TESTINDEXERID_] = running
+
+	// Not waiting for an exit that is not coming.
+	started := time.Now()
+	assert.NoError(t, handler.StopIndexer(_TESTINDEXERID_))
+	assert.Less(t, time.Since(started), _MEDIUMTIMEOUT_)
+	assert.True(t, running.hasExited())
+}
+
+func TestStartIndexerFails(t *testing.T) {
+	handler := NewIndexHandler()
+	indexer := testIndexer("exit 3", freePort(t))
+
+	assert.ErrorContains(t, handler.StartIndexer(indexer), "exited")
+	assert.Empty(t, handler.Indexers)
+}
+
+func TestStartIndexerOutside(t *testing.T) {
+	port := freePort(t)
+	serveIndexer(t, port,
+		func(writer http.ResponseWriter, request *http.Request) {
+			_, err := writer.Write(indexing.ResponsePing())
+			assert.NoError(t, err)
+		},
+	)
+
+	// Answers pings already, so nothing is started.
+	handler := NewIndexHandler()
+	indexer := testIndexer("exit 3", port)
+	assert.NoError(t, handler.StartIndexer(indexer))
+	assert.Empty(t, handler.Indexers)
+}
+
+func TestStartIndexerRunning(t *testing.T) {
+	port := freePort(t)
+	running := startProcess(t, "exec sleep 60", port)
+
+	handler := NewIndexHandler()
+	handler.Indexers[_TESTINDEXERID_] = running
+
+	assert.NoError(t, handler.StartIndexer(testIndexer("exit 3", port)))
+	assert.Same(t, running, handler.Indexers[_TESTINDEXERID_])
+	assert.NoError(t, running.kill())
+}
+
+func TestRunningReaps(t *testing.T) {
+	exited := startProcess(t, "exit 0", freePort(t))
+	<-exited.exited
+	sleeping := startProcess(t, "exec sleep 60", freePort(t))
+	sleeping.ID = "sleeping"
+
+	handler := NewIndexHandler()
+	handler.Indexers[exited.ID] = exited
+	handler.Indexers[sleeping.ID] = sleeping
+
+	assert.Equal(t, []IndexerID{"sleeping"}, handler.Running())
+	assert.Len(t, handler.Indexers, 1)
+
+	handler.ShutdownAll()
+	assert.Empty(t, handler.Indexers)
+	assert.True(t, sleeping.hasExited())
+	assert.Empty(t, handler.Running())
+}
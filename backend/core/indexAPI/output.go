@@ -0,0 +1,297 @@
+package indexAPI
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	STDOUT string = "stdout"
+	STDERR string = "stderr"
+
+	// _LOGLINES_ is the number of lines of output kept per indexer.
+	_LOGLINES_ int = 1000
+
+	// _MAXLINELENGTH_ is the number of bytes after which a line without
+	// newline is cut.
+	_MAXLINELENGTH_ int = 4096
+
+	// _LOGFILESIZE_ is the size in bytes after which a log file is rotated,
+	// keeping one older file ending with ".1".
+	_LOGFILESIZE_ int64 = 1 << 20
+)
+
+// LogLine is a line an indexer wrote to stdout or stderr.
+// Seq numbers the lines of an OutputLog from 0.
+type LogLine struct {
+	Seq    int
+	Time   time.Time
+	Stream string
+	Text   string
+}
+
+// String formats line as a line of a log file, without newline.
+func (line LogLine) String() string {
+	return fmt.Sprintf(
+		"%s %s %s",
+		line.Time.Format(time.RFC3339),
+		line.Stream,
+		line.Text,
+	)
+}
+
+/*
+OutputLog keeps the last lines an indexer wrote to stdout and stderr,
+across restarts, and appends them to a log file if it has one.
+It is safe for concurrent use. Create it with newOutputLog.
+*/
+type OutputLog struct {
+	mutex sync.Mutex
+
+	// lines is a ring buffer, the line numbered seq is at seq % len(lines).
+	lines []LogLine
+	next  int
+
+	// changed is closed when lines are added, and replaced.
+	changed chan struct{}
+
+	// file is nil if lines are only kept in memory.
+	file *rotatingFile
+}
+
+// newOutputLog creates an OutputLog keeping capacity lines,
+// and appending them to the file at path, unless it is empty.
+func newOutputLog(capacity int, path string) *OutputLog {
+	output := &OutputLog{
+		lines:   make([]LogLine, capacity),
+		changed: make(chan struct{}),
+	}
+	if path != "" {
+		output.file = &rotatingFile{path: path, limit: _LOGFILESIZE_}
+	}
+
+	return output
+}
+
+// Tail returns the last n lines kept, oldest first,
+// and the number of the next line.
+func (output *OutputLog) Tail(n int) ([]LogLine, int) {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	return output.since(output.next - n), output.next
+}
+
+// Since returns the lines kept numbered seq or later, oldest first, and a
+// channel closed when more lines are added.
+func (output *OutputLog) Since(seq int) ([]LogLine, <-chan struct{}) {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	return output.since(seq), output.changed
+}
+
+// since returns the lines kept numbered seq or later, the mutex must be held.
+func (output *OutputLog) since(seq int) []LogLine {
+	seq = max(seq, output.next-len(output.lines), 0)
+
+	lines := make([]LogLine, 0, output.next-seq)
+	for ; seq < output.next; seq++ {
+		lines = append(lines, output.lines[seq%len(output.lines)])
+	}
+
+	return lines
+}
+
+// add adds a line written to stream, dropping the oldest line kept if full.
+func (output *OutputLog) add(stream string, text []byte) {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	line := LogLine{
+		Seq:    output.next,
+		Time:   time.Now(),
+		Stream: stream,
+		Text:   string(text),
+	}
+	output.lines[output.next%len(output.lines)] = line
+	output.next++
+
+	close(output.changed)
+	output.changed = make(chan struct{})
+
+	if output.file != nil {
+		output.file.writeLine(line.String())
+	}
+}
+
+// Close closes the log file, it is opened again if more lines are added.
+func (output *OutputLog) Close() error {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	if output.file == nil || output.file.file == nil {
+		return nil
+	}
+
+	err := output.file.file.Close()
+	output.file.file = nil
+	return err
+}
+
+// Writer returns a writer adding what is written to it to output line by
+// line, as written to stream. Call Flush on it to add an unfinished line.
+func (output *OutputLog) Writer(stream string) *LogWriter {
+	return &LogWriter{output: output, stream: stream}
+}
+
+// LogWriter is an io.Writer splitting what it is written into lines of an
+// OutputLog, see OutputLog.Writer.
+type LogWriter struct {
+	mutex   sync.Mutex
+	output  *OutputLog
+	stream  string
+	partial []byte
+}
+
+// Write adds every finished line in p, and keeps the rest for the next write.
+// An unfinished line is added once it is _MAXLINELENGTH_ bytes long.
+func (writer *LogWriter) Write(p []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.partial = append(writer.partial, p...)
+	for {
+		end := bytes.IndexByte(writer.partial, '\n')
+		next := end + 1
+		if end < 0 {
+			if len(writer.partial) < _MAXLINELENGTH_ {
+				break
+			}
+			end, next = _MAXLINELENGTH_, _MAXLINELENGTH_
+		}
+
+		line := bytes.TrimSuffix(writer.partial[:end], []byte("\r"))
+		writer.output.add(writer.stream, line)
+		writer.partial = writer.partial[next:]
+	}
+
+	return len(p), nil
+}
+
+// Flush adds the unfinished line, if any.
+func (writer *LogWriter) Flush() {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if len(writer.partial) > 0 {
+		writer.output.add(writer.stream, writer.partial)
+		writer.partial = nil
+	}
+}
+
+// rotatingFile appends lines to the file at path, renaming it to path
+// ending with ".1" when it exceeds limit bytes.
+// Failures are logged, they do not stop the indexer.
+type rotatingFile struct {
+	path  string
+	limit int64
+	file  *os.File
+	size  int64
+}
+
+// writeLine appends text and a newline to the file, opening or rotating it
+// first if needed.
+func (rotating *rotatingFile) writeLine(text string) {
+	err := rotating.open()
+	if err == nil && rotating.size+int64(len(text))+1 > rotating.limit &&
+		rotating.size > 0 {
+		err = rotating.rotate()
+	}
+	if err != nil {
+		log.Printf("Failed to write indexer log %s: %s", rotating.path, err)
+		return
+	}
+
+	written, err := fmt.Fprintln(rotating.file, text)
+	rotating.size += int64(written)
+	if err != nil {
+		log.Printf("Failed to write indexer log %s: %s", rotating.path, err)
+	}
+}
+
+// open opens the file for appending, unless it is already open.
+func (rotating *rotatingFile) open() error {
+	if rotating.file != nil {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(rotating.path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(
+		rotating.path,
+		os.O_CREATE|os.O_APPEND|os.O_WRONLY,
+		0o644,
+	)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Join(err, file.Close())
+	}
+
+	rotating.file = file
+	rotating.size = info.Size()
+	return nil
+}
+
+// rotate replaces the older file with the current one, and opens a new one.
+func (rotating *rotatingFile) rotate() error {
+	err := rotating.file.Close()
+	rotating.file = nil
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(rotating.path, rotating.path+".1")
+	if err != nil {
+		return err
+	}
+
+	return rotating.open()
+}
+
+// Output returns what the indexer with id wrote since Core started it
+// the first time, false if it never did.
+func (handler *IndexHandler) Output(id IndexerID) (*OutputLog, bool) {
+	handler.healthMutex.Lock()
+	defer handler.healthMutex.Unlock()
+
+	supervised, ok := handler.supervised[id]
+	if !ok {
+		return nil, false
+	}
+
+	return supervised.output, true
+}
+
+// logPath returns the path of the log file of the indexer with id,
+// empty if the handler has no LogDir.
+func (handler *IndexHandler) logPath(id IndexerID) string {
+	if handler.LogDir == "" {
+		return ""
+	}
+
+	return filepath.Join(handler.LogDir, string(id)+".log")
+}
@@ -0,0 +1,120 @@
+package indexAPI
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// texts returns the text of lines.
+func texts(lines []LogLine) []string {
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		result[i] = line.Text
+	}
+	return result
+}
+
+func TestOutputLogRing(t *testing.T) {
+	output := newOutputLog(3, "")
+	lines, next := output.Tail(10)
+	assert.Empty(t, lines)
+	assert.Zero(t, next)
+
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		output.add(STDOUT, []byte(text))
+	}
+
+	lines, next = output.Tail(10)
+	assert.Equal(t, []string{"c", "d", "e"}, texts(lines))
+	assert.Equal(t, 2, lines[0].Seq)
+	assert.Equal(t, 5, next)
+
+	lines, _ = output.Tail(2)
+	assert.Equal(t, []string{"d", "e"}, texts(lines))
+
+	lines, _ = output.Since(4)
+	assert.Equal(t, []string{"e"}, texts(lines))
+}
+
+func TestOutputLogSince(t *testing.T) {
+	output := newOutputLog(_LOGLINES_, "")
+	lines, changed := output.Since(0)
+	assert.Empty(t, lines)
+
+	output.add(STDERR, []byte("panic"))
+	select {
+	case <-changed:
+	default:
+		assert.Fail(t, "adding a line did not signal a change")
+	}
+
+	lines, _ = output.Since(0)
+	assert.Equal(t, STDERR, lines[0].Stream)
+	assert.True(t, strings.HasSuffix(lines[0].String(), " stderr panic"))
+}
+
+func TestLogWriter(t *testing.T) {
+	output := newOutputLog(_LOGLINES_, "")
+	writer := output.Writer(STDOUT)
+
+	_, err := writer.Write([]byte("first\r\nsec"))
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("ond\n\nthi"))
+	assert.NoError(t, err)
+	lines, _ := output.Tail(10)
+	assert.Equal(t, []string{"first", "second", ""}, texts(lines))
+
+	writer.Flush()
+	lines, _ = output.Tail(1)
+	assert.Equal(t, []string{"thi"}, texts(lines))
+
+	_, err = writer.Write([]byte(strings.Repeat("x", _MAXLINELENGTH_+1)))
+	assert.NoError(t, err)
+	lines, _ = output.Tail(1)
+	assert.Len(t, lines[0].Text, _MAXLINELENGTH_)
+}
+
+func TestOutputLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "indexer.log")
+	text := strings.Repeat("y", 20)
+	line := LogLine{Time: time.Now(), Stream: STDOUT, Text: text}
+
+	// Three lines fit in a file.
+	output := newOutputLog(_LOGLINES_, path)
+	output.file.limit = int64(3 * (len(line.String()) + 1))
+
+	for range 5 {
+		output.add(STDOUT, []byte(text))
+	}
+	assert.NoError(t, output.Close())
+
+	current, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	older, err := os.ReadFile(path + ".1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(older), "\n"))
+	assert.Equal(t, 2, strings.Count(string(current), "\n"))
+	assert.Contains(t, string(current), " stdout "+text+"\n")
+}
+
+func TestStartOutput(t *testing.T) {
+	output := newOutputLog(_LOGLINES_, "")
+	indexer := testIndexer("echo hello; printf oops >&2; exit 3", freePort(t))
+
+	_, err := indexer.start(time.Minute, output)
+	assert.ErrorContains(t, err, "oops")
+
+	// The unfinished line is added after the indexer has exited.
+	assert.Eventually(t, func() bool {
+		lines, _ := output.Tail(10)
+		return len(lines) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	lines, _ := output.Tail(10)
+	assert.ElementsMatch(t, []string{"hello", "oops"}, texts(lines))
+}
@@ -3,6 +3,7 @@ package indexAPI
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"seekourney/core/database"
 	"seekourney/utils"
@@ -106,77 +107,41 @@ func (ind IndexerData) SQLScan(rows *sql.Rows) (IndexerData, error) {
 
 }
 
-// IndexerFromDB returns an indexer from the database, with the given ID
-func IndexerFromDB(db *sql.DB, id IndexerID) (IndexerData, error) {
-	var indexer IndexerData
+// IndexerStore stores registered indexers, see storage.Store.
+type IndexerStore interface {
+	// Indexer returns the indexer with the given ID,
+	// or an error if there is none.
+	Indexer(id IndexerID) (IndexerData, error)
 
-	q1 := database.Select().QueryAll()
-	query := q1.From(indexer.SQLGetName()).Where("id = $1")
-
-	insert := func(res *IndexerData, doc IndexerData) {
-		*res = doc
-	}
-
-	err := database.ExecScan(
-		db,
-		string(query),
-		&indexer,
-		insert,
-		id,
-	)
-
-	return indexer, err
+	// InsertIndexer stores a new indexer, its ID and port must be unused.
+	InsertIndexer(indexer IndexerData) error
 
+	// FreeIndexerPort returns the lowest port not assigned to any indexer,
+	// at least utils.MININDEXERPORT.
+	FreeIndexerPort() (utils.Port, error)
 }
 
 const (
 	_ENDPOINTPREFIX_ string = "http://localhost"
 )
 
-// GeneratePort generates a valid port value by finding the lowest int not
-// already taken
-// TODO: does not check for maximum value (nominally 500 but unsure if this is a
-// hard constraint)
-func generatePort(db *sql.DB) utils.Port {
-	query := "SELECT t1.port + 1 " +
-		"FROM indexer t1 " +
-		"WHERE NOT EXISTS(SELECT * FROM indexer t2 " +
-		"WHERE t2.port = t1.port + 1 " +
-		"AND t2.port > " + utils.MININDEXERPORT.String() + ") " +
-		"ORDER BY t1.port LIMIT 1"
-
-	rows, err := db.Query(query)
-	utils.PanicOnError(err)
-	defer func() {
-		err := rows.Close()
-		utils.PanicOnError(err)
-	}()
-
-	var result utils.Port
-	// if no indexers in table, will receive empty rows
-	notEmpty := rows.Next()
-	if notEmpty {
-		err = rows.Scan(&result)
-		utils.PanicOnError(err)
-	} else {
-		result = utils.MININDEXERPORT
-	}
-
-	return result
-}
-
-// RegisterIndexer adds a new indexer to the system.
+// RegisterIndexer adds a new indexer to the system. The indexer is started
+// to ask for its name, see IndexerData.start for timeout, and stopped again.
 // Returns the RegisterID representing the indexer and success status.
 func RegisterIndexer(
-	db *sql.DB,
+	store IndexerStore,
 	startupCMD string,
+	timeout time.Duration,
 ) (IndexerID, error) {
 
 	split := strings.Split(startupCMD, " ")
 	command := split[0]
 	args := split[1:]
 
-	port := generatePort(db)
+	port, err := store.FreeIndexerPort()
+	if err != nil {
+		return "", err
+	}
 
 	// If this ID is used we are out of ports, so we can use this as a temporary
 	// ID to register the indexer.
@@ -187,11 +152,15 @@ func RegisterIndexer(
 		Port:     port,
 	}
 
-	active, err := indexer.start()
-	utils.PanicOnError(err) // TODO actual error handling if test start fails
-	time.Sleep(1 * time.Second)
+	active, err := indexer.start(timeout, nil)
+	if err != nil {
+		return "", err
+	}
+
 	name, err := GetRequest(active, "name")
-	utils.PanicOnError(err)
+	if err != nil {
+		return "", errors.Join(err, active.kill())
+	}
 
 	indexer.Name = strings.TrimSpace(name)
 
@@ -202,20 +171,17 @@ func RegisterIndexer(
 	// utils.PanicOnError(err) // TODO actual error handling if shutdown fails
 	// TODO: Fix this, the indexer shutsdown before ansering
 
-	err = active.Exec.Wait()
-	utils.PanicOnError(err)
+	select {
+	case <-active.exited:
+	case <-time.After(_MEDIUMTIMEOUT_):
+		log.Printf("Indexer %s did not shut down, killing it", indexer.ID)
+		utils.PanicOnError(active.kill())
+	}
 
-	_, err = database.InsertInto(db, indexer)
+	err = store.InsertIndexer(indexer)
 	if err != nil {
 		log.Fatalf("Error inserting indexer: %s\n", err)
 	}
 
 	return indexer.ID, nil
 }
-
-// UnregisterIndexer removes an existing indexer from the system.
-func UnregisterIndexer(id IndexerID) error {
-	// TODO: Implement, this should remove it from the database.
-	// TODO: This functonality is not an priority
-	return nil
-}
@@ -0,0 +1,169 @@
+package indexAPI
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DEFAULTSTARTUPTIMEOUT is how long an indexer may take to get ready,
+	// unless configured otherwise, see IndexHandler.
+	DEFAULTSTARTUPTIMEOUT time.Duration = 30 * time.Second
+
+	// _FIRSTPINGDELAY_ is the wait before pinging a starting indexer again,
+	// doubled after every attempt up to _MAXPINGDELAY_.
+	_FIRSTPINGDELAY_ time.Duration = 25 * time.Millisecond
+	_MAXPINGDELAY_   time.Duration = 1 * time.Second
+
+	// _STDERRTAIL_ is the number of bytes kept of what an indexer wrote
+	// to stderr.
+	_STDERRTAIL_ int = 4096
+)
+
+// newRunningIndexer keeps track of the started process cmd of the indexer
+// with id, waiting for it to exit in the background.
+// Stderr holds what cmd writes to stderr, it may be nil.
+func newRunningIndexer(
+	id IndexerID,
+	cmd *exec.Cmd,
+	port utils.Port,
+	stderr *stderrTail,
+) *RunningIndexer {
+	running := &RunningIndexer{
+		ID:     id,
+		Exec:   cmd,
+		Port:   port,
+		stderr: stderr,
+		exited: make(chan struct{}),
+	}
+
+	go func() {
+		running.exitErr = cmd.Wait()
+		close(running.exited)
+	}()
+
+	return running
+}
+
+// kill kills the indexer, and waits until it has exited.
+func (indexer *RunningIndexer) kill() error {
+	err := indexer.Exec.Process.Kill()
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-indexer.exited
+
+	return nil
+}
+
+/*
+waitReady pings the indexer until it answers, see indexing.ResponsePing.
+Pings are retried while nothing answers, waiting twice as long after every
+attempt, up to _MAXPINGDELAY_. Returns an error if the indexer answers
+something else than a pong, exits, or does not answer within timeout.
+*/
+func (indexer *RunningIndexer) waitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	delay := _FIRSTPINGDELAY_
+
+	for {
+		resp, err := ping(indexer.Port)
+		if err == nil {
+			if resp.Status != indexing.STATUSSUCCESSFUL ||
+				resp.Data.Message != indexing.MESSAGEPONG {
+				return errors.New(
+					"indexer did not respond to ping request after startup",
+				)
+			}
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("indexer not ready after %s: %w", timeout, err)
+		}
+
+		select {
+		case <-indexer.exited:
+			return fmt.Errorf(
+				"indexer exited during startup: %v",
+				indexer.exitErr,
+			)
+		case <-time.After(min(delay, remaining)):
+		}
+		delay = min(2*delay, _MAXPINGDELAY_)
+	}
+}
+
+// ping sends a ping request to the indexer on port, giving up after
+// _SHORTTIMEOUT_. An answer that is not a response is an error.
+func ping(port utils.Port) (IndexerResponse, error) {
+	var resp IndexerResponse
+
+	client := http.Client{Timeout: _SHORTTIMEOUT_}
+	answer, err := client.Get(
+		_ENDPOINTPREFIX_ + ":" + port.String() + "/" + _PING_,
+	)
+	if err != nil {
+		return resp, err
+	}
+	defer func() {
+		utils.PanicOnError(answer.Body.Close())
+	}()
+
+	body, err := io.ReadAll(answer.Body)
+	if err != nil {
+		return resp, err
+	}
+
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
+
+// stderrTail is an io.Writer keeping the last _STDERRTAIL_ bytes written,
+// it is safe for concurrent use.
+type stderrTail struct {
+	mutex sync.Mutex
+	tail  []byte
+}
+
+// Write keeps the end of p, dropping the oldest bytes kept.
+func (stderr *stderrTail) Write(p []byte) (int, error) {
+	stderr.mutex.Lock()
+	defer stderr.mutex.Unlock()
+
+	stderr.tail = append(stderr.tail, p...)
+	if len(stderr.tail) > _STDERRTAIL_ {
+		stderr.tail = stderr.tail[len(stderr.tail)-_STDERRTAIL_:]
+	}
+
+	return len(p), nil
+}
+
+// String returns the bytes kept.
+func (stderr *stderrTail) String() string {
+	stderr.mutex.Lock()
+	defer stderr.mutex.Unlock()
+
+	return string(stderr.tail)
+}
+
+// annotate adds what was written to stderr to err, if anything was.
+func (stderr *stderrTail) annotate(err error) error {
+	output := strings.TrimSpace(stderr.String())
+	if output == "" {
+		return err
+	}
+
+	return fmt.Errorf("%w, stderr:\n%s", err, output)
+}
@@ -0,0 +1,103 @@
+package indexAPI
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// freePort returns a port nothing listens on.
+func freePort(t *testing.T) utils.Port {
+	listener, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	assert.NoError(t, listener.Close())
+	return utils.Port(port)
+}
+
+// testIndexer returns indexer data running command with sh on port.
+func testIndexer(command string, port utils.Port) IndexerData {
+	return IndexerData{
+		ID:       _TESTINDEXERID_,
+		ExecPath: "sh",
+		Args:     []string{"-c", command},
+		Port:     port,
+	}
+}
+
+func TestStartExited(t *testing.T) {
+	indexer := testIndexer("echo missing config >&2; exit 3", freePort(t))
+
+	started := time.Now()
+	_, err := indexer.start(time.Minute, nil)
+	assert.ErrorContains(t, err, "exited during startup")
+	assert.ErrorContains(t, err, "missing config")
+	assert.Less(t, time.Since(started), 10*time.Second)
+}
+
+func TestStartTimeout(t *testing.T) {
+	indexer := testIndexer("exec sleep 60", freePort(t))
+
+	started := time.Now()
+	_, err := indexer.start(200*time.Millisecond, nil)
+	assert.ErrorContains(t, err, "not ready after 200ms")
+	assert.Less(t, time.Since(started), 10*time.Second)
+}
+
+func TestStartReady(t *testing.T) {
+	port := freePort(t)
+	indexer := testIndexer("exec sleep 60", port)
+
+	// The indexer only listens after a while, so pings are retried.
+	server := &http.Server{
+		Addr: fmt.Sprintf("localhost:%d", port),
+		Handler: http.HandlerFunc(
+			func(writer http.ResponseWriter, request *http.Request) {
+				_, err := writer.Write(indexing.ResponsePing())
+				assert.NoError(t, err)
+			},
+		),
+	}
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		err := server.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			assert.NoError(t, err)
+		}
+	}()
+	defer func() {
+		assert.NoError(t, server.Close())
+	}()
+
+	running, err := indexer.start(time.Minute, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, running.kill())
+	assert.Error(t, running.Wait(), "killed")
+}
+
+func TestStderrTail(t *testing.T) {
+	stderr := &stderrTail{}
+	err := errors.New("failed")
+	assert.Equal(t, err, stderr.annotate(err))
+
+	_, werr := stderr.Write([]byte(strings.Repeat("a", _STDERRTAIL_)))
+	assert.NoError(t, werr)
+	_, werr = stderr.Write([]byte("end\n"))
+	assert.NoError(t, werr)
+
+	output := stderr.String()
+	assert.Len(t, output, _STDERRTAIL_)
+	assert.True(t, strings.HasSuffix(output, "aend\n"))
+
+	annotated := stderr.annotate(err)
+	assert.ErrorIs(t, annotated, err)
+	assert.True(t, strings.HasSuffix(annotated.Error(), "aend"))
+}
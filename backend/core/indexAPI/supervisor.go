@@ -0,0 +1,337 @@
+package indexAPI
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"time"
+)
+
+// IndexerState is the state of an indexer as seen by the IndexHandler.
+type IndexerState string
+
+const (
+	STATERUNNING  IndexerState = "running"
+	STATESTARTING IndexerState = "starting"
+	STATECRASHED  IndexerState = "crashed"
+	STATESTOPPED  IndexerState = "stopped"
+)
+
+const (
+	// DEFAULTCHECKINTERVAL is how often running indexers are pinged,
+	// unless configured otherwise, see IndexHandler.Supervise.
+	DEFAULTCHECKINTERVAL time.Duration = 10 * time.Second
+
+	// _UNHEALTHYFAILURES_ is the number of failed pings or restarts in a row
+	// after which an indexer is unhealthy.
+	_UNHEALTHYFAILURES_ int = 3
+
+	// _FIRSTRESTARTDELAY_ is the wait before restarting a crashed indexer,
+	// doubled after every crash up to _MAXRESTARTDELAY_.
+	_FIRSTRESTARTDELAY_ time.Duration = 1 * time.Second
+	_MAXRESTARTDELAY_   time.Duration = 1 * time.Minute
+)
+
+// errAlreadyStarted is returned when starting an indexer that is already
+// starting or running, see startSupervised.
+var errAlreadyStarted = errors.New("already started")
+
+// IndexerHealth is what the supervisor knows about an indexer.
+type IndexerHealth struct {
+	State IndexerState
+
+	// Healthy is false after _UNHEALTHYFAILURES_ failures in a row,
+	// until the indexer answers a ping again.
+	Healthy bool
+
+	// Failures is the number of failed pings or startups since the last
+	// answered ping, and Restarts the number of restarts after crashes.
+	Failures int
+	Restarts int
+
+	// Error is the last failure, if the indexer has not answered since.
+	Error string
+}
+
+// supervisedIndexer is an indexer started by the handler, and its health.
+type supervisedIndexer struct {
+	data   IndexerData
+	health IndexerHealth
+
+	// restartAt is when a crashed indexer is started again,
+	// delay the wait after its next crash.
+	restartAt time.Time
+	delay     time.Duration
+
+	// output keeps what the indexer wrote, across restarts.
+	output *OutputLog
+
+	// started is closed once the latest start has ended, see waitStarted.
+	started chan struct{}
+}
+
+// Health returns the health of the indexer with id. Indexers the handler
+// never started are stopped.
+func (handler *IndexHandler) Health(id IndexerID) IndexerHealth {
+	handler.healthMutex.Lock()
+	defer handler.healthMutex.Unlock()
+
+	indexer, ok := handler.supervised[id]
+	if !ok {
+		return IndexerHealth{State: STATESTOPPED, Healthy: true}
+	}
+
+	return indexer.health
+}
+
+/*
+Supervise checks the indexers started by the handler every interval,
+see Check, until ctx is done. Crashed indexers are restarted, waiting
+_FIRSTRESTARTDELAY_ after the first crash and twice as long after every
+crash that follows, up to _MAXRESTARTDELAY_.
+*/
+func (handler *IndexHandler) Supervise(
+	ctx context.Context,
+	interval time.Duration,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			handler.Check()
+		}
+	}
+}
+
+// Check pings the running indexers started by the handler, and restarts the
+// ones that crashed once their wait has passed. The mutex is only held to
+// find the running indexers and to add the restarted ones, so dispatching
+// is not blocked by slow pings or startups.
+func (handler *IndexHandler) Check() {
+	handler.Mutex.Lock()
+	handler.reap()
+	ports := make(map[IndexerID]utils.Port, len(handler.Indexers))
+	for id, running := range handler.Indexers {
+		ports[id] = running.Port
+	}
+	handler.Mutex.Unlock()
+
+	for id, port := range ports {
+		resp, err := ping(port)
+		if err == nil && (resp.Status != indexing.STATUSSUCCESSFUL ||
+			resp.Data.Message != indexing.MESSAGEPONG) {
+			err = errors.New("indexer did not respond to ping request")
+		}
+		handler.pinged(id, err)
+	}
+
+	for _, indexer := range handler.restartable(time.Now()) {
+		log.Printf("Restarting crashed indexer %s", indexer.ID)
+		running, err := handler.startSupervised(indexer)
+		if err != nil {
+			log.Printf("Failed to restart indexer %s: %s", indexer.ID, err)
+			continue
+		}
+		handler.install(running)
+	}
+}
+
+/*
+startSupervised starts indexer, see IndexerData.start, keeping track of
+its health. If it fails to start, it is restarted like a crashed indexer.
+Fails with errAlreadyStarted if the indexer is already starting or running,
+since the mutex need not be held. An indexer stopped while it starts is
+stopped again.
+*/
+func (handler *IndexHandler) startSupervised(
+	indexer IndexerData,
+) (*RunningIndexer, error) {
+	handler.healthMutex.Lock()
+	supervised, ok := handler.supervised[indexer.ID]
+	if !ok {
+		supervised = &supervisedIndexer{
+			health: IndexerHealth{Healthy: true},
+			delay:  _FIRSTRESTARTDELAY_,
+			output: newOutputLog(_LOGLINES_, handler.logPath(indexer.ID)),
+		}
+		handler.supervised[indexer.ID] = supervised
+	}
+	state := supervised.health.State
+	if state == STATESTARTING || state == STATERUNNING {
+		handler.healthMutex.Unlock()
+		return nil, fmt.Errorf(
+			"indexer %s is %s: %w", indexer.ID, state, errAlreadyStarted)
+	}
+	supervised.data = indexer
+	supervised.health.State = STATESTARTING
+	started := make(chan struct{})
+	supervised.started = started
+	handler.healthMutex.Unlock()
+	defer close(started)
+
+	running, err := indexer.start(handler.StartupTimeout, supervised.output)
+	if err != nil {
+		handler.crashed(indexer.ID, err)
+		return nil, err
+	}
+
+	handler.healthMutex.Lock()
+	stopped := supervised.health.State == STATESTOPPED
+	if !stopped {
+		supervised.health.State = STATERUNNING
+	}
+	handler.healthMutex.Unlock()
+
+	if stopped {
+		return nil, errors.Join(
+			errors.New("indexer "+string(indexer.ID)+" stopped while starting"),
+			running.stop(),
+		)
+	}
+
+	return running, nil
+}
+
+// waitStarted waits until the indexer with id is no longer starting,
+// and returns an error unless it is running then.
+func (handler *IndexHandler) waitStarted(id IndexerID) error {
+	handler.healthMutex.Lock()
+	var started chan struct{}
+	supervised, ok := handler.supervised[id]
+	if ok && supervised.health.State == STATESTARTING {
+		started = supervised.started
+	}
+	handler.healthMutex.Unlock()
+
+	if started != nil {
+		<-started
+	}
+
+	health := handler.Health(id)
+	if health.State != STATERUNNING {
+		return fmt.Errorf(
+			"indexer %s did not start, it is %s: %s",
+			id,
+			health.State,
+			health.Error,
+		)
+	}
+
+	return nil
+}
+
+// crashed marks the indexer with id as crashed with err, and schedules
+// its restart.
+func (handler *IndexHandler) crashed(id IndexerID, err error) {
+	handler.healthMutex.Lock()
+	defer handler.healthMutex.Unlock()
+
+	supervised, ok := handler.supervised[id]
+	if !ok || supervised.health.State == STATESTOPPED {
+		return
+	}
+
+	supervised.health.State = STATECRASHED
+	supervised.fail(err)
+	supervised.restartAt = time.Now().Add(supervised.delay)
+	supervised.delay = min(2*supervised.delay, _MAXRESTARTDELAY_)
+	handler.down(id, err)
+}
+
+// pinged records the outcome of pinging the indexer with id,
+// err is nil if it answered. Ignored if it is no longer running.
+func (handler *IndexHandler) pinged(id IndexerID, err error) {
+	handler.healthMutex.Lock()
+	defer handler.healthMutex.Unlock()
+
+	supervised, ok := handler.supervised[id]
+	if !ok || supervised.health.State != STATERUNNING {
+		return
+	}
+
+	if err != nil {
+		supervised.fail(err)
+		return
+	}
+
+	supervised.health.Healthy = true
+	supervised.health.Failures = 0
+	supervised.health.Error = ""
+	supervised.delay = _FIRSTRESTARTDELAY_
+}
+
+// stopped marks the indexer with id as stopped, so it is not restarted.
+func (handler *IndexHandler) stopped(id IndexerID) {
+	handler.healthMutex.Lock()
+	defer handler.healthMutex.Unlock()
+
+	supervised, ok := handler.supervised[id]
+	if ok {
+		handler.markStopped(id, supervised)
+	}
+}
+
+// markStopped marks supervised, the indexer with id, as stopped,
+// unless it is already. The health mutex must be held.
+func (handler *IndexHandler) markStopped(
+	id IndexerID,
+	supervised *supervisedIndexer,
+) {
+	if supervised.health.State == STATESTOPPED {
+		return
+	}
+
+	supervised.health.State = STATESTOPPED
+	handler.down(id, errors.New("indexer "+string(id)+" was stopped"))
+}
+
+// down tells OnDown that the indexer with id no longer works because of
+// reason, without waiting for it, so it may be called with mutexes held.
+func (handler *IndexHandler) down(id IndexerID, reason error) {
+	if handler.OnDown != nil {
+		go handler.OnDown(id, reason)
+	}
+}
+
+// restartable returns the crashed indexers whose restart is due at now,
+// counting the restarts.
+func (handler *IndexHandler) restartable(now time.Time) []IndexerData {
+	handler.healthMutex.Lock()
+	defer handler.healthMutex.Unlock()
+
+	indexers := []IndexerData{}
+	for _, supervised := range handler.supervised {
+		if supervised.health.State == STATECRASHED &&
+			!now.Before(supervised.restartAt) {
+			supervised.health.Restarts++
+			indexers = append(indexers, supervised.data)
+		}
+	}
+
+	return indexers
+}
+
+// fail records err as a failure of the indexer,
+// which is unhealthy after _UNHEALTHYFAILURES_ in a row.
+func (indexer *supervisedIndexer) fail(err error) {
+	indexer.health.Failures++
+	indexer.health.Error = err.Error()
+
+	if indexer.health.Healthy &&
+		indexer.health.Failures >= _UNHEALTHYFAILURES_ {
+		log.Printf(
+			"Indexer %s is unhealthy after %d failures: %s",
+			indexer.data.ID,
+			indexer.health.Failures,
+			err,
+		)
+		indexer.health.Healthy = false
+	}
+}
@@ -0,0 +1,183 @@
+package indexAPI
+
+import (
+	"net/http"
+	"seekourney/indexing"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthUnknown(t *testing.T) {
+	handler := NewIndexHandler()
+	assert.Equal(
+		t,
+		IndexerHealth{State: STATESTOPPED, Healthy: true},
+		handler.Health(_TESTINDEXERID_),
+	)
+}
+
+func TestCheckRestartsCrashed(t *testing.T) {
+	port := freePort(t)
+	serveIndexer(t, port,
+		func(writer http.ResponseWriter, request *http.Request) {
+			_, err := writer.Write(indexing.ResponsePing())
+			assert.NoError(t, err)
+		},
+	)
+
+	handler := NewIndexHandler()
+	indexer := testIndexer("exec sleep 60", port)
+	running, err := handler.startSupervised(indexer)
+	assert.NoError(t, err)
+	handler.Indexers[indexer.ID] = running
+	assert.Equal(t, STATERUNNING, handler.Health(indexer.ID).State)
+
+	assert.NoError(t, running.kill())
+	handler.Check()
+	health := handler.Health(indexer.ID)
+	assert.Equal(t, STATECRASHED, health.State)
+	assert.Equal(t, 1, health.Failures)
+	assert.Empty(t, handler.Indexers)
+
+	// Restarted once the wait has passed.
+	handler.supervised[indexer.ID].restartAt = time.Time{}
+	handler.Check()
+	health = handler.Health(indexer.ID)
+	assert.Equal(t, STATERUNNING, health.State)
+	assert.Equal(t, 1, health.Restarts)
+	assert.Contains(t, handler.Indexers, indexer.ID)
+
+	// Answering pings again resets the failures.
+	handler.Check()
+	assert.Zero(t, handler.Health(indexer.ID).Failures)
+
+	handler.ShutdownAll()
+	assert.Equal(t, STATESTOPPED, handler.Health(indexer.ID).State)
+}
+
+func TestOnDown(t *testing.T) {
+	port := freePort(t)
+	serveIndexer(t, port,
+		func(writer http.ResponseWriter, request *http.Request) {
+			_, err := writer.Write(indexing.ResponsePing())
+			assert.NoError(t, err)
+		},
+	)
+
+	handler := NewIndexHandler()
+	reasons := make(chan error, 2)
+	handler.OnDown = func(id IndexerID, reason error) {
+		assert.Equal(t, _TESTINDEXERID_, id)
+		reasons <- reason
+	}
+	indexer := testIndexer("exec sleep 60", port)
+	running, err := handler.startSupervised(indexer)
+	assert.NoError(t, err)
+	handler.install(running)
+
+	assert.NoError(t, running.kill())
+	handler.Check()
+	assert.ErrorContains(t, <-reasons, "indexer exited")
+
+	// Stopping a crashed indexer keeps it from being restarted.
+	assert.NoError(t, handler.StopIndexer(indexer.ID))
+	assert.ErrorContains(t, <-reasons, "was stopped")
+}
+
+func TestCheckUnhealthy(t *testing.T) {
+	port := freePort(t)
+	handler := NewIndexHandler()
+	running := startProcess(t, "exec sleep 60", port)
+	handler.Indexers[_TESTINDEXERID_] = running
+	handler.supervised[_TESTINDEXERID_] = &supervisedIndexer{
+		data:   testIndexer("exec sleep 60", port),
+		health: IndexerHealth{State: STATERUNNING, Healthy: true},
+		delay:  _FIRSTRESTARTDELAY_,
+		output: newOutputLog(_LOGLINES_, ""),
+	}
+
+	// Nothing answers pings.
+	for range _UNHEALTHYFAILURES_ - 1 {
+		handler.Check()
+	}
+	assert.True(t, handler.Health(_TESTINDEXERID_).Healthy)
+
+	handler.Check()
+	health := handler.Health(_TESTINDEXERID_)
+	assert.False(t, health.Healthy)
+	assert.Equal(t, STATERUNNING, health.State)
+	assert.Equal(t, _UNHEALTHYFAILURES_, health.Failures)
+	assert.NotEmpty(t, health.Error)
+
+	assert.NoError(t, running.kill())
+}
+
+func TestStartSupervisedBackoff(t *testing.T) {
+	handler := NewIndexHandler()
+	indexer := testIndexer("exit 3", freePort(t))
+
+	_, err := handler.startSupervised(indexer)
+	assert.Error(t, err)
+	assert.Equal(t, STATECRASHED, handler.Health(indexer.ID).State)
+	assert.Equal(t, 2*_FIRSTRESTARTDELAY_, handler.supervised[indexer.ID].delay)
+
+	now := time.Now()
+	assert.Empty(t, handler.restartable(now))
+	assert.Equal(
+		t,
+		[]IndexerData{indexer},
+		handler.restartable(now.Add(_FIRSTRESTARTDELAY_)),
+	)
+	assert.Equal(t, 1, handler.Health(indexer.ID).Restarts)
+
+	// Failing again doubles the wait, up to _MAXRESTARTDELAY_.
+	for range 10 {
+		handler.crashed(indexer.ID, err)
+	}
+	assert.Equal(t, _MAXRESTARTDELAY_, handler.supervised[indexer.ID].delay)
+	assert.False(t, handler.Health(indexer.ID).Healthy)
+
+	// Stopped indexers are not restarted.
+	assert.NoError(t, handler.StopIndexer(indexer.ID))
+	assert.Equal(t, STATESTOPPED, handler.Health(indexer.ID).State)
+	assert.Empty(t, handler.restartable(now.Add(time.Hour)))
+}
+
+func TestCheckStartsUnlocked(t *testing.T) {
+	handler := NewIndexHandler()
+	handler.StartupTimeout = 2 * time.Second
+	indexer := testIndexer("exec sleep 60", freePort(t))
+	handler.supervised[indexer.ID] = &supervisedIndexer{
+		data:   indexer,
+		health: IndexerHealth{State: STATECRASHED, Healthy: true},
+		delay:  _FIRSTRESTARTDELAY_,
+		output: newOutputLog(_LOGLINES_, ""),
+	}
+
+	// Nothing answers pings, so the restart waits for StartupTimeout.
+	checked := make(chan struct{})
+	go func() {
+		handler.Check()
+		close(checked)
+	}()
+	for handler.Health(indexer.ID).State != STATESTARTING {
+		time.Sleep(time.Millisecond)
+	}
+
+	started := time.Now()
+	assert.Empty(t, handler.Running())
+	assert.Less(t, time.Since(started), handler.StartupTimeout/2)
+
+	// Starting it meanwhile waits for the restart, which fails.
+	assert.ErrorContains(
+		t,
+		handler.StartIndexer(indexer),
+		"it is crashed",
+	)
+
+	<-checked
+	assert.Equal(t, STATECRASHED, handler.Health(indexer.ID).State)
+	assert.Empty(t, handler.Running())
+}
@@ -1,11 +1,10 @@
 package indexAPI
 
 import (
-	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os/exec"
-	"seekourney/indexing"
-	"seekourney/utils"
 	"testing"
 	"time"
 )
@@ -13,10 +12,14 @@ import (
 // TODO: Structured log messages and struct
 // TODO: Log should be in response body not query
 
-// start starts an indexer using data that is contined in the calling object..
-func (indexer *IndexerData) start() (*RunningIndexer, error) {
-	// TODO: Use timeout instead of sleep
-
+// start starts an indexer using data that is contined in the calling object,
+// and waits until it answers pings, at most timeout, see waitReady.
+// If it does not get ready it is killed, and the error includes the end of
+// what it wrote to stderr. Its output is added to output, unless it is nil.
+func (indexer *IndexerData) start(
+	timeout time.Duration,
+	output *OutputLog,
+) (*RunningIndexer, error) {
 	args := indexer.Args
 	// Hack to let us run ls command when testing to mock starting up indexer.
 	if !testing.Testing() {
@@ -25,37 +28,45 @@ func (indexer *IndexerData) start() (*RunningIndexer, error) {
 
 	execCmd := exec.Command(indexer.ExecPath, args...)
 
-	// TODO: Handle output
-	execCmd.Stdout = nil
-	execCmd.Stderr = nil
+	stderr := &stderrTail{}
+	execCmd.Stderr = stderr
+	var outputs []*LogWriter
+	if output != nil {
+		outputs = []*LogWriter{output.Writer(STDOUT), output.Writer(STDERR)}
+		execCmd.Stdout = outputs[0]
+		execCmd.Stderr = io.MultiWriter(stderr, outputs[1])
+	}
+	// Children of the indexer may keep stderr open after it has exited.
+	execCmd.WaitDelay = _SHORTTIMEOUT_
 
 	err := execCmd.Start()
 	if err != nil {
-		log.Fatalf("Failed to start command: %v", err)
+		return nil, fmt.Errorf("failed to start indexer: %w", err)
 	}
 
 	log.Printf("Starting indexer with command: %s %s\n", indexer.ExecPath, args)
 
-	time.Sleep(1 * time.Second)
+	running := newRunningIndexer(indexer.ID, execCmd, indexer.Port, stderr)
+	go func() {
+		// Output is only complete once the indexer has exited.
+		<-running.exited
+		for _, writer := range outputs {
+			writer.Flush()
+		}
+	}()
 
-	resp, err := utils.GetRequestJSON[IndexerResponse](
-		_ENDPOINTPREFIX_,
-		indexer.Port,
-		_PING_,
-	)
+	started := time.Now()
+	err = running.waitReady(timeout)
 	if err != nil {
-		return nil, err
-	}
-	if resp.Status != indexing.STATUSSUCCESSFUL ||
-		resp.Data.Message != indexing.MESSAGEPONG {
-		return nil, errors.New(
-			"indexer did not respond to ping request after startup",
-		)
+		killErr := running.kill()
+		if killErr != nil {
+			log.Printf("Failed to kill indexer %s: %s\n", indexer.ID, killErr)
+		}
+		return nil, stderr.annotate(err)
 	}
 
-	return &RunningIndexer{
-		ID:   indexer.ID,
-		Exec: execCmd,
-		Port: indexer.Port,
-	}, nil
+	log.Printf("Indexer %s ready after %s\n",
+		indexer.ID, time.Since(started).Round(time.Millisecond))
+
+	return running, nil
 }
@@ -0,0 +1,259 @@
+/*
+Package jobs keeps track of indexing jobs: the indexing of a collection
+dispatched by Core to its indexer, from when it is queued until the indexer
+reports it done, see indexing.IndexingProgress and indexing.IndexingDone.
+*/
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"seekourney/core/database"
+	"seekourney/indexing"
+	"slices"
+	"sync"
+	"time"
+)
+
+// State is the state of a job.
+type State string
+
+const (
+	QUEUED    State = "queued"
+	RUNNING   State = "running"
+	DONE      State = "done"
+	FAILED    State = "failed"
+	CANCELLED State = "cancelled"
+)
+
+// _KEPTJOBS_ is the number of ended jobs kept, older ones are forgotten.
+const _KEPTJOBS_ int = 500
+
+var (
+	// ErrUnknown is returned for jobs that do not exist, or are forgotten.
+	ErrUnknown = errors.New("unknown job")
+
+	// ErrEnded is returned when changing a job that has ended.
+	ErrEnded = errors.New("job has ended")
+)
+
+// Job is an indexing of a collection. Pushed and Failed count documents,
+// see indexing.IndexingProgress. Times are zero until reached.
+type Job struct {
+	ID         indexing.JobID
+	Collection indexing.CollectionID
+	State      State
+	Pushed     int
+	Failed     int
+
+	Queued   time.Time
+	Started  time.Time
+	Updated  time.Time
+	Finished time.Time
+
+	// Error is why the job failed, empty otherwise.
+	Error string
+}
+
+// Active returns true if the job has not ended.
+func (job Job) Active() bool {
+	return job.State == QUEUED || job.State == RUNNING
+}
+
+// Filter selects jobs, empty fields select every job.
+type Filter struct {
+	State      State
+	Collection indexing.CollectionID
+}
+
+// Tracker keeps the active jobs, and the last _KEPTJOBS_ ended ones.
+// It is safe for concurrent use.
+type Tracker struct {
+	mutex sync.Mutex
+	jobs  map[indexing.JobID]*Job
+
+	// ended holds the ended jobs, oldest first.
+	ended []indexing.JobID
+}
+
+// NewTracker creates a Tracker without jobs.
+func NewTracker() *Tracker {
+	return &Tracker{jobs: make(map[indexing.JobID]*Job)}
+}
+
+// Queue adds a job indexing collection, waiting to be dispatched.
+func (tracker *Tracker) Queue(collection indexing.CollectionID) Job {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	id := indexing.JobID(database.GenerateId())
+	for tracker.jobs[id] != nil {
+		id = indexing.JobID(database.GenerateId())
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:         id,
+		Collection: collection,
+		State:      QUEUED,
+		Queued:     now,
+		Updated:    now,
+	}
+	tracker.jobs[id] = job
+
+	return *job
+}
+
+// Start records that the queued job with id is dispatched to its indexer.
+// Returns ErrEnded if it was cancelled meanwhile.
+func (tracker *Tracker) Start(id indexing.JobID) error {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	job, err := tracker.active(id)
+	if err != nil {
+		return err
+	}
+
+	job.State = RUNNING
+	job.Started = time.Now()
+	job.Updated = job.Started
+	return nil
+}
+
+// Progress records progress reported by the indexer of a running job.
+func (tracker *Tracker) Progress(progress indexing.IndexingProgress) error {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	job, err := tracker.active(progress.Job)
+	if err != nil {
+		return err
+	}
+
+	job.Pushed = progress.Pushed
+	job.Failed = progress.Failed
+	job.Updated = time.Now()
+	return nil
+}
+
+// Finish ends a job when its indexer reports it done. It failed if the
+// indexing was not complete.
+func (tracker *Tracker) Finish(done indexing.IndexingDone) (Job, error) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	job, err := tracker.active(done.Job)
+	if err != nil {
+		return Job{}, err
+	}
+
+	job.Pushed = done.Pushed
+	job.Failed = done.Failed
+	if done.Complete {
+		tracker.end(job, DONE)
+	} else {
+		job.Error = fmt.Sprintf(
+			"indexing incomplete, %d documents failed",
+			done.Failed,
+		)
+		tracker.end(job, FAILED)
+	}
+
+	return *job, nil
+}
+
+// Fail ends the job with id because of err, such as its indexer failing
+// to start.
+func (tracker *Tracker) Fail(id indexing.JobID, err error) error {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	job, activeErr := tracker.active(id)
+	if activeErr != nil {
+		return activeErr
+	}
+
+	job.Error = err.Error()
+	tracker.end(job, FAILED)
+	return nil
+}
+
+// Cancel ends the job with id, and returns it as it was before.
+// Progress reported for it afterwards is ignored.
+func (tracker *Tracker) Cancel(id indexing.JobID) (Job, error) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	job, err := tracker.active(id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	before := *job
+	tracker.end(job, CANCELLED)
+	return before, nil
+}
+
+// Job returns the job with id, false if it is unknown.
+func (tracker *Tracker) Job(id indexing.JobID) (Job, bool) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	job, ok := tracker.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return *job, true
+}
+
+// Jobs returns the jobs selected by filter, the most recently queued first.
+func (tracker *Tracker) Jobs(filter Filter) []Job {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	jobs := make([]Job, 0, len(tracker.jobs))
+	for _, job := range tracker.jobs {
+		if filter.State != "" && job.State != filter.State {
+			continue
+		}
+		if filter.Collection != "" && job.Collection != filter.Collection {
+			continue
+		}
+		jobs = append(jobs, *job)
+	}
+
+	slices.SortFunc(jobs, func(a Job, b Job) int {
+		return b.Queued.Compare(a.Queued)
+	})
+	return jobs
+}
+
+// active returns the job with id if it has not ended,
+// the mutex must be held.
+func (tracker *Tracker) active(id indexing.JobID) (*Job, error) {
+	job, ok := tracker.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknown, id)
+	}
+	if !job.Active() {
+		return nil, fmt.Errorf("%w, it is %s", ErrEnded, job.State)
+	}
+
+	return job, nil
+}
+
+// end ends job in state, forgetting the oldest ended job if more than
+// _KEPTJOBS_ have ended. The mutex must be held.
+func (tracker *Tracker) end(job *Job, state State) {
+	job.State = state
+	job.Finished = time.Now()
+	job.Updated = job.Finished
+
+	tracker.ended = append(tracker.ended, job.ID)
+	if len(tracker.ended) > _KEPTJOBS_ {
+		delete(tracker.jobs, tracker.ended[0])
+		tracker.ended = tracker.ended[1:]
+	}
+}
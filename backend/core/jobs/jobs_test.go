@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"errors"
+	"seekourney/indexing"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	tracker := NewTracker()
+	job := tracker.Queue("c1")
+	assert.Equal(t, QUEUED, job.State)
+	assert.True(t, job.Active())
+	assert.False(t, job.Queued.IsZero())
+	assert.True(t, job.Started.IsZero())
+
+	assert.NoError(t, tracker.Start(job.ID))
+	assert.NoError(t, tracker.Progress(indexing.IndexingProgress{
+		Job:    job.ID,
+		Pushed: 10,
+		Failed: 1,
+	}))
+
+	job, ok := tracker.Job(job.ID)
+	assert.True(t, ok)
+	assert.Equal(t, RUNNING, job.State)
+	assert.Equal(t, 10, job.Pushed)
+	assert.Equal(t, 1, job.Failed)
+	assert.False(t, job.Started.IsZero())
+
+	finished, err := tracker.Finish(indexing.IndexingDone{
+		Job:      job.ID,
+		Complete: true,
+		Pushed:   12,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, DONE, finished.State)
+	assert.Equal(t, 12, finished.Pushed)
+	assert.Zero(t, finished.Failed)
+	assert.False(t, finished.Finished.IsZero())
+	assert.Empty(t, finished.Error)
+
+	// Ended jobs do not change anymore.
+	assert.ErrorIs(t, tracker.Start(job.ID), ErrEnded)
+	_, err = tracker.Cancel(job.ID)
+	assert.ErrorIs(t, err, ErrEnded)
+	assert.ErrorIs(
+		t,
+		tracker.Progress(indexing.IndexingProgress{Job: job.ID}),
+		ErrEnded,
+	)
+}
+
+func TestFinishIncomplete(t *testing.T) {
+	tracker := NewTracker()
+	job := tracker.Queue("c1")
+
+	finished, err := tracker.Finish(indexing.IndexingDone{
+		Job:    job.ID,
+		Pushed: 3,
+		Failed: 2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, FAILED, finished.State)
+	assert.Contains(t, finished.Error, "2 documents failed")
+}
+
+func TestFailCancel(t *testing.T) {
+	tracker := NewTracker()
+	failed := tracker.Queue("c1")
+	assert.NoError(t, tracker.Fail(failed.ID, errors.New("no indexer")))
+	failed, _ = tracker.Job(failed.ID)
+	assert.Equal(t, FAILED, failed.State)
+	assert.Equal(t, "no indexer", failed.Error)
+
+	cancelled := tracker.Queue("c1")
+	before, err := tracker.Cancel(cancelled.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, QUEUED, before.State)
+
+	// Not dispatched once cancelled.
+	assert.ErrorIs(t, tracker.Start(cancelled.ID), ErrEnded)
+	cancelled, _ = tracker.Job(cancelled.ID)
+	assert.Equal(t, CANCELLED, cancelled.State)
+
+	_, err = tracker.Cancel("unknown")
+	assert.ErrorIs(t, err, ErrUnknown)
+}
+
+func TestJobs(t *testing.T) {
+	tracker := NewTracker()
+	first := tracker.Queue("c1")
+	time.Sleep(time.Millisecond)
+	second := tracker.Queue("c2")
+	time.Sleep(time.Millisecond)
+	third := tracker.Queue("c1")
+	assert.NoError(t, tracker.Start(third.ID))
+
+	ids := func(jobs []Job) []indexing.JobID {
+		result := make([]indexing.JobID, len(jobs))
+		for i, job := range jobs {
+			result[i] = job.ID
+		}
+		return result
+	}
+
+	assert.Equal(
+		t,
+		[]indexing.JobID{third.ID, second.ID, first.ID},
+		ids(tracker.Jobs(Filter{})),
+	)
+	assert.Equal(
+		t,
+		[]indexing.JobID{third.ID, first.ID},
+		ids(tracker.Jobs(Filter{Collection: "c1"})),
+	)
+	assert.Equal(
+		t,
+		[]indexing.JobID{second.ID, first.ID},
+		ids(tracker.Jobs(Filter{State: QUEUED})),
+	)
+}
+
+func TestKeptJobs(t *testing.T) {
+	tracker := NewTracker()
+	active := tracker.Queue("c1")
+
+	ended := make([]indexing.JobID, 0, _KEPTJOBS_+1)
+	for range _KEPTJOBS_ + 1 {
+		job := tracker.Queue("c1")
+		assert.NoError(t, tracker.Fail(job.ID, errors.New("failed")))
+		ended = append(ended, job.ID)
+	}
+
+	// The oldest ended job is forgotten, active jobs are kept.
+	_, ok := tracker.Job(ended[0])
+	assert.False(t, ok)
+	_, ok = tracker.Job(ended[1])
+	assert.True(t, ok)
+	assert.Len(t, tracker.Jobs(Filter{State: FAILED}), _KEPTJOBS_)
+	_, ok = tracker.Job(active.ID)
+	assert.True(t, ok)
+}
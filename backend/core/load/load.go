@@ -0,0 +1,187 @@
+/*
+Package load indexes the local files of a collection within Core, without
+its indexer or a running server, such as from the command line. Every file
+is read as plain text, like the LocalText indexer does, so only collections
+of that indexer can be loaded, see CheckIndexer.
+
+Documents are stored in batches, and the documents of the collection not
+seen by a complete load are removed afterwards, see sweep.
+*/
+package load
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"seekourney/core/document"
+	"seekourney/core/indexAPI"
+	"seekourney/core/storage"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"seekourney/utils/normalize"
+	"time"
+)
+
+// _BATCHSIZE_ is the number of documents stored at once.
+const _BATCHSIZE_ int = 100
+
+// TEXTINDEXER is the name the LocalText indexer registers with.
+const TEXTINDEXER string = "LocalText"
+
+// Summary counts what a load did to the documents of a collection.
+type Summary struct {
+	Inserted  int
+	Updated   int
+	Unchanged int
+
+	// Failed counts files that could not be read or stored.
+	// Nothing is removed if any failed.
+	Failed int
+
+	// Removed are the paths of the documents not seen, ordered.
+	Removed []utils.Path
+}
+
+// CheckIndexer returns an error unless the collections of indexer can be
+// loaded, which only those of TEXTINDEXER can.
+func CheckIndexer(indexer indexAPI.IndexerData) error {
+	if indexer.Name == TEXTINDEXER {
+		return nil
+	}
+
+	return errors.New("only collections of the " + TEXTINDEXER +
+		" indexer can be loaded, index those of " + indexer.Name +
+		" with the server")
+}
+
+// Collection indexes the local files of collection, normalized with
+// normalizer, and removes its documents whose file was not seen.
+// URL collections, and those of other indexers than TEXTINDEXER,
+// can only be indexed by their indexer.
+// The summary counts the documents handled before an error.
+func Collection(
+	store storage.Store,
+	collection indexAPI.Collection,
+	normalizer normalize.Normalizer,
+) (Summary, error) {
+	summary := Summary{Removed: make([]utils.Path, 0)}
+	started := time.Now()
+
+	indexer, err := store.Indexer(collection.IndexerID)
+	if err != nil {
+		return summary, err
+	}
+	err = CheckIndexer(indexer)
+	if err != nil {
+		return summary, err
+	}
+
+	paths, err := Files(collection)
+	if err != nil {
+		return summary, err
+	}
+
+	batch := make([]document.Document, 0, _BATCHSIZE_)
+	for _, path := range paths {
+		raw, err := indexing.DocFromFile(path, collection.ID)
+		if err != nil {
+			log.Printf("Error reading %s: %s\n", path, err)
+			summary.Failed++
+			continue
+		}
+
+		batch = append(batch, document.Normalize(raw, normalizer))
+		if len(batch) == _BATCHSIZE_ {
+			err = storeBatch(store, batch, &summary)
+			if err != nil {
+				return summary, err
+			}
+			batch = make([]document.Document, 0, _BATCHSIZE_)
+		}
+	}
+
+	err = storeBatch(store, batch, &summary)
+	if err != nil || summary.Failed > 0 {
+		return summary, err
+	}
+
+	summary.Removed, err = store.SweepCollection(collection.ID, started)
+	return summary, err
+}
+
+// storeBatch stores docs and counts their outcomes in summary.
+func storeBatch(
+	store storage.Store,
+	docs []document.Document,
+	summary *Summary,
+) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	outcomes, err := store.UpsertDocuments(docs)
+	if err != nil {
+		return err
+	}
+
+	for i, outcome := range outcomes {
+		switch {
+		case outcome.Err != nil:
+			log.Printf("Error storing %s: %s\n", docs[i].Path, outcome.Err)
+			summary.Failed++
+		case outcome.Unchanged:
+			summary.Unchanged++
+		case outcome.Inserted:
+			summary.Inserted++
+		default:
+			summary.Updated++
+		}
+	}
+
+	return nil
+}
+
+// Files returns the paths of the files in collection, in directory order.
+// Subdirectories are only searched if the collection is recursive,
+// skipping those utils.WalkDirConfig forbids.
+func Files(collection indexAPI.Collection) ([]utils.Path, error) {
+	switch collection.SourceType {
+	case utils.FILE_SOURCE:
+		return []utils.Path{collection.Path}, nil
+
+	case utils.DIR_SOURCE:
+		// A missing directory would look empty to the walk,
+		// and every document would be removed.
+		_, err := os.Stat(string(collection.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		if collection.Recursive {
+			paths := make([]utils.Path, 0)
+			walk := utils.NewWalkDirConfig().WalkDir(collection.Path)
+			for path := range walk {
+				paths = append(paths, path)
+			}
+			return paths, nil
+		}
+
+		entries, err := os.ReadDir(string(collection.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		paths := make([]utils.Path, 0, len(entries))
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				path := filepath.Join(string(collection.Path), entry.Name())
+				paths = append(paths, utils.Path(path))
+			}
+		}
+		return paths, nil
+	}
+
+	return nil, errors.New("only file and directory collections can be " +
+		"loaded, index " + string(collection.Path) + " with its indexer")
+}
@@ -0,0 +1,163 @@
+package load
+
+import (
+	"os"
+	"path/filepath"
+	"seekourney/core/document"
+	"seekourney/core/indexAPI"
+	"seekourney/core/storage"
+	"seekourney/core/storage/embedded"
+	"seekourney/core/storage/storagetest"
+	"seekourney/utils"
+	"seekourney/utils/normalize"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// open returns an embedded store with a collection of dir.
+func open(t *testing.T, dir string) (storage.Store, indexAPI.Collection) {
+	store, err := embedded.Open(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, store.Close())
+	})
+
+	collection := storagetest.Collection("c1", "i1")
+	collection.Path = utils.Path(dir)
+
+	indexer := storagetest.Indexer("i1", 40000)
+	indexer.Name = TEXTINDEXER
+	assert.NoError(t, store.InsertIndexer(indexer))
+	assert.NoError(t, store.InsertCollection(collection))
+	return store, collection
+}
+
+// write creates a file with text in dir, and returns its path.
+func write(t *testing.T, dir string, name string, text string) utils.Path {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, []byte(text), 0644))
+	return utils.Path(path)
+}
+
+// find returns the stored document with path, if there is one.
+func find(
+	t *testing.T,
+	store storage.Store,
+	path utils.Path,
+) (document.Document, bool) {
+	docs, err := store.Documents()
+	assert.NoError(t, err)
+	for _, doc := range docs {
+		if doc.Path == path {
+			return doc, true
+		}
+	}
+	return document.Document{}, false
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	top := write(t, dir, "top.txt", "top")
+	nested := write(t, dir, "sub/nested.txt", "nested")
+	write(t, dir, ".git/config", "ignored")
+
+	collection := storagetest.Collection("c1", "i1")
+	collection.Path = utils.Path(dir)
+
+	paths, err := Files(collection)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []utils.Path{nested, top}, paths)
+
+	collection.Recursive = false
+	paths, err = Files(collection)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{top}, paths)
+
+	collection.SourceType = utils.FILE_SOURCE
+	collection.Path = top
+	paths, err = Files(collection)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{top}, paths)
+
+	collection.SourceType = utils.URL_SOURCE
+	_, err = Files(collection)
+	assert.Error(t, err)
+
+	collection.SourceType = utils.DIR_SOURCE
+	collection.Path = utils.Path(filepath.Join(dir, "missing"))
+	_, err = Files(collection)
+	assert.Error(t, err)
+}
+
+func TestCollection(t *testing.T) {
+	dir := t.TempDir()
+	first := write(t, dir, "first.txt", "Running words")
+	second := write(t, dir, "sub/second.txt", "other words")
+	store, collection := open(t, dir)
+
+	summary, err := Collection(store, collection, normalize.TO_LOWER)
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Inserted: 2, Removed: []utils.Path{}}, summary)
+
+	doc, found := find(t, store, first)
+	assert.True(t, found)
+	assert.Equal(t, utils.SOURCE_LOCAL, doc.Source)
+	assert.Equal(t, "first.txt", doc.Title)
+	assert.Contains(t, doc.Words, utils.Word("running"))
+
+	assert.NoError(t, os.Remove(string(second)))
+	write(t, dir, "first.txt", "changed words")
+
+	summary, err = Collection(store, collection, normalize.TO_LOWER)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		Summary{Updated: 1, Removed: []utils.Path{second}},
+		summary)
+
+	summary, err = Collection(store, collection, normalize.TO_LOWER)
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Unchanged: 1, Removed: []utils.Path{}}, summary)
+}
+
+func TestCollectionFailed(t *testing.T) {
+	dir := t.TempDir()
+	kept := utils.Path(filepath.Join(dir, "kept.txt"))
+	store, collection := open(t, dir)
+
+	_, err := store.UpsertDocuments([]document.Document{
+		storagetest.Document(kept, "c1", "kept"),
+	})
+	assert.NoError(t, err)
+
+	collection.SourceType = utils.FILE_SOURCE
+	collection.Path = kept
+
+	summary, err := Collection(store, collection, normalize.TO_LOWER)
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Failed: 1, Removed: []utils.Path{}}, summary)
+
+	_, found := find(t, store, kept)
+	assert.True(t, found)
+}
+
+func TestCollectionOtherIndexer(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "scan.pdf", "%PDF-1.7")
+	store, _ := open(t, dir)
+
+	assert.NoError(t, store.InsertIndexer(storagetest.Indexer("i2", 40001)))
+	collection := storagetest.Collection("c2", "i2")
+	collection.Path = utils.Path(dir)
+	assert.NoError(t, store.InsertCollection(collection))
+
+	// Its indexer may not read files as plain text.
+	summary, err := Collection(store, collection, normalize.TO_LOWER)
+	assert.Error(t, err)
+	assert.Equal(t, Summary{Removed: []utils.Path{}}, summary)
+
+	docs, err := store.Documents()
+	assert.NoError(t, err)
+	assert.Empty(t, docs)
+}
@@ -11,12 +11,19 @@ func init() {
 	timing.Init(timing.Default())
 }
 
-// Usage for running server or client: `go run . <server | client>`
+// Usage: `go run . [command] [flags] [arguments]`, see server.Main.
+// Running the server: `go run . [serve]`
+// Indexing a local path: `go run . load <path>`
+// Reindexing a collection: `go run . reindex <collection id>`
+// Showing statistics: `go run . stats`
+// Migrating the database: `go run . migrate [status | up]`
+// Exporting the index: `go run . export [file]`
+// Importing an export: `go run . import <file> [resume after path]`
 func main() {
 	t := timing.Measure(timing.Main)
-	defer t.Stop()
 
-	// check commandline args to run server or client
-	server.Run(os.Args[1:])
+	status := server.Main(os.Args[1:])
 
+	t.Stop()
+	os.Exit(status)
 }
@@ -0,0 +1,327 @@
+package renormalize
+
+import (
+	"errors"
+	"log"
+	"seekourney/core/document"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"seekourney/utils/normalize"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// _BATCHSIZE_ is the number of documents rewritten in one batch.
+	_BATCHSIZE_ int = 100
+)
+
+// Status describes the progress of a renormalization run.
+// Done and Failed count documents, and never exceed Total.
+type Status struct {
+	Running    bool
+	Normalizer normalize.Normalizer
+
+	// Collection is the collection being renormalized,
+	// empty if every document is renormalized.
+	Collection indexing.CollectionID
+
+	Total    int
+	Done     int
+	Failed   int
+	Started  time.Time
+	Finished time.Time
+
+	// Error is set if the run was aborted, empty otherwise.
+	Error string
+}
+
+// Revision is a kept revision of a document, see the revision package.
+type Revision struct {
+	Number   int
+	Document document.Document
+}
+
+// Store is the storage documents are renormalized in, see storage.Store.
+// An empty collection means every document.
+type Store interface {
+	// CountDocuments returns the number of documents in collection.
+	CountDocuments(collection indexing.CollectionID) (int, error)
+
+	// DocumentsAfter returns at most limit documents of collection,
+	// ordered by path, starting after the given path.
+	DocumentsAfter(
+		after utils.Path,
+		collection indexing.CollectionID,
+		limit int,
+	) ([]document.Document, error)
+
+	// DocumentRevisions returns the kept revisions of the documents with
+	// the given paths, with their raw texts, ordered by path and number.
+	DocumentRevisions(paths []utils.Path) ([]Revision, error)
+
+	// DeletedRevisionsAfter returns the kept revisions of collection of at
+	// most limit deleted documents, ordered by path and number, starting
+	// after the given path, with their raw texts.
+	DeletedRevisionsAfter(
+		after utils.Path,
+		collection indexing.CollectionID,
+		limit int,
+	) ([]Revision, error)
+
+	// UpdateWords replaces the stored words of docs and revisions, all or
+	// none of them. Only versions that still have the hash they were read
+	// with are updated: a document replaced since is skipped, unless it was
+	// kept as the newest revision of its path, which is updated instead.
+	UpdateWords(docs []document.Document, revisions []Revision) error
+
+	// SetCollectionNormalizer sets the normalizer of collection.
+	SetCollectionNormalizer(
+		collection indexing.CollectionID,
+		normalizer normalize.Normalizer,
+	) error
+}
+
+/*
+Renormalizer rebuilds the stored words of documents and their revisions from
+their raw text, without asking any indexer to read the original files again.
+Only one run can be active at a time. Documents are rewritten in small
+transactions, so searching keeps working while a run is in progress.
+It also keeps the normalizer in use for every document, which a run over
+every document replaces when it completes, see Target. A run over one
+collection can only rebuild its words with the normalizer in use, since
+queries are normalized the same way for every collection.
+*/
+type Renormalizer struct {
+	mutex      sync.Mutex
+	status     Status
+	normalizer normalize.Normalizer
+}
+
+// New creates a new idle Renormalizer, with normalizer in use.
+func New(normalizer normalize.Normalizer) *Renormalizer {
+	return &Renormalizer{normalizer: normalizer}
+}
+
+// Status returns a snapshot of the progress of the latest run.
+func (renorm *Renormalizer) Status() Status {
+	renorm.mutex.Lock()
+	defer renorm.mutex.Unlock()
+
+	return renorm.status
+}
+
+/*
+Target returns the normalizer newly pushed documents and queries should use.
+While a run is active it is the normalizer being applied, so that documents
+arriving during the run do not end up with stale words, and queries match
+the documents already rewritten. Otherwise it is the normalizer in use.
+*/
+func (renorm *Renormalizer) Target() normalize.Normalizer {
+	renorm.mutex.Lock()
+	defer renorm.mutex.Unlock()
+
+	if renorm.status.Running {
+		return renorm.status.Normalizer
+	}
+
+	return renorm.normalizer
+}
+
+// Start begins renormalizing documents in the background.
+// If collection is empty every document is renormalized, otherwise
+// normalizer must be the one in use.
+// onChange is called with the status after every batch of documents is
+// rewritten, and once the run has finished, it may be nil.
+func (renorm *Renormalizer) Start(
+	store Store,
+	normalizer normalize.Normalizer,
+	collection indexing.CollectionID,
+	onChange func(Status),
+) error {
+	if !normalizer.IsValid() {
+		return errors.New(
+			"invalid normalizer " + strconv.Itoa(int(normalizer)))
+	}
+
+	renorm.mutex.Lock()
+	defer renorm.mutex.Unlock()
+
+	if renorm.status.Running {
+		return errors.New("renormalization is already running")
+	}
+
+	if collection != "" && normalizer != renorm.normalizer {
+		return errors.New("a collection can only be renormalized with the " +
+			"normalizer in use " + strconv.Itoa(int(renorm.normalizer)))
+	}
+
+	total, err := store.CountDocuments(collection)
+	if err != nil {
+		return err
+	}
+
+	renorm.status = Status{
+		Running:    true,
+		Normalizer: normalizer,
+		Collection: collection,
+		Total:      total,
+		Started:    time.Now(),
+	}
+
+	go renorm.run(store, normalizer, collection, onChange)
+
+	return nil
+}
+
+// run rewrites all matching documents batch by batch, then the revisions
+// of deleted documents, and records the progress in the status.
+func (renorm *Renormalizer) run(
+	store Store,
+	normalizer normalize.Normalizer,
+	collection indexing.CollectionID,
+	onChange func(Status),
+) {
+	var runErr error
+	after := utils.Path("")
+
+	for {
+		docs, err := store.DocumentsAfter(after, collection, _BATCHSIZE_)
+		if err != nil {
+			runErr = err
+			break
+		}
+
+		if len(docs) == 0 {
+			break
+		}
+
+		done, failed, err := rewriteBatch(store, docs, normalizer)
+		status := renorm.progress(done, failed)
+		if onChange != nil {
+			onChange(status)
+		}
+		if err != nil {
+			runErr = err
+			break
+		}
+
+		after = docs[len(docs)-1].Path
+	}
+
+	if runErr == nil {
+		runErr = rewriteDeleted(store, normalizer, collection)
+	}
+
+	if runErr == nil {
+		// Stored on the collections, so it is used the next time they are
+		// indexed.
+		runErr = store.SetCollectionNormalizer(collection, normalizer)
+	}
+
+	renorm.mutex.Lock()
+	renorm.status.Running = false
+	renorm.status.Finished = time.Now()
+	if runErr != nil {
+		log.Printf("Renormalization aborted: %s\n", runErr)
+		renorm.status.Error = runErr.Error()
+	} else if collection == "" {
+		renorm.normalizer = normalizer
+	}
+	status := renorm.status
+	renorm.mutex.Unlock()
+
+	log.Printf(
+		"Renormalized %d of %d documents (%d failed)\n",
+		status.Done,
+		status.Total,
+		status.Failed,
+	)
+
+	if onChange != nil {
+		onChange(status)
+	}
+}
+
+// progress adds the given counts to the status, and returns it.
+func (renorm *Renormalizer) progress(done int, failed int) Status {
+	renorm.mutex.Lock()
+	defer renorm.mutex.Unlock()
+
+	renorm.status.Done += done
+	renorm.status.Failed += failed
+	return renorm.status
+}
+
+// rewriteBatch renormalizes docs with their revisions, so searches as of a
+// past time match the same words, and stores their new words in a single
+// batch. Returns the number of rewritten and failed documents.
+func rewriteBatch(
+	store Store,
+	docs []document.Document,
+	normalizer normalize.Normalizer,
+) (int, int, error) {
+	paths := make([]utils.Path, len(docs))
+	renormalized := make([]document.Document, len(docs))
+	for i, doc := range docs {
+		paths[i] = doc.Path
+		renormalized[i] = document.Renormalize(doc, normalizer)
+	}
+
+	revisions, err := store.DocumentRevisions(paths)
+	if err != nil {
+		return 0, len(docs), err
+	}
+
+	err = store.UpdateWords(renormalized,
+		renormalizeRevisions(revisions, normalizer))
+	if err != nil {
+		return 0, len(docs), err
+	}
+
+	return len(docs), 0, nil
+}
+
+// rewriteDeleted renormalizes the revisions kept of deleted documents of
+// collection batch by batch, so searches as of before they were deleted
+// match the same words. They are not counted in the status.
+func rewriteDeleted(
+	store Store,
+	normalizer normalize.Normalizer,
+	collection indexing.CollectionID,
+) error {
+	after := utils.Path("")
+
+	for {
+		revisions, err := store.DeletedRevisionsAfter(
+			after,
+			collection,
+			_BATCHSIZE_,
+		)
+		if err != nil || len(revisions) == 0 {
+			return err
+		}
+
+		err = store.UpdateWords(nil,
+			renormalizeRevisions(revisions, normalizer))
+		if err != nil {
+			return err
+		}
+
+		after = revisions[len(revisions)-1].Document.Path
+	}
+}
+
+// renormalizeRevisions renormalizes the words of revisions in place,
+// and returns them.
+func renormalizeRevisions(
+	revisions []Revision,
+	normalizer normalize.Normalizer,
+) []Revision {
+	for i, rev := range revisions {
+		revisions[i].Document = document.Renormalize(rev.Document, normalizer)
+	}
+
+	return revisions
+}
@@ -0,0 +1,281 @@
+package renormalize_test
+
+import (
+	"errors"
+	"fmt"
+	"seekourney/core/document"
+	"seekourney/core/renormalize"
+	"seekourney/core/search"
+	"seekourney/core/storage/embedded"
+	"seekourney/core/storage/storagetest"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"seekourney/utils/normalize"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openStore opens an embedded store with amount documents in collection c1,
+// and one in c2.
+func openStore(t *testing.T, amount int) *embedded.Store {
+	store, err := embedded.Open(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, store.Close())
+	})
+
+	assert.NoError(t, store.InsertIndexer(storagetest.Indexer("i1", 40000)))
+	for _, id := range []indexing.CollectionID{"c1", "c2"} {
+		assert.NoError(
+			t, store.InsertCollection(storagetest.Collection(id, "i1")))
+	}
+
+	docs := make([]document.Document, 0, amount+1)
+	for i := range amount {
+		path := utils.Path(fmt.Sprintf("/c1/%03d", i))
+		docs = append(docs, storagetest.Document(path, "c1", "Running dogs"))
+	}
+	docs = append(docs, storagetest.Document("/c2/doc", "c2", "Running dogs"))
+	_, err = store.UpsertDocuments(docs)
+	assert.NoError(t, err)
+
+	return store
+}
+
+// run starts renormalizing with normalizer, and returns every status
+// reported until the run has finished.
+func run(
+	t *testing.T,
+	renorm *renormalize.Renormalizer,
+	store renormalize.Store,
+	normalizer normalize.Normalizer,
+	collection indexing.CollectionID,
+	onChange func(renormalize.Status),
+) []renormalize.Status {
+	statuses := make(chan renormalize.Status, 100)
+	report := func(status renormalize.Status) {
+		if onChange != nil {
+			onChange(status)
+		}
+		statuses <- status
+	}
+	err := renorm.Start(store, normalizer, collection, report)
+	assert.NoError(t, err)
+
+	reported := make([]renormalize.Status, 0)
+	for status := range statuses {
+		reported = append(reported, status)
+		if !status.Running {
+			return reported
+		}
+	}
+
+	return reported
+}
+
+// words returns the stored words of the document at path.
+func words(t *testing.T, store *embedded.Store, path utils.Path) []utils.Word {
+	docs, err := store.Documents()
+	assert.NoError(t, err)
+
+	result := make([]utils.Word, 0)
+	for _, doc := range docs {
+		if doc.Path == path {
+			for word := range doc.Words {
+				result = append(result, word)
+			}
+		}
+	}
+
+	return result
+}
+
+func TestRun(t *testing.T) {
+	store := openStore(t, 250)
+	renorm := renormalize.New(normalize.TO_LOWER)
+
+	// Queries use the new normalizer as soon as documents are rewritten.
+	targets := make([]normalize.Normalizer, 0)
+	statuses := run(t, renorm, store, normalize.STEMMING, "",
+		func(status renormalize.Status) {
+			if status.Running {
+				targets = append(targets, renorm.Target())
+			}
+		},
+	)
+
+	// Reported after every batch, and when finished.
+	done := make([]int, len(statuses))
+	for i, status := range statuses {
+		done[i] = status.Done
+	}
+	assert.Equal(t, []int{100, 200, 251, 251}, done)
+	assert.Equal(t, []normalize.Normalizer{
+		normalize.STEMMING, normalize.STEMMING, normalize.STEMMING,
+	}, targets)
+
+	status := renorm.Status()
+	assert.Equal(t, statuses[len(statuses)-1], status)
+	assert.False(t, status.Running)
+	assert.Equal(t, 251, status.Total)
+	assert.Zero(t, status.Failed)
+	assert.Empty(t, status.Error)
+	assert.False(t, status.Finished.IsZero())
+
+	stemmed := []utils.Word{"run", "dog"}
+	assert.ElementsMatch(t, stemmed, words(t, store, "/c1/042"))
+	assert.ElementsMatch(t, stemmed, words(t, store, "/c2/doc"))
+
+	// The new normalizer is in use, and stored on every collection.
+	assert.Equal(t, normalize.STEMMING, renorm.Target())
+	collection, err := store.Collection("c2")
+	assert.NoError(t, err)
+	assert.Equal(t, normalize.STEMMING, collection.Normalfunc)
+}
+
+func TestRunCollection(t *testing.T) {
+	store := openStore(t, 3)
+	renorm := renormalize.New(normalize.STEMMING)
+
+	// Queries are normalized alike for every collection.
+	err := renorm.Start(store, normalize.TO_LOWER, "c1", nil)
+	assert.ErrorContains(t, err, "normalizer in use")
+	assert.False(t, renorm.Status().Running)
+
+	statuses := run(t, renorm, store, normalize.STEMMING, "c1", nil)
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, 3, renorm.Status().Done)
+
+	// Only documents of c1 are rewritten.
+	stemmed := []utils.Word{"run", "dog"}
+	assert.ElementsMatch(t, stemmed, words(t, store, "/c1/000"))
+	assert.ElementsMatch(
+		t,
+		[]utils.Word{"Running", "dogs"},
+		words(t, store, "/c2/doc"),
+	)
+
+	assert.Equal(t, normalize.STEMMING, renorm.Target())
+	collection, err := store.Collection("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, normalize.STEMMING, collection.Normalfunc)
+	collection, err = store.Collection("c2")
+	assert.NoError(t, err)
+	assert.Equal(t, normalize.TO_LOWER, collection.Normalfunc)
+}
+
+func TestRunRevisions(t *testing.T) {
+	store := openStore(t, 2)
+	for _, id := range []indexing.CollectionID{"c1", "c2"} {
+		collection, err := store.Collection(id)
+		assert.NoError(t, err)
+		collection.Revisions = 1
+		assert.NoError(t, store.UpdateCollection(collection))
+	}
+
+	before := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	replaced := storagetest.Document("/c2/doc", "c2", "Walking cats")
+	replaced.LastIndexed = before.Add(24 * time.Hour)
+	_, err := store.UpsertDocument(replaced)
+	assert.NoError(t, err)
+
+	// Deleted documents are renormalized as well.
+	_, err = store.DeleteDocument("/c1/001")
+	assert.NoError(t, err)
+
+	renorm := renormalize.New(normalize.TO_LOWER)
+	run(t, renorm, store, normalize.STEMMING, "", nil)
+
+	// Searches as of before the replacement match the stemmed words too.
+	results, err := store.Score(
+		[]utils.Word{"run"},
+		search.Filter{AsOf: before},
+		10,
+	)
+	assert.NoError(t, err)
+	paths := make([]utils.Path, len(results))
+	for i, result := range results {
+		paths[i] = result.Path
+	}
+	assert.ElementsMatch(t,
+		[]utils.Path{"/c1/000", "/c1/001", "/c2/doc"}, paths)
+}
+
+// failingStore fails to update words after updates succeeded.
+type failingStore struct {
+	renormalize.Store
+	updates int
+}
+
+func (store *failingStore) UpdateWords(
+	docs []document.Document,
+	revisions []renormalize.Revision,
+) error {
+	if store.updates == 0 {
+		return errors.New("disk full")
+	}
+	store.updates--
+	return store.Store.UpdateWords(docs, revisions)
+}
+
+func TestRunFailure(t *testing.T) {
+	store := openStore(t, 250)
+	renorm := renormalize.New(normalize.TO_LOWER)
+
+	statuses := run(
+		t,
+		renorm,
+		&failingStore{Store: store, updates: 1},
+		normalize.STEMMING,
+		"",
+		nil,
+	)
+	assert.Len(t, statuses, 3)
+
+	status := renorm.Status()
+	assert.False(t, status.Running)
+	assert.Equal(t, 100, status.Done)
+	assert.Equal(t, 100, status.Failed)
+	assert.Equal(t, "disk full", status.Error)
+
+	// The normalizer in use and of the collections are kept.
+	assert.Equal(t, normalize.TO_LOWER, renorm.Target())
+	collection, err := store.Collection("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, normalize.TO_LOWER, collection.Normalfunc)
+}
+
+func TestStartErrors(t *testing.T) {
+	store := openStore(t, 1)
+	renorm := renormalize.New(normalize.TO_LOWER)
+
+	assert.Error(t, renorm.Start(store, normalize.Normalizer(42), "", nil))
+	assert.False(t, renorm.Status().Running)
+
+	// Only one run at a time.
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	statuses := make(chan renormalize.Status, 10)
+	report := func(status renormalize.Status) {
+		if status.Running {
+			close(blocked)
+			<-release
+		}
+		statuses <- status
+	}
+	err := renorm.Start(store, normalize.STEMMING, "", report)
+	assert.NoError(t, err)
+
+	<-blocked
+	assert.Error(t, renorm.Start(store, normalize.STEMMING, "", nil))
+	close(release)
+	for status := range statuses {
+		if !status.Running {
+			break
+		}
+	}
+
+	run(t, renorm, store, normalize.TO_LOWER, "", nil)
+}
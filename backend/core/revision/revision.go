@@ -0,0 +1,210 @@
+/*
+Package revision keeps previous versions of documents. A collection keeps the
+last Revisions versions of each of its documents, see indexAPI.Collection.
+When a document is replaced by one with other content, see storage.Unchanged,
+the replaced document becomes a revision. A deleted document becomes a
+revision too, marked with when it was deleted, so searches as of a past time
+still find it. Revisions are deleted together with their collection.
+
+Revisions are numbered from 1 for every path, and the current document has
+the number after the newest revision. Two revisions can be compared with
+Diff, and a search can be made as of a past time, see search.Filter.
+*/
+package revision
+
+import (
+	"seekourney/utils"
+	"strings"
+	"time"
+)
+
+// Revision is a version of a document.
+type Revision struct {
+	Number int
+
+	// Indexed is when this version was indexed.
+	Indexed time.Time
+
+	// Hash is the content hash of this version, see document.ContentHash.
+	Hash string
+
+	// Current is true for the stored document itself.
+	Current bool
+}
+
+// Store is the storage keeping revisions, see storage.Store.
+type Store interface {
+	// Revisions returns the revisions of the document with path,
+	// oldest first, ending with the current document.
+	Revisions(path utils.Path) ([]Revision, error)
+
+	// RevisionText returns the raw text of the revision with the given
+	// number of the document with path, which may be the current document.
+	RevisionText(path utils.Path, number int) (string, error)
+}
+
+// Op says which of the texts compared by Diff a line is in.
+type Op string
+
+const (
+	// EQUAL lines are in both texts.
+	EQUAL Op = "="
+
+	// DELETE lines are only in the text compared from.
+	DELETE Op = "-"
+
+	// INSERT lines are only in the text compared to.
+	INSERT Op = "+"
+)
+
+// _MAXEDITS_ is the most differences Diff looks for. Finding d differences
+// takes memory proportional to d squared, so texts differing more are
+// diffed as all lines of one replaced by all lines of the other.
+const _MAXEDITS_ = 2000
+
+// Line is a line of a Diff.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+/*
+Diff compares the texts from and to line by line, and returns the lines of
+both in order, each marked with whether it was kept, deleted or inserted.
+As few lines as possible are deleted and inserted, and deletions come before
+insertions where both are possible.
+
+It uses the algorithm by Eugene W. Myers, taking time proportional to the
+number of lines times the number of differences.
+See: http://www.xmailserver.org/diff2.pdf
+Texts with more differences than _MAXEDITS_ are diffed by deleting every
+line of from and inserting every line of to.
+*/
+func Diff(from string, to string) []Line {
+	a := splitLines(from)
+	b := splitLines(to)
+
+	trace := shortestEdit(a, b)
+	if trace == nil {
+		return replace(a, b)
+	}
+
+	lines := make([]Line, 0, max(len(a), len(b)))
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+		previous := previousDiagonal(trace[d], d, k)
+		previousX := trace[d].at(previous)
+		previousY := previousX - previous
+
+		for x > previousX && y > previousY {
+			lines = append(lines, Line{Op: EQUAL, Text: a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == previousX {
+				lines = append(lines, Line{Op: INSERT, Text: b[y-1]})
+			} else {
+				lines = append(lines, Line{Op: DELETE, Text: a[x-1]})
+			}
+		}
+
+		x, y = previousX, previousY
+	}
+
+	// Lines were found from the end.
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	return lines
+}
+
+// frontier holds how far along a and b every diagonal k reaches,
+// after a number of differences d. Diagonals go from -d to d,
+// only every other one is used.
+type frontier struct {
+	d int
+	x []int
+}
+
+// at returns how far along a diagonal k reaches.
+// Diagonals outside the frontier have not been reached.
+func (f frontier) at(k int) int {
+	if k < -f.d || k > f.d {
+		return 0
+	}
+	return f.x[k+f.d]
+}
+
+// previousDiagonal returns the diagonal the shortest edit reaching
+// diagonal k with d differences came from, given the frontier before it.
+// Moving down inserts a line of b, moving right deletes a line of a.
+func previousDiagonal(f frontier, d int, k int) int {
+	if k == -d || (k != d && f.at(k-1) < f.at(k+1)) {
+		return k + 1
+	}
+	return k - 1
+}
+
+// shortestEdit finds the fewest differences needed to turn a into b.
+// Returns the frontier before every number of differences,
+// up to the one reaching the end of both,
+// or nil if more than _MAXEDITS_ differences are needed.
+func shortestEdit(a []string, b []string) []frontier {
+	trace := make([]frontier, 0)
+	current := frontier{d: 0, x: []int{0}}
+
+	for d := 0; ; d++ {
+		if d > _MAXEDITS_ {
+			return nil
+		}
+		trace = append(trace, current)
+
+		next := frontier{d: d, x: make([]int, 2*d+1)}
+		for k := -d; k <= d; k += 2 {
+			x := current.at(k + 1)
+			if previousDiagonal(current, d, k) == k-1 {
+				x = current.at(k-1) + 1
+			}
+			y := x - k
+
+			for x < len(a) && y < len(b) && a[x] == b[y] {
+				x++
+				y++
+			}
+			next.x[k+d] = x
+
+			if x >= len(a) && y >= len(b) {
+				return trace
+			}
+		}
+
+		current = next
+	}
+}
+
+// replace returns a diff deleting every line of a and inserting every line
+// of b.
+func replace(a []string, b []string) []Line {
+	lines := make([]Line, 0, len(a)+len(b))
+	for _, text := range a {
+		lines = append(lines, Line{Op: DELETE, Text: text})
+	}
+	for _, text := range b {
+		lines = append(lines, Line{Op: INSERT, Text: text})
+	}
+
+	return lines
+}
+
+// splitLines splits text into lines, without their line breaks.
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
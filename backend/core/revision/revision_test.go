@@ -0,0 +1,98 @@
+package revision
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	assert.Empty(t, Diff("", ""))
+
+	assert.Equal(t, []Line{
+		{Op: INSERT, Text: "a"},
+		{Op: INSERT, Text: "b"},
+	}, Diff("", "a\nb\n"))
+
+	assert.Equal(t, []Line{
+		{Op: EQUAL, Text: "title"},
+		{Op: DELETE, Text: "old line"},
+		{Op: INSERT, Text: "new line"},
+		{Op: EQUAL, Text: "kept"},
+		{Op: INSERT, Text: "added"},
+	}, Diff("title\nold line\nkept", "title\nnew line\nkept\nadded"))
+
+	assert.Equal(t, []Line{
+		{Op: DELETE, Text: "a"},
+		{Op: EQUAL, Text: "b"},
+		{Op: EQUAL, Text: "c"},
+	}, Diff("a\nb\nc", "b\nc"))
+}
+
+// apply rebuilds both texts compared by a diff.
+func apply(lines []Line) (string, string) {
+	from := make([]string, 0)
+	to := make([]string, 0)
+	for _, line := range lines {
+		if line.Op != INSERT {
+			from = append(from, line.Text)
+		}
+		if line.Op != DELETE {
+			to = append(to, line.Text)
+		}
+	}
+
+	return strings.Join(from, "\n"), strings.Join(to, "\n")
+}
+
+func TestDiffRandom(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	text := func() string {
+		lines := make([]string, random.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(4)))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	for range 200 {
+		from, to := text(), text()
+		lines := Diff(from, to)
+
+		rebuiltFrom, rebuiltTo := apply(lines)
+		assert.Equal(t, from, rebuiltFrom)
+		assert.Equal(t, to, rebuiltTo)
+
+		// A diff of a text with itself changes nothing.
+		for _, line := range Diff(from, from) {
+			assert.Equal(t, EQUAL, line.Op)
+		}
+	}
+}
+
+func TestDiffTooManyEdits(t *testing.T) {
+	from := make([]string, _MAXEDITS_)
+	to := make([]string, _MAXEDITS_)
+	for i := range from {
+		from[i] = "old " + strconv.Itoa(i)
+		to[i] = "new " + strconv.Itoa(i)
+	}
+
+	lines := Diff(strings.Join(from, "\n"), strings.Join(to, "\n"))
+	assert.Len(t, lines, 2*_MAXEDITS_)
+	for i, line := range lines[:_MAXEDITS_] {
+		assert.Equal(t, Line{Op: DELETE, Text: from[i]}, line)
+	}
+	for i, line := range lines[_MAXEDITS_:] {
+		assert.Equal(t, Line{Op: INSERT, Text: to[i]}, line)
+	}
+
+	// Texts differing little are still diffed line by line.
+	to = append(append([]string{}, from[1:]...), "added")
+	lines = Diff(strings.Join(from, "\n"), strings.Join(to, "\n"))
+	assert.Len(t, lines, _MAXEDITS_+1)
+	assert.Equal(t, Line{Op: DELETE, Text: from[0]}, lines[0])
+}
@@ -0,0 +1,210 @@
+package search
+
+import (
+	"container/list"
+	"seekourney/core/config"
+	"seekourney/utils"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options are the settings of a search, besides the query itself.
+// Limit is the maximum number of results, it must be positive.
+// AsOf searches documents as they were at that time if not zero,
+// see Filter.
+type Options struct {
+	Limit int
+	AsOf  time.Time
+}
+
+// DefaultOptions returns the options used when a request specifies none.
+func DefaultOptions() Options {
+	return Options{
+		Limit: _RESULTAMOUNT_,
+	}
+}
+
+// CacheStats are the counters of a Cache, as reported to clients.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+	Capacity  int
+
+	// Generation is the current index generation, see Cache.Invalidate.
+	Generation uint64
+}
+
+// cacheEntry is a cached search, valid for a single index generation.
+type cacheEntry struct {
+	key        string
+	generation uint64
+	results    []SearchResult
+}
+
+/*
+Cache is a least recently used cache of search results.
+It is safe for concurrent use.
+
+Every entry is tagged with the index generation it was computed in.
+Whenever the index changes the generation is bumped with Invalidate,
+which makes every older entry a miss, without having to find them.
+Stale entries are dropped when they are looked up or fall out of the cache.
+*/
+type Cache struct {
+	mutex      sync.Mutex
+	capacity   int
+	entries    map[string]*list.Element
+	order      *list.List
+	generation uint64
+	hits       uint64
+	misses     uint64
+	evictions  uint64
+}
+
+// NewCache creates an empty cache holding at most capacity searches.
+// A capacity of zero or less disables caching.
+func NewCache(capacity int) *Cache {
+	return &Cache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Generation returns the current index generation.
+// Read it before searching, and pass it to Put with the results,
+// so results computed while the index changed are never served.
+func (cache *Cache) Generation() uint64 {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return cache.generation
+}
+
+// Invalidate bumps the index generation, making every cached search stale.
+// Call it whenever documents are inserted, updated or deleted.
+func (cache *Cache) Invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+}
+
+// Get returns the cached results for key,
+// if they were computed in the current generation.
+func (cache *Cache) Get(key string) ([]SearchResult, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		cache.misses++
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if entry.generation != cache.generation {
+		cache.remove(element)
+		cache.misses++
+		return nil, false
+	}
+
+	cache.order.MoveToFront(element)
+	cache.hits++
+
+	return slices.Clone(entry.results), true
+}
+
+// Put stores results for key, computed in the given generation.
+// Results from an older generation are not stored.
+func (cache *Cache) Put(
+	key string,
+	generation uint64,
+	results []SearchResult,
+) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.capacity <= 0 || generation != cache.generation {
+		return
+	}
+
+	entry := &cacheEntry{
+		key:        key,
+		generation: generation,
+		results:    slices.Clone(results),
+	}
+
+	if element, ok := cache.entries[key]; ok {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+		return
+	}
+
+	cache.entries[key] = cache.order.PushFront(entry)
+
+	for cache.order.Len() > cache.capacity {
+		cache.remove(cache.order.Back())
+		cache.evictions++
+	}
+}
+
+// Stats returns a snapshot of the cache counters.
+func (cache *Cache) Stats() CacheStats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return CacheStats{
+		Hits:       cache.hits,
+		Misses:     cache.misses,
+		Evictions:  cache.evictions,
+		Size:       cache.order.Len(),
+		Capacity:   cache.capacity,
+		Generation: cache.generation,
+	}
+}
+
+// remove removes element from the cache, the mutex must be held.
+func (cache *Cache) remove(element *list.Element) {
+	entry := cache.order.Remove(element).(*cacheEntry)
+	delete(cache.entries, entry.key)
+}
+
+// cacheKey builds the key of a parsed query and its options.
+// Queries that are searched the same way get the same key,
+// regardless of word order, casing or how words are normalized.
+func cacheKey(
+	config *config.Config,
+	parsedQuery utils.ParsedQuery,
+	options Options,
+) string {
+	terms := make([]string, 0)
+	for _, term := range queryTerms(config, parsedQuery) {
+		terms = append(terms, string(term))
+	}
+	slices.Sort(terms)
+
+	sortedSet := func(words []string) string {
+		set := slices.Clone(words)
+		slices.Sort(set)
+		return strings.Join(slices.Compact(set), " ")
+	}
+
+	// Quotes are matched in order, so they are kept as is.
+	// Each part is quoted, so no two queries can produce the same key.
+	parts := []string{
+		strconv.Quote(strings.Join(terms, " ")),
+		strconv.Quote(sortedSet(parsedQuery.PlusWords)),
+		strconv.Quote(sortedSet(parsedQuery.MinusWords)),
+		strconv.Quote(strings.Join(parsedQuery.Quotes, "\"")),
+		strconv.Itoa(options.Limit),
+		strconv.FormatInt(options.AsOf.UnixNano(), 10),
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,141 @@
+package search
+
+import (
+	"seekourney/core/config"
+	"seekourney/utils"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cacheResults returns a single result, identifying the cached entry.
+func cacheResults(name string) []SearchResult {
+	return []SearchResult{{Path: utils.Path(name), Score: 1}}
+}
+
+func TestCacheHitAndMiss(t *testing.T) {
+	cache := NewCache(2)
+
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+
+	cache.Put("a", cache.Generation(), cacheResults("a"))
+	results, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, cacheResults("a"), results)
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Size)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(2)
+	generation := cache.Generation()
+
+	cache.Put("a", generation, cacheResults("a"))
+	cache.Put("b", generation, cacheResults("b"))
+
+	// Using "a" makes "b" the least recently used entry.
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+
+	cache.Put("c", generation, cacheResults("c"))
+
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	_, ok = cache.Get("a")
+	assert.True(t, ok)
+	_, ok = cache.Get("c")
+	assert.True(t, ok)
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Size)
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	cache := NewCache(10)
+	before := cache.Generation()
+
+	cache.Put("a", before, cacheResults("a"))
+	cache.Invalidate()
+
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Stats().Size)
+
+	// Results computed before the index changed are not stored.
+	cache.Put("a", before, cacheResults("a"))
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+
+	cache.Put("a", cache.Generation(), cacheResults("a"))
+	_, ok = cache.Get("a")
+	assert.True(t, ok)
+}
+
+func TestCacheDisabled(t *testing.T) {
+	cache := NewCache(0)
+
+	cache.Put("a", cache.Generation(), cacheResults("a"))
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Stats().Size)
+}
+
+func TestCacheReturnsCopies(t *testing.T) {
+	cache := NewCache(10)
+	results := cacheResults("a")
+
+	cache.Put("a", cache.Generation(), results)
+	results[0].Path = "changed"
+
+	cached, _ := cache.Get("a")
+	cached[0].Path = "changed again"
+
+	cached, _ = cache.Get("a")
+	assert.Equal(t, cacheResults("a"), cached)
+}
+
+func TestCacheKey(t *testing.T) {
+	conf := config.New()
+	key := func(query string, limit int) string {
+		parsed := parseQuery(conf, utils.Query(query))
+		return cacheKey(conf, parsed, Options{Limit: limit})
+	}
+
+	assert.Equal(t, key("apple banana", 10), key("banana apple", 10))
+	assert.Equal(t, key("+apple -pear", 10), key("-pear +apple", 10))
+	assert.NotEqual(t, key("apple", 10), key("apple", 20))
+	assert.NotEqual(t, key("apple", 10), key("+apple", 10))
+	assert.NotEqual(t, key("apple", 10), key("-apple", 10))
+	assert.NotEqual(t, key("\"a b\" \"c\"", 10), key("\"c\" \"a b\"", 10))
+}
+
+func TestCacheConcurrentUse(t *testing.T) {
+	cache := NewCache(8)
+	done := make(chan bool)
+
+	for worker := range 4 {
+		go func() {
+			for i := range 100 {
+				key := strconv.Itoa((worker + i) % 16)
+				cache.Put(key, cache.Generation(), cacheResults(key))
+				cache.Get(key)
+				if i%10 == 0 {
+					cache.Invalidate()
+				}
+			}
+			done <- true
+		}()
+	}
+
+	for range 4 {
+		<-done
+	}
+
+	assert.LessOrEqual(t, cache.Stats().Size, 8)
+}
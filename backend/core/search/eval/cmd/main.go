@@ -0,0 +1,122 @@
+/*
+Command eval runs judged queries against a search database,
+reports their relevance metrics, and diffs them against a baseline.
+
+Usage:
+
+	go run ./core/search/eval/cmd -judgments judgments.json \
+		-db "host=localhost port=5433 user=go-postgres \
+		password=go-postgres dbname=go-postgres sslmode=disable" \
+		[-k 10] [-baseline baseline.json] [-save baseline.json]
+
+Use -embedded <dir> instead of -db to search an embedded store.
+*/
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log"
+	"os"
+	"seekourney/core/config"
+	"seekourney/core/search"
+	"seekourney/core/search/eval"
+	"seekourney/core/storage"
+	"seekourney/core/storage/embedded"
+	"seekourney/core/storage/postgres"
+	"seekourney/utils"
+
+	_ "github.com/lib/pq" // PostgreSQL driver
+)
+
+const (
+	_DEFAULTK_ int = 10
+)
+
+func main() {
+	judgmentsPath := flag.String("judgments", "", "judgments file to run")
+	dsn := flag.String("db", "", "connection string of the test database")
+	embeddedDir := flag.String("embedded", "", "directory of an embedded store")
+	k := flag.Int("k", _DEFAULTK_, "number of results measured per query")
+	baselinePath := flag.String("baseline", "", "report to diff against")
+	savePath := flag.String("save", "", "file to save the report to")
+	flag.Parse()
+
+	if *judgmentsPath == "" || (*dsn == "") == (*embeddedDir == "") ||
+		*k <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	judgments, err := eval.LoadJudgments(utils.Path(*judgmentsPath))
+	if err != nil {
+		log.Fatalf("Error loading judgments: %s\n", err)
+	}
+
+	store := openStore(*dsn, *embeddedDir)
+	defer store.Close()
+
+	// Searches with the same settings as the server.
+	conf := config.Load()
+
+	searcher := func(query utils.Query, limit int) []utils.Path {
+		results := search.Search(
+			conf,
+			store,
+			query,
+			search.Options{Limit: limit},
+		)
+
+		paths := make([]utils.Path, len(results))
+		for i, result := range results {
+			paths[i] = result.Path
+		}
+		return paths
+	}
+
+	report := eval.Run(judgments, searcher, *k)
+	report.Write(os.Stdout)
+
+	if *baselinePath != "" {
+		baseline, err := eval.LoadReport(utils.Path(*baselinePath))
+		if err != nil {
+			log.Fatalf("Error loading baseline: %s\n", err)
+		}
+		if baseline.K != report.K {
+			log.Printf("Baseline measured top %d, not %d\n", baseline.K, *k)
+		}
+
+		os.Stdout.WriteString("\n")
+		eval.WriteDiff(os.Stdout, eval.Diff(baseline, &report))
+	}
+
+	if *savePath != "" {
+		err = eval.SaveReport(&report, utils.Path(*savePath))
+		if err != nil {
+			log.Fatalf("Error saving report: %s\n", err)
+		}
+	}
+}
+
+// openStore opens the database at dsn if it is set,
+// and the embedded store in dir otherwise.
+func openStore(dsn string, dir string) storage.Store {
+	if dir != "" {
+		store, err := embedded.Open(dir)
+		if err != nil {
+			log.Fatalf("Error opening embedded store: %s\n", err)
+		}
+		return store
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		log.Fatalf("Error opening database: %s\n", err)
+	}
+
+	if err = db.Ping(); err != nil {
+		log.Fatalf("Error connecting to database: %s\n", err)
+	}
+
+	return postgres.New(db)
+}
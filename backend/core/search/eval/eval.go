@@ -0,0 +1,196 @@
+/*
+Package eval measures the quality of search results against judged queries,
+so that changes to tokenization, normalization and ranking can be compared.
+
+A run searches every judged query, computes precision@k, reciprocal rank
+and nDCG for it, and averages them into a Report. Reports can be saved as
+a baseline, and later runs diffed against it.
+*/
+package eval
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"seekourney/utils"
+	"sort"
+)
+
+const (
+	// _TOLERANCE_ is the smallest change in a metric reported by Diff.
+	_TOLERANCE_ float64 = 1e-9
+)
+
+// Searcher returns the ranked paths found for a query, best first.
+type Searcher func(query utils.Query, limit int) []utils.Path
+
+// QueryReport holds the metrics of a single judged query.
+type QueryReport struct {
+	Query   utils.Query
+	Metrics Metrics
+}
+
+// Report holds the metrics of every judged query of a run, and their mean.
+type Report struct {
+	K       int
+	Queries []QueryReport
+	Mean    Metrics
+}
+
+// Run searches every judged query, and measures the top k results.
+func Run(judgments *Judgments, search Searcher, k int) Report {
+	report := Report{
+		K:       k,
+		Queries: make([]QueryReport, 0, len(judgments.Queries)),
+	}
+
+	for _, judgment := range judgments.Queries {
+		results := search(judgment.Query, k)
+		metrics := Measure(results, judgment.Relevant, k)
+
+		report.Queries = append(report.Queries, QueryReport{
+			Query:   judgment.Query,
+			Metrics: metrics,
+		})
+
+		report.Mean.Precision += metrics.Precision
+		report.Mean.ReciprocalRank += metrics.ReciprocalRank
+		report.Mean.NDCG += metrics.NDCG
+	}
+
+	if amount := float64(len(report.Queries)); amount > 0 {
+		report.Mean.Precision /= amount
+		report.Mean.ReciprocalRank /= amount
+		report.Mean.NDCG /= amount
+	}
+
+	return report
+}
+
+// LoadReport loads a report saved with SaveReport.
+func LoadReport(path utils.Path) (*Report, error) {
+	return utils.Load(path, func() *Report {
+		return &Report{}
+	})
+}
+
+// SaveReport saves a report, to be used as a baseline by later runs.
+func SaveReport(report *Report, path utils.Path) error {
+	return utils.Save(report, string(path))
+}
+
+// Write prints the metrics of every query and their mean.
+func (report Report) Write(writer io.Writer) {
+	fmt.Fprintf(writer, "%-40s %8s %8s %8s\n",
+		"query", "P@"+fmt.Sprint(report.K), "RR", "nDCG")
+
+	for _, query := range report.Queries {
+		writeMetrics(writer, string(query.Query), query.Metrics)
+	}
+
+	writeMetrics(writer, "mean", report.Mean)
+}
+
+// writeMetrics prints one row of metrics.
+func writeMetrics(writer io.Writer, name string, metrics Metrics) {
+	fmt.Fprintf(writer, "%-40s %8.4f %8.4f %8.4f\n",
+		name, metrics.Precision, metrics.ReciprocalRank, metrics.NDCG)
+}
+
+// Change is the difference in metrics of a query between two reports,
+// current minus baseline. Positive values are improvements.
+type Change struct {
+	Query utils.Query
+	Delta Metrics
+
+	// New is true if the query was not in the baseline,
+	// Removed if it is not in the current report.
+	New     bool
+	Removed bool
+}
+
+// Diff compares report against baseline. The mean is returned as a change
+// with an empty query, followed by every query whose metrics changed,
+// largest nDCG loss first.
+func Diff(baseline *Report, report *Report) []Change {
+	before := make(map[utils.Query]Metrics, len(baseline.Queries))
+	for _, query := range baseline.Queries {
+		before[query.Query] = query.Metrics
+	}
+
+	changes := make([]Change, 0)
+	for _, query := range report.Queries {
+		old, ok := before[query.Query]
+		delete(before, query.Query)
+
+		delta := subtract(query.Metrics, old)
+		if ok && !changed(delta) {
+			continue
+		}
+
+		changes = append(changes, Change{
+			Query: query.Query,
+			Delta: delta,
+			New:   !ok,
+		})
+	}
+
+	for query, old := range before {
+		changes = append(changes, Change{
+			Query:   query,
+			Delta:   subtract(Metrics{}, old),
+			Removed: true,
+		})
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Delta.NDCG != changes[j].Delta.NDCG {
+			return changes[i].Delta.NDCG < changes[j].Delta.NDCG
+		}
+		return changes[i].Query < changes[j].Query
+	})
+
+	mean := Change{Delta: subtract(report.Mean, baseline.Mean)}
+
+	return append([]Change{mean}, changes...)
+}
+
+// WriteDiff prints changes as returned by Diff.
+func WriteDiff(writer io.Writer, changes []Change) {
+	fmt.Fprintf(writer, "%-40s %8s %8s %8s\n", "change", "P@k", "RR", "nDCG")
+
+	for _, change := range changes {
+		name := string(change.Query)
+		switch {
+		case change.Query == "":
+			name = "mean"
+		case change.New:
+			name += " (new)"
+		case change.Removed:
+			name += " (removed)"
+		}
+
+		fmt.Fprintf(writer, "%-40s %+8.4f %+8.4f %+8.4f\n",
+			name,
+			change.Delta.Precision,
+			change.Delta.ReciprocalRank,
+			change.Delta.NDCG,
+		)
+	}
+}
+
+// subtract returns a - b, metric by metric.
+func subtract(a Metrics, b Metrics) Metrics {
+	return Metrics{
+		Precision:      a.Precision - b.Precision,
+		ReciprocalRank: a.ReciprocalRank - b.ReciprocalRank,
+		NDCG:           a.NDCG - b.NDCG,
+	}
+}
+
+// changed reports whether any metric in delta is not zero.
+func changed(delta Metrics) bool {
+	return math.Abs(delta.Precision) > _TOLERANCE_ ||
+		math.Abs(delta.ReciprocalRank) > _TOLERANCE_ ||
+		math.Abs(delta.NDCG) > _TOLERANCE_
+}
@@ -0,0 +1,138 @@
+package eval
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"seekourney/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const _DELTA_ float64 = 1e-9
+
+var relevant = map[utils.Path]Grade{
+	"/a": 3,
+	"/b": 1,
+	"/c": 0,
+}
+
+func TestPrecisionAtK(t *testing.T) {
+	results := []utils.Path{"/x", "/a", "/c", "/b"}
+
+	assert.InDelta(t, 0.0, PrecisionAtK(results, relevant, 1), _DELTA_)
+	assert.InDelta(t, 0.5, PrecisionAtK(results, relevant, 2), _DELTA_)
+	assert.InDelta(t, 0.5, PrecisionAtK(results, relevant, 4), _DELTA_)
+
+	// Missing results count as not relevant.
+	assert.InDelta(t, 0.25, PrecisionAtK(results[:2], relevant, 4), _DELTA_)
+	assert.InDelta(t, 0.0, PrecisionAtK(results, relevant, 0), _DELTA_)
+}
+
+func TestReciprocalRank(t *testing.T) {
+	results := []utils.Path{"/x", "/c", "/b", "/a"}
+
+	assert.InDelta(t, 1.0/3.0, ReciprocalRank(results, relevant, 10), _DELTA_)
+	assert.InDelta(t, 0.0, ReciprocalRank(results, relevant, 2), _DELTA_)
+	assert.InDelta(t, 0.0, ReciprocalRank(nil, relevant, 10), _DELTA_)
+}
+
+func TestNDCG(t *testing.T) {
+	ideal := []utils.Path{"/a", "/b"}
+	assert.InDelta(t, 1.0, NDCG(ideal, relevant, 10), _DELTA_)
+
+	// Gains 2^1-1 at rank 1 and 2^3-1 at rank 2,
+	// against the ideal 2^3-1 at rank 1 and 2^1-1 at rank 2.
+	swapped := []utils.Path{"/b", "/a"}
+	expected := (1 + 7/math.Log2(3)) / (7 + 1/math.Log2(3))
+	assert.InDelta(t, expected, NDCG(swapped, relevant, 10), _DELTA_)
+
+	assert.InDelta(t, 0.0, NDCG([]utils.Path{"/x"}, relevant, 10), _DELTA_)
+	assert.InDelta(
+		t, 0.0, NDCG(ideal, map[utils.Path]Grade{}, 10), _DELTA_)
+}
+
+// fixedSearch returns the same ranking for every query.
+func fixedSearch(paths ...utils.Path) Searcher {
+	return func(query utils.Query, limit int) []utils.Path {
+		return paths[:min(limit, len(paths))]
+	}
+}
+
+func TestRunAndDiff(t *testing.T) {
+	judgments := &Judgments{Queries: []Judgment{
+		{Query: "first", Relevant: map[utils.Path]Grade{"/a": 1}},
+		{Query: "second", Relevant: map[utils.Path]Grade{"/b": 1}},
+	}}
+
+	baseline := Run(judgments, fixedSearch("/a", "/b"), 2)
+	assert.Equal(t, 2, len(baseline.Queries))
+	assert.InDelta(t, 0.5, baseline.Mean.Precision, _DELTA_)
+	assert.InDelta(t, 0.75, baseline.Mean.ReciprocalRank, _DELTA_)
+
+	report := Run(judgments, fixedSearch("/b", "/a"), 2)
+	changes := Diff(&baseline, &report)
+
+	// The mean is unchanged, but both queries moved.
+	assert.Equal(t, 3, len(changes))
+	assert.Equal(t, utils.Query(""), changes[0].Query)
+	assert.InDelta(t, 0.0, changes[0].Delta.ReciprocalRank, _DELTA_)
+	assert.Equal(t, utils.Query("first"), changes[1].Query)
+	assert.InDelta(t, -0.5, changes[1].Delta.ReciprocalRank, _DELTA_)
+	assert.Equal(t, utils.Query("second"), changes[2].Query)
+	assert.InDelta(t, 0.5, changes[2].Delta.ReciprocalRank, _DELTA_)
+
+	assert.Equal(t, 1, len(Diff(&report, &report)))
+}
+
+func TestDiffNewAndRemoved(t *testing.T) {
+	baseline := Report{Queries: []QueryReport{{Query: "old"}}}
+	report := Report{Queries: []QueryReport{{Query: "new"}}}
+
+	changes := Diff(&baseline, &report)
+
+	assert.Equal(t, 3, len(changes))
+	for _, change := range changes[1:] {
+		assert.Equal(t, change.Query == "new", change.New)
+		assert.Equal(t, change.Query == "old", change.Removed)
+	}
+}
+
+func TestLoadJudgments(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) utils.Path {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return utils.Path(path)
+	}
+
+	judgments, err := LoadJudgments(write("ok.json",
+		`{"Queries": [{"Query": "q", "Relevant": {"/a": 2}}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, Grade(2), judgments.Queries[0].Relevant["/a"])
+
+	_, err = LoadJudgments(write("empty.json", `{"Queries": []}`))
+	assert.Error(t, err)
+
+	_, err = LoadJudgments(write("twice.json",
+		`{"Queries": [{"Query": "q"}, {"Query": "q"}]}`))
+	assert.Error(t, err)
+
+	_, err = LoadJudgments(write("negative.json",
+		`{"Queries": [{"Query": "q", "Relevant": {"/a": -1}}]}`))
+	assert.Error(t, err)
+}
+
+func TestSaveAndLoadReport(t *testing.T) {
+	path := utils.Path(filepath.Join(t.TempDir(), "baseline.json"))
+	judgments := &Judgments{Queries: []Judgment{
+		{Query: "q", Relevant: map[utils.Path]Grade{"/a": 1}},
+	}}
+	report := Run(judgments, fixedSearch("/a"), 5)
+
+	assert.NoError(t, SaveReport(&report, path))
+	loaded, err := LoadReport(path)
+	assert.NoError(t, err)
+	assert.Equal(t, report, *loaded)
+}
@@ -0,0 +1,60 @@
+package eval
+
+import (
+	"errors"
+	"seekourney/utils"
+)
+
+// Grade is how relevant a document is to a query.
+// 0 is not relevant, higher grades are more relevant.
+type Grade int
+
+// Judgment is a query together with the documents judged relevant to it.
+// Documents missing from Relevant are treated as not relevant.
+type Judgment struct {
+	Query    utils.Query
+	Relevant map[utils.Path]Grade
+}
+
+// Judgments is a set of judged queries, stored as JSON:
+//
+//	{"Queries": [{"Query": "parse json",
+//	              "Relevant": {"/src/parser.go": 3, "/doc/json.md": 1}}]}
+type Judgments struct {
+	Queries []Judgment
+}
+
+// LoadJudgments loads a judgments file and checks that it is usable.
+func LoadJudgments(path utils.Path) (*Judgments, error) {
+	judgments, err := utils.Load(path, func() *Judgments {
+		return &Judgments{}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(judgments.Queries) == 0 {
+		return nil, errors.New("no queries in " + string(path))
+	}
+
+	seen := make(map[utils.Query]bool)
+	for _, judgment := range judgments.Queries {
+		if judgment.Query == "" {
+			return nil, errors.New("judgment without query")
+		}
+		if seen[judgment.Query] {
+			return nil, errors.New(
+				"query judged twice: " + string(judgment.Query))
+		}
+		seen[judgment.Query] = true
+
+		for path, grade := range judgment.Relevant {
+			if grade < 0 {
+				return nil, errors.New(
+					"negative grade for " + string(path))
+			}
+		}
+	}
+
+	return judgments, nil
+}
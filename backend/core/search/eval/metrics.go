@@ -0,0 +1,121 @@
+package eval
+
+import (
+	"math"
+	"seekourney/utils"
+	"slices"
+)
+
+// Metrics are the relevance measures of a ranked list of results,
+// each between 0 (worst) and 1 (best).
+type Metrics struct {
+	// Precision is the fraction of the top k results that are relevant.
+	Precision float64
+
+	// ReciprocalRank is 1/rank of the first relevant result in the top k,
+	// 0 if there is none. Its mean over all queries is the MRR.
+	ReciprocalRank float64
+
+	// NDCG is the normalized discounted cumulative gain of the top k,
+	// which rewards putting highly graded documents first.
+	NDCG float64
+}
+
+// Measure computes all metrics of results for the given judgment.
+func Measure(
+	results []utils.Path,
+	relevant map[utils.Path]Grade,
+	k int,
+) Metrics {
+	return Metrics{
+		Precision:      PrecisionAtK(results, relevant, k),
+		ReciprocalRank: ReciprocalRank(results, relevant, k),
+		NDCG:           NDCG(results, relevant, k),
+	}
+}
+
+// topK returns at most the first k results.
+func topK(results []utils.Path, k int) []utils.Path {
+	if k < 0 {
+		k = 0
+	}
+	return results[:min(k, len(results))]
+}
+
+// PrecisionAtK returns the fraction of the first k results that are relevant.
+// Missing results count as not relevant, so the divisor is always k.
+// See: https://en.wikipedia.org/wiki/Precision_and_recall
+func PrecisionAtK(
+	results []utils.Path,
+	relevant map[utils.Path]Grade,
+	k int,
+) float64 {
+	if k <= 0 {
+		return 0
+	}
+
+	hits := 0
+	for _, path := range topK(results, k) {
+		if relevant[path] > 0 {
+			hits++
+		}
+	}
+
+	return float64(hits) / float64(k)
+}
+
+// ReciprocalRank returns 1/rank of the first relevant result within the
+// first k results, or 0 if none of them is relevant.
+// See: https://en.wikipedia.org/wiki/Mean_reciprocal_rank
+func ReciprocalRank(
+	results []utils.Path,
+	relevant map[utils.Path]Grade,
+	k int,
+) float64 {
+	for i, path := range topK(results, k) {
+		if relevant[path] > 0 {
+			return 1 / float64(i+1)
+		}
+	}
+
+	return 0
+}
+
+// NDCG returns the discounted cumulative gain of the first k results,
+// divided by that of the best possible ranking of the judged documents.
+// Gain is 2^grade - 1, discounted by log2 of the position plus one.
+// See: https://en.wikipedia.org/wiki/Discounted_cumulative_gain
+func NDCG(
+	results []utils.Path,
+	relevant map[utils.Path]Grade,
+	k int,
+) float64 {
+	grades := make([]Grade, 0, len(relevant))
+	for _, grade := range relevant {
+		grades = append(grades, grade)
+	}
+	slices.Sort(grades)
+	slices.Reverse(grades)
+
+	ideal := dcg(grades, k)
+	if ideal == 0 {
+		return 0
+	}
+
+	ranked := make([]Grade, 0, k)
+	for _, path := range topK(results, k) {
+		ranked = append(ranked, relevant[path])
+	}
+
+	return dcg(ranked, k) / ideal
+}
+
+// dcg returns the discounted cumulative gain of the first k grades.
+func dcg(grades []Grade, k int) float64 {
+	gain := 0.0
+	for i, grade := range grades[:max(0, min(k, len(grades)))] {
+		gain += (math.Exp2(float64(grade)) - 1) / math.Log2(float64(i+2))
+	}
+
+	return gain
+}
@@ -0,0 +1,287 @@
+package search
+
+import (
+	"container/heap"
+	"math"
+	"seekourney/utils"
+	"sort"
+)
+
+// Posting is one entry in the posting list of a term:
+// a document containing the term, how often it occurs there,
+// and the total number of words in the document.
+type Posting struct {
+	Path      utils.Path
+	Frequency utils.Frequency
+	Length    int
+}
+
+// PostingSource provides the statistics and posting lists needed to
+// evaluate a query in Go, for stores that cannot score documents themselves.
+// Any filtering (plus words, minus words, quotes) is applied by the source,
+// the planner only sees matching documents.
+type PostingSource interface {
+	// DocumentCount returns the total number of documents in the index.
+	DocumentCount() (int, error)
+
+	// DocumentFrequency returns the number of documents containing term.
+	DocumentFrequency(term utils.Word) (int, error)
+
+	// Postings returns the posting list of term. If restrict is non-nil,
+	// only postings for the given paths are returned.
+	Postings(term utils.Word, restrict []utils.Path) ([]Posting, error)
+}
+
+// Evaluate scores the documents of source against terms with tf-idf,
+// and returns the limit best ones, best first. It can be used to implement
+// Scorer for stores that provide a PostingSource.
+func Evaluate(
+	source PostingSource,
+	terms []utils.Word,
+	limit int,
+) ([]SearchResult, error) {
+	docAmount, err := source.DocumentCount()
+	if err != nil {
+		return nil, err
+	}
+
+	plans, err := planTerms(source, terms, docAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	return evaluate(source, plans, limit)
+}
+
+// termPlan is a query term together with its statistics.
+// Weight is the number of times the term occurs in the query.
+// Since term frequency is between 0 and 1, the score the term adds to any
+// document lies between lower and upper, with lower <= 0 <= upper.
+// Lower is only below 0 for terms found in almost every document,
+// which get a negative idf.
+type termPlan struct {
+	term   utils.Word
+	weight int
+	df     int
+	idf    float64
+	lower  float64
+	upper  float64
+}
+
+// planTerms looks up the document frequency of every distinct term and
+// orders them rarest first. Terms not found in any document are dropped,
+// as they cannot contribute to any score.
+func planTerms(
+	source PostingSource,
+	terms []utils.Word,
+	docAmount int,
+) ([]termPlan, error) {
+	weights := make(map[utils.Word]int)
+	order := make([]utils.Word, 0, len(terms))
+	for _, term := range terms {
+		if weights[term] == 0 {
+			order = append(order, term)
+		}
+		weights[term]++
+	}
+
+	plans := make([]termPlan, 0, len(order))
+	for _, term := range order {
+		df, err := source.DocumentFrequency(term)
+		if err != nil {
+			return nil, err
+		}
+		if df == 0 {
+			continue
+		}
+
+		idf := idfFromCount(df, docAmount)
+		weight := weights[term]
+		plans = append(plans, termPlan{
+			term:   term,
+			weight: weight,
+			df:     df,
+			idf:    idf,
+			lower:  math.Min(0, float64(weight)*idf),
+			upper:  math.Max(0, float64(weight)*idf),
+		})
+	}
+
+	sort.SliceStable(plans, func(i, j int) bool {
+		return plans[i].df < plans[j].df
+	})
+
+	return plans, nil
+}
+
+// idfFromCount calculates the Inverse Document Frequency of a term
+// appearing in df out of docAmount documents.
+// See: https://en.wikipedia.org/wiki/Tf%E2%80%93idf#Inverse_document_frequency
+func idfFromCount(df int, docAmount int) float64 {
+	return math.Log2(float64(docAmount) / (float64(df) + 1))
+}
+
+// evaluate scores documents term by term, rarest term first, and returns
+// the n best results.
+//
+// Once the n-th best final score is known to exceed the combined upper bound
+// of the remaining terms, no unseen document can enter the top n any more.
+// From then on, the remaining (common) terms are only looked up for the
+// documents that can still make it, instead of the whole corpus.
+// This is the MaxScore idea applied term-at-a-time.
+func evaluate(
+	source PostingSource,
+	plans []termPlan,
+	n int,
+) ([]SearchResult, error) {
+	scores := make(utils.ScoreMap)
+	if n <= 0 {
+		return []SearchResult{}, nil
+	}
+
+	// remainingLower[i] and remainingUpper[i] bound what the terms after
+	// plan i can add. Summed from the back, so the last ones are exactly 0.
+	remainingLower := make([]float64, len(plans))
+	remainingUpper := make([]float64, len(plans))
+	for i := len(plans) - 2; i >= 0; i-- {
+		remainingLower[i] = remainingLower[i+1] + plans[i+1].lower
+		remainingUpper[i] = remainingUpper[i+1] + plans[i+1].upper
+	}
+
+	var candidates []utils.Path
+	pruning := false
+
+	for i, plan := range plans {
+
+		postings, err := source.Postings(plan.term, candidates)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, posting := range postings {
+			if pruning {
+				if _, ok := scores[posting.Path]; !ok {
+					continue
+				}
+			}
+
+			scores[posting.Path] += utils.Score(
+				float64(plan.weight) * plan.idf * tf(posting),
+			)
+		}
+
+		if len(scores) < n {
+			continue
+		}
+
+		// The n-th best final score is at least this high.
+		threshold := float64(kthBest(scores, n)) + remainingLower[i]
+		if !pruning && remainingUpper[i] < threshold {
+			pruning = true
+		}
+
+		if pruning {
+			candidates = pruneCandidates(
+				scores,
+				threshold,
+				remainingUpper[i],
+			)
+		}
+	}
+
+	return topN(scores, n), nil
+}
+
+// tf calculates the term frequency of a posting.
+// See: https://en.wikipedia.org/wiki/Tf%E2%80%93idf#Term_frequency
+func tf(posting Posting) float64 {
+	if posting.Length <= 0 {
+		return 0
+	}
+	return float64(posting.Frequency) / float64(posting.Length)
+}
+
+// pruneCandidates removes every document from scores that cannot reach
+// threshold even if it gets the full remaining score,
+// and returns the paths of the documents left.
+func pruneCandidates(
+	scores utils.ScoreMap,
+	threshold float64,
+	remaining float64,
+) []utils.Path {
+	candidates := make([]utils.Path, 0, len(scores))
+
+	for path, score := range scores {
+		if float64(score)+remaining < threshold {
+			delete(scores, path)
+			continue
+		}
+		candidates = append(candidates, path)
+	}
+
+	return candidates
+}
+
+// resultHeap is a min-heap of search results, used to keep the best n.
+// The worst result is at the root.
+type resultHeap []SearchResult
+
+func (h resultHeap) Len() int { return len(h) }
+
+func (h resultHeap) Less(i, j int) bool { return worse(h[i], h[j]) }
+
+func (h resultHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *resultHeap) Push(x any) { *h = append(*h, x.(SearchResult)) }
+
+func (h *resultHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// worse reports whether a ranks below b.
+// Ties in score are broken by path, to make the order deterministic.
+func worse(a SearchResult, b SearchResult) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	return a.Path > b.Path
+}
+
+// bestN keeps the n best scores in a heap, without sorting all of them.
+func bestN(scores utils.ScoreMap, n int) resultHeap {
+	best := make(resultHeap, 0, n+1)
+
+	for path, score := range scores {
+		result := SearchResult{Path: path, Score: score}
+		if len(best) < n {
+			heap.Push(&best, result)
+			continue
+		}
+		if worse(best[0], result) {
+			best[0] = result
+			heap.Fix(&best, 0)
+		}
+	}
+
+	return best
+}
+
+// kthBest returns the n-th best score, there must be at least n scores.
+func kthBest(scores utils.ScoreMap, n int) utils.Score {
+	return bestN(scores, n)[0].Score
+}
+
+// topN returns the n best results, best first.
+func topN(scores utils.ScoreMap, n int) []SearchResult {
+	best := bestN(scores, n)
+
+	results := make([]SearchResult, len(best))
+	for i := len(best) - 1; i >= 0; i-- {
+		results[i] = heap.Pop(&best).(SearchResult)
+	}
+
+	return results
+}
@@ -0,0 +1,245 @@
+package search
+
+import (
+	"math/rand"
+	"seekourney/utils"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memorySource is an in-memory PostingSource over a synthetic corpus.
+// It counts the postings it hands out, to measure how much work
+// a query evaluation does.
+type memorySource struct {
+	docs     int
+	postings map[utils.Word][]Posting
+	served   int
+}
+
+func (source *memorySource) DocumentCount() (int, error) {
+	return source.docs, nil
+}
+
+func (source *memorySource) DocumentFrequency(
+	term utils.Word,
+) (int, error) {
+	return len(source.postings[term]), nil
+}
+
+func (source *memorySource) Postings(
+	term utils.Word,
+	restrict []utils.Path,
+) ([]Posting, error) {
+	all := source.postings[term]
+	if restrict == nil {
+		source.served += len(all)
+		return all, nil
+	}
+
+	allowed := make(map[utils.Path]bool, len(restrict))
+	for _, path := range restrict {
+		allowed[path] = true
+	}
+
+	result := make([]Posting, 0, len(restrict))
+	for _, posting := range all {
+		if allowed[posting.Path] {
+			result = append(result, posting)
+		}
+	}
+	source.served += len(result)
+
+	return result, nil
+}
+
+// syntheticCorpus generates docs documents of length words each,
+// with words drawn from a Zipf distribution, like natural text.
+func syntheticCorpus(docs int, length int, seed int64) *memorySource {
+	random := rand.New(rand.NewSource(seed))
+	zipf := rand.NewZipf(random, 1.1, 1, 5000)
+
+	source := &memorySource{
+		docs:     docs,
+		postings: make(map[utils.Word][]Posting),
+	}
+
+	for doc := range docs {
+		path := utils.Path("/doc/" + strconv.Itoa(doc))
+		freqs := make(utils.FrequencyMap)
+		for range length {
+			freqs[corpusWord(zipf.Uint64())]++
+		}
+
+		for word, freq := range freqs {
+			source.postings[word] = append(source.postings[word], Posting{
+				Path:      path,
+				Frequency: freq,
+				Length:    length,
+			})
+		}
+	}
+
+	return source
+}
+
+// corpusWord returns the word with the given rank in the corpus,
+// rank 0 is the most common word.
+func corpusWord(rank uint64) utils.Word {
+	return utils.Word("w" + strconv.FormatUint(rank, 10))
+}
+
+// exhaustiveScores scores every posting of every term.
+func exhaustiveScores(
+	source PostingSource,
+	terms []utils.Word,
+) utils.ScoreMap {
+	docAmount, _ := source.DocumentCount()
+	scores := make(utils.ScoreMap)
+
+	for _, term := range terms {
+		postings, _ := source.Postings(term, nil)
+		idf := idfFromCount(len(postings), docAmount)
+		for _, posting := range postings {
+			scores[posting.Path] += utils.Score(idf * tf(posting))
+		}
+	}
+
+	return scores
+}
+
+// exhaustive scores every posting of every term and sorts all results,
+// used as the reference the planner is compared against.
+func exhaustive(
+	source PostingSource,
+	terms []utils.Word,
+	n int,
+) []SearchResult {
+	scores := exhaustiveScores(source, terms)
+
+	results := make([]SearchResult, 0, len(scores))
+	for path, score := range scores {
+		results = append(results, SearchResult{Path: path, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return worse(results[j], results[i])
+	})
+
+	if len(results) > n {
+		results = results[:n]
+	}
+
+	return results
+}
+
+// benchmarkQuery mixes the most common words with a couple of rare ones.
+var benchmarkQuery = []utils.Word{
+	corpusWord(0),
+	corpusWord(1),
+	corpusWord(2),
+	corpusWord(800),
+	corpusWord(2500),
+}
+
+func TestPlanTermsOrder(t *testing.T) {
+	source := syntheticCorpus(200, 50, 1)
+	terms := []utils.Word{
+		corpusWord(0),
+		corpusWord(300),
+		corpusWord(0),
+		"missing",
+	}
+
+	plans, err := planTerms(source, terms, source.docs)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(plans))
+	assert.Equal(t, corpusWord(300), plans[0].term)
+	assert.Equal(t, corpusWord(0), plans[1].term)
+	assert.Equal(t, 2, plans[1].weight)
+	assert.LessOrEqual(t, plans[0].df, plans[1].df)
+}
+
+func TestEvaluateMatchesExhaustive(t *testing.T) {
+	for seed := range int64(5) {
+		source := syntheticCorpus(500, 80, seed)
+
+		all := exhaustiveScores(source, benchmarkQuery)
+
+		for _, n := range []int{1, 10, 50} {
+			expected := exhaustive(source, benchmarkQuery, n)
+			actual, err := Evaluate(source, benchmarkQuery, n)
+			assert.NoError(t, err)
+
+			// Documents with equal scores may be summed in a different
+			// order, so only scores are compared rank by rank.
+			assert.Equal(t, len(expected), len(actual))
+			for i := range expected {
+				assert.InDelta(
+					t,
+					float64(expected[i].Score),
+					float64(actual[i].Score),
+					1e-9,
+				)
+				assert.InDelta(
+					t,
+					float64(all[actual[i].Path]),
+					float64(actual[i].Score),
+					1e-9,
+				)
+			}
+		}
+	}
+}
+
+func TestEvaluatePrunesCommonTerms(t *testing.T) {
+	source := syntheticCorpus(2000, 100, 7)
+
+	_ = exhaustive(source, benchmarkQuery, 10)
+	exhaustiveWork := source.served
+	source.served = 0
+
+	_, err := Evaluate(source, benchmarkQuery, 10)
+	assert.NoError(t, err)
+
+	assert.Less(t, source.served, exhaustiveWork)
+}
+
+func TestEvaluateEmpty(t *testing.T) {
+	source := syntheticCorpus(10, 10, 1)
+
+	results, err := Evaluate(source, []utils.Word{"missing"}, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	results, err = Evaluate(source, benchmarkQuery, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func BenchmarkExhaustive(b *testing.B) {
+	source := syntheticCorpus(20000, 200, 42)
+	b.ResetTimer()
+
+	for b.Loop() {
+		exhaustive(source, benchmarkQuery, _RESULTAMOUNT_)
+	}
+
+	b.ReportMetric(float64(source.served)/float64(b.N), "postings/op")
+}
+
+func BenchmarkPlanned(b *testing.B) {
+	source := syntheticCorpus(20000, 200, 42)
+	b.ResetTimer()
+
+	for b.Loop() {
+		_, err := Evaluate(source, benchmarkQuery, _RESULTAMOUNT_)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(source.served)/float64(b.N), "postings/op")
+}
@@ -1,16 +1,12 @@
 package search
 
 import (
-	"database/sql"
 	"log"
-	"math"
 	"seekourney/core/config"
-	"seekourney/core/database"
-	"seekourney/core/document"
 	"seekourney/utils"
 	"seekourney/utils/words"
-	"sort"
 	"strings"
+	"time"
 )
 
 type status int
@@ -183,89 +179,115 @@ func wordsFromQuotes(quotes []string) []string {
 
 type SearchResult = utils.SearchResult
 
-// SqlSearch performs a search in the database using SQL.
-func SqlSearch(
-	config *config.Config,
-	db *sql.DB,
-	query utils.Query) []SearchResult {
-
-	result := make(utils.ScoreMap)
-
-	docAmount, err := database.RowAmount(db, "document")
-	if err != nil {
-		log.Printf("Error: %s\n", err)
-		panic(err)
-	}
-
-	parsedQuery := parseQuery(config, query)
+// _RESULTAMOUNT_ is the maximum number of results returned by a search.
+const _RESULTAMOUNT_ int = 10
 
+// queryTerms returns the normalized words of a parsed query, including the
+// words inside quotes. A word occurring twice is returned twice.
+func queryTerms(
+	config *config.Config,
+	parsedQuery utils.ParsedQuery,
+) []utils.Word {
 	stringFromQuotes := strings.Join(
 		wordsFromQuotes(parsedQuery.Quotes),
 		" ",
 	)
 
-	parsedQuery.ModifiedQuery += utils.Query(" " + stringFromQuotes)
+	modifiedQuery := string(parsedQuery.ModifiedQuery) + " " +
+		stringFromQuotes
 
-	for word := range words.WordsIter(string(parsedQuery.ModifiedQuery)) {
-		word = config.Normalizer.NormalizeWord(word)
-		freqMap, err := database.FreqMap(
-			db,
-			word,
-			parsedQuery.PlusWords,
-			parsedQuery.MinusWords,
-			parsedQuery.Quotes)
-
-		idf := calculateIdf(freqMap, docAmount)
+	terms := make([]utils.Word, 0)
+	for word := range words.WordsIter(modifiedQuery) {
+		terms = append(terms, config.Normalizer.NormalizeWord(word))
+	}
 
-		if err != nil {
-			log.Printf("Error: %s\n", err)
-			continue
-		}
+	return terms
+}
 
-		for path := range freqMap {
-			doc, err := document.DocumentFromDB(db, path)
+// Filter contains the search filters a document must satisfy to match.
+// PlusWords must all be in the document, MinusWords must all be absent,
+// and the raw text must contain every quote, in order.
+type Filter struct {
+	PlusWords  []string
+	MinusWords []string
+	Quotes     []string
+
+	// AsOf, if not zero, searches the version of every document that was
+	// indexed last at that time instead, see revision. Documents without
+	// such a version are left out, and idf counts these versions.
+	AsOf time.Time
+}
 
-			if err != nil {
-				log.Printf("Error: %s\n", err)
-				continue
-			}
+// Scorer scores stored documents, it is implemented by every storage backend.
+type Scorer interface {
+	// Score scores every document matching filter against terms with tf-idf,
+	// and returns the limit best ones, best first.
+	// A term given twice counts twice. Idf is computed from the total number
+	// of documents, and the number of matching documents containing the term.
+	Score(terms []utils.Word, filter Filter, limit int) ([]SearchResult, error)
+}
 
-			tf := doc.CalculateTf(word)
-			result[path] += utils.Score(tf * idf)
-		}
-	}
+// Search performs a search with the given scorer.
+// Only the best results are returned, see Options.
+func Search(
+	config *config.Config,
+	scorer Scorer,
+	query utils.Query,
+	options Options) []SearchResult {
 
-	return topN(scoreMapIntoSearchResult(result), 10)
+	return searchParsed(config, scorer, parseQuery(config, query), options)
 }
 
-// calculateIdf calculates the Inverse Document Frequency (IDF)
-// for a WordFrequencyMap.
-// See: https://en.wikipedia.org/wiki/Tf%E2%80%93idf#Inverse_document_frequency
-func calculateIdf(freqMap utils.WordFrequencyMap, docAmount int) float64 {
-	popularity := float64(len(freqMap))
-	return math.Log2(float64(docAmount) / (popularity + 1))
-}
+// CachedSearch performs a search like Search,
+// but answers from cache if the same search was made since the index
+// last changed. New results are added to the cache.
+func CachedSearch(
+	cache *Cache,
+	config *config.Config,
+	scorer Scorer,
+	query utils.Query,
+	options Options) []SearchResult {
 
-// scoreMapIntoSearchResult converts a ScoreMap into a slice of SearchResult.
-func scoreMapIntoSearchResult(scores utils.ScoreMap) []SearchResult {
-	results := make([]SearchResult, 0, len(scores))
+	parsedQuery := parseQuery(config, query)
+	key := cacheKey(config, parsedQuery, options)
+
+	// Must be read before searching, see Cache.Generation.
+	generation := cache.Generation()
 
-	for path, score := range scores {
-		results = append(results, SearchResult{Path: path, Score: score})
+	results, ok := cache.Get(key)
+	if ok {
+		return results
 	}
 
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score > results[j].Score
-	})
+	results = searchParsed(config, scorer, parsedQuery, options)
+	cache.Put(key, generation, results)
 
 	return results
 }
 
-// topN returns the top n results from the given results slice.
-func topN(results []SearchResult, n int) []SearchResult {
-	if len(results) < n {
-		return results
-	} else {
-		return results[:n]
+// searchParsed performs a search for an already parsed query.
+func searchParsed(
+	config *config.Config,
+	scorer Scorer,
+	parsedQuery utils.ParsedQuery,
+	options Options) []SearchResult {
+
+	filter := Filter{
+		PlusWords:  parsedQuery.PlusWords,
+		MinusWords: parsedQuery.MinusWords,
+		Quotes:     parsedQuery.Quotes,
+		AsOf:       options.AsOf,
+	}
+
+	results, err := scorer.Score(
+		queryTerms(config, parsedQuery),
+		filter,
+		options.Limit,
+	)
+	if err != nil {
+		log.Printf("Error: %s\n", err)
+		return []SearchResult{}
 	}
+
+	return results
 }
@@ -0,0 +1,89 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DEFAULTSNIPPETWIDTH is the number of characters of a snippet,
+// see Snippet.
+const DEFAULTSNIPPETWIDTH int = 200
+
+// _ELLIPSIS_ marks where text was cut from a snippet.
+const _ELLIPSIS_ string = "…"
+
+// MatchesQuotes reports whether text contains every quote, in order.
+func MatchesQuotes(text string, quotes []string) bool {
+	for _, quote := range quotes {
+		index := strings.Index(text, quote)
+		if index < 0 {
+			return false
+		}
+		text = text[index+len(quote):]
+	}
+
+	return true
+}
+
+/*
+Snippet returns about width characters of text around the first occurrence
+of any of words, ignoring case, or the start of text if none of them occur.
+Whitespace is collapsed to single spaces,
+and an ellipsis marks the ends where text was cut.
+*/
+func Snippet(text string, words []string, width int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	lower := lowerRunes(runes)
+
+	first := len(runes)
+	for _, word := range words {
+		index := runeIndex(lower, lowerRunes([]rune(word)))
+		if index >= 0 {
+			first = min(first, index)
+		}
+	}
+	if first == len(runes) {
+		first = 0
+	}
+
+	// The match is shown after a third of the snippet, for context.
+	start := max(0, min(first-width/3, len(runes)-width))
+	end := min(len(runes), start+width)
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = _ELLIPSIS_ + snippet
+	}
+	if end < len(runes) {
+		snippet += _ELLIPSIS_
+	}
+
+	return snippet
+}
+
+// runeIndex returns the index of the first occurrence of word in text,
+// -1 if it does not occur or is empty.
+func runeIndex(text []rune, word []rune) int {
+	if len(word) == 0 {
+		return -1
+	}
+
+	for i := 0; i+len(word) <= len(text); i++ {
+		if string(text[i:i+len(word)]) == string(word) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// lowerRunes returns runes in lower case. They are lowered one by one,
+// so indexes are the same in both.
+func lowerRunes(runes []rune) []rune {
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	return lower
+}
@@ -0,0 +1,32 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesQuotes(t *testing.T) {
+	text := "the quick brown fox jumps over the lazy dog"
+
+	assert.True(t, MatchesQuotes(text, nil))
+	assert.True(t, MatchesQuotes(text, []string{"quick brown", "lazy"}))
+	assert.False(t, MatchesQuotes(text, []string{"lazy", "quick brown"}))
+	assert.False(t, MatchesQuotes(text, []string{"brown quick"}))
+}
+
+func TestSnippet(t *testing.T) {
+	assert.Equal(t, "short text", Snippet("short\n  text", []string{"x"}, 20))
+
+	text := strings.Repeat("a ", 50) + "Needle " + strings.Repeat("b ", 50)
+
+	snippet := Snippet(text, []string{"missing", "needle"}, 30)
+	assert.Equal(t, "…a a a a a Needle b b b b b b b…", snippet)
+
+	snippet = Snippet(text, []string{"missing"}, 10)
+	assert.Equal(t, "a a a a a …", snippet)
+
+	snippet = Snippet("énorme Été fin", []string{"été"}, 6)
+	assert.Equal(t, "…e Été …", snippet)
+}
@@ -0,0 +1,555 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"seekourney/core/config"
+	"seekourney/core/database/migrate"
+	"seekourney/core/indexAPI"
+	"seekourney/core/load"
+	"seekourney/core/storage"
+	"seekourney/core/transfer"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"strings"
+)
+
+// Exit statuses of the commands, see Main.
+const (
+	_EXITOK_      int = 0
+	_EXITFAILURE_ int = 1
+	_EXITUSAGE_   int = 2
+)
+
+// _USAGE_ lists the commands, see Main.
+const _USAGE_ string = `Usage: core [command] [flags] [arguments]
+
+Commands:
+  serve    run the server (default)
+  load     register a collection of a local path and index it
+  reindex  index a collection of local files again
+  stats    print statistics of the index as JSON
+  migrate  show or apply database migrations
+  export   write the index as JSON Lines
+  import   read an index written by export
+  help     show this help
+
+Every command takes the database flags, see "core <command> -h".
+`
+
+/*
+Main runs the command named by the first argument with the rest of args,
+and returns the exit status: 0 on success, 1 if the command failed and 2
+if it was used wrongly. Without a command, or if args start with a flag,
+the server is run, see Run.
+
+Commands that open the storage, other than serve, must not be run while a
+server uses the same storage.
+*/
+func Main(args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	switch name {
+	case "serve":
+		return Run(args)
+	case "load":
+		return Load(args)
+	case "reindex":
+		return Reindex(args)
+	case "stats":
+		return Stats(args)
+	case "migrate":
+		return Migrate(args)
+	case "export":
+		return Export(args)
+	case "import":
+		return Import(args)
+	case "help":
+		fmt.Print(_USAGE_)
+		return _EXITOK_
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", name, _USAGE_)
+	return _EXITUSAGE_
+}
+
+// newFlags returns the flags of the command name, whose usage is given by
+// synopsis, such as "load [flags] <path>".
+func newFlags(name string, synopsis string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s\n", synopsis)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// loadConfig sets conf from the config file, the environment and args,
+// which are parsed with flags, see config.LoadWithOverrides.
+// Returns the arguments after the flags, or an error if they are invalid
+// or help was requested, see usageStatus.
+func loadConfig(flags *flag.FlagSet, args []string) ([]string, error) {
+	loaded, rest, err := config.LoadWithOverrides(flags, args)
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			log.Printf("Invalid settings: %s\n", err)
+		}
+		return nil, err
+	}
+
+	conf = loaded
+	return rest, nil
+}
+
+// usageStatus returns the exit status for an error from loadConfig.
+func usageStatus(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return _EXITOK_
+	}
+	return _EXITUSAGE_
+}
+
+/*
+Load registers a collection of a local file or directory, and indexes it
+without running the server or the indexer of the collection, see the load
+package. Prints the ID of the collection. Takes database flags,
+see config.ApplyFlags, and:
+
+-indexer - the ID of the indexer of the collection, which indexes it when
+the server reindexes it. Can be left out if only one indexer is registered.
+It must be the LocalText indexer, see load.CheckIndexer.
+
+-recursive - whether subdirectories are indexed, true by default.
+
+-revisions - the number of previous versions kept of every document.
+
+followed by the path. If a collection of the path is registered already,
+it is indexed again instead, keeping its settings.
+*/
+func Load(args []string) int {
+	flags := newFlags("load", "load [flags] <path>")
+	indexer := flags.String("indexer", "",
+		"ID of the indexer of the collection, "+
+			"can be left out if only one is registered")
+	recursive := flags.Bool("recursive", true, "index subdirectories")
+	revisions := flags.Int("revisions", 0,
+		"number of previous versions kept of every document")
+
+	args, err := loadConfig(flags, args)
+	if err != nil {
+		return usageStatus(err)
+	}
+	if len(args) != 1 || *revisions < 0 {
+		flags.Usage()
+		return _EXITUSAGE_
+	}
+
+	absolute, err := filepath.Abs(args[0])
+	if err != nil {
+		log.Printf("Invalid path %s: %s\n", args[0], err)
+		return _EXITUSAGE_
+	}
+	path := utils.Path(absolute)
+
+	sourceType, err := indexing.SourceTypeFromPath(path)
+	if err != nil {
+		log.Printf("Error loading %s: %s\n", path, err)
+		return _EXITFAILURE_
+	}
+
+	store, closeStorage, err := openStore()
+	if err != nil {
+		log.Printf("Error opening storage: %s\n", err)
+		return _EXITFAILURE_
+	}
+	defer closeStore(store, closeStorage)
+
+	collection, err := findOrRegister(
+		store,
+		indexAPI.UnregisteredCollection{
+			Path:       path,
+			IndexerID:  indexAPI.IndexerID(*indexer),
+			SourceType: sourceType,
+			Recursive:  *recursive,
+			Normalfunc: conf.Normalizer,
+			Revisions:  *revisions,
+		},
+	)
+	if err != nil {
+		log.Printf("Error registering collection of %s: %s\n", path, err)
+		return _EXITFAILURE_
+	}
+	fmt.Println(collection.ID)
+
+	return loadCollection(store, collection)
+}
+
+// findOrRegister returns the stored collection with the path of unreg,
+// or registers unreg if there is none. Without an indexer, unreg gets
+// the only registered one.
+func findOrRegister(
+	store storage.Store,
+	unreg indexAPI.UnregisteredCollection,
+) (indexAPI.Collection, error) {
+	collections, err := store.Collections()
+	if err != nil {
+		return indexAPI.Collection{}, err
+	}
+	for _, collection := range collections {
+		if collection.Path == unreg.Path {
+			log.Printf("Collection %s of %s is registered already\n",
+				collection.ID, collection.Path)
+			return collection, nil
+		}
+	}
+
+	if unreg.IndexerID == "" {
+		indexers, err := store.Indexers()
+		if err != nil {
+			return indexAPI.Collection{}, err
+		}
+		if len(indexers) == 0 {
+			return indexAPI.Collection{}, errors.New(
+				"no indexer is registered, register one with the server")
+		}
+		if len(indexers) > 1 {
+			return indexAPI.Collection{}, fmt.Errorf(
+				"%d indexers are registered, choose one with -indexer",
+				len(indexers),
+			)
+		}
+		unreg.IndexerID = indexers[0].ID
+	}
+
+	indexer, err := store.Indexer(unreg.IndexerID)
+	if err != nil {
+		return indexAPI.Collection{}, err
+	}
+	// Checked before registering, the collection could not be loaded.
+	err = load.CheckIndexer(indexer)
+	if err != nil {
+		return indexAPI.Collection{}, err
+	}
+
+	return indexAPI.RegisterCollection(store, unreg)
+}
+
+/*
+Reindex indexes a collection of local files again without running the
+server or its indexer, and removes the documents whose file is gone,
+see the load package. Takes database flags, see config.ApplyFlags,
+followed by the ID of the collection.
+*/
+func Reindex(args []string) int {
+	flags := newFlags("reindex", "reindex [flags] <collection id>")
+
+	args, err := loadConfig(flags, args)
+	if err != nil {
+		return usageStatus(err)
+	}
+	if len(args) != 1 {
+		flags.Usage()
+		return _EXITUSAGE_
+	}
+
+	store, closeStorage, err := openStore()
+	if err != nil {
+		log.Printf("Error opening storage: %s\n", err)
+		return _EXITFAILURE_
+	}
+	defer closeStore(store, closeStorage)
+
+	collection, err := store.Collection(indexing.CollectionID(args[0]))
+	if err != nil {
+		log.Printf("Error reindexing: %s\n", err)
+		return _EXITFAILURE_
+	}
+
+	return loadCollection(store, collection)
+}
+
+// loadCollection indexes collection, see load.Collection, and returns the
+// exit status. Files that could not be indexed are a failure.
+func loadCollection(store storage.Store, collection indexAPI.Collection) int {
+	summary, err := load.Collection(store, collection, conf.Normalizer)
+
+	log.Printf(
+		"Indexed collection %s: %d inserted, %d updated, %d unchanged, "+
+			"%d failed, %d removed\n",
+		collection.ID,
+		summary.Inserted,
+		summary.Updated,
+		summary.Unchanged,
+		summary.Failed,
+		len(summary.Removed),
+	)
+	if err != nil {
+		log.Printf("Error indexing collection %s: %s\n", collection.ID, err)
+		return _EXITFAILURE_
+	}
+	if summary.Failed > 0 {
+		return _EXITFAILURE_
+	}
+
+	return _EXITOK_
+}
+
+/*
+Stats prints statistics of the stored documents as JSON, like the /stats
+request, see stats.Stats. Takes database flags, see config.ApplyFlags.
+*/
+func Stats(args []string) int {
+	flags := newFlags("stats", "stats [flags]")
+
+	args, err := loadConfig(flags, args)
+	if err != nil {
+		return usageStatus(err)
+	}
+	if len(args) != 0 {
+		flags.Usage()
+		return _EXITUSAGE_
+	}
+
+	store, closeStorage, err := openStore()
+	if err != nil {
+		log.Printf("Error opening storage: %s\n", err)
+		return _EXITFAILURE_
+	}
+	defer closeStore(store, closeStorage)
+
+	result, err := store.Stats()
+	if err != nil {
+		log.Printf("Error reading stats: %s\n", err)
+		return _EXITFAILURE_
+	}
+
+	err = printJSON(os.Stdout, result)
+	if err != nil {
+		log.Printf("Error printing stats: %s\n", err)
+		return _EXITFAILURE_
+	}
+
+	return _EXITOK_
+}
+
+// printJSON writes data to writer as indented JSON.
+func printJSON(writer io.Writer, data any) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+/*
+Migrate opens the database and shows or updates the version of its schema,
+see the migrate package. Only postgres storage has a schema, see
+config.Config.Storage. Takes database flags, see config.ApplyFlags,
+followed by one argument:
+
+status - shows the current version and the pending migrations (default).
+
+up - applies all pending migrations.
+*/
+func Migrate(args []string) int {
+	flags := newFlags("migrate", "migrate [flags] [status | up]")
+
+	args, err := loadConfig(flags, args)
+	if err != nil {
+		return usageStatus(err)
+	}
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if len(args) > 1 || (command != "status" && command != "up") {
+		flags.Usage()
+		return _EXITUSAGE_
+	}
+	// Opening the database would start its container for nothing.
+	if conf.Storage != storage.POSTGRES {
+		log.Printf("Storage %s has no schema to migrate, only %s has\n",
+			conf.Storage, storage.POSTGRES)
+		return _EXITUSAGE_
+	}
+
+	db, closeDatabase := openDatabase()
+
+	err = runMigrate(db, command)
+
+	closeErr := db.Close()
+	if closeErr != nil {
+		log.Printf("Error while closing database: %s\n", closeErr)
+	}
+	closeDatabase()
+
+	if err != nil {
+		log.Printf("Error migrating database: %s\n", err)
+		return _EXITFAILURE_
+	}
+
+	return _EXITOK_
+}
+
+/*
+Export writes the whole index as JSON Lines, see the transfer package.
+Takes database flags, see config.ApplyFlags, followed by the file to write,
+standard output if it is missing or "-".
+*/
+func Export(args []string) int {
+	flags := newFlags("export", "export [flags] [file | -]")
+
+	args, err := loadConfig(flags, args)
+	if err != nil {
+		return usageStatus(err)
+	}
+	if len(args) > 1 {
+		flags.Usage()
+		return _EXITUSAGE_
+	}
+
+	output := os.Stdout
+	if len(args) > 0 && args[0] != "-" {
+		file, err := os.Create(args[0])
+		if err != nil {
+			log.Printf("Error creating export: %s\n", err)
+			return _EXITFAILURE_
+		}
+		defer func() {
+			utils.PanicOnError(file.Close())
+		}()
+		output = file
+	}
+
+	store, closeStorage, err := openStore()
+	if err != nil {
+		log.Printf("Error opening storage: %s\n", err)
+		return _EXITFAILURE_
+	}
+	summary, err := transfer.Export(store, output)
+	closeStore(store, closeStorage)
+
+	if err != nil {
+		log.Printf("Error exporting: %s\n", err)
+		return _EXITFAILURE_
+	}
+	log.Printf(
+		"Exported %d indexers, %d collections and %d documents\n",
+		summary.Indexers,
+		summary.Collections,
+		summary.Documents,
+	)
+
+	return _EXITOK_
+}
+
+/*
+Import reads an index written by Export, see the transfer package.
+Takes database flags, see config.ApplyFlags, followed by the file to read,
+standard input if it is "-", and optionally the path of the last document
+stored by an interrupted import to resume after it.
+*/
+func Import(args []string) int {
+	flags := newFlags("import", "import [flags] <file | -> [resume after path]")
+
+	args, err := loadConfig(flags, args)
+	if err != nil {
+		return usageStatus(err)
+	}
+	if len(args) == 0 || len(args) > 2 {
+		flags.Usage()
+		return _EXITUSAGE_
+	}
+
+	input := os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			log.Printf("Error opening import: %s\n", err)
+			return _EXITFAILURE_
+		}
+		defer func() {
+			utils.PanicOnError(file.Close())
+		}()
+		input = file
+	}
+
+	after := utils.Path("")
+	if len(args) > 1 {
+		after = utils.Path(args[1])
+	}
+
+	store, closeStorage, err := openStore()
+	if err != nil {
+		log.Printf("Error opening storage: %s\n", err)
+		return _EXITFAILURE_
+	}
+	summary, err := transfer.Import(store, input, after)
+	closeStore(store, closeStorage)
+
+	logImport(summary)
+	if err != nil {
+		log.Printf("Error importing: %s\n", err)
+		if summary.LastPath != "" {
+			log.Printf("Resume with: import %s %s\n", args[0], summary.LastPath)
+		}
+		return _EXITFAILURE_
+	}
+
+	return _EXITOK_
+}
+
+// closeStore closes store and stops anything started for it,
+// see openStore.
+func closeStore(store storage.Store, closeStorage func()) {
+	err := store.Close()
+	if err != nil {
+		log.Printf("Error while closing storage: %s\n", err)
+	}
+	closeStorage()
+}
+
+// logImport logs what an import stored.
+func logImport(summary transfer.Summary) {
+	log.Printf(
+		"Imported %d indexers, %d collections and %d documents, "+
+			"skipped %d, failed %d\n",
+		summary.Indexers,
+		summary.Collections,
+		summary.Documents,
+		summary.Skipped,
+		summary.Failed,
+	)
+}
+
+// runMigrate runs a migrate subcommand, see Migrate.
+func runMigrate(db *sql.DB, command string) error {
+	if command == "up" {
+		applied, err := migrate.Up(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migrations\n", len(applied))
+	}
+
+	status, err := migrate.GetStatus(db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version %d of %d\n", status.Current, status.Latest)
+	for _, migration := range status.Pending {
+		fmt.Printf("Pending: %d_%s\n", migration.Version, migration.Name)
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"seekourney/core/config"
 	"time"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
@@ -27,10 +28,8 @@ const (
 // is still starting up.
 // Returns database file descriptor ptr if the connection succeeds.
 // Panics with error on connection failure.
-func connectToDB() *sql.DB {
-	psqlconn := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		_HOST_, _DBPORT_, _USER_, _PASSWORD_, _DBNAME_)
+func connectToDB(settings config.Database) *sql.DB {
+	psqlconn := settings.ConnectionString()
 
 	log.Println("Connecting to database")
 	// Waiting animation
@@ -52,5 +51,8 @@ func connectToDB() *sql.DB {
 		fmt.Print(".")
 	}
 	fmt.Print("\n")
+	if settings.External {
+		panic("Could not connect to database " + settings.String())
+	}
 	panic("Could not connect to database, check docker.log for more info")
 }
@@ -16,15 +16,27 @@ import (
 	"os/signal"
 	"path"
 	"seekourney/core/config"
-	"seekourney/core/database"
+	"seekourney/core/database/migrate"
 	"seekourney/core/document"
 	"seekourney/core/indexAPI"
+	"seekourney/core/jobs"
 	"seekourney/core/modified_url"
+	"seekourney/core/renormalize"
+	"seekourney/core/revision"
 	"seekourney/core/search"
+	"seekourney/core/stats"
+	"seekourney/core/storage"
+	"seekourney/core/storage/embedded"
+	"seekourney/core/storage/postgres"
+	"seekourney/core/sweep"
+	"seekourney/core/transfer"
 	"seekourney/indexing"
 	"seekourney/utils"
+	"seekourney/utils/normalize"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -32,13 +44,7 @@ const (
 	_CONTAINERSTART_          string     = "./docker-start"
 	_CONTAINEROUTPUTFILE_     string     = "./docker.log"
 	_TESTCONTAINEROUTPUTFILE_ string     = "./test-docker.log"
-	_HOST_                    string     = "localhost"
-	_DBPORT_                  utils.Port = 5433
-	_CONTAINERNAME_           string     = "go-postgres"
 	_TESTCONTAINERNAME_       string     = "go-postgres-test"
-	_USER_                    string     = "go-postgres"
-	_PASSWORD_                string     = "go-postgres"
-	_DBNAME_                  string     = "go-postgres"
 	_EMPTYJSON_               JSONString = "{}"
 )
 
@@ -56,25 +62,64 @@ const (
 	_PUSHCOLLECTION_  string = "/push/collection"
 	_PUSHINDEXER_     string = "/push/indexer"
 	_LOG_             string = "/log"
+	_RENORMALIZE_     string = "/renormalize"
+	_RENORMALIZESTAT_ string = "/renormalize/status"
+	_SEARCHCACHE_     string = "/search/cache"
+	_DELETEDOCUMENT_  string = "/delete/document"
+	_DELETECOLLECT_   string = "/delete/collection"
+	_DELETEINDEXER_   string = "/delete/indexer"
+	_UPDATECOLLECT_   string = "/update/collection"
+	_EXPORT_          string = "/export"
+	_IMPORT_          string = "/import"
+	_PUSHDONE_        string = "/push/done"
+	_SWEEPMISSING_    string = "/sweep/missing"
+	_STATS_           string = "/stats"
+	_TERMS_           string = "/terms"
+	_PREVIEW_         string = "/preview"
+	_REVISIONS_       string = "/revisions"
+	_REVISIONDIFF_    string = "/revisions/diff"
+	_STARTINDEXER_    string = "/start/indexer"
+	_STOPINDEXER_     string = "/stop/indexer"
+	_RUNNINGINDEXERS_ string = "/running/indexers"
+	_PUSHPROGRESS_    string = "/push/progress"
+	_JOBS_            string = "/jobs"
+	_CANCELJOB_       string = "/jobs/cancel"
+
+	// _INDEXERLOGS_ is requested as /indexers/<id>/logs.
+	_INDEXERLOGS_ string = "/indexers/"
+	_LOGSSUFFIX_  string = "/logs"
 )
 
+// _LOGTAIL_ is the number of lines of indexer output sent by default.
+const _LOGTAIL_ int = 100
+
 // serverFuncParams is used by server query handler functions.
 type serverFuncParams struct {
 	writer io.Writer
-	db     *sql.DB
+	store  storage.Store
+}
+
+// containerName returns the name of the database container,
+// which is always _TESTCONTAINERNAME_ in tests.
+func containerName(db config.Database) string {
+	if testing.Testing() {
+		return _TESTCONTAINERNAME_
+	}
+
+	return db.Container
 }
 
 // startContainer start the database container using
-// the command defined in _CONTAINERSTART_.
+// the command defined in _CONTAINERSTART_, with the settings in db.
 // Blocks until the container is closed.
-func startContainer() {
+func startContainer(db config.Database) {
 
 	defer func() {
 		// TODO: Do something similar in IndexHandler for every indexer
 
 		if recover := recover(); recover != nil {
 			// TODO: Do we want to dot this, before starting the container?
-			err := exec.Command("docker", "kill", "go-postgres").Run()
+			err := exec.Command("docker", "kill", containerName(db)).Run()
 			utils.PanicOnError(err)
 			log.Fatalf(
 				"Error starting container: %s\nPlease, start the server again",
@@ -92,6 +137,14 @@ func startContainer() {
 	}
 	// TODO: Check in /bin/sh is needed
 	container := exec.Command("/bin/sh", _CONTAINERSTART_, testArg)
+	container.Env = append(
+		os.Environ(),
+		"CONTAINER_NAME="+containerName(db),
+		"DB_PORT="+db.Port.String(),
+		"POSTGRES_USER="+db.User,
+		"POSTGRES_PASSWORD="+db.Password,
+		"POSTGRES_DB="+db.Name,
+	)
 
 	outfile, err := os.Create(containerOutputFile)
 	utils.PanicOnError(err)
@@ -107,19 +160,13 @@ func startContainer() {
 
 // stopContainer signals the database container to stop,
 // and will finish the command started by startContainer().
-func stopContainer() {
-	containerName := _CONTAINERNAME_
-
-	if testing.Testing() {
-		containerName = _TESTCONTAINERNAME_
-	}
-
+func stopContainer(db config.Database) {
 	err := exec.Command(
 		"docker",
 		"stop",
 		"--signal",
 		"SIGTERM",
-		containerName,
+		containerName(db),
 	).Run()
 
 	if err != nil {
@@ -127,12 +174,65 @@ func stopContainer() {
 	}
 }
 
+// openDatabase connects to the database in the config, starting its
+// container first unless it is external.
+// Returns the database, and a function stopping the container.
+func openDatabase() (*sql.DB, func()) {
+	settings := conf.Database
+	log.Println("Using database", settings)
+
+	if settings.External {
+		return connectToDB(settings), func() {}
+	}
+
+	go startContainer(settings)
+
+	return connectToDB(settings), func() {
+		stopContainer(settings)
+	}
+}
+
 // conf holds the config object for the server.
-// Gets initialized in the Run function.
+// Gets initialized by loadConfig, when a command starts.
 var conf *config.Config
 
+// openStore opens the storage backend set in the config.
+// For postgres the database is opened, see openDatabase,
+// and the schema migrated.
+// Returns the store, and a function stopping anything started for it,
+// or an error if it could not be opened.
+func openStore() (storage.Store, func(), error) {
+	switch conf.Storage {
+	case storage.EMBEDDED:
+		store, err := embedded.Open(conf.StoragePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Println("Using embedded storage at", conf.StoragePath)
+		return store, func() {}, nil
+
+	case storage.POSTGRES:
+		db, closeDatabase := openDatabase()
+
+		_, err := migrate.Up(db)
+		if err != nil {
+			err = errors.Join(
+				fmt.Errorf("migrating database: %w", err), db.Close())
+			closeDatabase()
+			return nil, nil, err
+		}
+		return postgres.New(db), closeDatabase, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown storage backend %q", conf.Storage)
+}
+
 /*
-Run runs an http server with a postgres instance within docker container.
+Run runs an http server with a postgres instance within docker container,
+an external postgres database, or with embedded storage,
+see config.Config.Storage and config.Database.
+Database settings can be given as flags in args, see config.ApplyFlags.
+Returns the exit status, see Main.
 It can be accessed for example by `curl 'http://localhost:8080/search?q=key1'`
 or using the client package: `go run . client <command>`.
 
@@ -149,14 +249,23 @@ query under the key 'p'.
 
 /quit - Shuts down the server.
 */
-func Run(args []string) {
-
-	// Load config
-	conf = config.Load()
+func Run(args []string) int {
+	flags := newFlags("serve", "serve [flags]")
 
-	go startContainer()
+	args, err := loadConfig(flags, args)
+	if err != nil {
+		return usageStatus(err)
+	}
+	if len(args) != 0 {
+		flags.Usage()
+		return _EXITUSAGE_
+	}
 
-	db := connectToDB()
+	store, closeStorage, err := openStore()
+	if err != nil {
+		log.Printf("Error opening storage: %s\n", err)
+		return _EXITFAILURE_
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 
@@ -165,7 +274,7 @@ func Run(args []string) {
 		BaseContext: func(l net.Listener) context.Context { return ctx },
 	}
 
-	amount, err := database.RowAmount(db, utils.TABLEDOCUMENT)
+	amount, err := store.CountDocuments("")
 
 	if err == nil {
 		log.Printf("Row amount: %d\n", amount)
@@ -175,32 +284,79 @@ func Run(args []string) {
 
 	log.Println("Server started at", _SERVERADDRESS_)
 
+	// sweepRuns keeps when reindexing of collections started,
+	// documents not seen since are removed when it completes.
+	sweepRuns := sweep.NewRuns()
+
+	// jobTracker keeps the progress of dispatched indexings.
+	jobTracker := jobs.NewTracker()
+
 	// Indexhandler is used to manage running indexers.
 	indexHandler := indexAPI.NewIndexHandler()
+	if conf.IndexerStartupSeconds > 0 {
+		indexHandler.StartupTimeout =
+			time.Duration(conf.IndexerStartupSeconds) * time.Second
+	}
+	indexHandler.LogDir = conf.IndexerLogDir
+	indexHandler.OnDown = func(id indexAPI.IndexerID, reason error) {
+		failIndexerJobs(store, sweepRuns, jobTracker, id, reason)
+	}
+	if conf.IndexerCheckSeconds > 0 {
+		go indexHandler.Supervise(
+			ctx,
+			time.Duration(conf.IndexerCheckSeconds)*time.Second,
+		)
+	}
+
+	// Renormalizer rebuilds stored words when the normalizer changes,
+	// and keeps the normalizer in use from then on.
+	renormalizer := renormalize.New(conf.Normalizer)
+
+	// searchCache holds results of recent searches until the index changes.
+	searchCache := search.NewCache(conf.SearchCacheSize)
 
 	queryHandler := func(writer http.ResponseWriter, request *http.Request) {
 		utils.EnableCORS(&writer)
-		serverParams := serverFuncParams{writer: writer, db: db}
+		serverParams := serverFuncParams{writer: writer, store: store}
 		switch html.EscapeString(request.URL.Path) {
 		case _ALL_:
 			handleAll(serverParams)
 		case _ALL_INDEXERS_:
-			handleAllIndexers(serverParams)
+			handleAllIndexers(serverParams, &indexHandler)
 		case _ALL_COLLECTIONS_:
 			handleAllCollections(serverParams)
 		case _SEARCH_:
 			parsedQuery, _ := modifiedurl.ParseQuery(request.URL.RawQuery)
-			handleSearchSQL(serverParams, parsedQuery["q"])
+			handleSearch(
+				serverParams,
+				parsedQuery["q"],
+				parsedQuery.Get("n"),
+				parsedQuery.Get("asof"),
+				renormalizer,
+				searchCache,
+			)
+		case _SEARCHCACHE_:
+			sendJSON(serverParams.writer, searchCache.Stats())
 		case _PUSHPATHS_:
 			handlePushPaths(serverParams, request.URL.Query()["p"])
 		case _PUSHDOCS_:
-			handlePushDocs(serverParams, request)
+			handlePushDocs(serverParams, request, renormalizer, searchCache)
 		case _INDEX_:
 			handleIndex(serverParams)
 		case _PUSHCOLLECTION_:
-			handlePushCollection(serverParams, request, &indexHandler)
+			handlePushCollection(
+				serverParams,
+				request,
+				&indexHandler,
+				sweepRuns,
+				jobTracker,
+			)
 		case _PUSHINDEXER_:
-			handlePushIndexer(serverParams, request)
+			handlePushIndexer(
+				serverParams,
+				request,
+				indexHandler.StartupTimeout,
+			)
 		case _DOWNLOAD_:
 			writer.Header().Set("Content-Disposition", "attachment")
 			writer.Header().Set("Content-Type", "application/octet-stream")
@@ -210,19 +366,95 @@ func Run(args []string) {
 		case _LOG_:
 			msg := request.URL.Query().Get("msg")
 			log.Printf("Log: %s\n", msg)
+		case _RENORMALIZE_:
+			handleRenormalize(
+				serverParams,
+				request,
+				renormalizer,
+				searchCache,
+			)
+		case _RENORMALIZESTAT_:
+			sendJSON(serverParams.writer, renormalizer.Status())
+		case _UPDATECOLLECT_:
+			handleUpdateCollection(
+				serverParams,
+				request,
+				&indexHandler,
+				sweepRuns,
+				jobTracker,
+				searchCache,
+			)
+		case _DELETEDOCUMENT_:
+			handleDeleteDocument(serverParams, request, searchCache)
+		case _DELETECOLLECT_:
+			handleDeleteCollection(serverParams, request, searchCache)
+		case _DELETEINDEXER_:
+			handleDeleteIndexer(
+				serverParams,
+				request,
+				&indexHandler,
+				searchCache,
+			)
+		case _EXPORT_:
+			writer.Header().Set("Content-Disposition",
+				"attachment; filename=\"index.jsonl\"")
+			writer.Header().Set("Content-Type", "application/x-ndjson")
+			handleExport(serverParams)
+		case _IMPORT_:
+			handleImport(serverParams, request, searchCache)
+		case _PUSHDONE_:
+			handlePushDone(
+				serverParams,
+				request,
+				sweepRuns,
+				jobTracker,
+				searchCache,
+			)
+		case _PUSHPROGRESS_:
+			handlePushProgress(serverParams, request, jobTracker)
+		case _JOBS_:
+			handleJobs(serverParams, request, jobTracker)
+		case _CANCELJOB_:
+			handleCancelJob(serverParams, request, jobTracker, sweepRuns)
+		case _SWEEPMISSING_:
+			handleSweepMissing(serverParams, request, searchCache)
+		case _STATS_:
+			handleStats(serverParams)
+		case _TERMS_:
+			handleTerms(serverParams, request)
+		case _PREVIEW_:
+			handlePreview(serverParams, request)
+		case _REVISIONS_:
+			handleRevisions(serverParams, request)
+		case _REVISIONDIFF_:
+			handleRevisionDiff(serverParams, request)
+		case _STARTINDEXER_:
+			handleStartIndexer(serverParams, request, &indexHandler)
+		case _STOPINDEXER_:
+			handleStopIndexer(serverParams, request, &indexHandler)
+		case _RUNNINGINDEXERS_:
+			sendJSON(serverParams.writer, indexHandler.Running())
 		default:
+			id, ok := indexerLogsID(request.URL.Path)
+			if ok {
+				handleIndexerLogs(serverParams, request, &indexHandler, id)
+				return
+			}
 			log.Println("Unknown path:", request.URL)
 		}
 	}
 
 	http.HandleFunc("/", queryHandler)
 
+	// failed holds the error the server stopped with, if not shut down.
+	failed := make(chan error, 1)
+
 	go func() {
 		err := server.ListenAndServe()
 		if !errors.Is(err, http.ErrServerClosed) {
 			fmt.Println("Server encountered an error:", err)
+			failed <- err
 		}
-		indexHandler.ForceShutdownAll()
 		stop()
 	}()
 
@@ -234,12 +466,21 @@ func Run(args []string) {
 	if err != nil {
 		fmt.Println("Error while shutting down server: ", err)
 	}
-	err = db.Close()
+	// Stopped after the server, so no indexer is started meanwhile.
+	indexHandler.ShutdownAll()
+	err = store.Close()
 	if err != nil {
-		fmt.Println("Error while closing database: ", err)
+		fmt.Println("Error while closing storage: ", err)
 	}
 
-	stopContainer()
+	closeStorage()
+
+	select {
+	case <-failed:
+		return _EXITFAILURE_
+	default:
+		return _EXITOK_
+	}
 }
 
 // recoverSQLError calls recover and writes a message to writer
@@ -282,85 +523,85 @@ func respondWithSuccess(writer io.Writer) {
 	utils.PanicOnError(err)
 }
 
+// respondWithFail sends an indexing failure response through writer.
+func respondWithFail(writer io.Writer, message string) {
+	_, err := fmt.Fprintf(writer, "%s", string(indexing.ResponseFail(message)))
+	utils.PanicOnError(err)
+}
+
 // handleAll handles an /all request,
-// by querying all rows in database and writing output to response writer.
+// by querying all documents in storage and writing output to response writer.
 func handleAll(serverParams serverFuncParams) {
 	defer recoverSQLError(serverParams.writer)
 
-	var doc document.Document
-	query := database.Select().
-		Queries(doc.SQLGetFields()...).
-		From(utils.TABLEDOCUMENT)
-
-	insert := func(docs *[]document.Document, doc document.Document) {
-		*docs = append(*docs, doc)
-	}
-
-	docs := make([]document.Document, 0)
-
-	err := database.ExecScan(serverParams.db, string(query), &docs, insert)
+	docs, err := serverParams.store.Documents()
 	if err != nil {
-		sendError(serverParams.writer, "SQL failed", err)
+		sendError(serverParams.writer, "Storage failed", err)
 		return
 	}
 
 	sendJSON(serverParams.writer, docs)
 }
 
-// handleAllIndexers handles an /all/indexers request,
-// by querying all indexers in database and writing output to response writer.
-func handleAllIndexers(serverParams serverFuncParams) {
-
-	query := database.Select().
-		QueryAll().
-		From("indexer")
-
-	insert := func(docs *[]indexAPI.IndexerData, ind indexAPI.IndexerData) {
-		*docs = append(*docs, ind)
-	}
+// indexerStatus is an indexer in the response to /all/indexers,
+// with its health as seen by the supervisor.
+type indexerStatus struct {
+	indexAPI.IndexerData
+	indexAPI.IndexerHealth
+}
 
-	indexers := make([]indexAPI.IndexerData, 0)
+// handleAllIndexers handles an /all/indexers request,
+// by querying all indexers in storage and writing output to response writer,
+// with the state of each, see indexAPI.IndexHandler.Health.
+func handleAllIndexers(
+	serverParams serverFuncParams,
+	handler *indexAPI.IndexHandler,
+) {
 
-	err := database.ExecScan(serverParams.db, string(query), &indexers, insert)
+	indexers, err := serverParams.store.Indexers()
 	if err != nil {
-		sendError(serverParams.writer, "SQL failed", err)
+		sendError(serverParams.writer, "Storage failed", err)
 		return
 	}
 
-	sendJSON(serverParams.writer, indexers)
+	statuses := make([]indexerStatus, len(indexers))
+	for i, indexer := range indexers {
+		statuses[i] = indexerStatus{
+			IndexerData:   indexer,
+			IndexerHealth: handler.Health(indexer.ID),
+		}
+	}
+
+	sendJSON(serverParams.writer, statuses)
 }
 
 // handleAllCollections handles an /all/collections request,
-// by querying all collections in database and writing output to response
+// by querying all collections in storage and writing output to response
 // writer.
 func handleAllCollections(serverParams serverFuncParams) {
 
-	query := database.Select().
-		QueryAll().
-		From("collection")
-
-	insert := func(docs *[]indexAPI.Collection, col indexAPI.Collection) {
-		*docs = append(*docs, col)
-	}
-
-	collections := make([]indexAPI.Collection, 0)
-
-	err := database.ExecScan(
-		serverParams.db,
-		string(query),
-		&collections,
-		insert,
-	)
+	collections, err := serverParams.store.Collections()
 	if err != nil {
-		sendError(serverParams.writer, "SQL failed", err)
+		sendError(serverParams.writer, "Storage failed", err)
 		return
 	}
 
 	sendJSON(serverParams.writer, collections)
 }
 
-// handleSearchSQL handles a /search request.
-func handleSearchSQL(serverParams serverFuncParams, keys []string) {
+// handleSearch handles a /search request.
+// limit is the maximum number of results, the default is used if empty.
+// asOf searches the documents as they were at that time if not empty,
+// see parseAsOf. The query is normalized like the documents, see
+// renormalize.Renormalizer.Target.
+func handleSearch(
+	serverParams serverFuncParams,
+	keys []string,
+	limit string,
+	asOf string,
+	renormalizer *renormalize.Renormalizer,
+	cache *search.Cache,
+) {
 	defer recoverSQLError(serverParams.writer)
 
 	if len(keys) == 0 {
@@ -368,8 +609,36 @@ func handleSearchSQL(serverParams serverFuncParams, keys []string) {
 		return
 	}
 
+	options := search.DefaultOptions()
+	if limit != "" {
+		number, err := strconv.Atoi(limit)
+		if err != nil || number <= 0 {
+			sendError(serverParams.writer, "Invalid limit", err)
+			return
+		}
+		options.Limit = number
+	}
+
+	if asOf != "" {
+		var err error
+		options.AsOf, err = parseAsOf(asOf)
+		if err != nil {
+			sendError(serverParams.writer, "Invalid time", err)
+			return
+		}
+	}
+
+	searchConf := *conf
+	searchConf.Normalizer = renormalizer.Target()
+
 	query := utils.Query(strings.Join(keys, " "))
-	results := search.SqlSearch(conf, serverParams.db, query)
+	results := search.CachedSearch(
+		cache,
+		&searchConf,
+		serverParams.store,
+		query,
+		options,
+	)
 
 	response := utils.SearchResponse{
 		Query:   query,
@@ -408,10 +677,14 @@ func handlePushPaths(serverParams serverFuncParams, paths []string) {
 }
 
 // handlePushDocs handles a /push/docs request,
-// by normalizing documents send in request and adding them to db.
-func handlePushDocs(serverParams serverFuncParams, request *http.Request) {
-	respondWithSuccess(serverParams.writer)
-
+// by normalizing documents send in request and storing them as one batch.
+// Responds with the outcome of every document, see indexing.DocumentOutcome.
+func handlePushDocs(
+	serverParams serverFuncParams,
+	request *http.Request,
+	renormalizer *renormalize.Renormalizer,
+	cache *search.Cache,
+) {
 	body, err := io.ReadAll(request.Body)
 	utils.PanicOnError(err)
 
@@ -420,58 +693,145 @@ func handlePushDocs(serverParams serverFuncParams, request *http.Request) {
 	if err != nil {
 		log.Print("Main server failed to parse PushDocs request" +
 			" from indexer with error: " + err.Error())
+		respondWithFail(serverParams.writer, "invalid request: "+err.Error())
 		return
 	}
 
 	if resp.Status != indexing.STATUSSUCCESSFUL {
 		log.Print("indexing request failed (messaged with PushDocs request)" +
 			" with message: " + resp.Data.Message)
+		respondWithSuccess(serverParams.writer)
 		return
 	}
 
 	if len(resp.Data.Documents) == 0 {
 		log.Print("indexer indexed path and produced zero documents " +
 			"(pushdocs request)")
-		return
 	}
 
-	go func() {
-		for _, rawDoc := range resp.Data.Documents {
-			normalizedDoc := document.Normalize(rawDoc, conf.Normalizer)
+	normalizer := renormalizer.Target()
+	docs := make([]document.Document, len(resp.Data.Documents))
+	for i, rawDoc := range resp.Data.Documents {
+		docs[i] = document.Normalize(rawDoc, normalizer)
+	}
 
-			// TODO fix
-			// Error inserting row: pq: duplicate key value violates
-			// unique constraint "document_pkey"
-			// TODO: This not fixed Max will look into it
+	// Unchanged documents are not written, so searches are still valid.
+	outcomes := pushDocs(serverParams.store, docs)
+	for _, outcome := range outcomes {
+		if outcome.Status == indexing.OUTCOMEINSERTED ||
+			outcome.Status == indexing.OUTCOMEUPDATED {
+			cache.Invalidate()
+			break
+		}
+	}
 
-			exists, err := document.DocumentExsitsDB(
-				serverParams.db,
-				normalizedDoc.Path,
-			)
+	_, err = serverParams.writer.Write(indexing.ResponseOutcomes(outcomes))
+	utils.PanicOnError(err)
+}
 
-			if err != nil {
-				log.Printf("Error checking if document exists: %s\n", err)
-				continue
-			}
+// pushDocs stores docs as one batch,
+// and returns the outcome of every document.
+func pushDocs(
+	store storage.Store,
+	docs []document.Document,
+) []indexing.DocumentOutcome {
+	outcomes := make([]indexing.DocumentOutcome, len(docs))
+	for i, doc := range docs {
+		outcomes[i].Path = doc.Path
+	}
 
-			if exists {
-				err := normalizedDoc.UpdateDB(serverParams.db)
-				if err != nil {
-					log.Printf("Error updating document: %s\n", err)
-				}
-				continue
-			}
+	stored, err := store.UpsertDocuments(docs)
+	if err != nil {
+		log.Printf("Error storing %d documents: %s\n", len(docs), err)
+		for i := range outcomes {
+			outcomes[i].Status = indexing.OUTCOMEFAILED
+			outcomes[i].Message = err.Error()
+		}
+		return outcomes
+	}
 
-			_, err = database.InsertInto(serverParams.db, normalizedDoc)
+	counts := make(map[string]int)
+	for i, outcome := range stored {
+		switch {
+		case outcome.Err != nil:
+			outcomes[i].Status = indexing.OUTCOMEFAILED
+			outcomes[i].Message = outcome.Err.Error()
+			log.Printf("Error storing document %s: %s\n",
+				docs[i].Path, outcome.Err)
+		case outcome.Unchanged:
+			outcomes[i].Status = indexing.OUTCOMEUNCHANGED
+		case outcome.Inserted:
+			outcomes[i].Status = indexing.OUTCOMEINSERTED
+		default:
+			outcomes[i].Status = indexing.OUTCOMEUPDATED
+		}
+		counts[outcomes[i].Status]++
+	}
 
-			if err != nil {
-				log.Printf("Error inserting row: %s\n", err)
-			}
+	log.Printf(
+		"Handled pushdocs request: %d inserted, %d updated, "+
+			"%d unchanged, %d failed\n",
+		counts[indexing.OUTCOMEINSERTED],
+		counts[indexing.OUTCOMEUPDATED],
+		counts[indexing.OUTCOMEUNCHANGED],
+		counts[indexing.OUTCOMEFAILED],
+	)
+
+	return outcomes
+}
 
-			log.Print("Inserted document with path: ", normalizedDoc.Path)
+// handleRenormalize handles a /renormalize request by rebuilding the words
+// of stored documents from their raw text in the background.
+// The normalizer is given under the key 'n', and an optional collection ID
+// under the key 'c', see renormalize.Renormalizer.Start. Results are no
+// longer cached once a batch of documents is rewritten. When every document
+// has been renormalized the new normalizer is saved in the config file.
+func handleRenormalize(
+	serverParams serverFuncParams,
+	request *http.Request,
+	renormalizer *renormalize.Renormalizer,
+	cache *search.Cache,
+) {
+	values := request.URL.Query()
+
+	number, err := strconv.Atoi(values.Get("n"))
+	if err != nil {
+		sendError(serverParams.writer, "Invalid normalizer", err)
+		return
+	}
+	normalizer := normalize.Normalizer(number)
+	collection := indexing.CollectionID(values.Get("c"))
+
+	onChange := func(status renormalize.Status) {
+		cache.Invalidate()
+
+		if status.Running || status.Error != "" || status.Collection != "" {
+			return
 		}
-		log.Print("Handled pushdocs request successfully")
-	}()
+
+		// Searches read conf, the renormalizer has the normalizer in use.
+		// Only the normalizer changes in the file, conf also has the
+		// overrides from the environment and flags, such as the password.
+		saved := config.Load()
+		saved.Normalizer = status.Normalizer
+		err := config.Save(saved)
+		if err != nil {
+			log.Printf("Error saving config: %s\n", err)
+		}
+	}
+
+	err = renormalizer.Start(
+		serverParams.store,
+		normalizer,
+		collection,
+		onChange,
+	)
+	if err != nil {
+		sendError(serverParams.writer, "Renormalization failed", err)
+		return
+	}
+
+	sendJSON(serverParams.writer, renormalizer.Status())
 }
 
 // handleIndex handles an /index request by dispatching an indexing request
@@ -482,9 +842,11 @@ func handleIndex(serverParams serverFuncParams) {
 
 // handlePushIndexer handles a /push/indexer request from frontend client
 // by generating a new Indexer, storing it, and starting the indexer.
+// The indexer may take timeout to get ready, see indexAPI.RegisterIndexer.
 func handlePushIndexer(
 	serverParams serverFuncParams,
 	request *http.Request,
+	timeout time.Duration,
 ) {
 	// TODO fail or success response after unmarshall?
 	// respondWithSuccess(serverParams.writer)
@@ -497,7 +859,11 @@ func handlePushIndexer(
 		return
 	}
 
-	id, err := indexAPI.RegisterIndexer(serverParams.db, startupCMD)
+	id, err := indexAPI.RegisterIndexer(
+		serverParams.store,
+		startupCMD,
+		timeout,
+	)
 
 	if err != nil {
 		log.Print(
@@ -511,12 +877,21 @@ func handlePushIndexer(
 	utils.PanicOnError(err)
 }
 
+// collectionJob is the response to a /push/collection request.
+type collectionJob struct {
+	Collection indexing.CollectionID
+	Job        indexing.JobID
+}
+
 // handlePushCollection handles a /push/collection request from frontend client
 // by generating a new Collection, storing it, and indexing its associated path.
+// Responds with the collection ID and the job indexing it, see handleJobs.
 func handlePushCollection(
 	serverParams serverFuncParams,
 	request *http.Request,
 	indexers *indexAPI.IndexHandler,
+	runs *sweep.Runs,
+	tracker *jobs.Tracker,
 ) {
 	// TODO fail or success response after unmarshall?
 	// respondWithSuccess(serverParams.writer)
@@ -533,27 +908,824 @@ func handlePushCollection(
 		return
 	}
 
-	collection, err := indexAPI.RegisterCollection(serverParams.db, unreg)
+	collection, err := indexAPI.RegisterCollection(serverParams.store, unreg)
 	if err != nil {
-		panic("TODO")
+		sendError(serverParams.writer, "Invalid collection", err)
+		return
 	}
 
-	// Respond with collection ID
-	_, err = fmt.Fprintf(serverParams.writer, "%s", collection.ID)
+	job := tracker.Queue(collection.ID)
+	sendJSON(
+		serverParams.writer,
+		collectionJob{Collection: collection.ID, Job: job.ID},
+	)
+
+	go dispatchCollection(
+		serverParams.store,
+		indexers,
+		runs,
+		tracker,
+		job.ID,
+		collection,
+	)
+}
+
+// dispatchCollection requests indexing of collection from its indexer,
+// as the queued job, unless it was cancelled meanwhile.
+// Dispatch may startup indexer and add to handler
+// if it is not already running.
+// The start of the indexing is recorded in runs, see handlePushDone.
+// The job is started with the handler held, which is released before
+// dispatching, since starting the indexer can take its StartupTimeout.
+func dispatchCollection(
+	store storage.Store,
+	indexers *indexAPI.IndexHandler,
+	runs *sweep.Runs,
+	tracker *jobs.Tracker,
+	job indexing.JobID,
+	collection indexAPI.Collection,
+) {
+	indexers.Mutex.Lock()
+	err := tracker.Start(job)
 	if err != nil {
-		log.Fatalf("Error writing collection ID: %s\n", err)
+		indexers.Mutex.Unlock()
+		log.Printf("Not dispatching job %s: %s\n", job, err)
+		return
 	}
+	runs.Start(collection.ID)
+	indexers.Mutex.Unlock()
 
-	go func() {
+	errs := indexers.DispatchFromCollection(store, collection, job)
 
-		// Dispatch may startup indexer and add to handler
-		// if it is not already running.
-		indexers.Mutex.Lock()
-		errs := indexers.DispatchFromCollection(serverParams.db, collection)
-		indexers.Mutex.Unlock()
+	if errs.StartupAttempt != nil || errs.DispatchAttempt != nil {
+		runs.Finish(collection.ID)
+		err = tracker.Fail(
+			job,
+			errors.Join(errs.StartupAttempt, errs.DispatchAttempt),
+		)
+		if err != nil {
+			log.Printf("Job %s: %s\n", job, err)
+		}
+	}
+	logDispatchErrors(errs)
+}
 
-		logDispatchErrors(errs)
-	}()
+// failIndexerJobs fails the running jobs of the collections of the indexer
+// with id, which crashed or was stopped because of reason, and ends their
+// reindex in runs, so a later one sweeps from its own start.
+// Queued jobs are kept, dispatching them starts the indexer again.
+func failIndexerJobs(
+	store storage.Store,
+	runs *sweep.Runs,
+	tracker *jobs.Tracker,
+	id indexAPI.IndexerID,
+	reason error,
+) {
+	collections, err := store.Collections()
+	if err != nil {
+		log.Printf("Error failing jobs of indexer %s: %s\n", id, err)
+		return
+	}
+
+	for _, collection := range collections {
+		if collection.IndexerID != id {
+			continue
+		}
+
+		running := tracker.Jobs(jobs.Filter{
+			State:      jobs.RUNNING,
+			Collection: collection.ID,
+		})
+		for _, job := range running {
+			// Ended meanwhile, such as by the indexer reporting it done.
+			if tracker.Fail(job.ID, reason) != nil {
+				continue
+			}
+			runs.Finish(collection.ID)
+			log.Printf("Job %s failed: %s\n", job.ID, reason)
+		}
+	}
+}
+
+// collectionUpdate is the response to a /update/collection request.
+// Job is the job indexing the collection again, if the plan needs it.
+type collectionUpdate struct {
+	Collection indexAPI.Collection
+	Plan       indexAPI.UpdatePlan
+	Job        indexing.JobID
+}
+
+// handleUpdateCollection handles a /update/collection request, changing the
+// settings of the collection with the given id to those in the JSON body.
+// Settings missing from the body are kept. Schedules the work needed by the
+// change, see indexAPI.PlanUpdate, and responds with the plan.
+// Documents that no longer belong to the collection are removed once it is
+// indexed again, see handlePushDone. The normalizer can not be changed,
+// every collection uses the one in use, see handleRenormalize.
+func handleUpdateCollection(
+	serverParams serverFuncParams,
+	request *http.Request,
+	indexers *indexAPI.IndexHandler,
+	runs *sweep.Runs,
+	tracker *jobs.Tracker,
+	cache *search.Cache,
+) {
+	id := indexing.CollectionID(request.URL.Query().Get("id"))
+	old, err := serverParams.store.Collection(id)
+	if err != nil {
+		sendError(serverParams.writer, "Update failed", err)
+		return
+	}
+
+	body, err := io.ReadAll(request.Body)
+	utils.PanicOnError(err)
+
+	updated := old
+	err = json.Unmarshal(body, &updated)
+	if err != nil {
+		sendError(serverParams.writer, "Invalid collection", err)
+		return
+	}
+	// The ID can not be changed, documents refer to it.
+	updated.ID = id
+
+	if updated.Normalfunc != old.Normalfunc {
+		sendError(
+			serverParams.writer,
+			"Invalid collection",
+			errors.New("the normalizer can only be changed for every "+
+				"collection, see /renormalize"),
+		)
+		return
+	}
+
+	if updated.Revisions < 0 {
+		sendError(
+			serverParams.writer,
+			"Invalid collection",
+			errors.New("negative number of revisions"),
+		)
+		return
+	}
+
+	plan := indexAPI.PlanUpdate(old, updated)
+
+	err = serverParams.store.UpdateCollection(updated)
+	if err != nil {
+		sendError(serverParams.writer, "Update failed", err)
+		return
+	}
+
+	cache.Invalidate()
+
+	response := collectionUpdate{Collection: updated, Plan: plan}
+	if plan.Reindex {
+		job := tracker.Queue(id)
+		response.Job = job.ID
+		go dispatchCollection(
+			serverParams.store,
+			indexers,
+			runs,
+			tracker,
+			job.ID,
+			updated,
+		)
+	}
+
+	log.Printf("Updated collection %s: %+v\n", id, plan)
+	sendJSON(serverParams.writer, response)
+}
+
+// handleDeleteDocument handles a /delete/document request,
+// removing the document with path p.
+func handleDeleteDocument(
+	serverParams serverFuncParams,
+	request *http.Request,
+	cache *search.Cache,
+) {
+	if !requireDelete(serverParams.writer, request) {
+		return
+	}
+
+	path := utils.Path(request.URL.Query().Get("p"))
+	deleted, err := serverParams.store.DeleteDocument(path)
+	respondDeleted(serverParams.writer, deleted, err, cache)
+}
+
+// handleDeleteCollection handles a /delete/collection request,
+// removing the collection with the given id and all its documents.
+func handleDeleteCollection(
+	serverParams serverFuncParams,
+	request *http.Request,
+	cache *search.Cache,
+) {
+	if !requireDelete(serverParams.writer, request) {
+		return
+	}
+
+	id := indexing.CollectionID(request.URL.Query().Get("id"))
+	deleted, err := serverParams.store.DeleteCollection(id)
+	respondDeleted(serverParams.writer, deleted, err, cache)
+}
+
+// handleDeleteIndexer handles a /delete/indexer request, stopping the
+// indexer with the given id if it is running, and removing it with all its
+// collections and their documents. This frees the port of the indexer.
+func handleDeleteIndexer(
+	serverParams serverFuncParams,
+	request *http.Request,
+	indexers *indexAPI.IndexHandler,
+	cache *search.Cache,
+) {
+	if !requireDelete(serverParams.writer, request) {
+		return
+	}
+
+	id := indexAPI.IndexerID(request.URL.Query().Get("id"))
+	_, err := serverParams.store.Indexer(id)
+	if err != nil {
+		sendError(serverParams.writer, "Delete failed", err)
+		return
+	}
+
+	// Stopped first, so it does not push documents while it is deleted.
+	err = indexers.StopIndexer(id)
+	if err != nil {
+		sendError(serverParams.writer, "Stopping indexer failed", err)
+		return
+	}
+
+	deleted, err := serverParams.store.DeleteIndexer(id)
+	respondDeleted(serverParams.writer, deleted, err, cache)
+}
+
+// requireDelete checks that request uses the DELETE method,
+// and writes an error to writer if not.
+func requireDelete(writer io.Writer, request *http.Request) bool {
+	if request.Method == http.MethodDelete {
+		return true
+	}
+
+	sendError(
+		writer,
+		"Delete failed",
+		errors.New("method must be DELETE, not "+request.Method),
+	)
+	return false
+}
+
+// respondDeleted writes what a delete removed, or its error, to writer.
+// Cached searches are invalidated if anything was removed.
+func respondDeleted(
+	writer io.Writer,
+	deleted storage.Deleted,
+	err error,
+	cache *search.Cache,
+) {
+	if err != nil {
+		sendError(writer, "Delete failed", err)
+		return
+	}
+
+	cache.Invalidate()
+	log.Printf(
+		"Deleted %d indexers, %d collections and %d documents\n",
+		deleted.Indexers,
+		deleted.Collections,
+		deleted.Documents,
+	)
+	sendJSON(writer, deleted)
+}
+
+// indexerState is the response to indexer /start and /stop requests.
+type indexerState struct {
+	ID      indexAPI.IndexerID `json:"id"`
+	Running bool               `json:"running"`
+}
+
+// handleStartIndexer handles a /start/indexer request, starting the indexer
+// with the given id unless it is already running, see
+// indexAPI.IndexHandler.StartIndexer.
+func handleStartIndexer(
+	serverParams serverFuncParams,
+	request *http.Request,
+	indexers *indexAPI.IndexHandler,
+) {
+	id := indexAPI.IndexerID(request.URL.Query().Get("id"))
+	indexer, err := serverParams.store.Indexer(id)
+	if err != nil {
+		sendError(serverParams.writer, "Starting indexer failed", err)
+		return
+	}
+
+	err = indexers.StartIndexer(indexer)
+	if err != nil {
+		sendError(serverParams.writer, "Starting indexer failed", err)
+		return
+	}
+
+	sendJSON(serverParams.writer, indexerState{ID: id, Running: true})
+}
+
+// handleStopIndexer handles a /stop/indexer request, shutting down the
+// indexer with the given id if Core started it, see
+// indexAPI.IndexHandler.StopIndexer.
+func handleStopIndexer(
+	serverParams serverFuncParams,
+	request *http.Request,
+	indexers *indexAPI.IndexHandler,
+) {
+	id := indexAPI.IndexerID(request.URL.Query().Get("id"))
+	err := indexers.StopIndexer(id)
+	if err != nil {
+		sendError(serverParams.writer, "Stopping indexer failed", err)
+		return
+	}
+
+	sendJSON(serverParams.writer, indexerState{ID: id, Running: false})
+}
+
+// indexerLogsID returns the indexer ID in an /indexers/<id>/logs path,
+// false if path is not one.
+func indexerLogsID(path string) (indexAPI.IndexerID, bool) {
+	id, ok := strings.CutPrefix(path, _INDEXERLOGS_)
+	if !ok {
+		return "", false
+	}
+	id, ok = strings.CutSuffix(id, _LOGSSUFFIX_)
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+
+	return indexAPI.IndexerID(id), true
+}
+
+/*
+handleIndexerLogs handles an /indexers/<id>/logs request, by writing the last
+lines the indexer with id wrote to stdout and stderr, as many as under the
+key 'tail', see _LOGTAIL_. If the key 'follow' is true, lines are written
+as they come until the request is cancelled.
+*/
+func handleIndexerLogs(
+	serverParams serverFuncParams,
+	request *http.Request,
+	indexers *indexAPI.IndexHandler,
+	id indexAPI.IndexerID,
+) {
+	values := request.URL.Query()
+
+	tail := _LOGTAIL_
+	if values.Get("tail") != "" {
+		number, err := strconv.Atoi(values.Get("tail"))
+		if err != nil || number < 0 {
+			sendError(serverParams.writer, "Invalid tail", err)
+			return
+		}
+		tail = number
+	}
+	follow := values.Get("follow") == "true"
+
+	output, ok := indexers.Output(id)
+	if !ok {
+		sendError(
+			serverParams.writer,
+			"Logs failed",
+			fmt.Errorf("indexer %s has not been started", id),
+		)
+		return
+	}
+
+	lines, next := output.Tail(tail)
+	for {
+		for _, line := range lines {
+			_, err := fmt.Fprintln(serverParams.writer, line)
+			if err != nil {
+				return
+			}
+			next = line.Seq + 1
+		}
+		if !follow {
+			return
+		}
+
+		flusher, ok := serverParams.writer.(http.Flusher)
+		if ok {
+			flusher.Flush()
+		}
+
+		var changed <-chan struct{}
+		lines, changed = output.Since(next)
+		if len(lines) > 0 {
+			continue
+		}
+		select {
+		case <-changed:
+		case <-request.Context().Done():
+			return
+		}
+	}
+}
+
+// handleExport handles an /export request,
+// by writing the whole index as JSON Lines, see transfer.Export.
+func handleExport(serverParams serverFuncParams) {
+	summary, err := transfer.Export(serverParams.store, serverParams.writer)
+	if err != nil {
+		// The response is already partly written,
+		// the reader sees a truncated export.
+		log.Printf("Error exporting: %s\n", err)
+		return
+	}
+	log.Printf("Exported %d documents\n", summary.Documents)
+}
+
+// handleImport handles an /import request, by storing the JSON Lines export
+// in the POST body, see transfer.Import. An interrupted import can be resumed
+// after the path given under the key 'after'.
+// Responds with a transfer.Summary, or the error and the path to resume
+// after.
+func handleImport(
+	serverParams serverFuncParams,
+	request *http.Request,
+	cache *search.Cache,
+) {
+	if request.Method != http.MethodPost {
+		sendError(
+			serverParams.writer,
+			"Import failed",
+			errors.New("method must be POST, not "+request.Method),
+		)
+		return
+	}
+
+	after := utils.Path(request.URL.Query().Get("after"))
+	summary, err := transfer.Import(serverParams.store, request.Body, after)
+	cache.Invalidate()
+	logImport(summary)
+
+	if err != nil {
+		err = fmt.Errorf("%w, resume after %q", err, summary.LastPath)
+		sendError(serverParams.writer, "Import failed", err)
+		return
+	}
+
+	sendJSON(serverParams.writer, summary)
+}
+
+// handlePushDone handles a /push/done request from an indexer that has
+// indexed a collection, see indexing.IndexingDone, ending its job.
+// If the indexing was complete, the documents of the collection not seen
+// since Core dispatched it are removed, unless its job had already ended,
+// such as by being cancelled. Responds with a sweep.Result.
+func handlePushDone(
+	serverParams serverFuncParams,
+	request *http.Request,
+	runs *sweep.Runs,
+	tracker *jobs.Tracker,
+	cache *search.Cache,
+) {
+	done, err := utils.RequestBodyJson[indexing.IndexingDone](request)
+	if err != nil {
+		sendError(serverParams.writer, "Invalid request", err)
+		return
+	}
+
+	result := sweep.Result{
+		Collection: done.Collection,
+		Removed:    make([]utils.Path, 0),
+	}
+
+	if done.Job != "" {
+		_, err = tracker.Finish(done)
+		if err != nil {
+			log.Printf("Indexing done for job %s: %s\n", done.Job, err)
+			sendJSON(serverParams.writer, result)
+			return
+		}
+	}
+
+	started, running := runs.Finish(done.Collection)
+	if !running || !done.Complete {
+		log.Printf("Indexed collection %s, complete: %t, dispatched: %t\n",
+			done.Collection, done.Complete, running)
+		sendJSON(serverParams.writer, result)
+		return
+	}
+
+	result.Removed, err = serverParams.store.SweepCollection(
+		done.Collection,
+		started,
+	)
+	if err != nil {
+		sendError(serverParams.writer, "Sweep failed", err)
+		return
+	}
+
+	respondSwept(serverParams.writer, result, cache)
+}
+
+// handlePushProgress handles a /push/progress request from an indexer
+// indexing a collection as a job, see indexing.IndexingProgress.
+func handlePushProgress(
+	serverParams serverFuncParams,
+	request *http.Request,
+	tracker *jobs.Tracker,
+) {
+	progress, err := utils.RequestBodyJson[indexing.IndexingProgress](request)
+	if err != nil {
+		respondWithFail(serverParams.writer, "invalid request: "+err.Error())
+		return
+	}
+
+	err = tracker.Progress(progress)
+	if err != nil {
+		respondWithFail(serverParams.writer, err.Error())
+		return
+	}
+
+	respondWithSuccess(serverParams.writer)
+}
+
+// handleJobs handles a /jobs request, responding with the job with the ID
+// under the key 'id', or else the jobs in the state under the key 'state'
+// of the collection under the key 'c', most recently queued first.
+func handleJobs(
+	serverParams serverFuncParams,
+	request *http.Request,
+	tracker *jobs.Tracker,
+) {
+	values := request.URL.Query()
+
+	if values.Get("id") != "" {
+		job, ok := tracker.Job(indexing.JobID(values.Get("id")))
+		if !ok {
+			sendError(serverParams.writer, "Job failed", jobs.ErrUnknown)
+			return
+		}
+		sendJSON(serverParams.writer, job)
+		return
+	}
+
+	filter := jobs.Filter{
+		State:      jobs.State(values.Get("state")),
+		Collection: indexing.CollectionID(values.Get("c")),
+	}
+	sendJSON(serverParams.writer, tracker.Jobs(filter))
+}
+
+// handleCancelJob handles a /jobs/cancel request, cancelling the job with
+// the ID under the key 'id'. If it was running, its indexer is asked to stop
+// sending documents, and nothing is removed when it is done.
+// Responds with the cancelled job.
+func handleCancelJob(
+	serverParams serverFuncParams,
+	request *http.Request,
+	tracker *jobs.Tracker,
+	runs *sweep.Runs,
+) {
+	id := indexing.JobID(request.URL.Query().Get("id"))
+	before, err := tracker.Cancel(id)
+	if err != nil {
+		sendError(serverParams.writer, "Cancel failed", err)
+		return
+	}
+
+	if before.State == jobs.RUNNING {
+		runs.Finish(before.Collection)
+		err = cancelAtIndexer(serverParams.store, before)
+		if err != nil {
+			log.Printf("Indexer not told to cancel job %s: %s\n", id, err)
+		}
+	}
+
+	job, _ := tracker.Job(id)
+	sendJSON(serverParams.writer, job)
+}
+
+// cancelAtIndexer asks the indexer of the collection of job to stop
+// sending its documents, see indexAPI.CancelJob.
+func cancelAtIndexer(store storage.Store, job jobs.Job) error {
+	collection, err := store.Collection(job.Collection)
+	if err != nil {
+		return err
+	}
+
+	indexer, err := store.Indexer(collection.IndexerID)
+	if err != nil {
+		return err
+	}
+
+	return indexAPI.CancelJob(indexer, job.ID)
+}
+
+// handleSweepMissing handles a /sweep/missing request, removing the local
+// documents whose file no longer exists, see sweep.RemoveMissing.
+// Only documents in the collection with the given id are checked,
+// or all documents if no id is given. Responds with a sweep.Result.
+func handleSweepMissing(
+	serverParams serverFuncParams,
+	request *http.Request,
+	cache *search.Cache,
+) {
+	if !requireDelete(serverParams.writer, request) {
+		return
+	}
+
+	id := indexing.CollectionID(request.URL.Query().Get("id"))
+	result, err := sweep.RemoveMissing(serverParams.store, id)
+	if err != nil {
+		if len(result.Removed) > 0 {
+			cache.Invalidate()
+		}
+		sendError(serverParams.writer, "Sweep failed", err)
+		return
+	}
+
+	respondSwept(serverParams.writer, result, cache)
+}
+
+// respondSwept writes what a sweep removed to writer.
+// Cached searches are invalidated if anything was removed.
+func respondSwept(
+	writer io.Writer,
+	result sweep.Result,
+	cache *search.Cache,
+) {
+	if len(result.Removed) > 0 {
+		cache.Invalidate()
+	}
+
+	log.Printf("Swept %d documents of collection %q\n",
+		len(result.Removed), result.Collection)
+	sendJSON(writer, result)
+}
+
+// handleStats handles a /stats request, by summarizing the stored
+// documents, see stats.Stats.
+func handleStats(serverParams serverFuncParams) {
+	result, err := serverParams.store.Stats()
+	if err != nil {
+		sendError(serverParams.writer, "Stats failed", err)
+		return
+	}
+
+	sendJSON(serverParams.writer, result)
+}
+
+// handleTerms handles a /terms request, by listing the terms of the stored
+// documents with the number of documents containing each, ordered.
+// Only terms starting with the key 'prefix' and after the key 'after' are
+// listed, counting only documents in the collection with the ID under the
+// key 'c' if given. The maximum number of terms is under the key 'n',
+// see stats.DEFAULTTERMLIMIT and stats.MAXTERMLIMIT.
+func handleTerms(serverParams serverFuncParams, request *http.Request) {
+	values := request.URL.Query()
+
+	filter := stats.TermFilter{
+		Prefix:     values.Get("prefix"),
+		Collection: indexing.CollectionID(values.Get("c")),
+		After:      utils.Word(values.Get("after")),
+		Limit:      stats.DEFAULTTERMLIMIT,
+	}
+
+	if values.Get("n") != "" {
+		number, err := strconv.Atoi(values.Get("n"))
+		if err != nil || number <= 0 {
+			sendError(serverParams.writer, "Invalid limit", err)
+			return
+		}
+		filter.Limit = min(number, stats.MAXTERMLIMIT)
+	}
+
+	terms, err := serverParams.store.Terms(filter)
+	if err != nil {
+		sendError(serverParams.writer, "Terms failed", err)
+		return
+	}
+
+	sendJSON(serverParams.writer, terms)
+}
+
+// preview is the response to a /preview request.
+type preview struct {
+	Path    utils.Path
+	Snippet string
+}
+
+// handlePreview handles a /preview request, by responding with a snippet
+// of the stored text of the document with the path under the key 'p',
+// around the first word of the query under the key 'q' it contains,
+// see search.Snippet. Works for documents that can not be downloaded.
+func handlePreview(serverParams serverFuncParams, request *http.Request) {
+	values := request.URL.Query()
+	path := utils.Path(values.Get("p"))
+	if path == "" {
+		sendError(serverParams.writer, "No path given", nil)
+		return
+	}
+
+	text, err := serverParams.store.DocumentText(path)
+	if err != nil {
+		sendError(serverParams.writer, "Preview failed", err)
+		return
+	}
+
+	// Filters of the query are searched for as plain words.
+	words := strings.Fields(values.Get("q"))
+	for i, word := range words {
+		words[i] = strings.Trim(word, "+-\"")
+	}
+
+	sendJSON(serverParams.writer, preview{
+		Path:    path,
+		Snippet: search.Snippet(text, words, search.DEFAULTSNIPPETWIDTH),
+	})
+}
+
+// parseAsOf parses the time a search is made as of, either in RFC 3339
+// format, or a date such as 2025-03-01, which means the end of that day.
+func parseAsOf(value string) (time.Time, error) {
+	date, err := time.Parse(time.DateOnly, value)
+	if err == nil {
+		return date.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// handleRevisions handles a /revisions request, by listing the revisions of
+// the document with the path under the key 'p', see revision.Revision.
+func handleRevisions(serverParams serverFuncParams, request *http.Request) {
+	path := utils.Path(request.URL.Query().Get("p"))
+
+	revisions, err := serverParams.store.Revisions(path)
+	if err != nil {
+		sendError(serverParams.writer, "Revisions failed", err)
+		return
+	}
+
+	sendJSON(serverParams.writer, revisions)
+}
+
+// revisionDiff is the response to a /revisions/diff request.
+type revisionDiff struct {
+	Path  utils.Path
+	From  int
+	To    int
+	Lines []revision.Line
+}
+
+/*
+handleRevisionDiff handles a /revisions/diff request, by comparing the texts
+of two revisions of the document with the path under the key 'p',
+see revision.Diff. The revisions are numbered under the keys 'from' and
+'to'. By default to is the current document, and from the revision before.
+*/
+func handleRevisionDiff(
+	serverParams serverFuncParams,
+	request *http.Request,
+) {
+	values := request.URL.Query()
+	path := utils.Path(values.Get("p"))
+
+	revisions, err := serverParams.store.Revisions(path)
+	if err != nil {
+		sendError(serverParams.writer, "Diff failed", err)
+		return
+	}
+
+	diff := revisionDiff{Path: path, To: revisions[len(revisions)-1].Number}
+	if values.Get("to") != "" {
+		diff.To, err = strconv.Atoi(values.Get("to"))
+		if err != nil {
+			sendError(serverParams.writer, "Invalid revision", err)
+			return
+		}
+	}
+
+	diff.From = diff.To - 1
+	if values.Get("from") != "" {
+		diff.From, err = strconv.Atoi(values.Get("from"))
+		if err != nil {
+			sendError(serverParams.writer, "Invalid revision", err)
+			return
+		}
+	}
+
+	from, err := serverParams.store.RevisionText(path, diff.From)
+	if err != nil {
+		sendError(serverParams.writer, "Diff failed", err)
+		return
+	}
+
+	to, err := serverParams.store.RevisionText(path, diff.To)
+	if err != nil {
+		sendError(serverParams.writer, "Diff failed", err)
+		return
+	}
+
+	diff.Lines = revision.Diff(from, to)
+	sendJSON(serverParams.writer, diff)
 }
 
 // handleQuit handles a /quit request by initiating the shutdown process
@@ -5,15 +5,36 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"seekourney/core/config"
-	"seekourney/core/database"
+	"seekourney/core/database/migrate"
 	"seekourney/core/document"
+	"seekourney/core/indexAPI"
+	"seekourney/core/jobs"
+	"seekourney/core/load"
+	"seekourney/core/renormalize"
+	"seekourney/core/revision"
+	"seekourney/core/search"
+	"seekourney/core/stats"
+	"seekourney/core/storage"
+	"seekourney/core/storage/embedded"
+	"seekourney/core/storage/postgres"
+	"seekourney/core/sweep"
+	"seekourney/core/transfer"
+	"seekourney/indexing"
 	"seekourney/utils"
+	"seekourney/utils/normalize"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // Globally accessible buffer used as mock interface for server handlers
@@ -30,30 +51,20 @@ func panicOnError(err error) {
 	}
 }
 
-// Resets the state of the database by dropping the table and rerunning initdb
+// Resets the state of the database by dropping every table and type,
+// and rerunning all migrations
 func resetSQL(db *sql.DB) {
 	if db == nil {
 		return
 	}
 
-	_, err := db.Exec(`DROP TABLE document`)
+	_, err := db.Exec(`DROP SCHEMA public CASCADE`)
 	panicOnError(err)
 
-	_, err = db.Exec(`DROP TABLE collection`)
+	_, err = db.Exec(`CREATE SCHEMA public`)
 	panicOnError(err)
 
-	_, err = db.Exec(`DROP TABLE indexer`)
-	panicOnError(err)
-	err = exec.Command(
-		"docker",
-		"exec",
-		_TESTCONTAINERNAME_,
-		"psql",
-		"-U",
-		_DBNAME_,
-		"-f",
-		"/docker-entrypoint-initdb.d/initdb.sql",
-	).Run()
+	_, err = migrate.Up(db)
 	panicOnError(err)
 }
 
@@ -74,21 +85,24 @@ func assertBufferEquals(
 	}
 }
 
-// serverTest defers a func before running the test function to ensure that the
-// database container is stopped if the test panics.
-// Also resets the state of objects that may have been written to if the test
-// did not panic
+// serverTest runs a test function with an empty store opened by open,
+// and resets the buffer afterwards.
+// Calls cleanup if the test panics, to stop anything started for the store.
 func serverTest(
 	testFunc func(test *testing.T, serverParams serverFuncParams),
-	serverParams serverFuncParams,
+	open func(test *testing.T) storage.Store,
+	cleanup func(),
 ) func(*testing.T) {
 	return func(test *testing.T) {
+		serverParams := serverFuncParams{
+			writer: &buffer,
+			store:  open(test),
+		}
 		defer func() {
 			if err := recover(); err != nil {
-				stopContainer()
+				cleanup()
 				panic(err)
 			} else {
-				resetSQL(serverParams.db)
 				buffer.Reset()
 			}
 		}()
@@ -96,54 +110,102 @@ func serverTest(
 	}
 }
 
+// runServerTests runs every handler test, with stores opened by open.
+func runServerTests(
+	test *testing.T,
+	open func(test *testing.T) storage.Store,
+	cleanup func(),
+) {
+	ctx, stop = context.WithCancel(context.Background())
+	defer stop()
+
+	conf = config.New()
+
+	tests := []struct {
+		name     string
+		testFunc func(test *testing.T, serverParams serverFuncParams)
+	}{
+		{"TestHandleAllSingle", testHandleAllSingle},
+		{"TestHandleAllMultiple", testHandleAllMultiple},
+		{"TestHandleSearchSingle", testHandleSearchSingle},
+		{"TestHandleSearchInvalid", testHandleSearchInvalid},
+		{"TestHandleSearchMultiple", testHandleSearchMultiple},
+		{"TestHandlePushDocs", testHandlePushDocs},
+		{"TestHandlePushDocsInvalid", testHandlePushDocsInvalid},
+		{"TestHandleDeleteCollection", testHandleDeleteCollection},
+		{"TestHandleDeleteIndexer", testHandleDeleteIndexer},
+		{"TestHandleStartStopIndexer", testHandleStartStopIndexer},
+		{"TestHandleAllIndexers", testHandleAllIndexers},
+		{"TestHandleIndexerLogs", testHandleIndexerLogs},
+		{"TestHandleUpdateCollection", testHandleUpdateCollection},
+		{"TestHandlePushDone", testHandlePushDone},
+		{"TestHandleJobs", testHandleJobs},
+		{"TestFailIndexerJobs", testFailIndexerJobs},
+		{"TestHandlePushCollectionInvalid", testHandlePushCollectionInvalid},
+		{"TestHandleSweepMissing", testHandleSweepMissing},
+		{"TestHandleStatsTerms", testHandleStatsTerms},
+		{"TestHandlePreview", testHandlePreview},
+		{"TestHandleRevisions", testHandleRevisions},
+		{"TestHandleExportImport", testHandleExportImport},
+		{"TestFindOrRegister", testFindOrRegister},
+		{"TestHandleQuit", testHandleQuit},
+		{"TestHandleDownload", testHandleDownload},
+	}
+
+	for _, t := range tests {
+		test.Run(t.name, serverTest(t.testFunc, open, cleanup))
+	}
+}
+
+// TestServer runs the handler tests with embedded storage.
 func TestServer(test *testing.T) {
+	// Navigate back to root directory of codebase
+	// Tests seem to run from their own directory, not from where go test is run
+	test.Chdir("../..")
+
+	open := func(test *testing.T) storage.Store {
+		store, err := embedded.Open(test.TempDir())
+		panicOnError(err)
+		test.Cleanup(func() {
+			panicOnError(store.Close())
+		})
+		return store
+	}
+
+	runServerTests(test, open, func() {})
+}
+
+// TestServerPostgres runs the handler tests with a postgres database,
+// which is started in a docker container.
+func TestServerPostgres(test *testing.T) {
 	if testing.Short() {
 		test.SkipNow()
 	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		test.Skip("docker is not installed")
+	}
 
 	// Navigate back to root directory of codebase
 	// Tests seem to run from their own directory, not from where go test is run
 	test.Chdir("../..")
 
-	go startContainer()
-	defer stopContainer()
-
-	testDB := connectToDB()
+	settings := config.DefaultDatabase()
+	go startContainer(settings)
+	defer stopContainer(settings)
 
-	ctx, stop = context.WithCancel(context.Background())
-	defer stop()
+	testDB := connectToDB(settings)
+	store := postgres.New(testDB)
 
-	serverParams := serverFuncParams{
-		writer: &buffer,
-		db:     testDB,
+	open := func(test *testing.T) storage.Store {
+		resetSQL(testDB)
+		return store
 	}
 
-	conf = config.New()
-
-	test.Run(
-		"TestHandleAllSingle",
-		serverTest(testHandleAllSingle, serverParams),
-	)
-	test.Run(
-		"TestHandleAllMultiple",
-		serverTest(testHandleAllMultiple, serverParams),
-	)
-	test.Run(
-		"TestHandleSearchSQLSingle",
-		serverTest(testHandleSearchSQLSingle, serverParams),
-	)
-	test.Run(
-		"TestHandleSearchSQLInvalid",
-		serverTest(testHandleSearchSQLInvalid, serverParams),
-	)
-	test.Run(
-		"TestHandleSearchSQLMultiple",
-		serverTest(testHandleSearchSQLMultiple, serverParams),
-	)
-	test.Run("TestHandleQuit", serverTest(testHandleQuit, serverParams))
+	runServerTests(test, open, func() {
+		stopContainer(settings)
+	})
 
-	test.Run("TestHandleDownload", serverTest(testHandleDownload, serverParams))
-	err := testDB.Close()
+	err := store.Close()
 	if err != nil {
 		panic(err)
 	}
@@ -152,13 +214,13 @@ func TestServer(test *testing.T) {
 func testHandleAllSingle(test *testing.T, serverParams serverFuncParams) {
 	var expected bytes.Buffer
 
-	_, err := database.InsertInto(serverParams.db, testIndexer())
+	err := serverParams.store.InsertIndexer(testIndexer())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testCollection())
+	err = serverParams.store.InsertCollection(testCollection())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testDocument1())
+	_, err = serverParams.store.UpsertDocument(testDocument1())
 	panicOnError(err)
 
 	jsonData, err := json.Marshal([]document.Document{testDocument1()})
@@ -173,16 +235,16 @@ func testHandleAllSingle(test *testing.T, serverParams serverFuncParams) {
 func testHandleAllMultiple(test *testing.T, serverParams serverFuncParams) {
 	var expected bytes.Buffer
 
-	_, err := database.InsertInto(serverParams.db, testIndexer())
+	err := serverParams.store.InsertIndexer(testIndexer())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testCollection())
+	err = serverParams.store.InsertCollection(testCollection())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testDocument1())
+	_, err = serverParams.store.UpsertDocument(testDocument1())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testDocument2())
+	_, err = serverParams.store.UpsertDocument(testDocument2())
 	panicOnError(err)
 
 	jsonData, err := json.Marshal(
@@ -196,19 +258,838 @@ func testHandleAllMultiple(test *testing.T, serverParams serverFuncParams) {
 	assertBufferEquals(test, expected, buffer)
 }
 
-func testHandleSearchSQLSingle(test *testing.T, serverParams serverFuncParams) {
+func testHandlePushDocs(test *testing.T, serverParams serverFuncParams) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	err = serverParams.store.InsertCollection(testCollection())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument1())
+	panicOnError(err)
+
+	missing := indexing.DocFromText("/missing", 0, "2", "lost")
+	body := indexing.ResponseDocs([]indexing.UnnormalizedDocument{
+		indexing.DocFromText(testDocument1().Path, 0, "1", "Changed text"),
+		indexing.DocFromText("/new/path", 0, "1", "new text"),
+		missing,
+	})
+	request := httptest.NewRequest(
+		http.MethodPost,
+		_PUSHDOCS_,
+		bytes.NewReader(body),
+	)
+
+	renormalizer := renormalize.New(conf.Normalizer)
+	cache := search.NewCache(1)
+	handleSearch(serverParams, []string{"new"}, "", "", renormalizer, cache)
+	buffer.Reset()
+
+	handlePushDocs(serverParams, request, renormalizer, cache)
+
+	var response indexing.IndexerResponse
+	err = json.Unmarshal(buffer.Bytes(), &response)
+	panicOnError(err)
+
+	assert.Equal(test, indexing.STATUSSUCCESSFUL, response.Status)
+	outcomes := response.Data.Outcomes
+	assert.Equal(test, 3, len(outcomes))
+	assert.Equal(test, indexing.OUTCOMEUPDATED, outcomes[0].Status)
+	assert.Equal(test, indexing.OUTCOMEINSERTED, outcomes[1].Status)
+	assert.Equal(test, indexing.OUTCOMEFAILED, outcomes[2].Status)
+	assert.Equal(test, missing.Path, outcomes[2].Path)
+	assert.NotEmpty(test, outcomes[2].Message)
+
+	count, err := serverParams.store.CountDocuments("")
+	panicOnError(err)
+	assert.Equal(test, 2, count)
+
+	// The stored documents are found, not the cached results from before.
+	buffer.Reset()
+	handleSearch(serverParams, []string{"new"}, "", "", renormalizer, cache)
+	var searchResponse utils.SearchResponse
+	err = json.Unmarshal(buffer.Bytes(), &searchResponse)
+	panicOnError(err)
+	assert.Equal(test, 1, len(searchResponse.Results))
+
+	// Pushing the same documents again writes nothing.
+	buffer.Reset()
+	request = httptest.NewRequest(
+		http.MethodPost,
+		_PUSHDOCS_,
+		bytes.NewReader(body),
+	)
+	handlePushDocs(serverParams, request, renormalizer, cache)
+
+	response = indexing.IndexerResponse{}
+	err = json.Unmarshal(buffer.Bytes(), &response)
+	panicOnError(err)
+	outcomes = response.Data.Outcomes
+	assert.Equal(test, indexing.OUTCOMEUNCHANGED, outcomes[0].Status)
+	assert.Equal(test, indexing.OUTCOMEUNCHANGED, outcomes[1].Status)
+	assert.Equal(test, 2, response.Data.Counts[indexing.OUTCOMEUNCHANGED])
+}
+
+func testHandlePushDocsInvalid(
+	test *testing.T,
+	serverParams serverFuncParams,
+) {
+	request := httptest.NewRequest(
+		http.MethodPost,
+		_PUSHDOCS_,
+		strings.NewReader("not json"),
+	)
+
+	handlePushDocs(
+		serverParams,
+		request,
+		renormalize.New(conf.Normalizer),
+		search.NewCache(0),
+	)
+
+	var response indexing.IndexerResponse
+	err := json.Unmarshal(buffer.Bytes(), &response)
+	panicOnError(err)
+	assert.Equal(test, indexing.STATUSFAILURE, response.Status)
+}
+
+func testHandleDeleteCollection(
+	test *testing.T,
+	serverParams serverFuncParams,
+) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	err = serverParams.store.InsertCollection(testCollection())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument1())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument2())
+	panicOnError(err)
+
+	url := _DELETECOLLECT_ + "?id=" + string(testCollection().ID)
+	cache := search.NewCache(0)
+
+	// Only DELETE requests delete.
+	request := httptest.NewRequest(http.MethodGet, url, nil)
+	handleDeleteCollection(serverParams, request, cache)
+	assert.Contains(test, buffer.String(), "Delete failed")
+
+	buffer.Reset()
+	request = httptest.NewRequest(http.MethodDelete, url, nil)
+	handleDeleteCollection(serverParams, request, cache)
+
+	var deleted storage.Deleted
+	err = json.Unmarshal(buffer.Bytes(), &deleted)
+	panicOnError(err)
+	assert.Equal(test, storage.Deleted{Collections: 1, Documents: 2}, deleted)
+
+	count, err := serverParams.store.CountDocuments("")
+	panicOnError(err)
+	assert.Equal(test, 0, count)
+
+	buffer.Reset()
+	handleDeleteCollection(serverParams, request, cache)
+	assert.Contains(test, buffer.String(), "Delete failed")
+}
+
+func testHandleDeleteIndexer(
+	test *testing.T,
+	serverParams serverFuncParams,
+) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	err = serverParams.store.InsertCollection(testCollection())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument1())
+	panicOnError(err)
+
+	request := httptest.NewRequest(
+		http.MethodDelete,
+		_DELETEINDEXER_+"?id="+string(testIndexer().ID),
+		nil,
+	)
+	handler := indexAPI.NewIndexHandler()
+	handleDeleteIndexer(serverParams, request, &handler, search.NewCache(0))
+
+	var deleted storage.Deleted
+	err = json.Unmarshal(buffer.Bytes(), &deleted)
+	panicOnError(err)
+	assert.Equal(
+		test,
+		storage.Deleted{Indexers: 1, Collections: 1, Documents: 1},
+		deleted,
+	)
+
+	indexers, err := serverParams.store.Indexers()
+	panicOnError(err)
+	assert.Empty(test, indexers)
+}
+
+func testHandleAllIndexers(
+	test *testing.T,
+	serverParams serverFuncParams,
+) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	handler := indexAPI.NewIndexHandler()
+	handleAllIndexers(serverParams, &handler)
+
+	var statuses []indexerStatus
+	err = json.Unmarshal(buffer.Bytes(), &statuses)
+	panicOnError(err)
+	assert.Len(test, statuses, 1)
+	assert.Equal(test, testIndexer(), statuses[0].IndexerData)
+	assert.Equal(test, indexAPI.STATESTOPPED, statuses[0].State)
+	assert.True(test, statuses[0].Healthy)
+}
+
+func testHandleIndexerLogs(
+	test *testing.T,
+	serverParams serverFuncParams,
+) {
+	handler := indexAPI.NewIndexHandler()
+	id := testIndexer().ID
+
+	request := httptest.NewRequest(http.MethodGet, "/indexers/1/logs", nil)
+	handleIndexerLogs(serverParams, request, &handler, id)
+	assert.Contains(test, buffer.String(), "Logs failed")
+
+	// Its output is kept even though it fails to start.
+	indexer := testIndexer()
+	indexer.ExecPath = "sh"
+	indexer.Args = []string{"-c", "echo first; echo second >&2; exit 3"}
+	assert.Error(test, handler.StartIndexer(indexer))
+	output, ok := handler.Output(id)
+	assert.True(test, ok)
+	assert.Eventually(test, func() bool {
+		lines, _ := output.Tail(2)
+		return len(lines) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	buffer.Reset()
+	request = httptest.NewRequest(
+		http.MethodGet,
+		"/indexers/1/logs?tail=1",
+		nil,
+	)
+	handleIndexerLogs(serverParams, request, &handler, id)
+	assert.Equal(test, 1, strings.Count(buffer.String(), "\n"))
+
+	// Following stops when the request is cancelled.
+	buffer.Reset()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request = httptest.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		"/indexers/1/logs?follow=true",
+		nil,
+	)
+	handleIndexerLogs(serverParams, request, &handler, id)
+	assert.Contains(test, buffer.String(), " stdout first\n")
+	assert.Contains(test, buffer.String(), " stderr second\n")
+}
+
+func testHandleStartStopIndexer(
+	test *testing.T,
+	serverParams serverFuncParams,
+) {
+	handler := indexAPI.NewIndexHandler()
+
+	request := httptest.NewRequest(
+		http.MethodGet,
+		_STARTINDEXER_+"?id=unknown",
+		nil,
+	)
+	handleStartIndexer(serverParams, request, &handler)
+	assert.Contains(test, buffer.String(), "Starting indexer failed")
+	assert.Empty(test, handler.Running())
+
+	buffer.Reset()
+	id := testIndexer().ID
+	request = httptest.NewRequest(
+		http.MethodGet,
+		_STOPINDEXER_+"?id="+string(id),
+		nil,
+	)
+	handleStopIndexer(serverParams, request, &handler)
+
+	var state indexerState
+	err := json.Unmarshal(buffer.Bytes(), &state)
+	panicOnError(err)
+	assert.Equal(test, indexerState{ID: id, Running: false}, state)
+}
+
+func testHandleExportImport(
+	test *testing.T,
+	serverParams serverFuncParams,
+) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	err = serverParams.store.InsertCollection(testCollection())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument1())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument2())
+	panicOnError(err)
+
+	handleExport(serverParams)
+	exported := buffer.String()
+	assert.Equal(test, 5, strings.Count(exported, "\n"))
+
+	_, err = serverParams.store.DeleteIndexer(testIndexer().ID)
+	panicOnError(err)
+
+	cache := search.NewCache(0)
+
+	// Only POST requests import.
+	buffer.Reset()
+	request := httptest.NewRequest(http.MethodGet, _IMPORT_, nil)
+	handleImport(serverParams, request, cache)
+	assert.Contains(test, buffer.String(), "Import failed")
+
+	buffer.Reset()
+	request = httptest.NewRequest(
+		http.MethodPost,
+		_IMPORT_,
+		strings.NewReader(exported),
+	)
+	handleImport(serverParams, request, cache)
+
+	var summary transfer.Summary
+	err = json.Unmarshal(buffer.Bytes(), &summary)
+	panicOnError(err)
+	assert.Equal(test, 1, summary.Indexers)
+	assert.Equal(test, 1, summary.Collections)
+	assert.Equal(test, 2, summary.Documents)
+
+	count, err := serverParams.store.CountDocuments("")
+	panicOnError(err)
+	assert.Equal(test, 2, count)
+}
+
+func testHandlePushDone(test *testing.T, serverParams serverFuncParams) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	err = serverParams.store.InsertCollection(testCollection())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument1())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument2())
+	panicOnError(err)
+
+	runs := sweep.NewRuns()
+	tracker := jobs.NewTracker()
+	cache := search.NewCache(0)
+	done := func(complete bool, job indexing.JobID) sweep.Result {
+		buffer.Reset()
+		body, err := json.Marshal(indexing.IndexingDone{
+			Collection: testCollection().ID,
+			Complete:   complete,
+			Job:        job,
+			Pushed:     1,
+		})
+		panicOnError(err)
+
+		request := httptest.NewRequest(
+			http.MethodPost,
+			_PUSHDONE_,
+			bytes.NewReader(body),
+		)
+		handlePushDone(serverParams, request, runs, tracker, cache)
+
+		var result sweep.Result
+		err = json.Unmarshal(buffer.Bytes(), &result)
+		if err != nil {
+			test.Fatal(buffer.String())
+		}
+		return result
+	}
+
+	// Only the first document is seen by the reindex.
+	runs.Start(testCollection().ID)
+	seen := testDocument1()
+	seen.LastSeen = time.Now().Add(time.Minute)
+	_, err = serverParams.store.UpsertDocument(seen)
+	panicOnError(err)
+
+	// An incomplete reindex removes nothing.
+	assert.Empty(test, done(false, "").Removed)
+
+	// Nor does a cancelled one.
+	cancelled := tracker.Queue(testCollection().ID)
+	panicOnError(tracker.Start(cancelled.ID))
+	runs.Start(testCollection().ID)
+	_, err = tracker.Cancel(cancelled.ID)
+	panicOnError(err)
+	assert.Empty(test, done(true, cancelled.ID).Removed)
+
+	job := tracker.Queue(testCollection().ID)
+	panicOnError(tracker.Start(job.ID))
+	assert.Equal(
+		test,
+		[]utils.Path{testDocument2().Path},
+		done(true, job.ID).Removed,
+	)
+	job, _ = tracker.Job(job.ID)
+	assert.Equal(test, jobs.DONE, job.State)
+	assert.Equal(test, 1, job.Pushed)
+
+	// Without a dispatched reindex nothing is removed.
+	assert.Empty(test, done(true, "").Removed)
+
+	count, err := serverParams.store.CountDocuments("")
+	panicOnError(err)
+	assert.Equal(test, 1, count)
+}
+
+func testHandleJobs(test *testing.T, serverParams serverFuncParams) {
+	tracker := jobs.NewTracker()
+	runs := sweep.NewRuns()
+	job := tracker.Queue(testCollection().ID)
+
+	progress := func(
+		id indexing.JobID,
+		pushed int,
+	) indexing.IndexerResponse {
+		buffer.Reset()
+		body, err := json.Marshal(indexing.IndexingProgress{
+			Job:        id,
+			Collection: testCollection().ID,
+			Pushed:     pushed,
+		})
+		panicOnError(err)
+
+		request := httptest.NewRequest(
+			http.MethodPost,
+			_PUSHPROGRESS_,
+			bytes.NewReader(body),
+		)
+		handlePushProgress(serverParams, request, tracker)
+
+		var resp indexing.IndexerResponse
+		panicOnError(json.Unmarshal(buffer.Bytes(), &resp))
+		return resp
+	}
+
+	assert.Equal(test, indexing.STATUSFAILURE, progress("unknown", 1).Status)
+	panicOnError(tracker.Start(job.ID))
+	assert.Equal(test, indexing.STATUSSUCCESSFUL, progress(job.ID, 3).Status)
+
+	buffer.Reset()
+	request := httptest.NewRequest(
+		http.MethodGet,
+		_JOBS_+"?state=running&c="+string(testCollection().ID),
+		nil,
+	)
+	handleJobs(serverParams, request, tracker)
+	var listed []jobs.Job
+	panicOnError(json.Unmarshal(buffer.Bytes(), &listed))
+	assert.Len(test, listed, 1)
+	assert.Equal(test, 3, listed[0].Pushed)
+
+	// Its indexer is not registered, so only Core forgets the job.
+	buffer.Reset()
+	request = httptest.NewRequest(
+		http.MethodGet,
+		_CANCELJOB_+"?id="+string(job.ID),
+		nil,
+	)
+	handleCancelJob(serverParams, request, tracker, runs)
+	var cancelled jobs.Job
+	panicOnError(json.Unmarshal(buffer.Bytes(), &cancelled))
+	assert.Equal(test, jobs.CANCELLED, cancelled.State)
+
+	buffer.Reset()
+	handleCancelJob(serverParams, request, tracker, runs)
+	assert.Contains(test, buffer.String(), "Cancel failed")
+
+	buffer.Reset()
+	request = httptest.NewRequest(http.MethodGet, _JOBS_+"?id=unknown", nil)
+	handleJobs(serverParams, request, tracker)
+	assert.Contains(test, buffer.String(), "unknown job")
+}
+
+func testFailIndexerJobs(test *testing.T, serverParams serverFuncParams) {
+	store := serverParams.store
+	panicOnError(store.InsertIndexer(testIndexer()))
+	panicOnError(store.InsertCollection(testCollection()))
+
+	tracker := jobs.NewTracker()
+	runs := sweep.NewRuns()
+	running := tracker.Queue(testCollection().ID)
+	panicOnError(tracker.Start(running.ID))
+	runs.Start(testCollection().ID)
+	queued := tracker.Queue(testCollection().ID)
+
+	// Other indexers are not affected.
+	failIndexerJobs(store, runs, tracker, "2", errors.New("indexer exited"))
+	job, _ := tracker.Job(running.ID)
+	assert.Equal(test, jobs.RUNNING, job.State)
+
+	failIndexerJobs(
+		store,
+		runs,
+		tracker,
+		testIndexer().ID,
+		errors.New("indexer exited"),
+	)
+	job, _ = tracker.Job(running.ID)
+	assert.Equal(test, jobs.FAILED, job.State)
+	assert.Equal(test, "indexer exited", job.Error)
+	_, ok := runs.Finish(testCollection().ID)
+	assert.False(test, ok)
+
+	// Dispatching it starts the indexer again.
+	job, _ = tracker.Job(queued.ID)
+	assert.Equal(test, jobs.QUEUED, job.State)
+}
+
+func testHandlePushCollectionInvalid(
+	test *testing.T,
+	serverParams serverFuncParams,
+) {
+	buffer.Reset()
+	request := httptest.NewRequest(
+		http.MethodPost,
+		_PUSHCOLLECTION_,
+		strings.NewReader(`{"Path": "/some/path", "IndexerID": "missing"}`),
+	)
+	handlePushCollection(
+		serverParams,
+		request,
+		nil,
+		sweep.NewRuns(),
+		jobs.NewTracker(),
+	)
+	assert.Contains(test, buffer.String(), "Invalid collection")
+
+	collections, err := serverParams.store.Collections()
+	panicOnError(err)
+	assert.Empty(test, collections)
+}
+
+func testHandleSweepMissing(
+	test *testing.T,
+	serverParams serverFuncParams,
+) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	err = serverParams.store.InsertCollection(testCollection())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument1())
+	panicOnError(err)
+
+	cache := search.NewCache(0)
+	url := _SWEEPMISSING_ + "?id=" + string(testCollection().ID)
+
+	// Only DELETE requests remove documents.
+	request := httptest.NewRequest(http.MethodGet, url, nil)
+	handleSweepMissing(serverParams, request, cache)
+	assert.Contains(test, buffer.String(), "Delete failed")
+
+	buffer.Reset()
+	request = httptest.NewRequest(http.MethodDelete, url, nil)
+	handleSweepMissing(serverParams, request, cache)
+
+	var result sweep.Result
+	err = json.Unmarshal(buffer.Bytes(), &result)
+	panicOnError(err)
+	assert.Equal(test, []utils.Path{testDocument1().Path}, result.Removed)
+
+	count, err := serverParams.store.CountDocuments("")
+	panicOnError(err)
+	assert.Equal(test, 0, count)
+}
+
+func testHandleStatsTerms(test *testing.T, serverParams serverFuncParams) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	err = serverParams.store.InsertCollection(testCollection())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument1())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument2())
+	panicOnError(err)
+
+	handleStats(serverParams)
+
+	var result stats.Stats
+	err = json.Unmarshal(buffer.Bytes(), &result)
+	panicOnError(err)
+	assert.Equal(test, 2, result.Documents)
+	assert.Equal(test, 10, result.Terms)
+	assert.Equal(test, 3, result.DistinctTerms)
+	assert.Equal(test, 2, result.Collections[0].Documents)
+
+	terms := func(query string) []stats.Term {
+		buffer.Reset()
+		request := httptest.NewRequest(http.MethodGet, _TERMS_+query, nil)
+		handleTerms(serverParams, request)
+
+		var terms []stats.Term
+		err := json.Unmarshal(buffer.Bytes(), &terms)
+		if err != nil {
+			test.Fatal(buffer.String())
+		}
+		return terms
+	}
+
+	assert.Equal(test, []stats.Term{
+		{Term: "key1", Documents: 1},
+		{Term: "key2", Documents: 2},
+		{Term: "key3", Documents: 1},
+	}, terms(""))
+	assert.Equal(test, []stats.Term{{Term: "key2", Documents: 2}},
+		terms("?prefix=key&after=key1&n=1"))
+	assert.Empty(test, terms("?c=missing"))
+
+	buffer.Reset()
+	request := httptest.NewRequest(http.MethodGet, _TERMS_+"?n=0", nil)
+	handleTerms(serverParams, request)
+	assert.Contains(test, buffer.String(), "Invalid limit")
+}
+
+func testHandlePreview(test *testing.T, serverParams serverFuncParams) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	err = serverParams.store.InsertCollection(testCollection())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument2())
+	panicOnError(err)
+
+	request := httptest.NewRequest(http.MethodGet,
+		_PREVIEW_+"?p=/some/other/path&q=%2BOTHER", nil)
+	handlePreview(serverParams, request)
+
+	var result preview
+	err = json.Unmarshal(buffer.Bytes(), &result)
+	panicOnError(err)
+	assert.Equal(test, preview{
+		Path:    "/some/other/path",
+		Snippet: "some other text",
+	}, result)
+
+	buffer.Reset()
+	request = httptest.NewRequest(http.MethodGet, _PREVIEW_+"?p=/missing", nil)
+	handlePreview(serverParams, request)
+	assert.Contains(test, buffer.String(), "Preview failed")
+}
+
+func testHandleRevisions(test *testing.T, serverParams serverFuncParams) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	collection := testCollection()
+	collection.Revisions = 3
+	err = serverParams.store.InsertCollection(collection)
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument1())
+	panicOnError(err)
+
+	changed := testDocument1()
+	changed.RawText = "some\nchanged text"
+	changed.Words = utils.FrequencyMap{"key2": 1}
+	changed.LastIndexed = changed.LastIndexed.AddDate(0, 1, 0)
+	_, err = serverParams.store.UpsertDocument(changed)
+	panicOnError(err)
+
+	request := httptest.NewRequest(http.MethodGet,
+		_REVISIONS_+"?p=/some/path", nil)
+	handleRevisions(serverParams, request)
+
+	var revisions []revision.Revision
+	err = json.Unmarshal(buffer.Bytes(), &revisions)
+	panicOnError(err)
+	assert.Len(test, revisions, 2)
+	assert.True(test, revisions[1].Current)
+
+	buffer.Reset()
+	request = httptest.NewRequest(http.MethodGet,
+		_REVISIONDIFF_+"?p=/some/path", nil)
+	handleRevisionDiff(serverParams, request)
+
+	var diff revisionDiff
+	err = json.Unmarshal(buffer.Bytes(), &diff)
+	panicOnError(err)
+	assert.Equal(test, revisionDiff{
+		Path: "/some/path",
+		From: 1,
+		To:   2,
+		Lines: []revision.Line{
+			{Op: revision.DELETE, Text: "some text"},
+			{Op: revision.INSERT, Text: "some"},
+			{Op: revision.INSERT, Text: "changed text"},
+		},
+	}, diff)
+
+	buffer.Reset()
+	request = httptest.NewRequest(http.MethodGet,
+		_REVISIONDIFF_+"?p=/some/path&from=7", nil)
+	handleRevisionDiff(serverParams, request)
+	assert.Contains(test, buffer.String(), "Diff failed")
+
+	// The document had key1 before it changed.
+	searchAsOf := func(asOf string) []utils.SearchResult {
+		buffer.Reset()
+		handleSearch(
+			serverParams,
+			[]string{"key1"},
+			"",
+			asOf,
+			renormalize.New(conf.Normalizer),
+			search.NewCache(0),
+		)
+
+		var response utils.SearchResponse
+		err := json.Unmarshal(buffer.Bytes(), &response)
+		panicOnError(err)
+		return response.Results
+	}
+	assert.Empty(test, searchAsOf(""))
+	assert.Len(test, searchAsOf("2025-01-15"), 1)
+	assert.Empty(test, searchAsOf("2024-12-31T00:00:00Z"))
+
+	buffer.Reset()
+	handleSearch(
+		serverParams,
+		[]string{"key1"},
+		"",
+		"yesterday",
+		renormalize.New(conf.Normalizer),
+		search.NewCache(0),
+	)
+	assert.Contains(test, buffer.String(), "Invalid time")
+}
+
+func testHandleUpdateCollection(
+	test *testing.T,
+	serverParams serverFuncParams,
+) {
+	err := serverParams.store.InsertIndexer(testIndexer())
+	panicOnError(err)
+
+	err = serverParams.store.InsertCollection(testCollection())
+	panicOnError(err)
+
+	_, err = serverParams.store.UpsertDocument(testDocument1())
+	panicOnError(err)
+
+	url := _UPDATECOLLECT_ + "?id=" + string(testCollection().ID)
+	indexers := indexAPI.NewIndexHandler()
+	tracker := jobs.NewTracker()
+	cache := search.NewCache(0)
+	update := func(body string) collectionUpdate {
+		buffer.Reset()
+		request := httptest.NewRequest(
+			http.MethodPost,
+			url,
+			strings.NewReader(body),
+		)
+		handleUpdateCollection(
+			serverParams,
+			request,
+			&indexers,
+			sweep.NewRuns(),
+			tracker,
+			cache,
+		)
+
+		var response collectionUpdate
+		err := json.Unmarshal(buffer.Bytes(), &response)
+		if err != nil {
+			test.Fatal(buffer.String())
+		}
+		return response
+	}
+
+	// Only RespectLastModified changes, the other settings are kept.
+	response := update(`{"RespectLastModified": true}`)
+	assert.Equal(test, indexAPI.UpdatePlan{}, response.Plan)
+	assert.Equal(test, testCollection().Path, response.Collection.Path)
+	assert.True(test, response.Collection.RespectLastModified)
+
+	collection, err := serverParams.store.Collection(testCollection().ID)
+	panicOnError(err)
+	assert.True(test, collection.RespectLastModified)
+
+	// Holding the handler keeps the reindex from being dispatched
+	// until it is cancelled.
+	indexers.Mutex.Lock()
+	response = update(`{"Path": "/other/path"}`)
+	assert.Equal(
+		test,
+		indexAPI.UpdatePlan{Reindex: true, RemoveUnseen: true},
+		response.Plan,
+	)
+	_, err = tracker.Cancel(response.Job)
+	indexers.Mutex.Unlock()
+	panicOnError(err)
+
+	// Documents are only removed by a completed reindex, see handlePushDone.
+	count, err := serverParams.store.CountDocuments("")
+	panicOnError(err)
+	assert.Equal(test, 1, count)
+
+	// The normalizer is only changed for every collection at once.
+	buffer.Reset()
+	request := httptest.NewRequest(http.MethodPost, url, strings.NewReader(
+		`{"Normalfunc": 1}`))
+	handleUpdateCollection(
+		serverParams,
+		request,
+		nil,
+		sweep.NewRuns(),
+		jobs.NewTracker(),
+		cache,
+	)
+	assert.Contains(test, buffer.String(), "Invalid collection")
+
+	collection, err = serverParams.store.Collection(testCollection().ID)
+	panicOnError(err)
+	assert.Equal(test, normalize.TO_LOWER, collection.Normalfunc)
+}
+
+func testHandleSearchSingle(test *testing.T, serverParams serverFuncParams) {
 	var response utils.SearchResponse
 
-	_, err := database.InsertInto(serverParams.db, testIndexer())
+	err := serverParams.store.InsertIndexer(testIndexer())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testCollection())
+	err = serverParams.store.InsertCollection(testCollection())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testDocument1())
+	_, err = serverParams.store.UpsertDocument(testDocument1())
 	panicOnError(err)
 
-	handleSearchSQL(serverParams, []string{"key1"})
+	handleSearch(
+		serverParams,
+		[]string{"key1"},
+		"",
+		"",
+		renormalize.New(conf.Normalizer),
+		search.NewCache(0),
+	)
 
 	err = json.Unmarshal([]byte(buffer.Bytes()), &response)
 	panicOnError(err)
@@ -220,22 +1101,29 @@ func testHandleSearchSQLSingle(test *testing.T, serverParams serverFuncParams) {
 	}
 }
 
-func testHandleSearchSQLInvalid(
+func testHandleSearchInvalid(
 	test *testing.T,
 	serverParams serverFuncParams,
 ) {
 	var response utils.SearchResponse
 
-	_, err := database.InsertInto(serverParams.db, testIndexer())
+	err := serverParams.store.InsertIndexer(testIndexer())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testCollection())
+	err = serverParams.store.InsertCollection(testCollection())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testDocument1())
+	_, err = serverParams.store.UpsertDocument(testDocument1())
 	panicOnError(err)
 
-	handleSearchSQL(serverParams, []string{"badkey"})
+	handleSearch(
+		serverParams,
+		[]string{"badkey"},
+		"",
+		"",
+		renormalize.New(conf.Normalizer),
+		search.NewCache(0),
+	)
 
 	err = json.Unmarshal([]byte(buffer.Bytes()), &response)
 	panicOnError(err)
@@ -245,26 +1133,33 @@ func testHandleSearchSQLInvalid(
 	}
 }
 
-func testHandleSearchSQLMultiple(
+func testHandleSearchMultiple(
 	test *testing.T,
 	serverParams serverFuncParams,
 ) {
 	var response utils.SearchResponse
 
-	_, err := database.InsertInto(serverParams.db, testIndexer())
+	err := serverParams.store.InsertIndexer(testIndexer())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testCollection())
+	err = serverParams.store.InsertCollection(testCollection())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testDocument1())
+	_, err = serverParams.store.UpsertDocument(testDocument1())
 	panicOnError(err)
 
-	_, err = database.InsertInto(serverParams.db, testDocument2())
+	_, err = serverParams.store.UpsertDocument(testDocument2())
 	panicOnError(err)
 
 	// key1 is unique to testDocument1
-	handleSearchSQL(serverParams, []string{"key1"})
+	handleSearch(
+		serverParams,
+		[]string{"key1"},
+		"",
+		"",
+		renormalize.New(conf.Normalizer),
+		search.NewCache(0),
+	)
 
 	err = json.Unmarshal([]byte(buffer.Bytes()), &response)
 	panicOnError(err)
@@ -277,7 +1172,14 @@ func testHandleSearchSQLMultiple(
 	buffer.Reset()
 
 	// key3 is unique to testDocument2
-	handleSearchSQL(serverParams, []string{"key3"})
+	handleSearch(
+		serverParams,
+		[]string{"key3"},
+		"",
+		"",
+		renormalize.New(conf.Normalizer),
+		search.NewCache(0),
+	)
 
 	err = json.Unmarshal([]byte(buffer.Bytes()), &response)
 	panicOnError(err)
@@ -290,7 +1192,14 @@ func testHandleSearchSQLMultiple(
 	buffer.Reset()
 
 	// key2 is common among both documents
-	handleSearchSQL(serverParams, []string{"key2"})
+	handleSearch(
+		serverParams,
+		[]string{"key2"},
+		"",
+		"",
+		renormalize.New(conf.Normalizer),
+		search.NewCache(0),
+	)
 	err = json.Unmarshal([]byte(buffer.Bytes()), &response)
 	panicOnError(err)
 	if len(response.Results) != 2 {
@@ -327,3 +1236,82 @@ func testHandleQuit(test *testing.T, serverParams serverFuncParams) {
 	// Reset context globals
 	ctx, stop = context.WithCancel(context.Background())
 }
+
+func testFindOrRegister(test *testing.T, serverParams serverFuncParams) {
+	store := serverParams.store
+	unreg := indexAPI.UnregisteredCollection{
+		Path:       "/loaded/path",
+		SourceType: utils.DIR_SOURCE,
+		Recursive:  true,
+		Normalfunc: normalize.TO_LOWER,
+	}
+
+	_, err := findOrRegister(store, unreg)
+	assert.Error(test, err, "no indexer is registered")
+
+	indexer := testIndexer()
+	indexer.Name = load.TEXTINDEXER
+	assert.NoError(test, store.InsertIndexer(indexer))
+
+	registered, err := findOrRegister(store, unreg)
+	assert.NoError(test, err)
+	assert.Equal(test, testIndexer().ID, registered.IndexerID)
+	assert.Equal(test, unreg.Path, registered.Path)
+
+	found, err := findOrRegister(store, unreg)
+	assert.NoError(test, err)
+	assert.Equal(test, registered, found)
+
+	other := indexer
+	other.ID = "2"
+	other.Port = 2
+	assert.NoError(test, store.InsertIndexer(other))
+
+	unreg.Path = "/other/path"
+	_, err = findOrRegister(store, unreg)
+	assert.Error(test, err, "the indexer must be chosen")
+
+	unreg.IndexerID = "missing"
+	_, err = findOrRegister(store, unreg)
+	assert.Error(test, err)
+
+	unreg.IndexerID = other.ID
+	registered, err = findOrRegister(store, unreg)
+	assert.NoError(test, err)
+	assert.Equal(test, other.ID, registered.IndexerID)
+
+	// Files are read like the LocalText indexer reads them.
+	pdf := testIndexer()
+	pdf.ID = "3"
+	pdf.Port = 3
+	assert.NoError(test, store.InsertIndexer(pdf))
+	unreg.Path = "/pdf/path"
+	unreg.IndexerID = pdf.ID
+	_, err = findOrRegister(store, unreg)
+	assert.Error(test, err, "only LocalText collections can be loaded")
+
+	collections, err := store.Collections()
+	assert.NoError(test, err)
+	assert.Len(test, collections, 2)
+}
+
+func TestMainUsage(test *testing.T) {
+	assert.Equal(test, _EXITUSAGE_, Main([]string{"unknown"}))
+	assert.Equal(test, _EXITOK_, Main([]string{"help"}))
+}
+
+func TestIndexerLogsID(test *testing.T) {
+	id, ok := indexerLogsID("/indexers/42/logs")
+	assert.True(test, ok)
+	assert.Equal(test, indexAPI.IndexerID("42"), id)
+
+	for _, path := range []string{
+		"/indexers//logs",
+		"/indexers/42",
+		"/indexers/4/2/logs",
+		"/all/indexers",
+	} {
+		_, ok = indexerLogsID(path)
+		assert.False(test, ok, path)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Package stats describes what is in the index: how many documents each
+collection and source has, how many terms they contain and how large the
+index is, see Stats. The vocabulary can be browsed with the number of
+documents containing each term, see Term.
+*/
+package stats
+
+import (
+	"seekourney/indexing"
+	"seekourney/utils"
+	"strings"
+	"time"
+)
+
+const (
+	// DEFAULTTERMLIMIT is the number of terms returned if no limit is given.
+	DEFAULTTERMLIMIT int = 100
+
+	// MAXTERMLIMIT is the most terms returned at once.
+	MAXTERMLIMIT int = 10000
+)
+
+// Stats summarizes the stored documents.
+type Stats struct {
+	// Documents is the number of stored documents.
+	Documents int
+
+	// Collections are the stored collections, ordered by ID,
+	// including those without documents.
+	Collections []CollectionStats
+
+	// Sources is the number of documents from each source,
+	// by utils.Source.String. Sources without documents are left out.
+	Sources map[string]int
+
+	// Terms is the number of words in all documents,
+	// and DistinctTerms the number of different words.
+	Terms         int
+	DistinctTerms int
+
+	// AverageLength is the average number of words in a document.
+	AverageLength float64
+
+	// IndexSize is the number of bytes the backend stores, see Store.
+	IndexSize int64
+
+	// LastIndexed is when the newest document was indexed,
+	// zero if there are no documents.
+	LastIndexed time.Time
+}
+
+// CollectionStats summarizes the documents of one collection.
+type CollectionStats struct {
+	ID        indexing.CollectionID
+	Documents int
+
+	// LastIndexed is when its newest document was indexed,
+	// zero if it has no documents.
+	LastIndexed time.Time
+}
+
+// Term is a word of the vocabulary,
+// with the number of documents containing it.
+type Term struct {
+	Term      utils.Word
+	Documents int
+}
+
+// TermFilter selects the terms returned by Store.Terms.
+type TermFilter struct {
+	// Prefix is what every term starts with, empty for every term.
+	Prefix string
+
+	// Collection only counts documents of this collection,
+	// empty for every document. Terms it has no documents with are left out.
+	Collection indexing.CollectionID
+
+	// After skips terms up to and including this one,
+	// used to page through the vocabulary.
+	After utils.Word
+
+	// Limit is the most terms returned, it must be positive.
+	Limit int
+}
+
+// Matches reports whether term is selected by filter,
+// not counting its collection or the limit.
+func (filter TermFilter) Matches(term utils.Word) bool {
+	return strings.HasPrefix(string(term), filter.Prefix) &&
+		term > filter.After
+}
+
+// Store is the storage that is summarized, see storage.Store.
+type Store interface {
+	// Stats summarizes the stored documents. IndexSize is the size of the
+	// files of the embedded backend, and of the tables for postgres.
+	Stats() (Stats, error)
+
+	// Terms returns the terms selected by filter, ordered by their bytes.
+	Terms(filter TermFilter) ([]Term, error)
+}
+
+// Average returns the average number of words of documents containing
+// terms words in total, 0 if there are no documents.
+func Average(terms int, documents int) float64 {
+	if documents == 0 {
+		return 0
+	}
+	return float64(terms) / float64(documents)
+}
@@ -0,0 +1,23 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTermFilterMatches(t *testing.T) {
+	filter := TermFilter{Prefix: "ap", After: "apple"}
+
+	assert.False(t, filter.Matches("apple"))
+	assert.True(t, filter.Matches("apricot"))
+	assert.False(t, filter.Matches("banana"))
+	assert.False(t, filter.Matches("aardvark"))
+
+	assert.True(t, TermFilter{}.Matches("anything"))
+}
+
+func TestAverage(t *testing.T) {
+	assert.Zero(t, Average(0, 0))
+	assert.InDelta(t, 2.5, Average(5, 2), 0.001)
+}
@@ -0,0 +1,738 @@
+/*
+Package embedded implements storage.Store in pure Go, in a directory on disk.
+
+Everything is kept in memory, together with an inverted index used to score
+searches, see search.Evaluate. Every change is appended to a log file before
+it is applied, and the log is folded into a snapshot file once it grows long,
+and when the store is closed. Opening a store loads the snapshot and replays
+the log, so no change is lost if the server is killed.
+
+References between documents, collections and indexers are checked the same
+way the database does it for the postgres backend.
+Only one store may have a directory open at a time.
+*/
+package embedded
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"seekourney/core/document"
+	"seekourney/core/indexAPI"
+	"seekourney/core/renormalize"
+	"seekourney/core/search"
+	"seekourney/core/stats"
+	"seekourney/core/storage"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"seekourney/utils/normalize"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store is a storage.Store keeping everything in memory and in a directory.
+type Store struct {
+	mutex sync.RWMutex
+
+	// dir holds the snapshot and log files.
+	dir string
+
+	// log is the open log file, and logRecords the number of records in it.
+	log        *os.File
+	logRecords int
+
+	documents   map[utils.Path]storedDocument
+	collections map[indexing.CollectionID]indexAPI.Collection
+	indexers    map[indexAPI.IndexerID]indexAPI.IndexerData
+
+	// nextSequence numbers documents in the order they were first stored.
+	nextSequence int
+
+	// postings maps every word to the documents containing it,
+	// and how often it occurs there.
+	postings map[utils.Word]map[utils.Path]utils.Frequency
+
+	// revisions are the previous versions of documents, oldest first.
+	revisions map[utils.Path][]storedRevision
+}
+
+// storedDocument is a document with its insertion order and word count.
+type storedDocument struct {
+	document.Document
+	sequence  int
+	wordCount int
+}
+
+var _ storage.Store = (*Store)(nil)
+
+// Open opens the store in dir, creating it if it does not exist.
+func Open(dir string) (*Store, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &Store{
+		dir:         dir,
+		documents:   make(map[utils.Path]storedDocument),
+		collections: make(map[indexing.CollectionID]indexAPI.Collection),
+		indexers:    make(map[indexAPI.IndexerID]indexAPI.IndexerData),
+		postings:    make(map[utils.Word]map[utils.Path]utils.Frequency),
+		revisions:   make(map[utils.Path][]storedRevision),
+	}
+
+	err = store.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Close writes a snapshot and closes the log.
+func (store *Store) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.log == nil {
+		return errors.New("store already closed")
+	}
+
+	err := store.compact()
+	closeErr := store.log.Close()
+	store.log = nil
+
+	return errors.Join(err, closeErr)
+}
+
+/// Documents
+
+// Documents returns every stored document, in the order they were added.
+func (store *Store) Documents() ([]document.Document, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.sortedDocuments(func(doc storedDocument) bool {
+		return true
+	}, func(a storedDocument, b storedDocument) bool {
+		return a.sequence < b.sequence
+	}), nil
+}
+
+// DocumentText returns the raw text of the document with the given path,
+// which is kept in memory with the document.
+func (store *Store) DocumentText(path utils.Path) (string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	doc, ok := store.documents[path]
+	if !ok {
+		return "", errors.New("document " + string(path) + " not found")
+	}
+
+	return doc.RawText, nil
+}
+
+// UpsertDocument stores doc, replacing any document with the same path.
+// Returns true if the document was new.
+func (store *Store) UpsertDocument(doc document.Document) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.collections[doc.Collection]; !ok {
+		return false, errors.New(
+			"collection " + string(doc.Collection) + " not found")
+	}
+
+	stored, exists := store.documents[doc.Path]
+	revision := 0
+	if exists && !storage.Unchanged(stored.Document, doc) {
+		revision = store.revisionNumber(doc.Path)
+	}
+
+	err := store.write(record{Document: &doc, Revision: revision})
+	if err != nil {
+		return false, err
+	}
+
+	return !exists, nil
+}
+
+// UpsertDocuments stores docs with a single write to the log,
+// see storage.Store.
+func (store *Store) UpsertDocuments(
+	docs []document.Document,
+) ([]storage.Outcome, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	outcomes, valid := storage.CheckBatch(
+		docs,
+		func(id indexing.CollectionID) bool {
+			_, ok := store.collections[id]
+			return ok
+		},
+	)
+
+	records := make([]record, 0, len(valid)+1)
+	seen := make(map[utils.Path]time.Time)
+	for _, index := range valid {
+		stored, exists := store.documents[docs[index].Path]
+		if exists && storage.Unchanged(stored.Document, docs[index]) {
+			outcomes[index].Unchanged = true
+			seen[docs[index].Path] = docs[index].LastSeen
+			continue
+		}
+
+		outcomes[index].Inserted = !exists
+		records = append(records, record{
+			Document: &docs[index],
+			Revision: store.revisionNumber(docs[index].Path),
+		})
+	}
+
+	if len(seen) > 0 {
+		records = append(records, record{SeenDocuments: seen})
+	}
+
+	err := store.write(records...)
+	if err != nil {
+		return nil, err
+	}
+
+	return outcomes, nil
+}
+
+// DeleteDocument removes the document with the given path. It is kept as a
+// revision if its collection keeps revisions, see deletedRecords.
+func (store *Store) DeleteDocument(path utils.Path) (storage.Deleted, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.documents[path]; !ok {
+		return storage.Deleted{}, errors.New(
+			"document " + string(path) + " not found")
+	}
+
+	err := store.write(store.deletedRecords(path, time.Now())...)
+	if err != nil {
+		return storage.Deleted{}, err
+	}
+
+	return storage.Deleted{Documents: 1}, nil
+}
+
+// CountDocuments returns the number of documents in collection,
+// or of all documents if collection is empty.
+func (store *Store) CountDocuments(
+	collection indexing.CollectionID,
+) (int, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if collection == "" {
+		return len(store.documents), nil
+	}
+
+	count := 0
+	for _, doc := range store.documents {
+		if doc.Collection == collection {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// DocumentsAfter returns at most limit documents of collection,
+// ordered by path, starting after the given path.
+func (store *Store) DocumentsAfter(
+	after utils.Path,
+	collection indexing.CollectionID,
+	limit int,
+) ([]document.Document, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	docs := store.sortedDocuments(func(doc storedDocument) bool {
+		return doc.Path > after &&
+			(collection == "" || doc.Collection == collection)
+	}, func(a storedDocument, b storedDocument) bool {
+		return a.Path < b.Path
+	})
+
+	if len(docs) > limit {
+		docs = docs[:limit]
+	}
+
+	return docs, nil
+}
+
+// UpdateWords replaces the stored words of docs and revisions, all or none
+// of them, see renormalize.Store. Versions that are not stored are skipped.
+func (store *Store) UpdateWords(
+	docs []document.Document,
+	revisions []renormalize.Revision,
+) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	records := make([]record, 0, len(docs)+len(revisions))
+	for _, doc := range docs {
+		stored, ok := store.documents[doc.Path]
+		if ok && stored.Hash == doc.Hash {
+			updated := stored.Document
+			updated.Words = doc.Words
+			records = append(records, record{Document: &updated})
+			continue
+		}
+
+		// Replaced since it was read, it may have been kept as a revision.
+		kept := store.revisions[doc.Path]
+		if len(kept) > 0 {
+			rev := renormalize.Revision{
+				Number:   kept[len(kept)-1].Number,
+				Document: doc,
+			}
+			records = append(records, store.revisionWords(rev)...)
+		}
+	}
+
+	for _, rev := range revisions {
+		records = append(records, store.revisionWords(rev)...)
+	}
+
+	return store.write(records...)
+}
+
+// delete writes a delete record, and returns what it deletes.
+// The mutex must be held.
+func (store *Store) delete(rec record) (storage.Deleted, error) {
+	// Counted before writing, since the record is applied by write.
+	deleted := store.countDeleted(rec)
+
+	err := store.write(rec)
+	if err != nil {
+		return storage.Deleted{}, err
+	}
+
+	return deleted, nil
+}
+
+// countDeleted counts what a delete record would delete.
+// The mutex must be held.
+func (store *Store) countDeleted(rec record) storage.Deleted {
+	var deleted storage.Deleted
+
+	deletedCollections := make(map[indexing.CollectionID]bool)
+	switch {
+	case rec.DeletedIndexer != "":
+		deleted.Indexers = 1
+		for id, collection := range store.collections {
+			if collection.IndexerID == rec.DeletedIndexer {
+				deletedCollections[id] = true
+			}
+		}
+	case rec.DeletedCollection != "":
+		deletedCollections[rec.DeletedCollection] = true
+	}
+
+	deleted.Collections = len(deletedCollections)
+	for _, doc := range store.documents {
+		if deletedCollections[doc.Collection] {
+			deleted.Documents++
+		}
+	}
+
+	return deleted
+}
+
+// sortedDocuments returns the documents for which keep returns true,
+// sorted with less.
+func (store *Store) sortedDocuments(
+	keep func(storedDocument) bool,
+	less func(storedDocument, storedDocument) bool,
+) []document.Document {
+	stored := make([]storedDocument, 0)
+	for _, doc := range store.documents {
+		if keep(doc) {
+			stored = append(stored, doc)
+		}
+	}
+
+	sort.Slice(stored, func(i, j int) bool {
+		return less(stored[i], stored[j])
+	})
+
+	docs := make([]document.Document, len(stored))
+	for i, doc := range stored {
+		docs[i] = doc.Document
+	}
+
+	return docs
+}
+
+/// Search
+
+// Score scores the matching documents with the inverted index,
+// see search.Evaluate, and adds the source and metadata of each result.
+// Searches as of a past time go through every version instead,
+// and add the metadata of the versions.
+func (store *Store) Score(
+	terms []utils.Word,
+	filter search.Filter,
+	limit int,
+) ([]search.SearchResult, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var source search.PostingSource = store.postingSource(filter)
+	var versions *versionSource
+	if !filter.AsOf.IsZero() {
+		versions = store.versionSource(filter)
+		source = versions
+	}
+
+	results, err := search.Evaluate(source, terms, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, result := range results {
+		doc := store.documents[result.Path].Document
+		if versions != nil {
+			doc = versions.byPath[result.Path]
+		}
+		results[i].Source = doc.Source
+		results[i].Metadata = doc.Metadata
+	}
+
+	return results, nil
+}
+
+/// Stats
+
+// Stats summarizes the stored documents, see stats.Stats.
+// The index size is that of the snapshot and log files.
+func (store *Store) Stats() (stats.Stats, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	result := stats.Stats{
+		Documents:     len(store.documents),
+		Collections:   make([]stats.CollectionStats, 0),
+		Sources:       make(map[string]int),
+		DistinctTerms: len(store.postings),
+	}
+
+	collections := make(map[indexing.CollectionID]*stats.CollectionStats)
+	for id := range store.collections {
+		collections[id] = &stats.CollectionStats{ID: id}
+	}
+
+	for _, doc := range store.documents {
+		result.Sources[doc.Source.String()]++
+		result.Terms += doc.wordCount
+		if doc.LastIndexed.After(result.LastIndexed) {
+			result.LastIndexed = doc.LastIndexed
+		}
+
+		collection := collections[doc.Collection]
+		collection.Documents++
+		if doc.LastIndexed.After(collection.LastIndexed) {
+			collection.LastIndexed = doc.LastIndexed
+		}
+	}
+	result.AverageLength = stats.Average(result.Terms, result.Documents)
+
+	for _, collection := range collections {
+		result.Collections = append(result.Collections, *collection)
+	}
+	sort.Slice(result.Collections, func(i, j int) bool {
+		return result.Collections[i].ID < result.Collections[j].ID
+	})
+
+	for _, name := range []string{_SNAPSHOTFILE_, _LOGFILE_} {
+		info, err := os.Stat(filepath.Join(store.dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return stats.Stats{}, err
+		}
+		result.IndexSize += info.Size()
+	}
+
+	return result, nil
+}
+
+// Terms returns the terms of the inverted index selected by filter,
+// see stats.TermFilter.
+func (store *Store) Terms(filter stats.TermFilter) ([]stats.Term, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	terms := make([]stats.Term, 0)
+	for word, postings := range store.postings {
+		if !filter.Matches(word) {
+			continue
+		}
+
+		count := 0
+		for path := range postings {
+			if filter.Collection == "" ||
+				store.documents[path].Collection == filter.Collection {
+				count++
+			}
+		}
+
+		if count > 0 {
+			terms = append(terms, stats.Term{Term: word, Documents: count})
+		}
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > filter.Limit {
+		terms = terms[:filter.Limit]
+	}
+
+	return terms, nil
+}
+
+/// Collections
+
+// Collections returns every stored collection, ordered by ID.
+func (store *Store) Collections() ([]indexAPI.Collection, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	collections := make([]indexAPI.Collection, 0, len(store.collections))
+	for _, collection := range store.collections {
+		collections = append(collections, collection)
+	}
+
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].ID < collections[j].ID
+	})
+
+	return collections, nil
+}
+
+// Collection returns the collection with the given ID.
+func (store *Store) Collection(
+	id indexing.CollectionID,
+) (indexAPI.Collection, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	collection, ok := store.collections[id]
+	if !ok {
+		return indexAPI.Collection{}, errors.New(
+			"collection " + string(id) + " not found")
+	}
+
+	return collection, nil
+}
+
+// InsertCollection stores a new collection.
+func (store *Store) InsertCollection(collection indexAPI.Collection) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.collections[collection.ID]; ok {
+		return errors.New(
+			"collection " + string(collection.ID) + " already exists")
+	}
+
+	if _, ok := store.indexers[collection.IndexerID]; !ok {
+		return errors.New(
+			"indexer " + string(collection.IndexerID) + " not found")
+	}
+
+	return store.write(record{Collection: &collection})
+}
+
+// DeleteCollection removes a collection and all its documents.
+func (store *Store) DeleteCollection(
+	id indexing.CollectionID,
+) (storage.Deleted, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.collections[id]; !ok {
+		return storage.Deleted{}, errors.New(
+			"collection " + string(id) + " not found")
+	}
+
+	return store.delete(record{DeletedCollection: id})
+}
+
+// SweepCollection removes the documents of a collection last seen before
+// the given time, and returns their paths ordered. They are kept as
+// revisions if the collection keeps revisions, see deletedRecords.
+func (store *Store) SweepCollection(
+	id indexing.CollectionID,
+	before time.Time,
+) ([]utils.Path, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.collections[id]; !ok {
+		return nil, errors.New("collection " + string(id) + " not found")
+	}
+
+	paths := make([]utils.Path, 0)
+	for path, doc := range store.documents {
+		if doc.Collection == id && doc.LastSeen.Before(before) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i] < paths[j]
+	})
+
+	deleted := time.Now()
+	records := make([]record, 0, len(paths))
+	for _, path := range paths {
+		records = append(records, store.deletedRecords(path, deleted)...)
+	}
+
+	err := store.write(records...)
+	if err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// UpdateCollection replaces the stored collection with the same ID.
+func (store *Store) UpdateCollection(collection indexAPI.Collection) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.collections[collection.ID]; !ok {
+		return errors.New(
+			"collection " + string(collection.ID) + " not found")
+	}
+
+	if _, ok := store.indexers[collection.IndexerID]; !ok {
+		return errors.New(
+			"indexer " + string(collection.IndexerID) + " not found")
+	}
+
+	return store.write(record{Collection: &collection})
+}
+
+// SetCollectionNormalizer sets the normalizer of collection,
+// or of every collection if it is empty.
+func (store *Store) SetCollectionNormalizer(
+	collection indexing.CollectionID,
+	normalizer normalize.Normalizer,
+) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	records := make([]record, 0)
+	for id, stored := range store.collections {
+		if collection != "" && id != collection {
+			continue
+		}
+
+		updated := stored
+		updated.Normalfunc = normalizer
+		records = append(records, record{Collection: &updated})
+	}
+
+	return store.write(records...)
+}
+
+/// Indexers
+
+// Indexers returns every stored indexer, ordered by port.
+func (store *Store) Indexers() ([]indexAPI.IndexerData, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	indexers := make([]indexAPI.IndexerData, 0, len(store.indexers))
+	for _, indexer := range store.indexers {
+		indexers = append(indexers, indexer)
+	}
+
+	sort.Slice(indexers, func(i, j int) bool {
+		return indexers[i].Port < indexers[j].Port
+	})
+
+	return indexers, nil
+}
+
+// Indexer returns the indexer with the given ID.
+func (store *Store) Indexer(
+	id indexAPI.IndexerID,
+) (indexAPI.IndexerData, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	indexer, ok := store.indexers[id]
+	if !ok {
+		return indexAPI.IndexerData{}, errors.New(
+			"indexer " + string(id) + " not found")
+	}
+
+	return indexer, nil
+}
+
+// InsertIndexer stores a new indexer.
+func (store *Store) InsertIndexer(indexer indexAPI.IndexerData) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.indexers[indexer.ID]; ok {
+		return errors.New("indexer " + string(indexer.ID) + " already exists")
+	}
+
+	for _, other := range store.indexers {
+		if other.Port == indexer.Port {
+			return errors.New("port " + indexer.Port.String() + " is taken")
+		}
+	}
+
+	return store.write(record{Indexer: &indexer})
+}
+
+// DeleteIndexer removes an indexer,
+// and all its collections with their documents.
+func (store *Store) DeleteIndexer(
+	id indexAPI.IndexerID,
+) (storage.Deleted, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.indexers[id]; !ok {
+		return storage.Deleted{}, errors.New(
+			"indexer " + string(id) + " not found")
+	}
+
+	return store.delete(record{DeletedIndexer: id})
+}
+
+// FreeIndexerPort returns the lowest port not assigned to any indexer,
+// at least utils.MININDEXERPORT.
+func (store *Store) FreeIndexerPort() (utils.Port, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	taken := make(map[utils.Port]bool, len(store.indexers))
+	for _, indexer := range store.indexers {
+		taken[indexer.Port] = true
+	}
+
+	port := utils.MININDEXERPORT
+	for taken[port] {
+		port++
+	}
+
+	return port, nil
+}
@@ -0,0 +1,283 @@
+package embedded
+
+import (
+	"os"
+	"path/filepath"
+	"seekourney/core/document"
+	"seekourney/core/search"
+	"seekourney/core/storage"
+	"seekourney/core/storage/storagetest"
+	"seekourney/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		store, err := Open(t.TempDir())
+		assert.NoError(t, err)
+		return store
+	})
+}
+
+// fill stores an indexer, a collection and amount documents.
+func fill(t *testing.T, store *Store, amount int) {
+	assert.NoError(t, store.InsertIndexer(storagetest.Indexer("i1", 40000)))
+	assert.NoError(
+		t, store.InsertCollection(storagetest.Collection("c1", "i1")))
+
+	for i := range amount {
+		path := utils.Path("/doc/" + string(rune('a'+i%26)) +
+			"/" + string(rune('a'+i/26)))
+		doc := storagetest.Document(path, "c1", "common word "+string(path))
+		_, err := store.UpsertDocument(doc)
+		assert.NoError(t, err)
+	}
+}
+
+// assertContent checks that store holds what fill stored.
+func assertContent(t *testing.T, store *Store, amount int) {
+	docs, err := store.Documents()
+	assert.NoError(t, err)
+	assert.Equal(t, amount, len(docs))
+
+	_, err = store.Indexer("i1")
+	assert.NoError(t, err)
+
+	results, err := store.Score(
+		[]utils.Word{"common"},
+		search.Filter{},
+		amount,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, amount, len(results))
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(dir)
+	assert.NoError(t, err)
+	fill(t, store, 10)
+
+	// Not closed, as if the server was killed.
+	// The state is rebuilt from the log alone.
+	reopened, err := Open(dir)
+	assert.NoError(t, err)
+	assertContent(t, reopened, 10)
+	assert.NoError(t, reopened.Close())
+
+	// Closing writes a snapshot and empties the log.
+	info, err := os.Stat(filepath.Join(dir, _LOGFILE_))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	reopened, err = Open(dir)
+	assert.NoError(t, err)
+	assertContent(t, reopened, 10)
+
+	// Documents keep the order they were added in.
+	docs, err := reopened.Documents()
+	assert.NoError(t, err)
+	assert.Equal(t, utils.Path("/doc/a/a"), docs[0].Path)
+	assert.Equal(t, utils.Path("/doc/b/a"), docs[1].Path)
+	assert.NoError(t, reopened.Close())
+}
+
+func TestReopenAfterDelete(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(dir)
+	assert.NoError(t, err)
+	fill(t, store, 10)
+
+	_, err = store.DeleteDocument("/doc/a/a")
+	assert.NoError(t, err)
+
+	// Deletes are replayed from the log.
+	reopened, err := Open(dir)
+	assert.NoError(t, err)
+	assertContent(t, reopened, 9)
+
+	_, err = reopened.DeleteCollection("c1")
+	assert.NoError(t, err)
+	assert.NoError(t, reopened.Close())
+
+	// And kept in the snapshot.
+	reopened, err = Open(dir)
+	assert.NoError(t, err)
+	count, err := reopened.CountDocuments("")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.NoError(t, reopened.Close())
+}
+
+func TestReopenRevisions(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(dir)
+	assert.NoError(t, err)
+	fill(t, store, 1)
+
+	collection, err := store.Collection("c1")
+	assert.NoError(t, err)
+	collection.Revisions = 1
+	assert.NoError(t, store.UpdateCollection(collection))
+
+	for _, text := range []string{"first", "second", "third"} {
+		_, err = store.UpsertDocument(
+			storagetest.Document("/a", "c1", text))
+		assert.NoError(t, err)
+	}
+
+	assertRevisions := func(store *Store) {
+		revisions, err := store.Revisions("/a")
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 2)
+		assert.Equal(t, 2, revisions[0].Number)
+
+		text, err := store.RevisionText("/a", 2)
+		assert.NoError(t, err)
+		assert.Equal(t, "second", text)
+	}
+
+	// Revisions are replayed from the log.
+	reopened, err := Open(dir)
+	assert.NoError(t, err)
+	assertRevisions(reopened)
+	assert.NoError(t, reopened.Close())
+
+	// And kept in the snapshot.
+	reopened, err = Open(dir)
+	assert.NoError(t, err)
+	assertRevisions(reopened)
+	assert.NoError(t, reopened.Close())
+}
+
+func TestCrashDuringCompaction(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(dir)
+	assert.NoError(t, err)
+	fill(t, store, 1)
+
+	collection, err := store.Collection("c1")
+	assert.NoError(t, err)
+	// More than are made, so none is pruned.
+	collection.Revisions = 10
+	assert.NoError(t, store.UpdateCollection(collection))
+
+	for _, text := range []string{"first", "second", "third"} {
+		_, err = store.UpsertDocument(
+			storagetest.Document("/a", "c1", text))
+		assert.NoError(t, err)
+	}
+	_, err = store.UpsertDocuments([]document.Document{
+		storagetest.Document("/a", "c1", "fourth"),
+	})
+	assert.NoError(t, err)
+	// Kept as a revision when deleted.
+	_, err = store.DeleteDocument("/a")
+	assert.NoError(t, err)
+	_, err = store.UpsertDocument(storagetest.Document("/a", "c1", "fifth"))
+	assert.NoError(t, err)
+
+	// Killed after the snapshot was written, before the log was emptied.
+	logPath := filepath.Join(dir, _LOGFILE_)
+	content, err := os.ReadFile(logPath)
+	assert.NoError(t, err)
+	store.mutex.Lock()
+	assert.NoError(t, store.compact())
+	store.mutex.Unlock()
+	assert.NoError(t, os.WriteFile(logPath, content, 0644))
+
+	// Replaying the log again keeps no revision twice.
+	reopened, err := Open(dir)
+	assert.NoError(t, err)
+	revisions, err := reopened.Revisions("/a")
+	assert.NoError(t, err)
+	numbers := make([]int, len(revisions))
+	for i, rev := range revisions {
+		numbers[i] = rev.Number
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, numbers)
+
+	text, err := reopened.RevisionText("/a", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", text)
+	text, err = reopened.RevisionText("/a", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "fourth", text)
+	text, err = reopened.RevisionText("/a", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "fifth", text)
+	count, err := reopened.CountDocuments("")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NoError(t, reopened.Close())
+}
+
+func TestCompaction(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(dir)
+	assert.NoError(t, err)
+	fill(t, store, _COMPACTAFTER_+10)
+
+	assert.Less(t, store.logRecords, _COMPACTAFTER_)
+	_, err = os.Stat(filepath.Join(dir, _SNAPSHOTFILE_))
+	assert.NoError(t, err)
+
+	// Snapshot plus the rest of the log.
+	reopened, err := Open(dir)
+	assert.NoError(t, err)
+	assertContent(t, reopened, _COMPACTAFTER_+10)
+	assert.NoError(t, reopened.Close())
+}
+
+func TestTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(dir)
+	assert.NoError(t, err)
+	fill(t, store, 3)
+
+	// A record cut off by a crash while it was written.
+	_, err = store.log.WriteString(`{"Document":{"Path":"/torn"`)
+	assert.NoError(t, err)
+
+	reopened, err := Open(dir)
+	assert.NoError(t, err)
+	assertContent(t, reopened, 3)
+
+	// The torn record is gone, new records can be read again.
+	indexer := storagetest.Indexer("i2", 40001)
+	assert.NoError(t, reopened.InsertIndexer(indexer))
+
+	again, err := Open(dir)
+	assert.NoError(t, err)
+	assertContent(t, again, 3)
+	_, err = again.Indexer("i2")
+	assert.NoError(t, err)
+}
+
+func TestCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+
+	content := "not json\n{}\n"
+	err := os.WriteFile(filepath.Join(dir, _LOGFILE_), []byte(content), 0644)
+	assert.NoError(t, err)
+
+	_, err = Open(dir)
+	assert.Error(t, err)
+}
+
+func TestClosedStore(t *testing.T) {
+	store, err := Open(t.TempDir())
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+
+	assert.Error(t, store.Close())
+	assert.Error(t, store.InsertIndexer(storagetest.Indexer("i1", 40000)))
+}
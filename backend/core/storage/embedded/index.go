@@ -0,0 +1,149 @@
+package embedded
+
+import (
+	"seekourney/core/document"
+	"seekourney/core/search"
+	"seekourney/utils"
+)
+
+// postingSource is a search.PostingSource over the inverted index of a store,
+// which only sees the documents matching a filter.
+// The store must stay read locked while it is used.
+type postingSource struct {
+	store *Store
+
+	// allowed are the documents matching the filter,
+	// nil if every document matches.
+	allowed map[utils.Path]bool
+}
+
+// postingSource creates a posting source for the documents matching filter.
+func (store *Store) postingSource(filter search.Filter) *postingSource {
+	source := &postingSource{store: store}
+
+	if len(filter.PlusWords) == 0 &&
+		len(filter.MinusWords) == 0 &&
+		len(filter.Quotes) == 0 {
+		return source
+	}
+
+	source.allowed = make(map[utils.Path]bool)
+	for _, path := range store.candidates(filter.PlusWords) {
+		if store.matches(path, filter) {
+			source.allowed[path] = true
+		}
+	}
+
+	return source
+}
+
+// candidates returns the documents containing every plus word,
+// or every document if there are none.
+func (store *Store) candidates(plusWords []string) []utils.Path {
+	paths := make([]utils.Path, 0)
+
+	if len(plusWords) == 0 {
+		for path := range store.documents {
+			paths = append(paths, path)
+		}
+		return paths
+	}
+
+	// Checking the rarest word first would be faster,
+	// but plus words are few and rarely common.
+	for path := range store.postings[utils.Word(plusWords[0])] {
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+// matches reports whether the document at path satisfies filter,
+// see matchesDocument.
+func (store *Store) matches(path utils.Path, filter search.Filter) bool {
+	return matchesDocument(store.documents[path].Document, filter)
+}
+
+// matchesDocument reports whether doc satisfies filter: it contains every
+// plus word, no minus word, and every quote in order.
+func matchesDocument(doc document.Document, filter search.Filter) bool {
+	for _, word := range filter.PlusWords {
+		if _, ok := doc.Words[utils.Word(word)]; !ok {
+			return false
+		}
+	}
+
+	for _, word := range filter.MinusWords {
+		if _, ok := doc.Words[utils.Word(word)]; ok {
+			return false
+		}
+	}
+
+	return search.MatchesQuotes(doc.RawText, filter.Quotes)
+}
+
+// isAllowed reports whether the document at path matches the filter.
+func (source *postingSource) isAllowed(path utils.Path) bool {
+	return source.allowed == nil || source.allowed[path]
+}
+
+// DocumentCount returns the number of stored documents,
+// including those not matching the filter.
+func (source *postingSource) DocumentCount() (int, error) {
+	return len(source.store.documents), nil
+}
+
+// DocumentFrequency returns the number of matching documents containing term.
+func (source *postingSource) DocumentFrequency(
+	term utils.Word,
+) (int, error) {
+	postings := source.store.postings[term]
+	if source.allowed == nil {
+		return len(postings), nil
+	}
+
+	count := 0
+	for path := range postings {
+		if source.allowed[path] {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Postings returns the postings of term in matching documents.
+// If restrict is non-nil, only postings for the given paths are returned.
+func (source *postingSource) Postings(
+	term utils.Word,
+	restrict []utils.Path,
+) ([]search.Posting, error) {
+	postings := source.store.postings[term]
+	result := make([]search.Posting, 0)
+
+	add := func(path utils.Path, freq utils.Frequency) {
+		if !source.isAllowed(path) {
+			return
+		}
+		result = append(result, search.Posting{
+			Path:      path,
+			Frequency: freq,
+			Length:    source.store.documents[path].wordCount,
+		})
+	}
+
+	if restrict == nil {
+		for path, freq := range postings {
+			add(path, freq)
+		}
+		return result, nil
+	}
+
+	for _, path := range restrict {
+		if freq, ok := postings[path]; ok {
+			add(path, freq)
+		}
+	}
+
+	return result, nil
+}
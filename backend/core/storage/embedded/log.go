@@ -0,0 +1,422 @@
+package embedded
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"seekourney/core/document"
+	"seekourney/core/indexAPI"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"sort"
+	"time"
+)
+
+const (
+	_SNAPSHOTFILE_ string = "snapshot.json"
+	_LOGFILE_      string = "log.jsonl"
+
+	// _COMPACTAFTER_ is the number of log records after which the log is
+	// folded into the snapshot.
+	_COMPACTAFTER_ int = 1000
+
+	// _FORMATVERSION_ is the version of the snapshot format.
+	_FORMATVERSION_ int = 1
+)
+
+// record is a single change in the log, exactly one field is set,
+// besides Revision. Every record stores the whole new object, replacing the
+// old one, or the ID of an object to delete, with everything referring to it.
+type record struct {
+	Indexer    *indexAPI.IndexerData `json:",omitempty"`
+	Collection *indexAPI.Collection  `json:",omitempty"`
+	Document   *document.Document    `json:",omitempty"`
+
+	// Revision is the number the document replaced by Document is kept as,
+	// 0 if it is not kept, see revisionNumber. Replaying the record once the
+	// revision is kept, such as after a crash during compact, keeps nothing.
+	Revision int `json:",omitempty"`
+
+	// KeptRevision replaces the kept revision with its path and number,
+	// or is kept as a new revision, see putRevision.
+	KeptRevision *storedRevision `json:",omitempty"`
+
+	DeletedIndexer    indexAPI.IndexerID    `json:",omitempty"`
+	DeletedCollection indexing.CollectionID `json:",omitempty"`
+	DeletedDocument   utils.Path            `json:",omitempty"`
+
+	// SeenDocuments updates when unchanged documents were last seen.
+	SeenDocuments map[utils.Path]time.Time `json:",omitempty"`
+}
+
+// snapshot is the state of the store when the log was last compacted.
+// Documents are in the order they were added,
+// and revisions ordered by path and number.
+type snapshot struct {
+	Version     int
+	Indexers    []indexAPI.IndexerData
+	Collections []indexAPI.Collection
+	Documents   []document.Document
+	Revisions   []storedRevision `json:",omitempty"`
+}
+
+// write appends records to the log as a single write, and applies them once
+// they are on disk. The mutex must be held.
+func (store *Store) write(records ...record) error {
+	if store.log == nil {
+		return errors.New("store is closed")
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buffer.Write(line)
+		buffer.WriteByte('\n')
+	}
+
+	end, err := store.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.log.Write(buffer.Bytes())
+	if err == nil {
+		err = store.log.Sync()
+	}
+	if err != nil {
+		// Cut off anything partially written, so later records stay readable.
+		return errors.Join(err, truncate(store.log, end))
+	}
+
+	for _, rec := range records {
+		store.apply(rec)
+	}
+	store.logRecords += len(records)
+
+	if store.logRecords >= _COMPACTAFTER_ {
+		return store.compact()
+	}
+
+	return nil
+}
+
+// apply applies a record to the in-memory state. The mutex must be held.
+func (store *Store) apply(rec record) {
+	switch {
+	case rec.Indexer != nil:
+		store.indexers[rec.Indexer.ID] = *rec.Indexer
+	case rec.Collection != nil:
+		store.collections[rec.Collection.ID] = *rec.Collection
+	case rec.Document != nil:
+		if rec.Revision > 0 {
+			store.keepRevision(rec.Document.Path, rec.Revision)
+		}
+		store.putDocument(*rec.Document)
+		store.pruneRevisions(rec.Document.Path, rec.Document.Collection)
+	case rec.KeptRevision != nil:
+		store.putRevision(*rec.KeptRevision)
+	case rec.DeletedIndexer != "":
+		store.deleteIndexer(rec.DeletedIndexer)
+	case rec.DeletedCollection != "":
+		store.deleteCollection(rec.DeletedCollection)
+	case rec.DeletedDocument != "":
+		store.removeDocument(rec.DeletedDocument)
+	case rec.SeenDocuments != nil:
+		store.seeDocuments(rec.SeenDocuments)
+	}
+}
+
+// seeDocuments updates when documents were last seen.
+// The mutex must be held.
+func (store *Store) seeDocuments(seen map[utils.Path]time.Time) {
+	for path, lastSeen := range seen {
+		doc, ok := store.documents[path]
+		if !ok {
+			continue
+		}
+		doc.LastSeen = lastSeen
+		store.documents[path] = doc
+	}
+}
+
+// deleteIndexer removes an indexer, its collections and their documents.
+// The mutex must be held.
+func (store *Store) deleteIndexer(id indexAPI.IndexerID) {
+	for _, collection := range store.collections {
+		if collection.IndexerID == id {
+			store.deleteCollection(collection.ID)
+		}
+	}
+
+	delete(store.indexers, id)
+}
+
+// deleteCollection removes a collection, its documents and the revisions
+// kept in it. The mutex must be held.
+func (store *Store) deleteCollection(id indexing.CollectionID) {
+	for path, doc := range store.documents {
+		if doc.Collection == id {
+			store.removeDocument(path)
+		}
+	}
+	store.deleteRevisions(id)
+
+	delete(store.collections, id)
+}
+
+// removeDocument removes a document from the documents and the inverted
+// index. Its revisions are kept, see deletedRecords.
+// The mutex must be held.
+func (store *Store) removeDocument(path utils.Path) {
+	doc, ok := store.documents[path]
+	if !ok {
+		return
+	}
+
+	for word := range doc.Words {
+		postings := store.postings[word]
+		delete(postings, path)
+		if len(postings) == 0 {
+			delete(store.postings, word)
+		}
+	}
+
+	delete(store.documents, path)
+}
+
+// putDocument adds doc to the documents and the inverted index,
+// replacing any document with the same path. The mutex must be held.
+func (store *Store) putDocument(doc document.Document) {
+	sequence := store.nextSequence
+
+	old, exists := store.documents[doc.Path]
+	if exists {
+		sequence = old.sequence
+		store.removeDocument(doc.Path)
+	} else {
+		store.nextSequence++
+	}
+
+	for word, freq := range doc.Words {
+		postings, ok := store.postings[word]
+		if !ok {
+			postings = make(map[utils.Path]utils.Frequency)
+			store.postings[word] = postings
+		}
+		postings[doc.Path] = freq
+	}
+
+	store.documents[doc.Path] = storedDocument{
+		Document:  doc,
+		sequence:  sequence,
+		wordCount: doc.GetWordCount(),
+	}
+}
+
+// load reads the snapshot, replays the log and opens it for appending.
+func (store *Store) load() error {
+	err := store.loadSnapshot()
+	if err != nil {
+		return err
+	}
+
+	logPath := filepath.Join(store.dir, _LOGFILE_)
+	file, err := os.OpenFile(logPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = store.replay(file)
+	if err != nil {
+		closeErr := file.Close()
+		return errors.Join(err, closeErr)
+	}
+
+	store.log = file
+
+	return nil
+}
+
+// loadSnapshot loads the snapshot file, if there is one.
+func (store *Store) loadSnapshot() error {
+	content, err := os.ReadFile(filepath.Join(store.dir, _SNAPSHOTFILE_))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	err = json.Unmarshal(content, &snap)
+	if err != nil {
+		return fmt.Errorf("corrupt snapshot: %w", err)
+	}
+
+	if snap.Version != _FORMATVERSION_ {
+		return fmt.Errorf("unknown snapshot version %d", snap.Version)
+	}
+
+	for _, indexer := range snap.Indexers {
+		store.indexers[indexer.ID] = indexer
+	}
+	for _, collection := range snap.Collections {
+		store.collections[collection.ID] = collection
+	}
+	for _, doc := range snap.Documents {
+		store.putDocument(doc)
+	}
+	for _, rev := range snap.Revisions {
+		path := rev.Document.Path
+		store.revisions[path] = append(store.revisions[path], rev)
+	}
+
+	return nil
+}
+
+// replay applies every record in the log, and leaves file positioned at
+// its end. A torn last record, from a crash while it was written,
+// is cut off. Any other damage is an error.
+func (store *Store) replay(file *os.File) error {
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				log.Printf("Dropping incomplete record at end of %s\n",
+					file.Name())
+				return truncate(file, offset)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec record
+		err = json.Unmarshal(line, &rec)
+		if err != nil {
+			return fmt.Errorf(
+				"corrupt record at byte %d of %s: %w",
+				offset,
+				file.Name(),
+				err,
+			)
+		}
+
+		store.apply(rec)
+		store.logRecords++
+		offset += int64(len(line))
+	}
+
+	_, err := file.Seek(0, io.SeekEnd)
+	return err
+}
+
+// truncate cuts file off at size, and positions it at the new end.
+func truncate(file *os.File, size int64) error {
+	err := file.Truncate(size)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Seek(size, io.SeekStart)
+	return err
+}
+
+// compact writes the whole state to a new snapshot and empties the log.
+// The snapshot is replaced atomically, so a crash leaves either the old
+// snapshot with the full log, or the new one with a log that only repeats
+// changes it already contains. Replaying these ends in the same state,
+// every record replaces or deletes whole objects, and revisions already
+// kept are not kept again. The mutex must be held.
+func (store *Store) compact() error {
+	snap := snapshot{
+		Version:     _FORMATVERSION_,
+		Indexers:    make([]indexAPI.IndexerData, 0, len(store.indexers)),
+		Collections: make([]indexAPI.Collection, 0, len(store.collections)),
+	}
+
+	for _, indexer := range store.indexers {
+		snap.Indexers = append(snap.Indexers, indexer)
+	}
+	for _, collection := range store.collections {
+		snap.Collections = append(snap.Collections, collection)
+	}
+	snap.Documents = store.sortedDocuments(func(doc storedDocument) bool {
+		return true
+	}, func(a storedDocument, b storedDocument) bool {
+		return a.sequence < b.sequence
+	})
+	for _, revisions := range store.revisions {
+		snap.Revisions = append(snap.Revisions, revisions...)
+	}
+
+	sort.Slice(snap.Indexers, func(i, j int) bool {
+		return snap.Indexers[i].ID < snap.Indexers[j].ID
+	})
+	sort.Slice(snap.Collections, func(i, j int) bool {
+		return snap.Collections[i].ID < snap.Collections[j].ID
+	})
+	sort.Slice(snap.Revisions, func(i, j int) bool {
+		a, b := snap.Revisions[i], snap.Revisions[j]
+		if a.Document.Path != b.Document.Path {
+			return a.Document.Path < b.Document.Path
+		}
+		return a.Number < b.Number
+	})
+
+	content, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(filepath.Join(store.dir, _SNAPSHOTFILE_), content)
+	if err != nil {
+		return err
+	}
+
+	err = truncate(store.log, 0)
+	if err != nil {
+		return err
+	}
+	store.logRecords = 0
+
+	return nil
+}
+
+// writeFileAtomic writes content to a temporary file,
+// and renames it to path once it is on disk.
+func writeFileAtomic(path string, content []byte) error {
+	temp := path + ".tmp"
+
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err = errors.Join(err, closeErr); err != nil {
+		return err
+	}
+
+	return os.Rename(temp, path)
+}
@@ -0,0 +1,412 @@
+package embedded
+
+import (
+	"errors"
+	"seekourney/core/document"
+	"seekourney/core/renormalize"
+	"seekourney/core/revision"
+	"seekourney/core/search"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// storedRevision is a previous version of a document, see revision.
+type storedRevision struct {
+	Number   int
+	Document document.Document
+
+	// Deleted is when the document was deleted, if it was kept as this
+	// revision when it was deleted.
+	Deleted time.Time `json:",omitzero"`
+}
+
+// revisionNumber returns the number the stored document with path is kept
+// as when it is replaced, 0 if there is none or its collection keeps no
+// revisions. The mutex must be held.
+func (store *Store) revisionNumber(path utils.Path) int {
+	doc, ok := store.documents[path]
+	if !ok || store.collections[doc.Collection].Revisions <= 0 {
+		return 0
+	}
+
+	return currentNumber(store.revisions[path])
+}
+
+// keepRevision keeps the stored document with path as the revision with
+// number, unless that is not its number, as when the revision is already
+// kept. The mutex must be held.
+func (store *Store) keepRevision(path utils.Path, number int) {
+	if store.revisionNumber(path) != number {
+		return
+	}
+
+	doc := store.documents[path]
+	store.revisions[path] = append(store.revisions[path], storedRevision{
+		Number:   number,
+		Document: doc.Document,
+	})
+}
+
+// deletedRecords returns the records deleting the stored document with
+// path at the given time, keeping it as a revision first if its collection
+// keeps revisions. The mutex must be held.
+func (store *Store) deletedRecords(
+	path utils.Path,
+	deleted time.Time,
+) []record {
+	number := store.revisionNumber(path)
+	if number == 0 {
+		return []record{{DeletedDocument: path}}
+	}
+
+	return []record{
+		{KeptRevision: &storedRevision{
+			Number:   number,
+			Document: store.documents[path].Document,
+			Deleted:  deleted,
+		}},
+		{DeletedDocument: path},
+	}
+}
+
+// pruneRevisions removes the oldest revisions of the document with path,
+// beyond the number the collection with id keeps. The mutex must be held.
+func (store *Store) pruneRevisions(
+	path utils.Path,
+	id indexing.CollectionID,
+) {
+	revisions := store.revisions[path]
+	keep := max(0, store.collections[id].Revisions)
+	if len(revisions) <= keep {
+		return
+	}
+
+	if keep == 0 {
+		delete(store.revisions, path)
+		return
+	}
+	store.revisions[path] = revisions[len(revisions)-keep:]
+}
+
+// deleteRevisions removes the revisions kept in the collection with id.
+// The mutex must be held.
+func (store *Store) deleteRevisions(id indexing.CollectionID) {
+	for path, revisions := range store.revisions {
+		revisions = slices.DeleteFunc(revisions, func(rev storedRevision) bool {
+			return rev.Document.Collection == id
+		})
+		if len(revisions) == 0 {
+			delete(store.revisions, path)
+			continue
+		}
+		store.revisions[path] = revisions
+	}
+}
+
+// currentNumber returns the number of the current document,
+// given its revisions.
+func currentNumber(revisions []storedRevision) int {
+	if len(revisions) == 0 {
+		return 1
+	}
+	return revisions[len(revisions)-1].Number + 1
+}
+
+// Revisions returns the revisions of the document with path,
+// see revision.Store.
+func (store *Store) Revisions(path utils.Path) ([]revision.Revision, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	doc, ok := store.documents[path]
+	if !ok {
+		return nil, errors.New("document " + string(path) + " not found")
+	}
+
+	stored := store.revisions[path]
+	revisions := make([]revision.Revision, 0, len(stored)+1)
+	for _, rev := range stored {
+		revisions = append(revisions, revision.Revision{
+			Number:  rev.Number,
+			Indexed: rev.Document.LastIndexed,
+			Hash:    rev.Document.Hash,
+		})
+	}
+
+	revisions = append(revisions, revision.Revision{
+		Number:  currentNumber(stored),
+		Indexed: doc.LastIndexed,
+		Hash:    doc.Hash,
+		Current: true,
+	})
+
+	return revisions, nil
+}
+
+// RevisionText returns the raw text of a revision of the document with path,
+// see revision.Store.
+func (store *Store) RevisionText(
+	path utils.Path,
+	number int,
+) (string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	doc, ok := store.documents[path]
+	if !ok {
+		return "", errors.New("document " + string(path) + " not found")
+	}
+
+	stored := store.revisions[path]
+	if number == currentNumber(stored) {
+		return doc.RawText, nil
+	}
+
+	for _, rev := range stored {
+		if rev.Number == number {
+			return rev.Document.RawText, nil
+		}
+	}
+
+	return "", errors.New("revision " + strconv.Itoa(number) +
+		" of document " + string(path) + " not found")
+}
+
+// DocumentRevisions returns the kept revisions of the documents with the
+// given paths, with their raw texts, see renormalize.Store.
+func (store *Store) DocumentRevisions(
+	paths []utils.Path,
+) ([]renormalize.Revision, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	sorted := slices.Clone(paths)
+	slices.Sort(sorted)
+
+	revisions := make([]renormalize.Revision, 0)
+	for _, path := range slices.Compact(sorted) {
+		for _, rev := range store.revisions[path] {
+			revisions = append(revisions, renormalize.Revision{
+				Number:   rev.Number,
+				Document: rev.Document,
+			})
+		}
+	}
+
+	return revisions, nil
+}
+
+// DeletedRevisionsAfter returns the kept revisions of collection of at most
+// limit deleted documents, with their raw texts, see renormalize.Store.
+func (store *Store) DeletedRevisionsAfter(
+	after utils.Path,
+	collection indexing.CollectionID,
+	limit int,
+) ([]renormalize.Revision, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	inCollection := func(rev storedRevision) bool {
+		return collection == "" || rev.Document.Collection == collection
+	}
+
+	paths := make([]utils.Path, 0)
+	for path, revisions := range store.revisions {
+		_, exists := store.documents[path]
+		if !exists && path > after &&
+			slices.ContainsFunc(revisions, inCollection) {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+	paths = paths[:min(len(paths), limit)]
+
+	revisions := make([]renormalize.Revision, 0)
+	for _, path := range paths {
+		for _, rev := range store.revisions[path] {
+			if inCollection(rev) {
+				revisions = append(revisions, renormalize.Revision{
+					Number:   rev.Number,
+					Document: rev.Document,
+				})
+			}
+		}
+	}
+
+	return revisions, nil
+}
+
+// revisionWords returns the record replacing the words of the kept revision
+// of rev.Document with the number of rev, if it still has the same hash.
+// The mutex must be held.
+func (store *Store) revisionWords(rev renormalize.Revision) []record {
+	for _, kept := range store.revisions[rev.Document.Path] {
+		if kept.Number != rev.Number ||
+			kept.Document.Hash != rev.Document.Hash {
+			continue
+		}
+
+		kept.Document.Words = rev.Document.Words
+		return []record{{KeptRevision: &kept}}
+	}
+
+	return nil
+}
+
+// putRevision replaces the kept revision with the same path and number as
+// rev, if it is still kept, or keeps rev if it is newer than every kept
+// revision. The mutex must be held.
+func (store *Store) putRevision(rev storedRevision) {
+	path := rev.Document.Path
+	revisions := store.revisions[path]
+	for i := range revisions {
+		if revisions[i].Number == rev.Number {
+			revisions[i] = rev
+			return
+		}
+	}
+
+	if rev.Number < currentNumber(revisions) {
+		// Pruned since, as when the log is replayed over a newer snapshot.
+		return
+	}
+	store.revisions[path] = append(revisions, rev)
+	store.pruneRevisions(path, rev.Document.Collection)
+}
+
+// versions returns the version of every document that was indexed last at
+// asOf, either the document itself or one of its revisions, which may be
+// of a document deleted since. The mutex must be held.
+func (store *Store) versions(asOf time.Time) []document.Document {
+	versions := make([]document.Document, 0)
+
+	for path, doc := range store.documents {
+		if !doc.LastIndexed.After(asOf) {
+			versions = append(versions, doc.Document)
+			continue
+		}
+
+		version, ok := revisionAsOf(store.revisions[path], asOf)
+		if ok {
+			versions = append(versions, version)
+		}
+	}
+
+	for path, revisions := range store.revisions {
+		if _, ok := store.documents[path]; ok {
+			continue
+		}
+
+		version, ok := revisionAsOf(revisions, asOf)
+		if ok {
+			versions = append(versions, version)
+		}
+	}
+
+	return versions
+}
+
+// revisionAsOf returns the newest of revisions that was indexed at asOf,
+// unless the document was deleted by then.
+func revisionAsOf(
+	revisions []storedRevision,
+	asOf time.Time,
+) (document.Document, bool) {
+	for i := len(revisions) - 1; i >= 0; i-- {
+		rev := revisions[i]
+		if rev.Document.LastIndexed.After(asOf) {
+			continue
+		}
+
+		deleted := !rev.Deleted.IsZero() && !rev.Deleted.After(asOf)
+		return rev.Document, !deleted
+	}
+
+	return document.Document{}, false
+}
+
+// versionSource is a search.PostingSource over the versions of documents
+// at a past time, which only sees the versions matching a filter.
+// It has no inverted index, every term goes through all versions.
+type versionSource struct {
+	// count is the number of versions, including those not matching.
+	count int
+
+	matching []document.Document
+
+	// byPath has the matching versions by their path.
+	byPath map[utils.Path]document.Document
+}
+
+// versionSource creates a posting source for the versions at filter.AsOf
+// matching filter. The mutex must be held.
+func (store *Store) versionSource(filter search.Filter) *versionSource {
+	versions := store.versions(filter.AsOf)
+	source := &versionSource{
+		count:  len(versions),
+		byPath: make(map[utils.Path]document.Document),
+	}
+
+	for _, doc := range versions {
+		if matchesDocument(doc, filter) {
+			source.matching = append(source.matching, doc)
+			source.byPath[doc.Path] = doc
+		}
+	}
+
+	return source
+}
+
+// DocumentCount returns the number of versions,
+// including those not matching the filter.
+func (source *versionSource) DocumentCount() (int, error) {
+	return source.count, nil
+}
+
+// DocumentFrequency returns the number of matching versions containing term.
+func (source *versionSource) DocumentFrequency(
+	term utils.Word,
+) (int, error) {
+	count := 0
+	for _, doc := range source.matching {
+		if _, ok := doc.Words[term]; ok {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Postings returns the postings of term in matching versions.
+// If restrict is non-nil, only postings for the given paths are returned.
+func (source *versionSource) Postings(
+	term utils.Word,
+	restrict []utils.Path,
+) ([]search.Posting, error) {
+	var allowed map[utils.Path]bool
+	if restrict != nil {
+		allowed = make(map[utils.Path]bool, len(restrict))
+		for _, path := range restrict {
+			allowed[path] = true
+		}
+	}
+
+	result := make([]search.Posting, 0)
+	for _, doc := range source.matching {
+		freq, ok := doc.Words[term]
+		if !ok || (allowed != nil && !allowed[doc.Path]) {
+			continue
+		}
+
+		result = append(result, search.Posting{
+			Path:      doc.Path,
+			Frequency: freq,
+			Length:    doc.GetWordCount(),
+		})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,1100 @@
+// Package postgres implements storage.Store with a PostgreSQL database.
+// The schema is created by the migrate package.
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"seekourney/core/database"
+	"seekourney/core/document"
+	"seekourney/core/indexAPI"
+	"seekourney/core/renormalize"
+	"seekourney/core/search"
+	"seekourney/core/stats"
+	"seekourney/core/storage"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"seekourney/utils/normalize"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Store is a storage.Store keeping everything in a PostgreSQL database.
+type Store struct {
+	db *sql.DB
+}
+
+var _ storage.Store = (*Store)(nil)
+
+// New creates a store using db, which must be migrated.
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Close closes the database connection.
+func (store *Store) Close() error {
+	return store.db.Close()
+}
+
+const (
+	// _COPYTHRESHOLD_ is the number of documents from which a batch is
+	// copied into a temporary table, instead of sent as statement values.
+	_COPYTHRESHOLD_ int = 500
+
+	// _MAXPARAMETERS_ is the most parameters a statement may have.
+	_MAXPARAMETERS_ int = 65535
+
+	// _IMPORTTABLE_ is the temporary table batches are copied to.
+	_IMPORTTABLE_ string = "document_import"
+
+	// _INSERTED_ is returned by an upsert for every row, together with its
+	// path, and is true if the row is new. xmax is only set on rows that
+	// existed before the statement.
+	_INSERTED_ string = "(xmax = 0)"
+
+	// _UPDATECHANGED_ makes an upsert skip rows stored with the same content,
+	// see storage.Unchanged. Skipped rows are not returned.
+	_UPDATECHANGED_ string = "EXCLUDED.content_hash = ''" +
+		" OR document.content_hash <> EXCLUDED.content_hash"
+)
+
+// collectionCondition matches every document if the collection
+// argument is empty, and only the documents of that collection otherwise.
+const collectionCondition = "($1 = '' OR collection_id = $1)"
+
+/// Documents
+
+// Documents returns every stored document, with their raw texts.
+func (store *Store) Documents() ([]document.Document, error) {
+	var doc document.Document
+	query := database.Select(doc.SQLGetFields()...).
+		From(utils.TABLEDOCUMENT).
+		Build()
+
+	docs, err := scanAll[document.Document](store.db, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return withTexts(store.db, docs)
+}
+
+// UpsertDocument stores doc, replacing any document with the same path.
+// Returns true if the document was new.
+func (store *Store) UpsertDocument(doc document.Document) (bool, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		// Does nothing if the transaction was committed.
+		_ = tx.Rollback()
+	}()
+
+	query := database.UpsertObjects(doc).
+		Returning("path", _INSERTED_).
+		Build()
+
+	err = keepRevisions(tx, []document.Document{doc})
+	if err != nil {
+		return false, err
+	}
+
+	var path utils.Path
+	var inserted bool
+	err = query.Row(tx).Scan(&path, &inserted)
+	if err != nil {
+		return false, err
+	}
+
+	err = writeTexts(tx, []document.Document{doc},
+		map[utils.Path]bool{path: inserted})
+	if err != nil {
+		return false, err
+	}
+
+	err = pruneRevisions(tx, []utils.Path{path})
+	if err != nil {
+		return false, err
+	}
+
+	return inserted, tx.Commit()
+}
+
+// UpsertDocuments stores docs in a single transaction, see storage.Store.
+// Large batches are copied into a temporary table first, which is faster
+// than sending every value as a parameter.
+func (store *Store) UpsertDocuments(
+	docs []document.Document,
+) ([]storage.Outcome, error) {
+	collections, err := store.existingCollections(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes, valid := storage.CheckBatch(
+		docs,
+		func(id indexing.CollectionID) bool {
+			return collections[id]
+		},
+	)
+	if len(valid) == 0 {
+		return outcomes, nil
+	}
+
+	batch := make([]document.Document, len(valid))
+	for i, index := range valid {
+		batch[i] = docs[index]
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// Does nothing if the transaction was committed.
+		_ = tx.Rollback()
+	}()
+
+	err = keepRevisions(tx, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	upsert := upsertValues
+	if len(batch) >= _COPYTHRESHOLD_ {
+		upsert = upsertCopy
+	}
+
+	inserted, err := upsert(tx, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeTexts(tx, batch, inserted)
+	if err != nil {
+		return nil, err
+	}
+
+	written := make([]utils.Path, 0, len(inserted))
+	for path := range inserted {
+		written = append(written, path)
+	}
+	err = pruneRevisions(tx, written)
+	if err != nil {
+		return nil, err
+	}
+
+	err = seeUnchanged(tx, batch, inserted)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range valid {
+		isNew, written := inserted[docs[index].Path]
+		outcomes[index].Inserted = isNew
+		outcomes[index].Unchanged = !written
+	}
+
+	return outcomes, nil
+}
+
+// seeUnchanged updates when the documents of batch that were not written,
+// since they are unchanged, were last seen.
+// written has the paths of the documents that were written.
+func seeUnchanged(
+	tx *sql.Tx,
+	batch []document.Document,
+	written map[utils.Path]bool,
+) error {
+	paths := make([]string, 0)
+	var lastSeen time.Time
+	for _, doc := range batch {
+		if _, ok := written[doc.Path]; ok {
+			continue
+		}
+		paths = append(paths, string(doc.Path))
+		if doc.LastSeen.After(lastSeen) {
+			lastSeen = doc.LastSeen
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil
+	}
+
+	// The documents of a batch are seen at almost the same time,
+	// so they share the latest time.
+	_, err := database.Update(utils.TABLEDOCUMENT).
+		Set("last_seen", lastSeen).
+		Where("path = ANY($1)", pq.Array(paths)).
+		Build().
+		Exec(tx)
+	return err
+}
+
+// existingCollections returns which of the collections of docs exist.
+func (store *Store) existingCollections(
+	docs []document.Document,
+) (map[indexing.CollectionID]bool, error) {
+	ids := make([]string, 0)
+	seen := make(map[indexing.CollectionID]bool)
+	for _, doc := range docs {
+		if !seen[doc.Collection] {
+			seen[doc.Collection] = true
+			ids = append(ids, string(doc.Collection))
+		}
+	}
+
+	var collection indexAPI.Collection
+	rows, err := database.Select("id").
+		From(collection.SQLGetName()).
+		Where("id = ANY($1)", pq.Array(ids)).
+		Build().
+		Rows(store.db)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[indexing.CollectionID]bool)
+	for rows.Next() {
+		var id indexing.CollectionID
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		existing[id] = true
+	}
+
+	return existing, rows.Err()
+}
+
+// upsertValues upserts docs with statements sending every value as a
+// parameter, as few statements as the parameter limit allows.
+// Returns whether each path was inserted, unchanged paths are missing.
+func upsertValues(
+	tx *sql.Tx,
+	docs []document.Document,
+) (map[utils.Path]bool, error) {
+	var template document.Document
+	rowsPerStatement := _MAXPARAMETERS_ / len(template.SQLGetFields())
+
+	inserted := make(map[utils.Path]bool, len(docs))
+	for start := 0; start < len(docs); start += rowsPerStatement {
+		chunk := docs[start:min(start+rowsPerStatement, len(docs))]
+
+		query := database.UpsertObjects(chunk...).
+			Where(_UPDATECHANGED_).
+			Returning("path", _INSERTED_).
+			Build()
+
+		err := scanInserted(tx, inserted, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return inserted, nil
+}
+
+// upsertCopy copies docs into a temporary table, and upserts them all
+// from there. Returns whether each path was inserted,
+// unchanged paths are missing.
+func upsertCopy(
+	tx *sql.Tx,
+	docs []document.Document,
+) (map[utils.Path]bool, error) {
+	var template document.Document
+	fields := template.SQLGetFields()
+
+	// Only the columns are copied, not the constraints.
+	columns := database.Select(fields...).From(template.SQLGetName()).Build()
+	_, err := tx.Exec(
+		"CREATE TEMP TABLE " + _IMPORTTABLE_ + " ON COMMIT DROP AS " +
+			columns.SQL + " WITH NO DATA",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn(_IMPORTTABLE_, fields...))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		_, err = stmt.Exec(copyValues(doc.SQLGetValues())...)
+		if err != nil {
+			return nil, errors.Join(err, stmt.Close())
+		}
+	}
+
+	// Flushes the copied rows.
+	_, err = stmt.Exec()
+	err = errors.Join(err, stmt.Close())
+	if err != nil {
+		return nil, err
+	}
+
+	inserted := make(map[utils.Path]bool, len(docs))
+	query := database.UpsertFrom(template, _IMPORTTABLE_).
+		Where(_UPDATECHANGED_).
+		Returning("path", _INSERTED_).
+		Build()
+
+	return inserted, scanInserted(tx, inserted, query)
+}
+
+// copyValues converts values for COPY, which sends []byte as bytea,
+// while every []byte value of a document is text.
+func copyValues(values []any) []any {
+	converted := make([]any, len(values))
+	for i, value := range values {
+		if bytes, ok := value.([]byte); ok {
+			value = string(bytes)
+		}
+		converted[i] = value
+	}
+
+	return converted
+}
+
+// scanInserted runs an upsert returning the path and _INSERTED_,
+// and records whether each path was inserted.
+func scanInserted(
+	tx *sql.Tx,
+	inserted map[utils.Path]bool,
+	query database.Query,
+) error {
+	rows, err := query.Rows(tx)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var path utils.Path
+		var isNew bool
+		err = rows.Scan(&path, &isNew)
+		if err != nil {
+			return err
+		}
+		inserted[path] = isNew
+	}
+
+	return rows.Err()
+}
+
+// CountDocuments returns the number of documents in collection,
+// or of all documents if collection is empty.
+func (store *Store) CountDocuments(
+	collection indexing.CollectionID,
+) (int, error) {
+	var count int
+
+	err := database.Select("COUNT(*)").
+		From(utils.TABLEDOCUMENT).
+		Where(collectionCondition, collection).
+		Build().
+		Row(store.db).
+		Scan(&count)
+
+	return count, err
+}
+
+// DocumentsAfter returns at most limit documents of collection,
+// ordered by path, starting after the given path, with their raw texts.
+func (store *Store) DocumentsAfter(
+	after utils.Path,
+	collection indexing.CollectionID,
+	limit int,
+) ([]document.Document, error) {
+	var doc document.Document
+
+	query := database.Select(doc.SQLGetFields()...).
+		From(utils.TABLEDOCUMENT).
+		Where(collectionCondition, collection).
+		Where("path > $1", after).
+		OrderBy("path").
+		Limit(limit).
+		Build()
+
+	docs, err := scanAll[document.Document](store.db, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return withTexts(store.db, docs)
+}
+
+// UpdateWords replaces the stored words of docs and revisions in a single
+// transaction, see renormalize.Store.
+func (store *Store) UpdateWords(
+	docs []document.Document,
+	revisions []renormalize.Revision,
+) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Does nothing if the transaction was committed.
+		_ = tx.Rollback()
+	}()
+
+	for _, doc := range docs {
+		err = updateDocumentWords(tx, doc)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rev := range revisions {
+		words, err := rev.Document.WordsJSON()
+		if err != nil {
+			return err
+		}
+
+		_, err = database.Update(utils.TABLEDOCUMENTREVISION).
+			Set("words", words).
+			Set("word_count", rev.Document.GetWordCount()).
+			Where("path = $1", rev.Document.Path).
+			Where("number = $1", rev.Number).
+			Where("content_hash = $1", rev.Document.Hash).
+			Build().
+			Exec(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// updateDocumentWords replaces the stored words of doc if it still has the
+// same hash, or else of its newest revision if that has it.
+func updateDocumentWords(tx *sql.Tx, doc document.Document) error {
+	words, err := doc.WordsJSON()
+	if err != nil {
+		return err
+	}
+
+	result, err := database.Update(utils.TABLEDOCUMENT).
+		Set("words", words).
+		Set("word_count", doc.GetWordCount()).
+		Where("path = $1", doc.Path).
+		Where("content_hash = $1", doc.Hash).
+		Build().
+		Exec(tx)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil || updated > 0 {
+		return err
+	}
+
+	// Replaced since it was read, it may have been kept as a revision.
+	_, err = database.Update(utils.TABLEDOCUMENTREVISION).
+		Set("words", words).
+		Set("word_count", doc.GetWordCount()).
+		Where("path = $1", doc.Path).
+		Where("content_hash = $1", doc.Hash).
+		Where("number = (SELECT MAX(number) FROM document_revision AS newest" +
+			" WHERE newest.path = document_revision.path)").
+		Build().
+		Exec(tx)
+	return err
+}
+
+// DeleteDocument removes the document with the given path. It is kept as a
+// revision if its collection keeps revisions, see deleteDocuments.
+func (store *Store) DeleteDocument(path utils.Path) (storage.Deleted, error) {
+	remove := func(tx *sql.Tx) (storage.Deleted, error) {
+		paths, err := deleteDocuments(tx, "path = $1", path)
+		return storage.Deleted{Documents: len(paths)}, err
+	}
+	found := func(deleted storage.Deleted) bool {
+		return deleted.Documents > 0
+	}
+
+	return store.deleteInTx("document "+string(path), remove, found)
+}
+
+/// Search
+
+// Score scores the matching documents in the database,
+// see database.ScoreQuery. If filter has quotes, the texts of the
+// documents that could match are loaded to check them first.
+func (store *Store) Score(
+	terms []utils.Word,
+	filter search.Filter,
+	limit int,
+) ([]search.SearchResult, error) {
+	dbFilter := database.Filter{
+		PlusWords:  filter.PlusWords,
+		MinusWords: filter.MinusWords,
+		AsOf:       filter.AsOf,
+	}
+
+	if len(filter.Quotes) > 0 {
+		candidates, err := database.MatchingPaths(store.db, terms, dbFilter)
+		if err != nil {
+			return nil, err
+		}
+
+		dbFilter.Paths, err = store.containingQuotes(
+			candidates,
+			filter.Quotes,
+			filter.AsOf,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := database.ScoreQuery(store.db, terms, dbFilter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]search.SearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = search.SearchResult{
+			Path:     row.Path,
+			Score:    row.Score,
+			Source:   row.Source,
+			Metadata: row.Metadata,
+		}
+	}
+
+	return results, nil
+}
+
+/// Stats
+
+// Stats summarizes the stored documents, see stats.Stats.
+// The index size is that of the tables, including their indexes.
+func (store *Store) Stats() (stats.Stats, error) {
+	result := stats.Stats{Sources: make(map[string]int)}
+	var lastIndexed sql.NullTime
+
+	query := database.Select(
+		"COUNT(*)",
+		"COALESCE(SUM(word_count), 0)",
+		"MAX(last_indexed)",
+		"pg_total_relation_size('document') + "+
+			"pg_total_relation_size('document_text') + "+
+			"pg_total_relation_size('document_revision') + "+
+			"pg_total_relation_size('collection') + "+
+			"pg_total_relation_size('indexer')",
+	).
+		From(utils.TABLEDOCUMENT).
+		Build()
+
+	err := query.Row(store.db).Scan(
+		&result.Documents,
+		&result.Terms,
+		&lastIndexed,
+		&result.IndexSize,
+	)
+	if err != nil {
+		return stats.Stats{}, err
+	}
+	result.LastIndexed = lastIndexed.Time
+	result.AverageLength = stats.Average(result.Terms, result.Documents)
+
+	err = database.Select("COUNT(DISTINCT key)").
+		From("document, jsonb_object_keys(words) AS key").
+		Build().
+		Row(store.db).
+		Scan(&result.DistinctTerms)
+	if err != nil {
+		return stats.Stats{}, err
+	}
+
+	rows, err := database.Select("type", "COUNT(*)").
+		From(utils.TABLEDOCUMENT).
+		GroupBy("type").
+		Build().
+		Rows(store.db)
+	if err != nil {
+		return stats.Stats{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var source string
+		var count int
+		err = rows.Scan(&source, &count)
+		if err != nil {
+			return stats.Stats{}, err
+		}
+		result.Sources[source] = count
+	}
+	if rows.Err() != nil {
+		return stats.Stats{}, rows.Err()
+	}
+
+	result.Collections, err = store.collectionStats()
+	return result, err
+}
+
+// collectionStats summarizes the documents of every collection,
+// ordered by ID.
+func (store *Store) collectionStats() ([]stats.CollectionStats, error) {
+	rows, err := database.Select(
+		"collection.id",
+		"COUNT(document.path)",
+		"MAX(document.last_indexed)",
+	).
+		From("collection").
+		LeftJoin("document", "document.collection_id = collection.id").
+		GroupBy("collection.id").
+		OrderBy("collection.id").
+		Build().
+		Rows(store.db)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := make([]stats.CollectionStats, 0)
+	for rows.Next() {
+		var collection stats.CollectionStats
+		var lastIndexed sql.NullTime
+		err = rows.Scan(
+			&collection.ID,
+			&collection.Documents,
+			&lastIndexed,
+		)
+		if err != nil {
+			return nil, err
+		}
+		collection.LastIndexed = lastIndexed.Time
+		collections = append(collections, collection)
+	}
+
+	return collections, rows.Err()
+}
+
+// Terms returns the terms in the words of the documents selected by filter,
+// see stats.TermFilter. Terms are compared by their bytes, like in Go.
+func (store *Store) Terms(filter stats.TermFilter) ([]stats.Term, error) {
+	rows, err := database.Select("key", "COUNT(*)").
+		From("document, jsonb_object_keys(words) AS key").
+		Where(collectionCondition, filter.Collection).
+		Where("starts_with(key, $1)", filter.Prefix).
+		Where("key COLLATE \"C\" > $1", filter.After).
+		GroupBy("key").
+		OrderBy("key COLLATE \"C\"").
+		Limit(filter.Limit).
+		Build().
+		Rows(store.db)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := make([]stats.Term, 0)
+	for rows.Next() {
+		var term stats.Term
+		err = rows.Scan(&term.Term, &term.Documents)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+
+	return terms, rows.Err()
+}
+
+/// Collections
+
+// Collections returns every stored collection.
+func (store *Store) Collections() ([]indexAPI.Collection, error) {
+	var collection indexAPI.Collection
+	query := database.Select().From(collection.SQLGetName()).Build()
+
+	return scanAll[indexAPI.Collection](store.db, query)
+}
+
+// Collection returns the collection with the given ID.
+func (store *Store) Collection(
+	id indexing.CollectionID,
+) (indexAPI.Collection, error) {
+	var collection indexAPI.Collection
+	query := database.Select().
+		From(collection.SQLGetName()).
+		Where("id = $1", id).
+		Build()
+
+	return scanOne[indexAPI.Collection](
+		store.db,
+		query,
+		"collection "+string(id),
+	)
+}
+
+// InsertCollection stores a new collection.
+func (store *Store) InsertCollection(collection indexAPI.Collection) error {
+	_, err := database.InsertInto(store.db, collection)
+	return err
+}
+
+// DeleteCollection removes a collection and all its documents.
+func (store *Store) DeleteCollection(
+	id indexing.CollectionID,
+) (storage.Deleted, error) {
+	remove := func(tx *sql.Tx) (storage.Deleted, error) {
+		return deleteCollections(tx, "id = $1", id)
+	}
+	found := func(deleted storage.Deleted) bool {
+		return deleted.Collections > 0
+	}
+
+	return store.deleteInTx("collection "+string(id), remove, found)
+}
+
+// SweepCollection removes the documents of a collection last seen before
+// the given time, and returns their paths ordered. They are kept as
+// revisions if the collection keeps revisions, see deleteDocuments.
+func (store *Store) SweepCollection(
+	id indexing.CollectionID,
+	before time.Time,
+) ([]utils.Path, error) {
+	_, err := store.Collection(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// Does nothing if the transaction was committed.
+		_ = tx.Rollback()
+	}()
+
+	paths, err := deleteDocuments(tx,
+		"collection_id = $1 AND last_seen < $2", id, before)
+	if err != nil {
+		return nil, err
+	}
+
+	return paths, tx.Commit()
+}
+
+// UpdateCollection replaces the stored collection with the same ID.
+func (store *Store) UpdateCollection(collection indexAPI.Collection) error {
+	fields := collection.SQLGetFields()
+	values := collection.SQLGetValues()
+
+	// The first field is the ID, the others are replaced.
+	statement := database.Update(collection.SQLGetName())
+	for i, field := range fields[1:] {
+		statement.Set(field, values[i+1])
+	}
+
+	result, err := statement.
+		Where("id = $1", values[0]).
+		Build().
+		Exec(store.db)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("collection " + string(collection.ID) + " not found")
+	}
+
+	return nil
+}
+
+// SetCollectionNormalizer sets the normalizer of collection,
+// or of every collection if it is empty.
+func (store *Store) SetCollectionNormalizer(
+	collection indexing.CollectionID,
+	normalizer normalize.Normalizer,
+) error {
+	_, err := database.Update("collection").
+		Set("normalizer", normalizer).
+		Where("$1 = '' OR id = $1", collection).
+		Build().
+		Exec(store.db)
+
+	return err
+}
+
+/// Indexers
+
+// Indexers returns every stored indexer.
+func (store *Store) Indexers() ([]indexAPI.IndexerData, error) {
+	var indexer indexAPI.IndexerData
+	query := database.Select().From(indexer.SQLGetName()).Build()
+
+	return scanAll[indexAPI.IndexerData](store.db, query)
+}
+
+// Indexer returns the indexer with the given ID.
+func (store *Store) Indexer(
+	id indexAPI.IndexerID,
+) (indexAPI.IndexerData, error) {
+	var indexer indexAPI.IndexerData
+	query := database.Select().
+		From(indexer.SQLGetName()).
+		Where("id = $1", id).
+		Build()
+
+	return scanOne[indexAPI.IndexerData](
+		store.db,
+		query,
+		"indexer "+string(id),
+	)
+}
+
+// InsertIndexer stores a new indexer.
+func (store *Store) InsertIndexer(indexer indexAPI.IndexerData) error {
+	_, err := database.InsertInto(store.db, indexer)
+	return err
+}
+
+// DeleteIndexer removes an indexer,
+// and all its collections with their documents.
+func (store *Store) DeleteIndexer(
+	id indexAPI.IndexerID,
+) (storage.Deleted, error) {
+	remove := func(tx *sql.Tx) (storage.Deleted, error) {
+		deleted, err := deleteCollections(tx, "indexer_id = $1", id)
+		if err != nil {
+			return deleted, err
+		}
+
+		var indexer indexAPI.IndexerData
+		deleted.Indexers, err = execCount(tx,
+			database.Delete(indexer.SQLGetName()).Where("id = $1", id))
+		return deleted, err
+	}
+	found := func(deleted storage.Deleted) bool {
+		return deleted.Indexers > 0
+	}
+
+	return store.deleteInTx("indexer "+string(id), remove, found)
+}
+
+// FreeIndexerPort returns the lowest port not assigned to any indexer,
+// at least utils.MININDEXERPORT. That is either utils.MININDEXERPORT or
+// right after a taken port.
+// TODO: does not check for maximum value (nominally 500 but unsure if this is
+// a hard constraint)
+func (store *Store) FreeIndexerPort() (utils.Port, error) {
+	var port utils.Port
+
+	err := database.Select("port").
+		From("(SELECT $1::int AS port UNION "+
+			"SELECT port + 1 FROM indexer WHERE port >= $1) AS candidate",
+			utils.MININDEXERPORT).
+		Where("NOT EXISTS (SELECT FROM indexer " +
+			"WHERE indexer.port = candidate.port)").
+		OrderBy("port").
+		Limit(1).
+		Build().
+		Row(store.db).
+		Scan(&port)
+
+	return port, err
+}
+
+/// Helpers
+
+// deleteInTx runs remove in a transaction, which is committed if found
+// returns true for what it deleted.
+// Otherwise nothing is deleted, and the error names what was not found.
+func (store *Store) deleteInTx(
+	name string,
+	remove func(tx *sql.Tx) (storage.Deleted, error),
+	found func(deleted storage.Deleted) bool,
+) (storage.Deleted, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return storage.Deleted{}, err
+	}
+	defer func() {
+		// Does nothing if the transaction was committed.
+		_ = tx.Rollback()
+	}()
+
+	deleted, err := remove(tx)
+	if err != nil {
+		return storage.Deleted{}, err
+	}
+	if !found(deleted) {
+		return storage.Deleted{}, errors.New(name + " not found")
+	}
+
+	return deleted, tx.Commit()
+}
+
+// deleteDocuments deletes the documents matching condition, and returns
+// their paths ordered. They are kept as revisions marked as deleted now if
+// their collections keep revisions, so searches as of a past time still find
+// them, see database.VersionsAsOf.
+func deleteDocuments(
+	tx *sql.Tx,
+	condition string,
+	args ...any,
+) ([]utils.Path, error) {
+	paths, err := lockDocuments(tx, condition, args...)
+	if err != nil || len(paths) == 0 {
+		return paths, err
+	}
+
+	err = keepDeleted(tx, paths, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	err = pruneRevisions(tx, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = string(path)
+	}
+	_, err = database.Delete(utils.TABLEDOCUMENT).
+		Where("path = ANY($1)", pq.StringArray(names)).
+		Build().
+		Exec(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// lockDocuments returns the paths of the documents matching condition
+// ordered, and locks them until the end of tx, so they are not replaced
+// while they are kept and deleted.
+func lockDocuments(
+	tx *sql.Tx,
+	condition string,
+	args ...any,
+) ([]utils.Path, error) {
+	rows, err := database.Select("path").
+		From(utils.TABLEDOCUMENT).
+		Where(condition, args...).
+		OrderBy("path").
+		ForUpdate().
+		Build().
+		Rows(tx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make([]utils.Path, 0)
+	for rows.Next() {
+		var path utils.Path
+		err = rows.Scan(&path)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+// deleteCollections deletes the collections matching condition,
+// and their documents. The documents are deleted explicitly to count them,
+// the foreign keys would delete them as well.
+func deleteCollections(
+	tx *sql.Tx,
+	condition string,
+	args ...any,
+) (storage.Deleted, error) {
+	var collection indexAPI.Collection
+	var deleted storage.Deleted
+	var err error
+
+	matching := database.Select("id").
+		From(collection.SQLGetName()).
+		Where(condition, args...).
+		Build()
+
+	deleted.Documents, err = execCount(tx,
+		database.Delete(utils.TABLEDOCUMENT).
+			Where("collection_id IN ("+matching.SQL+")", matching.Args...))
+	if err != nil {
+		return deleted, err
+	}
+
+	deleted.Collections, err = execCount(tx,
+		database.Delete(collection.SQLGetName()).Where(condition, args...))
+
+	return deleted, err
+}
+
+// execCount executes a statement and returns the number of affected rows.
+func execCount(
+	tx *sql.Tx,
+	statement *database.DeleteStatement,
+) (int, error) {
+	result, err := statement.Build().Exec(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// scanAll runs query and scans every row.
+func scanAll[T database.SQLScan[T]](
+	db *sql.DB,
+	query database.Query,
+) ([]T, error) {
+	insert := func(res *[]T, obj T) {
+		*res = append(*res, obj)
+	}
+
+	result := make([]T, 0)
+	err := database.ExecScan(db, query, &result, insert)
+
+	return result, err
+}
+
+// scanOne runs query and scans its single row,
+// returns an error naming what was looked for if there is none.
+func scanOne[T database.SQLScan[T]](
+	db *sql.DB,
+	query database.Query,
+	name string,
+) (T, error) {
+	var empty T
+
+	rows, err := scanAll[T](db, query)
+	if err != nil {
+		return empty, err
+	}
+
+	if len(rows) == 0 {
+		return empty, errors.New(name + " not found")
+	}
+
+	return rows[0], nil
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"seekourney/core/database/dbtest"
+	"seekourney/core/database/migrate"
+	"seekourney/core/storage"
+	"seekourney/core/storage/storagetest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStore runs the storage checks against a database in a container,
+// see dbtest. Every check gets its own connection, closed by the store.
+func TestStore(t *testing.T) {
+	settings := dbtest.Start(t, "go-postgres-test-store", 5434)
+	admin := dbtest.Connect(t, settings)
+
+	migrations, err := migrate.Migrations()
+	assert.NoError(t, err)
+
+	// A new database, and one created by the old initdb.sql before
+	// migrations existed, which the initial migration is.
+	schemas := []struct {
+		name    string
+		initial string
+	}{
+		{"Empty", ""},
+		{"Baseline", migrations[0].SQL},
+	}
+
+	for _, schema := range schemas {
+		t.Run(schema.name, func(t *testing.T) {
+			storagetest.Run(t, func(t *testing.T) storage.Store {
+				dbtest.Reset(t, admin)
+				if schema.initial != "" {
+					_, err := admin.Exec(schema.initial)
+					assert.NoError(t, err)
+				}
+				_, err := migrate.Up(admin)
+				assert.NoError(t, err)
+
+				return New(dbtest.Connect(t, settings))
+			})
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"seekourney/core/database"
+	"seekourney/core/document"
+	"seekourney/core/renormalize"
+	"seekourney/core/revision"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// keepRevisions copies the stored documents that docs replace with other
+// content to their revisions, if their collections keep revisions.
+// It must run before docs are written.
+func keepRevisions(tx *sql.Tx, docs []document.Document) error {
+	paths := make([]utils.Path, len(docs))
+	hashes := make([]string, len(docs))
+	for i, doc := range docs {
+		paths[i] = doc.Path
+		hashes[i] = doc.Hash
+	}
+
+	return keepDocuments(tx, paths, hashes, sql.NullTime{})
+}
+
+// keepDeleted copies the stored documents with the given paths, which are
+// about to be deleted at the given time, to their revisions, if their
+// collections keep revisions. See database.VersionsAsOf.
+func keepDeleted(tx *sql.Tx, paths []utils.Path, deleted time.Time) error {
+	// An empty hash keeps every document, see storage.Unchanged.
+	hashes := make([]string, len(paths))
+
+	return keepDocuments(tx, paths, hashes,
+		sql.NullTime{Time: deleted, Valid: true})
+}
+
+// keepDocuments copies the stored documents with the given paths to their
+// revisions, if their collections keep revisions, unless they have the hash
+// at the same index of hashes. They are marked as deleted at deleted,
+// if it is valid.
+func keepDocuments(
+	tx *sql.Tx,
+	paths []utils.Path,
+	hashes []string,
+	deleted sql.NullTime,
+) error {
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = string(path)
+	}
+
+	kept := database.Select(
+		"document.path",
+		"COALESCE((SELECT MAX(number) FROM document_revision AS newest "+
+			"WHERE newest.path = document.path), 0) + 1",
+		"document.collection_id",
+		"document.type",
+		"words",
+		"word_count",
+		"content",
+		"content_hash",
+		"last_indexed",
+		"title",
+		"size",
+		"modified",
+		"mime_type",
+		"language",
+		"deletion.deleted",
+	).
+		From(utils.TABLEDOCUMENT).
+		Join("unnest($1::text[], $2::text[]) AS incoming (path, hash)",
+			"incoming.path = document.path",
+			pq.StringArray(names), pq.StringArray(hashes)).
+		Join("(SELECT $1::timestamptz AS deleted) AS deletion", "true",
+			deleted).
+		Join(utils.TABLEDOCUMENTTEXT,
+			"document_text.path = document.path").
+		Join("collection", "collection.id = document.collection_id").
+		Where("collection.revisions > 0").
+		// See storage.Unchanged.
+		Where("incoming.hash = '' OR incoming.hash <> content_hash").
+		Build()
+
+	_, err := database.Insert(
+		utils.TABLEDOCUMENTREVISION,
+		"path",
+		"number",
+		"collection_id",
+		"type",
+		"words",
+		"word_count",
+		"content",
+		"content_hash",
+		"last_indexed",
+		"title",
+		"size",
+		"modified",
+		"mime_type",
+		"language",
+		"deleted",
+	).
+		Select(kept).
+		Build().
+		Exec(tx)
+	return err
+}
+
+// pruneRevisions removes the oldest revisions of the documents with the
+// given paths, beyond the number their collections keep.
+func pruneRevisions(tx *sql.Tx, paths []utils.Path) error {
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = string(path)
+	}
+
+	_, err := database.Delete(utils.TABLEDOCUMENTREVISION).
+		Where("path = ANY($1)", pq.StringArray(names)).
+		Where("number <= (SELECT MAX(number) FROM document_revision AS newest" +
+			" WHERE newest.path = document_revision.path) - " +
+			"(SELECT GREATEST(revisions, 0) FROM document" +
+			" JOIN collection ON collection.id = document.collection_id" +
+			" WHERE document.path = document_revision.path)").
+		Build().
+		Exec(tx)
+	return err
+}
+
+// Revisions returns the revisions of the document with path,
+// see revision.Store.
+func (store *Store) Revisions(path utils.Path) ([]revision.Revision, error) {
+	var current revision.Revision
+	err := database.Select("last_indexed", "content_hash").
+		From(utils.TABLEDOCUMENT).
+		Where("path = $1", path).
+		Build().
+		Row(store.db).
+		Scan(&current.Indexed, &current.Hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("document " + string(path) + " not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.Select("number", "last_indexed", "content_hash").
+		From(utils.TABLEDOCUMENTREVISION).
+		Where("path = $1", path).
+		OrderBy("number").
+		Build().
+		Rows(store.db)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]revision.Revision, 0)
+	for rows.Next() {
+		var rev revision.Revision
+		err = rows.Scan(&rev.Number, &rev.Indexed, &rev.Hash)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	current.Number = 1
+	if len(revisions) > 0 {
+		current.Number = revisions[len(revisions)-1].Number + 1
+	}
+	current.Current = true
+
+	return append(revisions, current), nil
+}
+
+// RevisionText returns the raw text of a revision of the document with path,
+// see revision.Store.
+func (store *Store) RevisionText(
+	path utils.Path,
+	number int,
+) (string, error) {
+	revisions, err := store.Revisions(path)
+	if err != nil {
+		return "", err
+	}
+
+	if number == revisions[len(revisions)-1].Number {
+		return store.DocumentText(path)
+	}
+
+	var content []byte
+	err = database.Select("content").
+		From(utils.TABLEDOCUMENTREVISION).
+		Where("path = $1", path).
+		Where("number = $1", number).
+		Build().
+		Row(store.db).
+		Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errors.New("revision " + strconv.Itoa(number) +
+			" of document " + string(path) + " not found")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return decodeText(content)
+}
+
+// DocumentRevisions returns the kept revisions of the documents with the
+// given paths, with their raw texts, see renormalize.Store.
+func (store *Store) DocumentRevisions(
+	paths []utils.Path,
+) ([]renormalize.Revision, error) {
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = string(path)
+	}
+
+	query := database.Select(revisionColumns...).
+		From(utils.TABLEDOCUMENTREVISION).
+		Where("path = ANY($1)", pq.StringArray(names)).
+		OrderBy("path", "number").
+		Build()
+
+	return scanRevisions(store.db, query)
+}
+
+// DeletedRevisionsAfter returns the kept revisions of collection of at most
+// limit deleted documents, with their raw texts, see renormalize.Store.
+func (store *Store) DeletedRevisionsAfter(
+	after utils.Path,
+	collection indexing.CollectionID,
+	limit int,
+) ([]renormalize.Revision, error) {
+	deleted := database.Select("DISTINCT path").
+		From(utils.TABLEDOCUMENTREVISION).
+		Where(collectionCondition, collection).
+		Where("path > $1", after).
+		Where("NOT EXISTS (SELECT FROM document " +
+			"WHERE document.path = document_revision.path)").
+		OrderBy("path").
+		Limit(limit).
+		Build()
+
+	query := database.Select(revisionColumns...).
+		With("deleted", deleted).
+		From(utils.TABLEDOCUMENTREVISION).
+		JoinUsing("deleted", "path").
+		Where(collectionCondition, collection).
+		OrderBy("path", "number").
+		Build()
+
+	return scanRevisions(store.db, query)
+}
+
+// revisionColumns are the columns scanned by scanRevisions.
+var revisionColumns = []string{
+	"path",
+	"number",
+	"content",
+	"content_hash",
+	"last_indexed",
+}
+
+// scanRevisions runs query, which selects revisionColumns,
+// and scans every revision with its raw text.
+func scanRevisions(
+	conn database.Conn,
+	query database.Query,
+) ([]renormalize.Revision, error) {
+	rows, err := query.Rows(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]renormalize.Revision, 0)
+	for rows.Next() {
+		var rev renormalize.Revision
+		var content []byte
+		err = rows.Scan(
+			&rev.Document.Path,
+			&rev.Number,
+			&content,
+			&rev.Document.Hash,
+			&rev.Document.LastIndexed,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		rev.Document.RawText, err = decodeText(content)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// loadVersionTexts returns the raw texts of the versions at asOf of the
+// documents with the given paths, see database.VersionsAsOf.
+// Paths without such a version are missing.
+func loadVersionTexts(
+	conn database.Conn,
+	paths []utils.Path,
+	asOf time.Time,
+) (map[utils.Path]string, error) {
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = string(path)
+	}
+
+	versions := database.VersionsAsOf(
+		utils.TABLEDOCUMENT+" JOIN "+utils.TABLEDOCUMENTTEXT+" USING (path)",
+		asOf,
+		"content",
+	)
+
+	query := database.Select("path", "content").
+		With("versions", versions).
+		From("versions").
+		Where("path = ANY($1)", pq.StringArray(names)).
+		Build()
+
+	return scanTexts(conn, query)
+}
@@ -0,0 +1,225 @@
+package postgres
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"io"
+	"seekourney/core/database"
+	"seekourney/core/document"
+	"seekourney/core/search"
+	"seekourney/utils"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// _TEXTBATCHSIZE_ is the number of texts loaded at once,
+// when checking the quotes of a search.
+const _TEXTBATCHSIZE_ int = 500
+
+// _GZIPHEADER_ starts every gzip stream. Valid UTF-8 text never starts
+// with it, as 0x8b can only continue a character.
+var _GZIPHEADER_ = []byte{0x1f, 0x8b}
+
+// encodeText compresses text for the document_text table.
+func encodeText(text string) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+
+	_, err := writer.Write([]byte(text))
+	err = errors.Join(err, writer.Close())
+
+	return buffer.Bytes(), err
+}
+
+// decodeText returns the text stored as content by encodeText.
+// Content without a gzip header is text moved from the document table by
+// a migration, which is stored as is.
+func decodeText(content []byte) (string, error) {
+	if !bytes.HasPrefix(content, _GZIPHEADER_) {
+		return string(content), nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	text, err := io.ReadAll(reader)
+	err = errors.Join(err, reader.Close())
+
+	return string(text), err
+}
+
+// writeTexts stores the raw texts of the documents of docs with a path in
+// written, replacing their previous texts.
+func writeTexts(
+	tx *sql.Tx,
+	docs []document.Document,
+	written map[utils.Path]bool,
+) error {
+	// Every row has a path and a content.
+	rowsPerStatement := _MAXPARAMETERS_ / 2
+
+	pending := make([]document.Document, 0, len(written))
+	for _, doc := range docs {
+		if _, ok := written[doc.Path]; ok {
+			pending = append(pending, doc)
+		}
+	}
+
+	for start := 0; start < len(pending); start += rowsPerStatement {
+		chunk := pending[start:min(start+rowsPerStatement, len(pending))]
+
+		statement := database.Insert(
+			utils.TABLEDOCUMENTTEXT,
+			"path",
+			"content",
+		)
+		for _, doc := range chunk {
+			content, err := encodeText(doc.RawText)
+			if err != nil {
+				return err
+			}
+			statement.Values(doc.Path, content)
+		}
+
+		_, err := statement.
+			OnConflict("path").
+			DoUpdate("content").
+			Build().
+			Exec(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadTexts returns the raw texts of the documents with the given paths.
+// Paths without a stored text are missing.
+func loadTexts(
+	conn database.Conn,
+	paths []utils.Path,
+) (map[utils.Path]string, error) {
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = string(path)
+	}
+
+	query := database.Select("path", "content").
+		From(utils.TABLEDOCUMENTTEXT).
+		Where("path = ANY($1)", pq.StringArray(names)).
+		Build()
+
+	return scanTexts(conn, query)
+}
+
+// scanTexts runs query, which selects paths with their stored content,
+// and returns their raw texts.
+func scanTexts(
+	conn database.Conn,
+	query database.Query,
+) (map[utils.Path]string, error) {
+	rows, err := query.Rows(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	texts := make(map[utils.Path]string)
+	for rows.Next() {
+		var path utils.Path
+		var content []byte
+		err = rows.Scan(&path, &content)
+		if err != nil {
+			return nil, err
+		}
+
+		texts[path], err = decodeText(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return texts, rows.Err()
+}
+
+// withTexts sets the raw text of every document of docs.
+func withTexts(
+	conn database.Conn,
+	docs []document.Document,
+) ([]document.Document, error) {
+	paths := make([]utils.Path, len(docs))
+	for i, doc := range docs {
+		paths[i] = doc.Path
+	}
+
+	texts, err := loadTexts(conn, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range docs {
+		docs[i].RawText = texts[docs[i].Path]
+	}
+
+	return docs, nil
+}
+
+// DocumentText returns the raw text of the document with the given path.
+func (store *Store) DocumentText(path utils.Path) (string, error) {
+	texts, err := loadTexts(store.db, []utils.Path{path})
+	if err != nil {
+		return "", err
+	}
+
+	text, ok := texts[path]
+	if !ok {
+		return "", errors.New("document " + string(path) + " not found")
+	}
+
+	return text, nil
+}
+
+// containingQuotes returns the paths of the documents of candidates whose
+// raw text contains every quote in order, see search.MatchesQuotes.
+// If asOf is not zero, the texts of the versions at that time are checked.
+// Texts are loaded in batches of _TEXTBATCHSIZE_.
+func (store *Store) containingQuotes(
+	candidates []utils.Path,
+	quotes []string,
+	asOf time.Time,
+) ([]utils.Path, error) {
+	load := loadTexts
+	if !asOf.IsZero() {
+		load = func(
+			conn database.Conn,
+			paths []utils.Path,
+		) (map[utils.Path]string, error) {
+			return loadVersionTexts(conn, paths, asOf)
+		}
+	}
+
+	paths := make([]utils.Path, 0)
+
+	for start := 0; start < len(candidates); start += _TEXTBATCHSIZE_ {
+		batch := candidates[start:min(start+_TEXTBATCHSIZE_, len(candidates))]
+
+		texts, err := load(store.db, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range batch {
+			if search.MatchesQuotes(texts[path], quotes) {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeText(t *testing.T) {
+	for _, text := range []string{"", "some text", "bébé € 😀"} {
+		content, err := encodeText(text)
+		assert.NoError(t, err)
+
+		decoded, err := decodeText(content)
+		assert.NoError(t, err)
+		assert.Equal(t, text, decoded)
+	}
+
+	// Text moved by the migration is not compressed.
+	decoded, err := decodeText([]byte("moved text"))
+	assert.NoError(t, err)
+	assert.Equal(t, "moved text", decoded)
+}
@@ -0,0 +1,158 @@
+/*
+Package storage defines where core keeps its documents, collections and
+indexers. Every package defines the part of the storage it needs, Store
+combines them into what a backend has to implement.
+
+Two backends exist:
+
+postgres - stores everything in a PostgreSQL database, and scores searches
+in the database. Started with docker by the server.
+
+embedded - stores everything in a directory, in pure Go. Needs no other
+programs, which makes it suited for tests and small collections.
+*/
+package storage
+
+import (
+	"errors"
+	"seekourney/core/document"
+	"seekourney/core/indexAPI"
+	"seekourney/core/renormalize"
+	"seekourney/core/revision"
+	"seekourney/core/search"
+	"seekourney/core/stats"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"time"
+)
+
+// Backend names, as set in config.Config.
+const (
+	POSTGRES string = "postgres"
+	EMBEDDED string = "embedded"
+)
+
+// Store is a storage backend, it must be safe for concurrent use.
+type Store interface {
+	indexAPI.IndexerStore
+	indexAPI.CollectionStore
+	renormalize.Store
+	revision.Store
+	search.Scorer
+	stats.Store
+
+	// Documents returns every stored document.
+	Documents() ([]document.Document, error)
+
+	// DocumentText returns the raw text of the document with the given
+	// path. It is only loaded when needed, such as for previews.
+	DocumentText(path utils.Path) (string, error)
+
+	// UpsertDocument stores doc, replacing any document with the same path.
+	// Returns true if the document was new.
+	// The collection of doc must be stored.
+	UpsertDocument(doc document.Document) (bool, error)
+
+	// UpsertDocuments stores docs as one batch, like UpsertDocument.
+	// Documents that can not be stored are skipped, see CheckBatch,
+	// the rest are stored all or none. Documents that are stored with the
+	// same content already are not written again, see Unchanged,
+	// only when they were last seen is updated.
+	// Returns the outcome of every document, in the same order,
+	// or an error if none were stored.
+	UpsertDocuments(docs []document.Document) ([]Outcome, error)
+
+	// DeleteDocument removes the document with the given path.
+	// It is kept as a revision if its collection keeps revisions.
+	DeleteDocument(path utils.Path) (Deleted, error)
+
+	// DeleteCollection removes a collection and all its documents,
+	// with the revisions kept in it.
+	DeleteCollection(id indexing.CollectionID) (Deleted, error)
+
+	// SweepCollection removes the documents of a collection that were last
+	// seen before the given time, see document.Document.LastSeen, keeping
+	// them as revisions like DeleteDocument.
+	// Returns the paths of the removed documents, ordered.
+	SweepCollection(
+		id indexing.CollectionID,
+		before time.Time,
+	) ([]utils.Path, error)
+
+	// DeleteIndexer removes an indexer, which frees its port,
+	// and all its collections with their documents.
+	DeleteIndexer(id indexAPI.IndexerID) (Deleted, error)
+
+	// Indexers returns every stored indexer.
+	Indexers() ([]indexAPI.IndexerData, error)
+
+	// Collections returns every stored collection.
+	Collections() ([]indexAPI.Collection, error)
+
+	// Close releases the resources of the store, it must not be used after.
+	Close() error
+}
+
+// Deleted counts what was removed by a delete, including everything
+// that referred to the deleted object. The Delete methods of Store
+// return an error instead if nothing was found to delete.
+type Deleted struct {
+	Indexers    int
+	Collections int
+	Documents   int
+}
+
+// ErrReplacedInBatch is the outcome of a document followed by another
+// document with the same path in the same batch, which is stored instead.
+var ErrReplacedInBatch = errors.New("replaced by a later document in batch")
+
+// Outcome is what happened to a document given to UpsertDocuments.
+type Outcome struct {
+	// Inserted is true if the document was new,
+	// and false if it replaced a stored one.
+	Inserted bool
+
+	// Unchanged is true if the document was already stored with the same
+	// content, so it was not written, see Unchanged.
+	Unchanged bool
+
+	// Err is why the document was not stored, nil if it was.
+	Err error
+}
+
+// Unchanged reports whether doc has the same content as the stored
+// document with its path, by their hashes, see document.ContentHash.
+// A document without a hash is always written.
+func Unchanged(stored document.Document, doc document.Document) bool {
+	return doc.Hash != "" && stored.Hash == doc.Hash
+}
+
+// CheckBatch finds the documents of a batch that can not be stored, because
+// their collection does not exist, or they are replaced in the batch.
+// Returns the outcomes with these failed, and the indices of the rest.
+func CheckBatch(
+	docs []document.Document,
+	hasCollection func(indexing.CollectionID) bool,
+) ([]Outcome, []int) {
+	outcomes := make([]Outcome, len(docs))
+	last := make(map[utils.Path]int, len(docs))
+
+	for i, doc := range docs {
+		last[doc.Path] = i
+	}
+
+	valid := make([]int, 0, len(docs))
+	for i, doc := range docs {
+		switch {
+		case last[doc.Path] != i:
+			outcomes[i].Err = ErrReplacedInBatch
+		case !hasCollection(doc.Collection):
+			outcomes[i].Err = errors.New(
+				"collection " + string(doc.Collection) + " not found")
+		default:
+			valid = append(valid, i)
+		}
+	}
+
+	return outcomes, valid
+}
@@ -0,0 +1,1102 @@
+/*
+Package storagetest checks that a storage.Store behaves like every other
+backend. Backends call Run from their own tests:
+
+	func TestStore(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.Store {
+			return openEmptyStore(t)
+		})
+	}
+*/
+package storagetest
+
+import (
+	"fmt"
+	"seekourney/core/document"
+	"seekourney/core/indexAPI"
+	"seekourney/core/renormalize"
+	"seekourney/core/search"
+	"seekourney/core/stats"
+	"seekourney/core/storage"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"seekourney/utils/normalize"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Open opens an empty store, which is closed by the caller.
+type Open func(t *testing.T) storage.Store
+
+// Run runs every check against stores created by open.
+func Run(t *testing.T, open Open) {
+	checks := []struct {
+		name  string
+		check func(*testing.T, storage.Store)
+	}{
+		{"Indexers", checkIndexers},
+		{"Collections", checkCollections},
+		{"Documents", checkDocuments},
+		{"DocumentText", checkDocumentText},
+		{"UpsertDocuments", checkUpsertDocuments},
+		{"UpsertDocumentsLarge", checkUpsertDocumentsLarge},
+		{"UpsertDocumentsUnchanged", checkUpsertDocumentsUnchanged},
+		{"SweepCollection", checkSweepCollection},
+		{"DocumentsAfter", checkDocumentsAfter},
+		{"DeleteDocument", checkDeleteDocument},
+		{"DeleteCollection", checkDeleteCollection},
+		{"DeleteIndexer", checkDeleteIndexer},
+		{"UpdateCollection", checkUpdateCollection},
+		{"UpdateWords", checkUpdateWords},
+		{"UpdateWordsReplaced", checkUpdateWordsReplaced},
+		{"SetCollectionNormalizer", checkSetCollectionNormalizer},
+		{"Score", checkScore},
+		{"ScoreFilter", checkScoreFilter},
+		{"Metadata", checkMetadata},
+		{"Stats", checkStats},
+		{"Terms", checkTerms},
+		{"Revisions", checkRevisions},
+		{"ScoreAsOf", checkScoreAsOf},
+		{"ScoreAsOfMetadata", checkScoreAsOfMetadata},
+		{"ScoreAsOfDeleted", checkScoreAsOfDeleted},
+	}
+
+	for _, check := range checks {
+		t.Run(check.name, func(t *testing.T) {
+			store := open(t)
+			defer func() {
+				assert.NoError(t, store.Close())
+			}()
+			check.check(t, store)
+		})
+	}
+}
+
+// Indexer returns an indexer for tests.
+func Indexer(id utils.IndexerID, port utils.Port) indexAPI.IndexerData {
+	return indexAPI.IndexerData{
+		ID:       id,
+		Name:     "Indexer " + string(id),
+		ExecPath: "/bin/indexer",
+		Args:     []string{"--verbose"},
+		Port:     port,
+	}
+}
+
+// Collection returns a collection for tests.
+func Collection(
+	id indexing.CollectionID,
+	indexer utils.IndexerID,
+) indexAPI.Collection {
+	return indexAPI.Collection{
+		UnregisteredCollection: indexAPI.UnregisteredCollection{
+			Path:                "/home/" + utils.Path(id),
+			IndexerID:           indexer,
+			SourceType:          utils.DIR_SOURCE,
+			Recursive:           true,
+			RespectLastModified: false,
+			Normalfunc:          normalize.TO_LOWER,
+		},
+		ID: id,
+	}
+}
+
+// Document returns a document of collection, with the words of text.
+func Document(
+	path utils.Path,
+	collection indexing.CollectionID,
+	text string,
+) document.Document {
+	words := make(utils.FrequencyMap)
+	for _, word := range strings.Fields(text) {
+		words[utils.Word(word)]++
+	}
+
+	return document.NewDocument(
+		path,
+		utils.SOURCE_LOCAL,
+		words,
+		collection,
+		text,
+		time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC),
+	)
+}
+
+// version returns a document of collection with the words of text,
+// indexed on the given day of March 2025. Its hash is its text.
+func version(
+	path utils.Path,
+	collection indexing.CollectionID,
+	text string,
+	day int,
+) document.Document {
+	doc := Document(path, collection, text)
+	doc.LastIndexed = time.Date(2025, time.March, day, 12, 0, 0, 0, time.UTC)
+	doc.Hash = text
+	return doc
+}
+
+// keepRevisions makes the collection with id keep revisions.
+func keepRevisions(
+	t *testing.T,
+	store storage.Store,
+	id indexing.CollectionID,
+	revisions int,
+) {
+	collection, err := store.Collection(id)
+	assert.NoError(t, err)
+	collection.Revisions = revisions
+	assert.NoError(t, store.UpdateCollection(collection))
+}
+
+// setup stores an indexer, collections "c1" and "c2", and documents.
+func setup(t *testing.T, store storage.Store, docs ...document.Document) {
+	assert.NoError(t, store.InsertIndexer(Indexer("i1", 40000)))
+	assert.NoError(t, store.InsertCollection(Collection("c1", "i1")))
+	assert.NoError(t, store.InsertCollection(Collection("c2", "i1")))
+
+	for _, doc := range docs {
+		inserted, err := store.UpsertDocument(doc)
+		assert.NoError(t, err)
+		assert.True(t, inserted)
+	}
+}
+
+// corpus are documents where scores are easy to reason about.
+func corpus() []document.Document {
+	return []document.Document{
+		Document("/a", "c1", "apple apple apple banana"),
+		Document("/b", "c1", "cherry apple cherry"),
+		Document("/c", "c1", "banana date banana"),
+		Document("/d", "c2", "date date date date"),
+		Document("/e", "c2", "fig"),
+	}
+}
+
+// assertSameDocument checks that two documents have the same content.
+func assertSameDocument(
+	t *testing.T,
+	expected document.Document,
+	actual document.Document,
+) {
+	assert.Equal(t, expected.Path, actual.Path)
+	assert.Equal(t, expected.Words, actual.Words)
+	assert.Equal(t, expected.Collection, actual.Collection)
+	assert.Equal(t, expected.RawText, actual.RawText)
+	assert.True(t, expected.LastIndexed.Equal(actual.LastIndexed))
+	assertSameMetadata(t, expected.Source, expected.Metadata,
+		actual.Source, actual.Metadata)
+}
+
+// assertSameMetadata checks that two documents have the same source and
+// metadata. Times are compared as instants, backends may change the zone.
+func assertSameMetadata(
+	t *testing.T,
+	expectedSource utils.Source,
+	expected utils.Metadata,
+	actualSource utils.Source,
+	actual utils.Metadata,
+) {
+	assert.Equal(t, expectedSource, actualSource)
+	assert.True(t, expected.Modified.Equal(actual.Modified))
+
+	expected.Modified = time.Time{}
+	actual.Modified = time.Time{}
+	assert.Equal(t, expected, actual)
+}
+
+// paths returns the paths of docs or results, in order.
+func paths[T document.Document | search.SearchResult](items []T) []utils.Path {
+	result := make([]utils.Path, len(items))
+	for i, item := range items {
+		switch item := any(item).(type) {
+		case document.Document:
+			result[i] = item.Path
+		case search.SearchResult:
+			result[i] = item.Path
+		}
+	}
+	return result
+}
+
+func checkIndexers(t *testing.T, store storage.Store) {
+	port, err := store.FreeIndexerPort()
+	assert.NoError(t, err)
+	assert.Equal(t, utils.MININDEXERPORT, port)
+
+	indexer := Indexer("i1", port)
+	assert.NoError(t, store.InsertIndexer(indexer))
+
+	stored, err := store.Indexer("i1")
+	assert.NoError(t, err)
+	assert.Equal(t, indexer, stored)
+
+	_, err = store.Indexer("missing")
+	assert.Error(t, err)
+
+	// IDs and ports are unique.
+	assert.Error(t, store.InsertIndexer(Indexer("i1", port+1)))
+	assert.Error(t, store.InsertIndexer(Indexer("i2", port)))
+
+	port, err = store.FreeIndexerPort()
+	assert.NoError(t, err)
+	assert.Equal(t, utils.MININDEXERPORT+1, port)
+
+	assert.NoError(t, store.InsertIndexer(Indexer("i2", port)))
+	indexers, err := store.Indexers()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(indexers))
+
+	// The port of a deleted indexer is free again, also the lowest one.
+	_, err = store.DeleteIndexer("i1")
+	assert.NoError(t, err)
+	port, err = store.FreeIndexerPort()
+	assert.NoError(t, err)
+	assert.Equal(t, utils.MININDEXERPORT, port)
+}
+
+func checkCollections(t *testing.T, store storage.Store) {
+	// The indexer of a collection must exist.
+	assert.Error(t, store.InsertCollection(Collection("c1", "i1")))
+
+	setup(t, store)
+
+	collection, err := store.Collection("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, Collection("c1", "i1"), collection)
+
+	_, err = store.Collection("missing")
+	assert.Error(t, err)
+
+	assert.Error(t, store.InsertCollection(Collection("c1", "i1")))
+
+	collections, err := store.Collections()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(collections))
+}
+
+func checkDocuments(t *testing.T, store storage.Store) {
+	doc := Document("/a", "c1", "some words")
+
+	// The collection of a document must exist.
+	_, err := store.UpsertDocument(doc)
+	assert.Error(t, err)
+
+	setup(t, store, doc)
+
+	docs, err := store.Documents()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(docs))
+	assertSameDocument(t, doc, docs[0])
+
+	changed := Document("/a", "c2", "other words entirely")
+	inserted, err := store.UpsertDocument(changed)
+	assert.NoError(t, err)
+	assert.False(t, inserted)
+
+	docs, err = store.Documents()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(docs))
+	assertSameDocument(t, changed, docs[0])
+
+	count, err := store.CountDocuments("")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func checkDocumentText(t *testing.T, store storage.Store) {
+	long := strings.Repeat("a long text with some words. ", 1000)
+	setup(t, store,
+		Document("/a", "c1", long),
+		Document("/b", "c1", "bébé € 😀"),
+	)
+
+	text, err := store.DocumentText("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, long, text)
+
+	text, err = store.DocumentText("/b")
+	assert.NoError(t, err)
+	assert.Equal(t, "bébé € 😀", text)
+
+	_, err = store.DocumentText("/missing")
+	assert.Error(t, err)
+
+	// Replacing a document replaces its text, in batches as well.
+	_, err = store.UpsertDocument(Document("/a", "c1", "short"))
+	assert.NoError(t, err)
+	_, err = store.UpsertDocuments(
+		[]document.Document{Document("/b", "c1", "other")})
+	assert.NoError(t, err)
+
+	docs, err := store.DocumentsAfter("", "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "short", docs[0].RawText)
+	assert.Equal(t, "other", docs[1].RawText)
+
+	// A deleted document has no text.
+	_, err = store.DeleteDocument("/a")
+	assert.NoError(t, err)
+	_, err = store.DocumentText("/a")
+	assert.Error(t, err)
+}
+
+func checkUpsertDocuments(t *testing.T, store storage.Store) {
+	setup(t, store, Document("/a", "c1", "apple"))
+
+	outcomes, err := store.UpsertDocuments([]document.Document{
+		Document("/a", "c2", "pear"),
+		Document("/b", "c1", "first"),
+		Document("/c", "missing", "lost"),
+		Document("/b", "c1", "second"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(outcomes))
+
+	assert.NoError(t, outcomes[0].Err)
+	assert.False(t, outcomes[0].Inserted)
+	assert.ErrorIs(t, outcomes[1].Err, storage.ErrReplacedInBatch)
+	assert.Error(t, outcomes[2].Err)
+	assert.NoError(t, outcomes[3].Err)
+	assert.True(t, outcomes[3].Inserted)
+
+	docs, err := store.DocumentsAfter("", "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/a", "/b"}, paths(docs))
+	assertSameDocument(t, Document("/a", "c2", "pear"), docs[0])
+	assertSameDocument(t, Document("/b", "c1", "second"), docs[1])
+
+	// Stored documents are searchable.
+	results, err := store.Score([]utils.Word{"second"}, search.Filter{}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/b"}, paths(results))
+
+	outcomes, err = store.UpsertDocuments(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, outcomes)
+}
+
+// checkUpsertDocumentsLarge stores a batch large enough for backends to
+// store it differently than small ones.
+func checkUpsertDocumentsLarge(t *testing.T, store storage.Store) {
+	setup(t, store, Document("/doc/0000", "c1", "old"))
+
+	docs := make([]document.Document, 1200)
+	for i := range docs {
+		path := utils.Path(fmt.Sprintf("/doc/%04d", i))
+		docs[i] = Document(path, "c2", fmt.Sprintf("word%d shared", i))
+	}
+
+	outcomes, err := store.UpsertDocuments(docs)
+	assert.NoError(t, err)
+	for i, outcome := range outcomes {
+		assert.NoError(t, outcome.Err)
+		assert.Equal(t, i != 0, outcome.Inserted)
+	}
+
+	count, err := store.CountDocuments("c2")
+	assert.NoError(t, err)
+	assert.Equal(t, len(docs), count)
+
+	stored, err := store.DocumentsAfter("", "", 1)
+	assert.NoError(t, err)
+	assertSameDocument(t, docs[0], stored[0])
+
+	// Large batches also skip unchanged documents.
+	for i := range docs {
+		docs[i].Hash = string(docs[i].Path)
+	}
+	_, err = store.UpsertDocuments(docs)
+	assert.NoError(t, err)
+
+	outcomes, err = store.UpsertDocuments(docs)
+	assert.NoError(t, err)
+	for _, outcome := range outcomes {
+		assert.True(t, outcome.Unchanged)
+	}
+}
+
+func checkUpsertDocumentsUnchanged(t *testing.T, store storage.Store) {
+	setup(t, store)
+
+	hashed := Document("/a", "c1", "apple")
+	hashed.Hash = "hash of a"
+	unhashed := Document("/b", "c1", "banana")
+
+	outcomes, err := store.UpsertDocuments(
+		[]document.Document{hashed, unhashed})
+	assert.NoError(t, err)
+	assert.False(t, outcomes[0].Unchanged)
+	assert.True(t, outcomes[0].Inserted)
+
+	// The same content indexed later is not written again,
+	// documents without a hash always are.
+	again := hashed
+	again.LastIndexed = hashed.LastIndexed.Add(time.Hour)
+	outcomes, err = store.UpsertDocuments(
+		[]document.Document{again, unhashed})
+	assert.NoError(t, err)
+	assert.NoError(t, outcomes[0].Err)
+	assert.True(t, outcomes[0].Unchanged)
+	assert.False(t, outcomes[0].Inserted)
+	assert.False(t, outcomes[1].Unchanged)
+
+	docs, err := store.DocumentsAfter("", "", 1)
+	assert.NoError(t, err)
+	assertSameDocument(t, hashed, docs[0])
+	assert.Equal(t, hashed.Hash, docs[0].Hash)
+
+	changed := Document("/a", "c1", "pear")
+	changed.Hash = "new hash of a"
+	outcomes, err = store.UpsertDocuments([]document.Document{changed})
+	assert.NoError(t, err)
+	assert.False(t, outcomes[0].Unchanged)
+
+	docs, err = store.DocumentsAfter("", "", 1)
+	assert.NoError(t, err)
+	assertSameDocument(t, changed, docs[0])
+}
+
+func checkSweepCollection(t *testing.T, store storage.Store) {
+	seen := Document("/seen", "c1", "apple")
+	seen.Hash = "hash of seen"
+	setup(t, store,
+		seen,
+		Document("/gone", "c1", "banana"),
+		Document("/other", "c2", "cherry"),
+	)
+
+	// A reindex starts, and sends one document again unchanged.
+	started := seen.LastSeen.Add(time.Hour)
+	again := seen
+	again.LastSeen = started.Add(time.Minute)
+	outcomes, err := store.UpsertDocuments([]document.Document{again})
+	assert.NoError(t, err)
+	assert.True(t, outcomes[0].Unchanged)
+
+	removed, err := store.SweepCollection("c1", started)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/gone"}, removed)
+
+	docs, err := store.Documents()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []utils.Path{"/seen", "/other"}, paths(docs))
+
+	removed, err = store.SweepCollection("c1", started)
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+
+	_, err = store.SweepCollection("missing", started)
+	assert.Error(t, err)
+}
+
+func checkDocumentsAfter(t *testing.T, store storage.Store) {
+	setup(t, store, corpus()...)
+
+	count, err := store.CountDocuments("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	docs, err := store.DocumentsAfter("", "", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/a", "/b"}, paths(docs))
+
+	docs, err = store.DocumentsAfter("/b", "", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/c", "/d"}, paths(docs))
+
+	docs, err = store.DocumentsAfter("/a", "c2", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/d", "/e"}, paths(docs))
+
+	docs, err = store.DocumentsAfter("/e", "", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, docs)
+}
+
+func checkDeleteDocument(t *testing.T, store storage.Store) {
+	setup(t, store, corpus()...)
+
+	deleted, err := store.DeleteDocument("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Deleted{Documents: 1}, deleted)
+
+	_, err = store.DeleteDocument("/a")
+	assert.Error(t, err)
+
+	// Deleted documents are not found by searches.
+	results, err := store.Score([]utils.Word{"apple"}, search.Filter{}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/b"}, paths(results))
+
+	count, err := store.CountDocuments("")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+}
+
+func checkDeleteCollection(t *testing.T, store storage.Store) {
+	setup(t, store, corpus()...)
+
+	deleted, err := store.DeleteCollection("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Deleted{Collections: 1, Documents: 3}, deleted)
+
+	_, err = store.DeleteCollection("c1")
+	assert.Error(t, err)
+
+	_, err = store.Collection("c1")
+	assert.Error(t, err)
+
+	docs, err := store.DocumentsAfter("", "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/d", "/e"}, paths(docs))
+
+	results, err := store.Score([]utils.Word{"apple"}, search.Filter{}, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Documents can not be added to a deleted collection.
+	_, err = store.UpsertDocument(Document("/a", "c1", "apple"))
+	assert.Error(t, err)
+}
+
+func checkDeleteIndexer(t *testing.T, store storage.Store) {
+	setup(t, store, corpus()...)
+	assert.NoError(t, store.InsertIndexer(Indexer("i2", 40001)))
+	assert.NoError(t, store.InsertCollection(Collection("c3", "i2")))
+	_, err := store.UpsertDocument(Document("/f", "c3", "apple"))
+	assert.NoError(t, err)
+
+	deleted, err := store.DeleteIndexer("i1")
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		storage.Deleted{Indexers: 1, Collections: 2, Documents: 5},
+		deleted,
+	)
+
+	_, err = store.DeleteIndexer("i1")
+	assert.Error(t, err)
+
+	indexers, err := store.Indexers()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(indexers))
+
+	collections, err := store.Collections()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(collections))
+
+	docs, err := store.Documents()
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/f"}, paths(docs))
+
+	// The port of the deleted indexer can be used again.
+	assert.NoError(t, store.InsertIndexer(Indexer("i3", 40000)))
+}
+
+func checkUpdateCollection(t *testing.T, store storage.Store) {
+	setup(t, store)
+
+	updated := Collection("c1", "i1")
+	updated.Path = "/other"
+	updated.Recursive = false
+	assert.NoError(t, store.UpdateCollection(updated))
+
+	collection, err := store.Collection("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, updated, collection)
+
+	// The indexer must exist, and so must the collection.
+	assert.Error(t, store.UpdateCollection(Collection("c1", "missing")))
+	assert.Error(t, store.UpdateCollection(Collection("missing", "i1")))
+}
+
+func checkUpdateWords(t *testing.T, store storage.Store) {
+	setup(t, store, corpus()...)
+
+	updated := Document("/e", "c2", "fig")
+	updated.Words = utils.FrequencyMap{"apple": 10}
+	assert.NoError(t, store.UpdateWords([]document.Document{updated}, nil))
+
+	docs, err := store.DocumentsAfter("/d", "", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, updated.Words, docs[0].Words)
+	assert.Equal(t, "fig", docs[0].RawText)
+
+	// The new words are searchable, and the word count is updated.
+	results, err := store.Score([]utils.Word{"apple"}, search.Filter{}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/e"}, paths(results))
+}
+
+func checkUpdateWordsReplaced(t *testing.T, store storage.Store) {
+	setup(t, store)
+	keepRevisions(t, store, "c1", 5)
+
+	_, err := store.UpsertDocuments([]document.Document{
+		version("/a", "c1", "first version", 1),
+		version("/b", "c1", "first version", 1),
+	})
+	assert.NoError(t, err)
+
+	docs, err := store.DocumentsAfter("", "", 10)
+	assert.NoError(t, err)
+	revisions, err := store.DocumentRevisions(paths(docs))
+	assert.NoError(t, err)
+	assert.Empty(t, revisions)
+
+	// /a is replaced after it was read, what was read is kept as a revision.
+	_, err = store.UpsertDocument(version("/a", "c1", "second version", 2))
+	assert.NoError(t, err)
+
+	for i := range docs {
+		docs[i].Words = utils.FrequencyMap{"renormalized": 1}
+	}
+	assert.NoError(t, store.UpdateWords(docs, nil))
+
+	score := func(word utils.Word, day int) []utils.Path {
+		var filter search.Filter
+		if day > 0 {
+			filter.AsOf = time.Date(
+				2025, time.March, day, 12, 0, 0, 0, time.UTC)
+		}
+		results, err := store.Score([]utils.Word{word}, filter, 10)
+		assert.NoError(t, err)
+		return paths(results)
+	}
+
+	// The new version of /a is not updated, its revision is.
+	assert.Equal(t, []utils.Path{"/b"}, score("renormalized", 0))
+	assert.Equal(t, []utils.Path{"/a", "/b"}, score("renormalized", 1))
+	assert.Equal(t, []utils.Path{"/a"}, score("second", 0))
+
+	revisions, err = store.DocumentRevisions([]utils.Path{"/b", "/a"})
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 1)
+	assert.Equal(t, 1, revisions[0].Number)
+	assert.Equal(t, utils.Path("/a"), revisions[0].Document.Path)
+	assert.Equal(t, "first version", revisions[0].Document.RawText)
+
+	// Revisions are only updated with the hash they were read with.
+	revisions[0].Document.Words = utils.FrequencyMap{"again": 1}
+	stale := revisions[0]
+	stale.Document.Hash = "other version"
+	stale.Document.Words = utils.FrequencyMap{"stale": 1}
+	assert.NoError(t, store.UpdateWords(nil, []renormalize.Revision{
+		revisions[0],
+		stale,
+	}))
+
+	assert.Equal(t, []utils.Path{"/a"}, score("again", 1))
+	assert.Empty(t, score("stale", 1))
+	assert.Empty(t, score("again", 0))
+}
+
+func checkSetCollectionNormalizer(t *testing.T, store storage.Store) {
+	setup(t, store)
+
+	assert.NoError(t, store.SetCollectionNormalizer("c1", normalize.STEMMING))
+
+	collection, err := store.Collection("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, normalize.STEMMING, collection.Normalfunc)
+
+	collection, err = store.Collection("c2")
+	assert.NoError(t, err)
+	assert.Equal(t, normalize.TO_LOWER, collection.Normalfunc)
+
+	assert.NoError(t, store.SetCollectionNormalizer("", normalize.STEMMING))
+
+	collection, err = store.Collection("c2")
+	assert.NoError(t, err)
+	assert.Equal(t, normalize.STEMMING, collection.Normalfunc)
+}
+
+func checkScore(t *testing.T, store storage.Store) {
+	setup(t, store, corpus()...)
+
+	results, err := store.Score([]utils.Word{"apple"}, search.Filter{}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/a", "/b"}, paths(results))
+
+	// idf = log2(5 / (2 + 1)), tf = 3/4
+	assert.InDelta(t, 0.5527, float64(results[0].Score), 1e-4)
+
+	results, err = store.Score(
+		[]utils.Word{"apple", "banana"},
+		search.Filter{},
+		1,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/a"}, paths(results))
+
+	results, err = store.Score([]utils.Word{"missing"}, search.Filter{}, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func checkScoreFilter(t *testing.T, store storage.Store) {
+	setup(t, store, corpus()...)
+	apple := []utils.Word{"apple"}
+
+	results, err := store.Score(
+		apple,
+		search.Filter{PlusWords: []string{"cherry"}},
+		10,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/b"}, paths(results))
+
+	results, err = store.Score(
+		apple,
+		search.Filter{MinusWords: []string{"cherry"}},
+		10,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/a"}, paths(results))
+
+	results, err = store.Score(
+		apple,
+		search.Filter{Quotes: []string{"cherry apple"}},
+		10,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/b"}, paths(results))
+
+	// Quotes must appear in the given order.
+	results, err = store.Score(
+		apple,
+		search.Filter{Quotes: []string{"apple", "cherry apple"}},
+		10,
+	)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func checkMetadata(t *testing.T, store storage.Store) {
+	web := Document("https://example.com", "c1", "apple")
+	web.Source = utils.SOURCE_WEB
+	web.Metadata = utils.Metadata{
+		Title:    "Example",
+		Size:     1256,
+		Modified: time.Date(2025, time.April, 2, 8, 30, 0, 0, time.UTC),
+		MIMEType: "text/html",
+		Language: "en",
+	}
+	// Unknown metadata is kept unknown.
+	local := Document("/a", "c1", "apple banana")
+
+	setup(t, store, web, local)
+
+	docs, err := store.Documents()
+	assert.NoError(t, err)
+	assert.Len(t, docs, 2)
+	for _, doc := range docs {
+		if doc.Path == web.Path {
+			assertSameDocument(t, web, doc)
+		} else {
+			assertSameDocument(t, local, doc)
+		}
+	}
+
+	// Search results have the metadata of their documents.
+	results, err := store.Score([]utils.Word{"apple"}, search.Filter{}, 10)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []utils.Path{web.Path, local.Path}, paths(results))
+	for _, result := range results {
+		if result.Path == web.Path {
+			assertSameMetadata(t, web.Source, web.Metadata,
+				result.Source, result.Metadata)
+		} else {
+			assertSameMetadata(t, local.Source, local.Metadata,
+				result.Source, result.Metadata)
+		}
+	}
+}
+
+func checkStats(t *testing.T, store storage.Store) {
+	empty, err := store.Stats()
+	assert.NoError(t, err)
+	assert.Zero(t, empty.Documents)
+	assert.Empty(t, empty.Collections)
+	assert.Zero(t, empty.AverageLength)
+	assert.True(t, empty.LastIndexed.IsZero())
+
+	web := Document("https://example.com", "c1", "apple apple banana")
+	web.Source = utils.SOURCE_WEB
+	web.LastIndexed = web.LastIndexed.Add(time.Hour)
+
+	setup(t, store,
+		Document("/a", "c1", "apple cherry"),
+		web,
+		Document("/b", "c2", "banana"),
+	)
+	assert.NoError(t, store.InsertCollection(Collection("c3", "i1")))
+
+	result, err := store.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Documents)
+	assert.Equal(t, map[string]int{"file": 2, "web": 1}, result.Sources)
+	assert.Equal(t, 6, result.Terms)
+	assert.Equal(t, 3, result.DistinctTerms)
+	assert.InDelta(t, 2.0, result.AverageLength, 0.001)
+	assert.Positive(t, result.IndexSize)
+	assert.True(t, web.LastIndexed.Equal(result.LastIndexed))
+
+	assert.Len(t, result.Collections, 3)
+	ids := make([]indexing.CollectionID, len(result.Collections))
+	for i, collection := range result.Collections {
+		ids[i] = collection.ID
+	}
+	assert.Equal(t, []indexing.CollectionID{"c1", "c2", "c3"}, ids)
+
+	assert.Equal(t, 2, result.Collections[0].Documents)
+	assert.True(t, web.LastIndexed.Equal(result.Collections[0].LastIndexed))
+	assert.Equal(t, 1, result.Collections[1].Documents)
+	assert.Zero(t, result.Collections[2].Documents)
+	assert.True(t, result.Collections[2].LastIndexed.IsZero())
+}
+
+func checkTerms(t *testing.T, store storage.Store) {
+	setup(t, store,
+		Document("/a", "c1", "apple apricot banana"),
+		Document("/b", "c1", "apple"),
+		Document("/c", "c2", "apple avocado"),
+	)
+
+	terms, err := store.Terms(stats.TermFilter{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []stats.Term{
+		{Term: "apple", Documents: 3},
+		{Term: "apricot", Documents: 1},
+		{Term: "avocado", Documents: 1},
+		{Term: "banana", Documents: 1},
+	}, terms)
+
+	terms, err = store.Terms(stats.TermFilter{
+		Prefix:     "a",
+		Collection: "c1",
+		Limit:      10,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []stats.Term{
+		{Term: "apple", Documents: 2},
+		{Term: "apricot", Documents: 1},
+	}, terms)
+
+	// Paging through the vocabulary.
+	terms, err = store.Terms(stats.TermFilter{After: "apple", Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []stats.Term{
+		{Term: "apricot", Documents: 1},
+		{Term: "avocado", Documents: 1},
+	}, terms)
+
+	terms, err = store.Terms(stats.TermFilter{Prefix: "x", Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, terms)
+}
+
+func checkRevisions(t *testing.T, store storage.Store) {
+	setup(t, store)
+	keepRevisions(t, store, "c1", 2)
+
+	upsert := func(doc document.Document) {
+		_, err := store.UpsertDocuments([]document.Document{doc})
+		assert.NoError(t, err)
+	}
+
+	_, err := store.UpsertDocument(version("/a", "c1", "first version", 1))
+	assert.NoError(t, err)
+	// Unchanged documents are not kept again.
+	upsert(version("/a", "c1", "first version", 1))
+	_, err = store.UpsertDocument(version("/a", "c1", "second version", 2))
+	assert.NoError(t, err)
+	upsert(version("/a", "c1", "third version", 3))
+	upsert(version("/a", "c1", "fourth version", 4))
+
+	// Only the last two revisions are kept, besides the document.
+	revisions, err := store.Revisions("/a")
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 3)
+	for i, rev := range revisions {
+		assert.Equal(t, i+2, rev.Number)
+		assert.Equal(t, i == 2, rev.Current)
+		assert.True(t, rev.Indexed.Equal(
+			time.Date(2025, time.March, i+2, 12, 0, 0, 0, time.UTC)))
+	}
+	assert.Equal(t, "second version", revisions[0].Hash)
+
+	text, err := store.RevisionText("/a", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "second version", text)
+
+	text, err = store.RevisionText("/a", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "fourth version", text)
+
+	_, err = store.RevisionText("/a", 1)
+	assert.Error(t, err)
+	_, err = store.Revisions("/missing")
+	assert.Error(t, err)
+
+	// Collections keep no revisions by default.
+	upsert(version("/b", "c2", "first version", 1))
+	upsert(version("/b", "c2", "second version", 2))
+	revisions, err = store.Revisions("/b")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, revisions[0].Number)
+	assert.Len(t, revisions, 1)
+
+	// Deleted documents are kept as revisions, numbered on when they return.
+	_, err = store.DeleteDocument("/a")
+	assert.NoError(t, err)
+	_, err = store.Revisions("/a")
+	assert.Error(t, err)
+	upsert(version("/a", "c1", "new", 5))
+	revisions, err = store.Revisions("/a")
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 3)
+	assert.Equal(t, 5, revisions[2].Number)
+	text, err = store.RevisionText("/a", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "fourth version", text)
+
+	// Revisions are deleted with their collection.
+	_, err = store.DeleteCollection("c1")
+	assert.NoError(t, err)
+	kept, err := store.DocumentRevisions([]utils.Path{"/a"})
+	assert.NoError(t, err)
+	assert.Empty(t, kept)
+}
+
+func checkScoreAsOf(t *testing.T, store storage.Store) {
+	setup(t, store)
+	keepRevisions(t, store, "c1", 5)
+
+	_, err := store.UpsertDocuments([]document.Document{
+		version("/a", "c1", "apple banana", 1),
+		version("/b", "c1", "banana", 1),
+		version("/c", "c1", "apple apple cherry", 3),
+	})
+	assert.NoError(t, err)
+	_, err = store.UpsertDocuments([]document.Document{
+		version("/a", "c1", "cherry", 3),
+		version("/b", "c1", "apple apple", 3),
+	})
+	assert.NoError(t, err)
+
+	asOf := func(day int, filter search.Filter) []utils.Path {
+		filter.AsOf = time.Date(2025, time.March, day, 12, 0, 0, 0, time.UTC)
+		results, err := store.Score([]utils.Word{"apple"}, filter, 10)
+		assert.NoError(t, err)
+		return paths(results)
+	}
+
+	// /c did not exist yet, /a had apple, /b did not.
+	assert.Equal(t, []utils.Path{"/a"}, asOf(2, search.Filter{}))
+	assert.Empty(t, asOf(2, search.Filter{Quotes: []string{"cherry"}}))
+	assert.Equal(t, []utils.Path{"/a"},
+		asOf(2, search.Filter{Quotes: []string{"apple banana"}}))
+
+	assert.Equal(t, []utils.Path{"/b", "/c"}, asOf(3, search.Filter{}))
+	assert.Equal(t, []utils.Path{"/c"},
+		asOf(3, search.Filter{PlusWords: []string{"cherry"}}))
+	assert.Empty(t, asOf(0, search.Filter{}))
+}
+
+func checkScoreAsOfMetadata(t *testing.T, store storage.Store) {
+	setup(t, store)
+	keepRevisions(t, store, "c1", 5)
+
+	old := version("/a", "c1", "apple", 1)
+	old.Metadata = utils.Metadata{
+		Title:    "Draft",
+		Size:     5,
+		Modified: time.Date(2025, time.February, 28, 9, 0, 0, 0, time.UTC),
+		MIMEType: "text/plain",
+		Language: "en",
+	}
+	// The metadata of the new version is unknown.
+	current := version("/a", "c1", "apple pie", 3)
+
+	for _, doc := range []document.Document{old, current} {
+		_, err := store.UpsertDocument(doc)
+		assert.NoError(t, err)
+	}
+
+	// Results have the metadata of the version at the time.
+	for day, expected := range map[int]document.Document{2: old, 4: current} {
+		filter := search.Filter{
+			AsOf: time.Date(2025, time.March, day, 12, 0, 0, 0, time.UTC),
+		}
+		results, err := store.Score([]utils.Word{"apple"}, filter, 10)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		for _, result := range results {
+			assertSameMetadata(t, expected.Source, expected.Metadata,
+				result.Source, result.Metadata)
+		}
+	}
+}
+
+func checkScoreAsOfDeleted(t *testing.T, store storage.Store) {
+	setup(t, store)
+	keepRevisions(t, store, "c1", 5)
+
+	_, err := store.UpsertDocuments([]document.Document{
+		version("/a", "c1", "apple", 1),
+		version("/b", "c1", "apple pie", 1),
+		version("/c", "c2", "apple", 1),
+		version("/d", "c1", "banana", 1),
+	})
+	assert.NoError(t, err)
+
+	_, err = store.DeleteDocument("/a")
+	assert.NoError(t, err)
+	_, err = store.DeleteDocument("/c")
+	assert.NoError(t, err)
+	swept, err := store.SweepCollection("c1", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/b", "/d"}, swept)
+
+	asOf := func(asOf time.Time) []search.SearchResult {
+		filter := search.Filter{AsOf: asOf}
+		results, err := store.Score([]utils.Word{"apple"}, filter, 10)
+		assert.NoError(t, err)
+		return results
+	}
+
+	// Only c1 keeps revisions, so /c is gone.
+	before := asOf(time.Date(2025, time.March, 2, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, []utils.Path{"/a", "/b"}, paths(before))
+	for _, result := range before {
+		assert.Equal(t, utils.SOURCE_LOCAL, result.Source)
+	}
+	assert.Empty(t, asOf(time.Now().Add(time.Minute)))
+
+	revisions, err := store.DeletedRevisionsAfter("", "c1", 2)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, utils.Path("/a"), revisions[0].Document.Path)
+	assert.Equal(t, "apple", revisions[0].Document.RawText)
+	assert.Equal(t, utils.Path("/b"), revisions[1].Document.Path)
+
+	revisions, err = store.DeletedRevisionsAfter("/b", "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 1)
+	assert.Equal(t, utils.Path("/d"), revisions[0].Document.Path)
+
+	revisions, err = store.DeletedRevisionsAfter("", "c2", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, revisions)
+
+	// A returning document is found as of after it returned.
+	_, err = store.UpsertDocument(version("/a", "c1", "apple", 5))
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{"/a"},
+		paths(asOf(time.Now().Add(time.Minute))))
+}
@@ -0,0 +1,143 @@
+/*
+Package sweep removes documents whose source is gone, so they stop showing
+up in search results. A document is gone if a complete reindex of its
+collection did not see it, see Runs, or if it is a local file that no longer
+exists, see RemoveMissing.
+*/
+package sweep
+
+import (
+	"errors"
+	"os"
+	"seekourney/core/document"
+	"seekourney/core/storage"
+	"seekourney/indexing"
+	"seekourney/utils"
+	"sync"
+	"time"
+)
+
+// _BATCHSIZE_ is the number of documents read in one batch.
+const _BATCHSIZE_ int = 500
+
+// Result tells what a sweep removed.
+type Result struct {
+	// Collection is the swept collection,
+	// empty if every collection was swept.
+	Collection indexing.CollectionID
+
+	// Removed are the paths of the removed documents, ordered.
+	Removed []utils.Path
+}
+
+// Store is the storage documents are swept from, see storage.Store.
+// An empty collection means every document.
+type Store interface {
+	// DocumentsAfter returns at most limit documents of collection,
+	// ordered by path, starting after the given path.
+	DocumentsAfter(
+		after utils.Path,
+		collection indexing.CollectionID,
+		limit int,
+	) ([]document.Document, error)
+
+	// DeleteDocument removes the document with the given path.
+	DeleteDocument(path utils.Path) (storage.Deleted, error)
+}
+
+// Runs keeps when the running reindex of each collection started.
+// Documents of a collection not seen since its reindex started are removed
+// once the indexer reports the reindex complete. It is safe for concurrent
+// use.
+type Runs struct {
+	mutex   sync.Mutex
+	started map[indexing.CollectionID]time.Time
+}
+
+// NewRuns returns a Runs with no reindex running.
+func NewRuns() *Runs {
+	return &Runs{started: make(map[indexing.CollectionID]time.Time)}
+}
+
+// Start records that a reindex of collection starts now.
+// If a reindex of it is already running, the earlier start is kept,
+// so no document seen by either is removed.
+func (runs *Runs) Start(collection indexing.CollectionID) {
+	runs.mutex.Lock()
+	defer runs.mutex.Unlock()
+
+	if _, running := runs.started[collection]; !running {
+		runs.started[collection] = time.Now()
+	}
+}
+
+// Finish ends the reindex of collection, returning when it started,
+// or false if no reindex of it was running.
+func (runs *Runs) Finish(
+	collection indexing.CollectionID,
+) (time.Time, bool) {
+	runs.mutex.Lock()
+	defer runs.mutex.Unlock()
+
+	started, running := runs.started[collection]
+	delete(runs.started, collection)
+	return started, running
+}
+
+// Missing returns the paths of the local documents of collection whose
+// file no longer exists, ordered. Files that can not be checked for
+// another reason, such as permissions, are not missing.
+func Missing(
+	store Store,
+	collection indexing.CollectionID,
+) ([]utils.Path, error) {
+	missing := make([]utils.Path, 0)
+	after := utils.Path("")
+
+	for {
+		docs, err := store.DocumentsAfter(after, collection, _BATCHSIZE_)
+		if err != nil {
+			return missing, err
+		}
+		if len(docs) == 0 {
+			return missing, nil
+		}
+
+		for _, doc := range docs {
+			if doc.Source != utils.SOURCE_LOCAL {
+				continue
+			}
+
+			_, err := os.Stat(string(doc.Path))
+			if errors.Is(err, os.ErrNotExist) {
+				missing = append(missing, doc.Path)
+			}
+		}
+		after = docs[len(docs)-1].Path
+	}
+}
+
+// RemoveMissing removes the local documents of collection whose file no
+// longer exists, see Missing. The result holds the documents removed before
+// an error.
+func RemoveMissing(
+	store Store,
+	collection indexing.CollectionID,
+) (Result, error) {
+	result := Result{Collection: collection, Removed: make([]utils.Path, 0)}
+
+	missing, err := Missing(store, collection)
+	if err != nil {
+		return result, err
+	}
+
+	for _, path := range missing {
+		_, err := store.DeleteDocument(path)
+		if err != nil {
+			return result, err
+		}
+		result.Removed = append(result.Removed, path)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,92 @@
+package sweep
+
+import (
+	"os"
+	"path/filepath"
+	"seekourney/core/document"
+	"seekourney/core/storage"
+	"seekourney/core/storage/embedded"
+	"seekourney/core/storage/storagetest"
+	"seekourney/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// open returns an embedded store with the collections c1 and c2.
+func open(t *testing.T) storage.Store {
+	store, err := embedded.Open(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, store.Close())
+	})
+
+	assert.NoError(t, store.InsertIndexer(storagetest.Indexer("i1", 40000)))
+	assert.NoError(
+		t, store.InsertCollection(storagetest.Collection("c1", "i1")))
+	assert.NoError(
+		t, store.InsertCollection(storagetest.Collection("c2", "i1")))
+	return store
+}
+
+func TestRuns(t *testing.T) {
+	runs := NewRuns()
+
+	_, running := runs.Finish("c1")
+	assert.False(t, running)
+
+	before := time.Now()
+	runs.Start("c1")
+	first, _ := runs.Finish("c1")
+	assert.False(t, first.Before(before))
+
+	runs.Start("c1")
+	first, _ = runs.Finish("c1")
+	runs.Start("c1")
+	runs.Start("c1")
+	started, running := runs.Finish("c1")
+	assert.True(t, running)
+	assert.False(t, started.Before(first))
+
+	_, running = runs.Finish("c1")
+	assert.False(t, running)
+}
+
+func TestRemoveMissing(t *testing.T) {
+	store := open(t)
+	dir := t.TempDir()
+
+	exists := utils.Path(filepath.Join(dir, "exists.txt"))
+	assert.NoError(t, os.WriteFile(string(exists), []byte("text"), 0644))
+	gone := utils.Path(filepath.Join(dir, "gone.txt"))
+	other := utils.Path(filepath.Join(dir, "other.txt"))
+
+	web := storagetest.Document("https://example.com", "c1", "web page")
+	web.Source = utils.SOURCE_WEB
+
+	_, err := store.UpsertDocuments([]document.Document{
+		storagetest.Document(exists, "c1", "exists"),
+		storagetest.Document(gone, "c1", "gone"),
+		storagetest.Document(other, "c2", "other"),
+		web,
+	})
+	assert.NoError(t, err)
+
+	missing, err := Missing(store, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Path{gone, other}, missing)
+
+	result, err := RemoveMissing(store, "c1")
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Collection: "c1", Removed: []utils.Path{gone}},
+		result)
+
+	docs, err := store.Documents()
+	assert.NoError(t, err)
+	assert.Len(t, docs, 3)
+
+	result, err = RemoveMissing(store, "c1")
+	assert.NoError(t, err)
+	assert.Empty(t, result.Removed)
+}
@@ -0,0 +1,321 @@
+/*
+Package transfer exports a whole index to JSON Lines, and imports it again,
+to move an index between machines or storage backends, and for backups.
+
+The first line is a Header, every following line a Record with one object.
+Indexers come first, then collections, then documents ordered by path:
+
+	{"Format":"seekourney-index","Version":1,"Exported":"2025-..."}
+	{"Indexer":{"ID":"...","Name":"...","ExecPath":"...",...}}
+	{"Collection":{"Path":"...","IndexerID":"...",...,"ID":"..."}}
+	{"Document":{"Path":"/a","Words":{"word":1},"RawText":"word",...}}
+
+Importing keeps indexers and collections that are already stored, and
+replaces documents with the same path. Since documents are ordered by path,
+an interrupted import can be resumed after the last path it stored.
+*/
+package transfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"seekourney/core/document"
+	"seekourney/core/indexAPI"
+	"seekourney/core/storage"
+	"seekourney/utils"
+	"time"
+)
+
+const (
+	// FORMAT identifies an export in its header.
+	FORMAT string = "seekourney-index"
+
+	// VERSION is the version of the format written by Export.
+	// Import reads this version and older ones.
+	VERSION int = 1
+
+	// _BATCHSIZE_ is the number of documents read or stored at a time.
+	_BATCHSIZE_ int = 500
+)
+
+// Header is the first line of an export.
+type Header struct {
+	Format   string
+	Version  int
+	Exported time.Time
+}
+
+// Record is a line of an export after the header, exactly one field is set.
+type Record struct {
+	Indexer    *indexAPI.IndexerData `json:",omitempty"`
+	Collection *indexAPI.Collection  `json:",omitempty"`
+	Document   *document.Document    `json:",omitempty"`
+}
+
+// Summary counts what was exported or imported.
+type Summary struct {
+	Indexers    int
+	Collections int
+	Documents   int
+
+	// Skipped counts objects that were already stored, documents stored with
+	// the same content, and documents before the point an import was resumed
+	// from.
+	Skipped int
+
+	// Failed counts objects that could not be stored,
+	// such as documents of a collection that is not stored.
+	Failed int
+
+	// LastPath is the path of the last document written,
+	// an import can be resumed after it.
+	LastPath utils.Path
+}
+
+// Export writes every indexer, collection and document in store to writer.
+// Documents are read in batches, so the whole index is never in memory.
+func Export(store storage.Store, writer io.Writer) (Summary, error) {
+	var summary Summary
+
+	buffered := bufio.NewWriter(writer)
+	encoder := json.NewEncoder(buffered)
+
+	err := encoder.Encode(Header{
+		Format:   FORMAT,
+		Version:  VERSION,
+		Exported: time.Now(),
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	indexers, err := store.Indexers()
+	if err != nil {
+		return summary, err
+	}
+	for _, indexer := range indexers {
+		err = encoder.Encode(Record{Indexer: &indexer})
+		if err != nil {
+			return summary, err
+		}
+		summary.Indexers++
+	}
+
+	collections, err := store.Collections()
+	if err != nil {
+		return summary, err
+	}
+	for _, collection := range collections {
+		err = encoder.Encode(Record{Collection: &collection})
+		if err != nil {
+			return summary, err
+		}
+		summary.Collections++
+	}
+
+	for {
+		docs, err := store.DocumentsAfter(summary.LastPath, "", _BATCHSIZE_)
+		if err != nil {
+			return summary, err
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		for _, doc := range docs {
+			err = encoder.Encode(Record{Document: &doc})
+			if err != nil {
+				return summary, err
+			}
+			summary.Documents++
+			summary.LastPath = doc.Path
+		}
+	}
+
+	return summary, buffered.Flush()
+}
+
+// Import reads an export from reader into store. Documents with a path up to
+// and including after are skipped, to resume an earlier import.
+// Indexers whose port is taken get a free port instead.
+// Returns what was imported so far if it fails.
+func Import(
+	store storage.Store,
+	reader io.Reader,
+	after utils.Path,
+) (Summary, error) {
+	decoder := json.NewDecoder(bufio.NewReader(reader))
+
+	err := readHeader(decoder)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	importer := importer{
+		store: store,
+		after: after,
+		batch: make([]document.Document, 0, _BATCHSIZE_),
+	}
+
+	for line := 2; ; line++ {
+		var record Record
+		err = decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Store what was read, so the import can be resumed after it.
+			flushErr := importer.flush()
+			return importer.summary, errors.Join(
+				fmt.Errorf("line %d: %w", line, err),
+				flushErr,
+			)
+		}
+
+		err = importer.add(record)
+		if err != nil {
+			return importer.summary, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	return importer.summary, importer.flush()
+}
+
+// readHeader reads the header, and checks that the format can be read.
+func readHeader(decoder *json.Decoder) error {
+	var header Header
+	err := decoder.Decode(&header)
+	if err != nil {
+		return fmt.Errorf("invalid header: %w", err)
+	}
+
+	if header.Format != FORMAT {
+		return fmt.Errorf("not a %s export", FORMAT)
+	}
+
+	if header.Version < 1 || header.Version > VERSION {
+		return fmt.Errorf(
+			"unsupported version %d, at most %d is supported",
+			header.Version,
+			VERSION,
+		)
+	}
+
+	return nil
+}
+
+// importer stores the records of an import, documents in batches.
+type importer struct {
+	store   storage.Store
+	after   utils.Path
+	batch   []document.Document
+	summary Summary
+}
+
+// add stores record, or adds it to the batch if it is a document.
+func (imp *importer) add(record Record) error {
+	switch {
+	case record.Indexer != nil:
+		return imp.addIndexer(*record.Indexer)
+	case record.Collection != nil:
+		return imp.addCollection(*record.Collection)
+	case record.Document != nil:
+		if record.Document.Path <= imp.after {
+			imp.summary.Skipped++
+			return nil
+		}
+
+		imp.batch = append(imp.batch, *record.Document)
+		if len(imp.batch) >= _BATCHSIZE_ {
+			return imp.flush()
+		}
+		return nil
+	}
+
+	return errors.New("empty record")
+}
+
+// addIndexer stores indexer unless its ID is already stored.
+func (imp *importer) addIndexer(indexer indexAPI.IndexerData) error {
+	if _, err := imp.store.Indexer(indexer.ID); err == nil {
+		imp.summary.Skipped++
+		return nil
+	}
+
+	indexers, err := imp.store.Indexers()
+	if err != nil {
+		return err
+	}
+	for _, other := range indexers {
+		if other.Port != indexer.Port {
+			continue
+		}
+
+		port, err := imp.store.FreeIndexerPort()
+		if err != nil {
+			return err
+		}
+		log.Printf("Port %s of indexer %s is taken, using %s\n",
+			indexer.Port, indexer.ID, port)
+		indexer.Port = port
+		break
+	}
+
+	err = imp.store.InsertIndexer(indexer)
+	if err != nil {
+		return err
+	}
+	imp.summary.Indexers++
+
+	return nil
+}
+
+// addCollection stores collection unless its ID is already stored.
+func (imp *importer) addCollection(collection indexAPI.Collection) error {
+	if _, err := imp.store.Collection(collection.ID); err == nil {
+		imp.summary.Skipped++
+		return nil
+	}
+
+	err := imp.store.InsertCollection(collection)
+	if err != nil {
+		log.Printf("Error importing collection %s: %s\n", collection.ID, err)
+		imp.summary.Failed++
+		return nil
+	}
+	imp.summary.Collections++
+
+	return nil
+}
+
+// flush stores the batch of documents.
+func (imp *importer) flush() error {
+	if len(imp.batch) == 0 {
+		return nil
+	}
+
+	outcomes, err := imp.store.UpsertDocuments(imp.batch)
+	if err != nil {
+		return err
+	}
+
+	for i, outcome := range outcomes {
+		if outcome.Err != nil {
+			log.Printf("Error importing document %s: %s\n",
+				imp.batch[i].Path, outcome.Err)
+			imp.summary.Failed++
+		} else if outcome.Unchanged {
+			imp.summary.Skipped++
+		} else {
+			imp.summary.Documents++
+		}
+	}
+	imp.summary.LastPath = imp.batch[len(imp.batch)-1].Path
+	imp.batch = imp.batch[:0]
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package transfer
+
+import (
+	"bytes"
+	"fmt"
+	"seekourney/core/document"
+	"seekourney/core/storage"
+	"seekourney/core/storage/embedded"
+	"seekourney/core/storage/storagetest"
+	"seekourney/utils"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// open returns an empty embedded store.
+func open(t *testing.T) storage.Store {
+	store, err := embedded.Open(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, store.Close())
+	})
+	return store
+}
+
+// fill stores an indexer, a collection and amount documents.
+func fill(t *testing.T, store storage.Store, amount int) {
+	assert.NoError(t, store.InsertIndexer(storagetest.Indexer("i1", 40000)))
+	assert.NoError(
+		t, store.InsertCollection(storagetest.Collection("c1", "i1")))
+
+	docs := make([]document.Document, 0, amount)
+	for i := range amount {
+		path := utils.Path(fmt.Sprintf("/doc/%04d", i))
+		doc := storagetest.Document(path, "c1", "word "+string(path))
+		docs = append(docs, doc)
+	}
+	_, err := store.UpsertDocuments(docs)
+	assert.NoError(t, err)
+}
+
+// export returns store exported.
+func export(t *testing.T, store storage.Store) *bytes.Buffer {
+	var buffer bytes.Buffer
+	_, err := Export(store, &buffer)
+	assert.NoError(t, err)
+	return &buffer
+}
+
+func TestRoundTrip(t *testing.T) {
+	amount := _BATCHSIZE_ + 10
+	source := open(t)
+	fill(t, source, amount)
+
+	buffer := export(t, source)
+	lines := strings.Count(buffer.String(), "\n")
+	assert.Equal(t, 1+1+1+amount, lines)
+
+	target := open(t)
+	summary, err := Import(target, buffer, "")
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{
+		Indexers:    1,
+		Collections: 1,
+		Documents:   amount,
+		LastPath:    utils.Path(fmt.Sprintf("/doc/%04d", amount-1)),
+	}, summary)
+
+	expected, err := source.Documents()
+	assert.NoError(t, err)
+	imported, err := target.Documents()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, expected, imported)
+
+	collection, err := target.Collection("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, storagetest.Collection("c1", "i1"), collection)
+}
+
+func TestImportExisting(t *testing.T) {
+	source := open(t)
+	fill(t, source, 3)
+	exported := export(t, source).String()
+
+	// Importing twice keeps the stored rows and replaces the documents.
+	target := open(t)
+	_, err := Import(target, strings.NewReader(exported), "")
+	assert.NoError(t, err)
+
+	summary, err := Import(target, strings.NewReader(exported), "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, summary.Skipped)
+	assert.Equal(t, 3, summary.Documents)
+
+	count, err := target.CountDocuments("")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestImportPortTaken(t *testing.T) {
+	source := open(t)
+	fill(t, source, 1)
+
+	target := open(t)
+	other := storagetest.Indexer("other", 40000)
+	assert.NoError(t, target.InsertIndexer(other))
+
+	_, err := Import(target, export(t, source), "")
+	assert.NoError(t, err)
+
+	indexer, err := target.Indexer("i1")
+	assert.NoError(t, err)
+	assert.NotEqual(t, other.Port, indexer.Port)
+}
+
+func TestImportResume(t *testing.T) {
+	source := open(t)
+	fill(t, source, 10)
+	exported := export(t, source).String()
+
+	// Cut off in the middle of a document, as if the transfer broke.
+	cut := strings.Index(exported, `"/doc/0006"`)
+	target := open(t)
+	summary, err := Import(target, strings.NewReader(exported[:cut]), "")
+	assert.Error(t, err)
+	assert.Equal(t, 6, summary.Documents)
+	assert.Equal(t, utils.Path("/doc/0005"), summary.LastPath)
+
+	summary, err = Import(
+		target,
+		strings.NewReader(exported),
+		summary.LastPath,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, summary.Documents)
+	// The indexer, the collection and the documents already imported.
+	assert.Equal(t, 2+6, summary.Skipped)
+
+	count, err := target.CountDocuments("")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, count)
+}
+
+func TestImportMissingCollection(t *testing.T) {
+	input := `{"Format":"seekourney-index","Version":1}
+{"Document":{"Path":"/a","Collection":"missing"}}
+`
+	summary, err := Import(open(t), strings.NewReader(input), "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Equal(t, 0, summary.Documents)
+}
+
+func TestImportInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"not json\n",
+		`{"Format":"other","Version":1}` + "\n",
+		`{"Format":"seekourney-index","Version":2}` + "\n",
+		`{"Format":"seekourney-index","Version":1}` + "\n{}\n",
+		`{"Format":"seekourney-index","Version":1}` + "\n[]\n",
+	}
+
+	for _, input := range invalid {
+		_, err := Import(open(t), strings.NewReader(input), "")
+		assert.Error(t, err, input)
+	}
+}
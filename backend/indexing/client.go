@@ -2,6 +2,7 @@ package indexing
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -14,6 +15,15 @@ import (
 	"os/signal"
 	"seekourney/utils"
 	"strconv"
+	"sync"
+)
+
+const (
+	// _PUSHBATCHSIZE_ is the most documents sent to Core in one request.
+	_PUSHBATCHSIZE_ int = 100
+
+	// _COREPORT_ is the port Core listens on.
+	_COREPORT_ utils.Port = 8080
 )
 
 // IndexerClient abstracts away most of the boilerplate code and infrastructure
@@ -26,6 +36,18 @@ type IndexerClient struct {
 	Parallel   bool
 	ConfigPath *utils.Path
 	channel    chan *UnnormalizedDocument
+
+	// progress holds the progress of the indexing of every collection
+	// since it was last reported done, see finish. Cancelled holds the jobs
+	// Core cancelled, see Context.Cancelled.
+	mutex     sync.Mutex
+	progress  map[CollectionID]*IndexingProgress
+	cancelled map[JobID]bool
+
+	// pending counts the documents of every collection being indexed or
+	// pushed, settled is signalled when a count goes down.
+	pending map[CollectionID]int
+	settled *sync.Cond
 }
 
 // NewClient creates a new IndexerClient. It reads the command line for
@@ -70,33 +92,261 @@ func NewClient(name string) *IndexerClient {
 		Parallel:   parrallel,
 		ConfigPath: configPath,
 		channel:    channel,
+		progress:   make(map[CollectionID]*IndexingProgress),
+		cancelled:  make(map[JobID]bool),
+		pending:    make(map[CollectionID]int),
 	}
+	client.settled = sync.NewCond(&client.mutex)
 
-	go func() {
-		for doc := range client.channel {
-			if doc != nil {
-				bytes := ResponseDocs([]UnnormalizedDocument{*doc})
-				body := utils.BytesBody(bytes)
-				port := utils.Port(8080)
-				resp, err := utils.PostRequest(
-					body,
-					"http://localhost",
-					port,
-					"push",
-					"docs",
-				)
-				if err != nil {
-					client.Log("Error sending document: %s", err)
-					return
+	go client.pushDocuments()
+
+	client.Log("Client initialized")
+	return client
+
+}
+
+// pushDocuments sends the documents in the channel to Core. Documents that
+// are ready together are sent as one batch, of at most _PUSHBATCHSIZE_.
+func (client *IndexerClient) pushDocuments() {
+	for doc := range client.channel {
+		batch := make([]UnnormalizedDocument, 0, _PUSHBATCHSIZE_)
+		if doc != nil {
+			batch = append(batch, *doc)
+		}
+
+	collect:
+		for len(batch) < _PUSHBATCHSIZE_ {
+			select {
+			case next, ok := <-client.channel:
+				if !ok {
+					break collect
+				}
+				if next != nil {
+					batch = append(batch, *next)
 				}
-				log.Println("Response:", resp)
+			default:
+				break collect
 			}
 		}
-	}()
 
-	client.Log("Client initialized")
-	return client
+		if len(batch) == 0 {
+			continue
+		}
+
+		err := client.push(batch)
+		if err != nil {
+			client.Log("Error sending documents: %s", err)
+			for _, doc := range batch {
+				client.fail(doc.Collection)
+			}
+		}
+		client.report(batch)
+		for _, doc := range batch {
+			client.settle(doc.Collection)
+		}
+	}
+}
+
+// add records that a document of collection is being indexed or pushed,
+// until it is settled.
+func (client *IndexerClient) add(collection CollectionID) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.pending[collection]++
+}
+
+// settle records that a document of collection was pushed or failed,
+// see add.
+func (client *IndexerClient) settle(collection CollectionID) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.pending[collection]--
+	client.settled.Broadcast()
+}
+
+// wait waits until every document of collection is settled, see add.
+// Documents of other collections are not waited for.
+func (client *IndexerClient) wait(collection CollectionID) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	for client.pending[collection] > 0 {
+		client.settled.Wait()
+	}
+	delete(client.pending, collection)
+}
+
+// begin records that an indexing of a collection starts, see Settings.
+func (client *IndexerClient) begin(settings Settings) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.progressOf(settings.CollectionID).Job = settings.JobID
+}
+
+// fail records that a document of collection could not be indexed or pushed,
+// so its indexing is not complete.
+func (client *IndexerClient) fail(collection CollectionID) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.progressOf(collection).Failed++
+}
+
+// stored records that Core stored a document of collection.
+func (client *IndexerClient) stored(collection CollectionID) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.progressOf(collection).Pushed++
+}
 
+// progressOf returns the progress of the indexing of collection,
+// the mutex must be held.
+func (client *IndexerClient) progressOf(
+	collection CollectionID,
+) *IndexingProgress {
+	progress, ok := client.progress[collection]
+	if !ok {
+		progress = &IndexingProgress{Collection: collection}
+		client.progress[collection] = progress
+	}
+
+	return progress
+}
+
+// cancel records that Core cancelled job, unless no indexing is running
+// for it.
+func (client *IndexerClient) cancel(job JobID) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if job == "" {
+		return
+	}
+	for _, progress := range client.progress {
+		if progress.Job == job {
+			client.cancelled[job] = true
+		}
+	}
+}
+
+// isCancelled returns true if Core cancelled job.
+func (client *IndexerClient) isCancelled(job JobID) bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.cancelled[job]
+}
+
+// report tells Core the progress of the indexings of the collections of
+// batch, see IndexingProgress. Indexings not dispatched as a job are not
+// reported.
+func (client *IndexerClient) report(batch []UnnormalizedDocument) {
+	reported := make(map[CollectionID]bool)
+	for _, doc := range batch {
+		if reported[doc.Collection] {
+			continue
+		}
+		reported[doc.Collection] = true
+
+		client.mutex.Lock()
+		progress := *client.progressOf(doc.Collection)
+		client.mutex.Unlock()
+		if progress.Job == "" {
+			continue
+		}
+
+		_, err := utils.PostRequest(
+			utils.JsonBody(progress),
+			"http://localhost",
+			_COREPORT_,
+			"push",
+			"progress",
+		)
+		if err != nil {
+			client.Log("Error sending indexing progress: %s", err)
+		}
+	}
+}
+
+// finish waits until the documents of an indexing of collection are pushed,
+// and tells Core that it is done, see IndexingDone.
+func (client *IndexerClient) finish(collection CollectionID) {
+	client.wait(collection)
+
+	client.mutex.Lock()
+	progress := client.progressOf(collection)
+	done := IndexingDone{
+		Collection: collection,
+		Complete:   progress.Failed == 0,
+		Job:        progress.Job,
+		Pushed:     progress.Pushed,
+		Failed:     progress.Failed,
+	}
+	delete(client.progress, collection)
+	delete(client.cancelled, progress.Job)
+	client.mutex.Unlock()
+
+	_, err := utils.PostRequest(
+		utils.JsonBody(done),
+		"http://localhost",
+		_COREPORT_,
+		"push",
+		"done",
+	)
+	if err != nil {
+		client.Log("Error sending indexing done: %s", err)
+	}
+}
+
+// push sends a batch of documents to Core,
+// and logs the documents Core failed to store.
+func (client *IndexerClient) push(batch []UnnormalizedDocument) error {
+	body := utils.BytesBody(ResponseDocs(batch))
+	resp, err := utils.PostRequest(
+		body,
+		"http://localhost",
+		_COREPORT_,
+		"push",
+		"docs",
+	)
+	if err != nil {
+		return err
+	}
+
+	parsed := IndexerResponse{}
+	err = json.Unmarshal([]byte(resp), &parsed)
+	if err != nil {
+		return err
+	}
+
+	if parsed.Status != STATUSSUCCESSFUL {
+		return errors.New(parsed.Data.Message)
+	}
+
+	for i, outcome := range parsed.Data.Outcomes {
+		if i >= len(batch) {
+			break
+		}
+		if outcome.Status == OUTCOMEFAILED {
+			client.Log("Core failed to store %s: %s",
+				outcome.Path, outcome.Message)
+			client.fail(batch[i].Collection)
+		} else {
+			client.stored(batch[i].Collection)
+		}
+	}
+	log.Printf(
+		"Pushed %d documents, %d unchanged, %d failed",
+		len(batch),
+		parsed.Data.Counts[OUTCOMEUNCHANGED],
+		parsed.Data.Counts[OUTCOMEFAILED],
+	)
+
+	return nil
 }
 
 // Start starts the indexer client. It listens for requests on the
@@ -106,6 +356,7 @@ func NewClient(name string) *IndexerClient {
 // 2. /name: returns the name of the indexer
 // 3. /ping: returns a ping response
 // 4. /shutdown: shuts down the indexer
+// 5. /cancel: stops sending documents of the job under the key 'job'
 
 func (client *IndexerClient) Start(f func(cxt Context, settings Settings)) {
 
@@ -141,11 +392,27 @@ func (client *IndexerClient) Start(f func(cxt Context, settings Settings)) {
 			resp := ResponseSuccess("Indexing started")
 			_, err = writer.Write(resp)
 			utils.PanicOnError(err)
+			// Core only waits for indexing to start, not to finish.
+			if flusher, ok := writer.(http.Flusher); ok {
+				flusher.Flush()
+			}
 
+			client.begin(settings)
 			cxt := NewContext(client)
+			cxt.job = settings.JobID
 
 			f(cxt, settings)
 
+			if err == nil {
+				client.finish(settings.CollectionID)
+			}
+
+		case "/cancel":
+			job := JobID(request.URL.Query().Get("job"))
+			client.cancel(job)
+			client.Log("Job %s cancelled by Core", job)
+			_, err := writer.Write(ResponseSuccess("Cancelled"))
+			utils.PanicOnError(err)
 		case "/name":
 			_, err := fmt.Fprintf(writer, "%s\n", string(client.Name))
 			utils.PanicOnError(err)
@@ -157,6 +424,10 @@ func (client *IndexerClient) Start(f func(cxt Context, settings Settings)) {
 			_, err := fmt.Fprintf(writer, "%s", string(ResponseExiting()))
 			client.Log("Shutdown triggered by Core, shutting down indexer")
 			utils.PanicOnError(err)
+			// Core waits for the answer before waiting for the exit.
+			if flusher, ok := writer.(http.Flusher); ok {
+				flusher.Flush()
+			}
 			stop()
 		default:
 			client.Log("Unknown path: %s", request.URL)
@@ -3,6 +3,7 @@ package indexing
 import (
 	"seekourney/utils"
 	"strings"
+	"time"
 )
 
 // Context is a struct that holds the client and provides methods
@@ -11,6 +12,9 @@ import (
 // breaking older code.
 type Context struct {
 	client *IndexerClient
+
+	// job is the job of the indexing, see Settings.
+	job JobID
 }
 
 // NewContext creates a new Context struct.
@@ -29,18 +33,32 @@ func (cxt *Context) Log(msg string, args ...any) {
 	cxt.client.Log(msg, args...)
 }
 
+// Cancelled returns true if Core cancelled the indexing. Documents done after
+// are not sent, so indexers may check it to stop early.
+func (cxt *Context) Cancelled() bool {
+	return cxt.client.isCancelled(cxt.job)
+}
+
 // StartDoc creates a new document builder.
+// For local files the size and modification time are read from the file,
+// the other metadata can be set on the builder, see SetTitle.
 func (cxt *Context) StartDoc(
 	path utils.Path,
 	source utils.Source,
 	settings Settings,
 ) *docBuilder {
 
+	var metadata utils.Metadata
+	if source == utils.SOURCE_LOCAL {
+		metadata = fileMetadata(path)
+	}
+
 	return &docBuilder{
 		path:       path,
 		source:     source,
 		text:       make([]string, 0),
 		collection: settings.CollectionID,
+		metadata:   metadata,
 		cxt:        cxt,
 	}
 }
@@ -57,6 +75,8 @@ func index(
 	doc, err := docBuilder.index()
 	if err != nil {
 		client.Log("Error indexing document: %s", err)
+		client.fail(docBuilder.collection)
+		client.settle(docBuilder.collection)
 		return
 	}
 
@@ -74,9 +94,39 @@ type docBuilder struct {
 	source     utils.Source
 	collection CollectionID
 	text       []string
+	metadata   utils.Metadata
 	cxt        *Context
 }
 
+// SetTitle sets the title of the document, by default the file name.
+func (doc *docBuilder) SetTitle(title string) {
+	doc.metadata.Title = title
+}
+
+// SetSize sets the size of the source in bytes, by default the size of the
+// local file, or the length of the text.
+func (doc *docBuilder) SetSize(size int64) {
+	doc.metadata.Size = size
+}
+
+// SetModified sets when the source was last modified,
+// by default when the local file was.
+func (doc *docBuilder) SetModified(modified time.Time) {
+	doc.metadata.Modified = modified
+}
+
+// SetMIMEType sets the media type of the source,
+// by default it is detected, see DetectMIMEType.
+func (doc *docBuilder) SetMIMEType(mimeType string) {
+	doc.metadata.MIMEType = mimeType
+}
+
+// SetLanguage sets the ISO 639-1 code of the language of the document,
+// by default it is detected, see DetectLanguage.
+func (doc *docBuilder) SetLanguage(language string) {
+	doc.metadata.Language = language
+}
+
 // AddText adds text to the document.
 func (doc *docBuilder) AddText(text string) {
 	doc.text = append(doc.text, text)
@@ -88,6 +138,14 @@ func (doc *docBuilder) AddText(text string) {
 // When indexed the document is sent to the server.
 func (doc *docBuilder) Done(f *func(*UnnormalizedDocument)) {
 
+	if doc.cxt.Cancelled() {
+		*doc = docBuilder{}
+		return
+	}
+
+	// Counted until pushed, so Core is told indexing is done after it is.
+	doc.cxt.client.add(doc.collection)
+
 	if doc.cxt.client.Parallel {
 		go index(doc.cxt.client, *doc, f)
 	} else {
@@ -112,6 +170,8 @@ func (docBuilder *docBuilder) index() (*UnnormalizedDocument, error) {
 		docBuilder.collection,
 		text,
 	)
+	doc.Metadata = docBuilder.metadata
+	completeMetadata(&doc)
 
 	return &doc, nil
 
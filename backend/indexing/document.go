@@ -2,6 +2,7 @@ package indexing
 
 import (
 	"log"
+	"os"
 	"seekourney/utils"
 )
 
@@ -15,6 +16,8 @@ type UnnormalizedDocument struct {
 
 	Collection CollectionID
 	RawText    string
+
+	utils.Metadata
 }
 
 // DocNew creates a new document.
@@ -57,6 +60,24 @@ func DocFromBytes(
 	return doc
 }
 
+// DocFromFile creates a new document from the text of a local file,
+// with its metadata, see Context.StartDoc.
+func DocFromFile(
+	path utils.Path,
+	collection CollectionID,
+) (UnnormalizedDocument, error) {
+	content, err := os.ReadFile(string(path))
+	if err != nil {
+		return UnnormalizedDocument{}, err
+	}
+
+	doc := DocFromBytes(path, utils.SOURCE_LOCAL, collection, content)
+	doc.Metadata = fileMetadata(path)
+	completeMetadata(&doc)
+
+	return doc, nil
+}
+
 // Misc
 
 // DebugPrint prints information about the document.
@@ -2,7 +2,9 @@ package indexing
 
 import (
 	"seekourney/utils"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -22,3 +24,66 @@ func TestIsValidPort(t *testing.T) {
 	assert.True(t, IsValidPort(_MAXPORT_))
 	assert.False(t, IsValidPort(_MAXPORT_+1))
 }
+
+func TestProgress(t *testing.T) {
+	client := &IndexerClient{
+		progress:  make(map[CollectionID]*IndexingProgress),
+		cancelled: make(map[JobID]bool),
+	}
+	client.begin(Settings{CollectionID: "c1", JobID: "j1"})
+	client.stored("c1")
+	client.stored("c1")
+	client.fail("c1")
+
+	assert.Equal(
+		t,
+		IndexingProgress{Job: "j1", Collection: "c1", Pushed: 2, Failed: 1},
+		*client.progress["c1"],
+	)
+
+	// Only jobs being indexed can be cancelled.
+	cxt := NewContext(client)
+	cxt.job = "j1"
+	client.cancel("j2")
+	assert.False(t, cxt.Cancelled())
+	assert.Empty(t, client.cancelled)
+	client.cancel("j1")
+	assert.True(t, cxt.Cancelled())
+
+	// Documents of a cancelled job are not sent.
+	doc := cxt.StartDoc("/tmp/doc.txt", utils.SOURCE_WEB, Settings{})
+	doc.Done(nil)
+	assert.Empty(t, client.channel)
+}
+
+func TestWaitPending(t *testing.T) {
+	client := &IndexerClient{pending: make(map[CollectionID]int)}
+	client.settled = sync.NewCond(&client.mutex)
+
+	// Nothing pending.
+	client.wait("c1")
+
+	client.add("c1")
+	client.add("c2")
+	waited := make(chan struct{})
+	go func() {
+		client.wait("c1")
+		close(waited)
+	}()
+
+	// Other collections come and go while waiting.
+	client.add("c2")
+	client.settle("c2")
+	client.add("c1")
+	client.settle("c1")
+	select {
+	case <-waited:
+		t.Fatal("returned with a document of c1 pending")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Documents of c2 are still pending.
+	client.settle("c1")
+	<-waited
+	assert.Equal(t, 1, client.pending["c2"])
+}
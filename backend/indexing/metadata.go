@@ -0,0 +1,107 @@
+package indexing
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"seekourney/utils"
+	"strings"
+)
+
+// _MINLANGUAGEHITS_ is the number of stop words a text needs
+// before its language is guessed.
+const _MINLANGUAGEHITS_ utils.Frequency = 3
+
+// stopWords are the most common words of the languages DetectLanguage knows,
+// by ISO 639-1 code. Words shared between languages count for all of them.
+var stopWords = map[string][]utils.Word{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "with",
+		"for"},
+	"sv": {"och", "att", "det", "som", "en", "är", "på", "för", "med",
+		"inte"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "ein", "zu"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "pour", "dans",
+		"pas"},
+	"es": {"el", "los", "las", "y", "que", "es", "por", "una", "para",
+		"con"},
+}
+
+// DetectLanguage guesses the language of a text from the frequency of its
+// words, by which language's stop words are most common in it.
+// Returns an ISO 639-1 code, or "" if the text is too short to tell.
+func DetectLanguage(words utils.FrequencyMap) string {
+	lowered := make(utils.FrequencyMap, len(words))
+	for word, frequency := range words {
+		lowered[utils.Word(strings.ToLower(string(word)))] += frequency
+	}
+
+	best := ""
+	var bestHits utils.Frequency
+
+	for language, common := range stopWords {
+		var hits utils.Frequency
+		for _, word := range common {
+			hits += lowered[word]
+		}
+
+		// Ties go to the first code in alphabetical order,
+		// so the result does not depend on the order of the map.
+		if hits > bestHits || (hits == bestHits && language < best) {
+			best = language
+			bestHits = hits
+		}
+	}
+
+	if bestHits < _MINLANGUAGEHITS_ {
+		return ""
+	}
+	return best
+}
+
+// DetectMIMEType guesses the media type of a document from the extension
+// of its path, or from its content if the extension is unknown.
+func DetectMIMEType(docPath utils.Path, content string) string {
+	byExtension := mime.TypeByExtension(path.Ext(string(docPath)))
+	if byExtension != "" {
+		return byExtension
+	}
+
+	return http.DetectContentType([]byte(content))
+}
+
+// fileMetadata returns the size and modification time of a local file,
+// or empty metadata if it cannot be read.
+func fileMetadata(filePath utils.Path) utils.Metadata {
+	info, err := os.Stat(string(filePath))
+	if err != nil || info.IsDir() {
+		return utils.Metadata{}
+	}
+
+	return utils.Metadata{
+		Size:     info.Size(),
+		Modified: info.ModTime(),
+	}
+}
+
+// completeMetadata fills the metadata of doc the indexer did not set:
+// the title is the name of the file, and the size the length of the text.
+// The MIME type and language are detected, see DetectMIMEType and
+// DetectLanguage.
+func completeMetadata(doc *UnnormalizedDocument) {
+	if doc.Title == "" {
+		doc.Title = path.Base(string(doc.Path))
+	}
+
+	if doc.Size == 0 {
+		doc.Size = int64(len(doc.RawText))
+	}
+
+	if doc.MIMEType == "" {
+		doc.MIMEType = DetectMIMEType(doc.Path, doc.RawText)
+	}
+
+	if doc.Language == "" {
+		doc.Language = DetectLanguage(doc.Words)
+	}
+}
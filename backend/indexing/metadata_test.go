@@ -0,0 +1,62 @@
+package indexing
+
+import (
+	"os"
+	"path/filepath"
+	"seekourney/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	texts := map[string]string{
+		"The cat is in the garden with the dog":          "en",
+		"Katten är i trädgården och hunden är inte det":  "sv",
+		"Der Hund und die Katze sind nicht im Garten":    "de",
+		"Le chat et le chien ne sont pas dans la maison": "fr",
+		"El perro y el gato están en la casa por ahora":  "es",
+		"Too short": "",
+	}
+
+	for text, language := range texts {
+		assert.Equal(t, language, DetectLanguage(IndexString(text)), text)
+	}
+}
+
+func TestDetectMIMEType(t *testing.T) {
+	assert.Equal(t, "text/html; charset=utf-8",
+		DetectMIMEType("/page.html", "text"))
+	assert.Equal(t, "text/plain; charset=utf-8",
+		DetectMIMEType("/README", "plain text"))
+}
+
+func TestCompleteMetadata(t *testing.T) {
+	dir := t.TempDir()
+	path := utils.Path(filepath.Join(dir, "notes.txt"))
+	assert.NoError(t, os.WriteFile(string(path), []byte("hello"), 0644))
+
+	modified := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(string(path), modified, modified))
+
+	doc := DocFromText(path, utils.SOURCE_LOCAL, "1", "the text in the file")
+	doc.Metadata = fileMetadata(path)
+	doc.Title = "My notes"
+	completeMetadata(&doc)
+
+	assert.Equal(t, "My notes", doc.Title)
+	assert.Equal(t, int64(5), doc.Size)
+	assert.True(t, modified.Equal(doc.Modified))
+	assert.Equal(t, "text/plain; charset=utf-8", doc.MIMEType)
+	assert.Equal(t, "en", doc.Language)
+
+	// Without a file, the title is the name and the size that of the text.
+	doc = DocFromText("/missing/page", utils.SOURCE_WEB, "1", "text")
+	doc.Metadata = fileMetadata(doc.Path)
+	completeMetadata(&doc)
+
+	assert.Equal(t, "page", doc.Title)
+	assert.Equal(t, int64(4), doc.Size)
+	assert.True(t, doc.Modified.IsZero())
+}
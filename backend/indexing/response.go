@@ -2,6 +2,7 @@ package indexing
 
 import (
 	"encoding/json"
+	"seekourney/utils"
 )
 
 // See indexing_API for documentation.
@@ -10,6 +11,23 @@ import (
 type ResponseData struct {
 	Message   string                 `json:"message"`
 	Documents []UnnormalizedDocument `json:"documents"`
+
+	// Outcomes is only set in responses from Core to pushed documents,
+	// with one outcome per document in the order they were pushed.
+	Outcomes []DocumentOutcome `json:"outcomes,omitempty"`
+
+	// Counts is the number of outcomes with each status,
+	// set together with Outcomes.
+	Counts map[string]int `json:"counts,omitempty"`
+}
+
+// DocumentOutcome tells what Core did with a pushed document.
+type DocumentOutcome struct {
+	Path   utils.Path `json:"path"`
+	Status string     `json:"status"`
+
+	// Message explains why the document failed.
+	Message string `json:"message,omitempty"`
 }
 
 // IndexerResponse is the standard format for responses from indexer.
@@ -18,6 +36,34 @@ type IndexerResponse struct {
 	Data   ResponseData `json:"data"`
 }
 
+// IndexingProgress is sent by an indexer to Core while it indexes
+// a collection, after every batch of documents it pushed.
+type IndexingProgress struct {
+	Job        JobID        `json:"job"`
+	Collection CollectionID `json:"collection"`
+
+	// Pushed counts the documents Core stored so far, and Failed those
+	// that could not be indexed or stored.
+	Pushed int `json:"pushed"`
+	Failed int `json:"failed"`
+}
+
+// IndexingDone is sent by an indexer to Core when it has indexed
+// a collection and pushed all its documents.
+type IndexingDone struct {
+	Collection CollectionID `json:"collection"`
+
+	// Complete is false if some documents could not be indexed or pushed.
+	// Core only removes the documents not seen after a complete indexing.
+	Complete bool `json:"complete"`
+
+	// Job is the job of the indexing, see Settings,
+	// and Pushed and Failed its final counts, see IndexingProgress.
+	Job    JobID `json:"job"`
+	Pushed int   `json:"pushed"`
+	Failed int   `json:"failed"`
+}
+
 const (
 	// Values used in status field in response.
 	STATUSSUCCESSFUL string = "success"
@@ -25,6 +71,11 @@ const (
 	// Values used in message field in response.
 	MESSAGEPONG    string = "pong"
 	MESSAGEEXITING string = "exiting"
+	// Values used in status field of document outcomes.
+	OUTCOMEINSERTED  string = "inserted"
+	OUTCOMEUPDATED   string = "updated"
+	OUTCOMEUNCHANGED string = "unchanged"
+	OUTCOMEFAILED    string = "failed"
 )
 
 // ResponseSuccess creates an indexer response denoting success in JSON format.
@@ -100,3 +151,24 @@ func ResponseDocs(docs []UnnormalizedDocument) []byte {
 
 	return jsonData
 }
+
+// ResponseOutcomes creates a Core response to a pushdocs request,
+// with the outcome of every pushed document and how many there are of each
+// status, in JSON format.
+func ResponseOutcomes(outcomes []DocumentOutcome) []byte {
+	counts := make(map[string]int)
+	for _, outcome := range outcomes {
+		counts[outcome.Status]++
+	}
+
+	jsonData, err := json.Marshal(IndexerResponse{
+		Status: STATUSSUCCESSFUL,
+		Data:   ResponseData{Outcomes: outcomes, Counts: counts},
+	})
+
+	if err != nil {
+		panic("indexing ResponseOutcomes could not marshal response")
+	}
+
+	return jsonData
+}
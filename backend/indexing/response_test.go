@@ -90,3 +90,25 @@ func TestResponseDocs(t *testing.T) {
 	)
 	assert.Equal(t, goData.Data.Documents[1].Collection, udocs[1].Collection)
 }
+
+func TestResponseOutcomes(t *testing.T) {
+	outcomes := []DocumentOutcome{
+		{Path: "test/path/1", Status: OUTCOMEINSERTED},
+		{Path: "test/path/2", Status: OUTCOMEFAILED, Message: "no collection"},
+		{Path: "test/path/3", Status: OUTCOMEUNCHANGED},
+		{Path: "test/path/4", Status: OUTCOMEUNCHANGED},
+	}
+
+	jsonData := ResponseOutcomes(outcomes)
+	goData := IndexerResponse{}
+	err := json.Unmarshal(jsonData, &goData)
+
+	assert.NoError(t, err)
+	assert.Equal(t, goData.Status, STATUSSUCCESSFUL)
+	assert.Equal(t, outcomes, goData.Data.Outcomes)
+	assert.Equal(t, map[string]int{
+		OUTCOMEINSERTED:  1,
+		OUTCOMEFAILED:    1,
+		OUTCOMEUNCHANGED: 2,
+	}, goData.Data.Counts)
+}
@@ -10,6 +10,10 @@ import (
 // Used to locate a collection in the database.
 type CollectionID utils.ObjectId
 
+// JobID identifies an indexing of a collection dispatched by Core.
+// The indexer reports its progress against it, see IndexingProgress.
+type JobID utils.ObjectId
+
 // TODO: Find a better name for this
 
 // Settings is a struct that contains the settings for the indexer client.
@@ -24,12 +28,15 @@ type CollectionID utils.ObjectId
 //  4. Recursive: whether to index recursively
 //
 //  5. Parallel: whether to index in parallel
+//
+//  6. JobID: the job Core tracks the indexing as, may be empty
 type Settings struct {
 	Path         utils.Path   `json:"path"`
 	Type         SourceType   `json:"type"`
 	CollectionID CollectionID `json:"collection_id"`
 	Recursive    bool         `json:"recursive"`
 	Parrallel    bool         `json:"parrallel"`
+	JobID        JobID        `json:"job_id"`
 }
 
 // SettingsFromRequest converts the request into a Settings struct.
@@ -8,5 +8,7 @@ const (
 
 // Database tables.
 const (
-	TABLEDOCUMENT string = "document"
+	TABLEDOCUMENT         string = "document"
+	TABLEDOCUMENTTEXT     string = "document_text"
+	TABLEDOCUMENTREVISION string = "document_revision"
 )
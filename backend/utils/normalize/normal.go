@@ -18,6 +18,11 @@ const (
 	STEMMING
 )
 
+// IsValid reports whether norm is one of the known normalizers.
+func (norm Normalizer) IsValid() bool {
+	return norm == TO_LOWER || norm == STEMMING
+}
+
 // NormalizeWord is a function that normalizes a word.
 // To normalize a word means to convert it to a standard format to make the
 // indexing more efficient.
@@ -1,6 +1,10 @@
 package utils
 
-import "strconv"
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
 
 // Query is a string containing plain words separated by spaces.
 // E.g. "1.24.2 golang documentation".
@@ -30,6 +34,29 @@ const (
 	SOURCE_WEB
 )
 
+// String returns the name a source is stored under,
+// "file" for SOURCE_LOCAL and "web" for SOURCE_WEB.
+func (source Source) String() string {
+	switch source {
+	case SOURCE_LOCAL:
+		return "file"
+	case SOURCE_WEB:
+		return "web"
+	}
+	return "unknown"
+}
+
+// ParseSource returns the source with the given name, see Source.String.
+func ParseSource(name string) (Source, error) {
+	switch name {
+	case "file":
+		return SOURCE_LOCAL, nil
+	case "web":
+		return SOURCE_WEB, nil
+	}
+	return SOURCE_LOCAL, fmt.Errorf("unknown source %q", name)
+}
+
 // TODO: Should probably use utils.Source instead of SourceType or rename it
 
 // SourceType is an enumeration of the different source types.
@@ -65,12 +92,33 @@ type ParsedQuery struct {
 	Quotes        []string
 }
 
+// Metadata describes a document, besides its content.
+// Fields an indexer does not know are left as zero values.
+type Metadata struct {
+	// Title is a human readable name, such as the title of a web page
+	// or the name of a file.
+	Title string
+
+	// Size is the size of the source in bytes.
+	Size int64
+
+	// Modified is when the source was last modified.
+	Modified time.Time
+
+	// MIMEType is the media type of the source, e.g. "text/html".
+	MIMEType string
+
+	// Language is an ISO 639-1 code, e.g. "en".
+	Language string
+}
+
 // SearchResult is information about a single document
 // with respect to a current search query.
 type SearchResult struct {
 	Path   Path
 	Score  Score
 	Source Source
+	Metadata
 }
 
 // SearchResponse is the format an HTTP search response